@@ -2,9 +2,20 @@ package app
 
 import (
 	"spark/hal"
+	_ "spark/sparkos/apps/builtin"
 	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+	"spark/sparkos/services/appmgr"
+	"spark/sparkos/services/audio"
+	"spark/sparkos/services/compositor"
+	"spark/sparkos/services/consolemux"
+	"spark/sparkos/services/gpio"
 	"spark/sparkos/services/logger"
+	"spark/sparkos/services/names"
+	"spark/sparkos/services/notify"
+	"spark/sparkos/services/serial"
 	"spark/sparkos/services/shell"
+	"spark/sparkos/services/supervisor"
 	"spark/sparkos/services/term"
 	"spark/sparkos/services/termkbd"
 	timesvc "spark/sparkos/services/time"
@@ -22,6 +33,22 @@ type system struct {
 type Config struct {
 	TermDemo bool
 	Shell    bool
+	// Full boots the whole service graph behind the shell: VFS, audio, gpio,
+	// serial, appmgr and consolemux, with apps launched from the shell.
+	// It implies Shell.
+	Full bool
+	// Launcher makes the launcher app the foreground after login and the
+	// place apps return to when they exit. It needs Full.
+	Launcher bool
+	// TmpBytes is the RAM budget of /tmp (0 = vfs.DefaultTmpBytes).
+	TmpBytes uint64
+
+	// Trace starts the kernel IPC trace with a ring of Trace events (0 = off).
+	Trace int
+	// Input, if set, replaces the keyboard as the shell's input source: it
+	// is called with the console input endpoint, the shell's or, with Full,
+	// consolemux's (see trace.NewReplay).
+	Input func(shell kernel.Capability) kernel.Task
 }
 
 // New initializes and starts the OS with default config.
@@ -47,8 +74,15 @@ func RunWithConfig(h hal.HAL, cfg Config) {
 }
 
 func newSystem(h hal.HAL, cfg Config) *system {
+	if cfg.Full {
+		cfg.Shell = true
+	}
+
 	k := kernel.New()
 	installPanicHandler(h)
+	if cfg.Trace > 0 {
+		k.StartTrace(cfg.Trace)
+	}
 
 	if cfg.Shell {
 		bootDiagStart(h)
@@ -59,40 +93,175 @@ func newSystem(h hal.HAL, cfg Config) *system {
 	timeEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
 	termEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
 	shellEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	// vfsEP is the public VFS endpoint in the name service; requests on it
+	// run as nobody. vfsSysEP has the system identity and goes only to the
+	// services named below.
 	vfsEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	vfsSysEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	// vfsAuthEP issues VFS credentials; only the shell, which logs users
+	// in, holds it.
+	vfsAuthEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
 	audioEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
 	gpioEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
 	serialEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	svcEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	notifyEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	// consolemux gets focus changes on the urgent lane, ahead of typed input.
+	muxEP := k.NewEndpointWith(kernel.RightSend|kernel.RightRecv, kernel.EndpointOptions{Urgent: true})
 
-	k.AddTask(logger.New(h.Logger(), logEP.Restrict(kernel.RightRecv)))
-	k.AddTask(timesvc.New(timeEP))
-	k.AddTask(vfs.New(h.Flash(), vfsEP.Restrict(kernel.RightRecv)))
-	_ = audioEP
-	_ = gpioEP
-	_ = serialEP
+	// The name table outlives restarts of the names task: Spec.New hands out
+	// the same *names.Service every time.
+	reg := names.New()
+	reg.Register("logger", logEP.Restrict(kernel.RightSend))
+	reg.Register("time", timeEP.Restrict(kernel.RightSend))
+	reg.Register("vfs", vfsEP.Restrict(kernel.RightSend))
+	reg.Register("supervisor", svcEP.Restrict(kernel.RightSend))
+
+	specs := []supervisor.Spec{
+		{Name: "names", Policy: proto.SvcPermanent, New: func() kernel.Task {
+			return reg
+		}},
+		{Name: "logger", Policy: proto.SvcPermanent, New: func() kernel.Task {
+			return logger.New(h.Logger(), logEP.Restrict(kernel.RightRecv))
+		}},
+		{Name: "time", Policy: proto.SvcPermanent, New: func() kernel.Task {
+			return timesvc.New(timeEP)
+		}},
+		{Name: "vfs", Policy: proto.SvcPermanent, After: []string{"logger"}, New: func() kernel.Task {
+			return vfs.NewWith(h.Flash(), vfsEP.Restrict(kernel.RightRecv), vfs.Options{
+				SystemCap: vfsSysEP.Restrict(kernel.RightRecv),
+				AuthCap:   vfsAuthEP.Restrict(kernel.RightRecv),
+				TmpBytes:  cfg.TmpBytes,
+			})
+		}},
+	}
+	// With Full the compositor owns the display: term and the apps draw on
+	// its screen layer below the status bar, full-screen apps on all of it.
+	// Like reg, it survives restarts of its task.
+	disp := h.Display()
+	var fullDisp hal.Display
+	var comp *compositor.Service
+	termSpec := supervisor.Spec{Name: "term", Policy: proto.SvcPermanent, New: func() kernel.Task {
+		return term.New(disp, termEP.Restrict(kernel.RightRecv))
+	}}
+	if cfg.Full {
+		comp = compositor.New(h.Display(), compositorOptions)
+		disp = comp.Inset(notify.BarHeight)
+		fullDisp = comp.Screen()
+		termSpec.After = []string{"compositor"}
+		specs = append(specs, supervisor.Spec{Name: "compositor", Policy: proto.SvcPermanent, New: func() kernel.Task {
+			return comp
+		}})
+	}
 
 	if cfg.Shell {
-		bootScreen(h, "init: term")
-		k.AddTask(term.New(h.Display(), termEP.Restrict(kernel.RightRecv)))
-		k.AddTask(bootmsg.New(termEP.Restrict(kernel.RightSend)))
-		k.AddTask(kbdprobe.New(termEP.Restrict(kernel.RightSend)))
-		bootScreen(h, "init: termkbd")
-		k.AddTask(termkbd.NewInput(h.Input(), shellEP.Restrict(kernel.RightSend)))
-		k.AddTask(shell.New(
-			shellEP.Restrict(kernel.RightRecv),
-			termEP.Restrict(kernel.RightSend),
-			logEP.Restrict(kernel.RightSend),
-			kernel.Capability{}, // no VFS
-			timeEP.Restrict(kernel.RightSend),
-			kernel.Capability{}, // no consolemux
-		))
+		reg.Register("term", termEP.Restrict(kernel.RightSend))
+		reg.Register("shell", shellEP.Restrict(kernel.RightSend))
+		specs = append(specs,
+			termSpec,
+			supervisor.Spec{Name: "bootmsg", Policy: proto.SvcTemporary, After: []string{"term"}, New: func() kernel.Task {
+				return bootmsg.New(termEP.Restrict(kernel.RightSend))
+			}},
+			supervisor.Spec{Name: "kbdprobe", Policy: proto.SvcTemporary, After: []string{"term"}, New: func() kernel.Task {
+				return kbdprobe.New(termEP.Restrict(kernel.RightSend))
+			}},
+		)
+
+		// Without consolemux the keyboard talks to the shell directly and the
+		// shell runs without VFS (no login), apps and status bar.
+		consoleEP := shellEP
+		shellOpts := shell.Options{
+			Log:  logEP.Restrict(kernel.RightSend),
+			Time: timeEP.Restrict(kernel.RightSend),
+			Svc:  svcEP.Restrict(kernel.RightSend),
+		}
+		home := proto.AppNone
+		if cfg.Full {
+			if cfg.Launcher {
+				home = proto.AppLauncher
+			}
+			consoleEP = muxEP
+			shellOpts.VFS = vfsSysEP.Restrict(kernel.RightSend)
+			shellOpts.VFSAuth = vfsAuthEP.Restrict(kernel.RightSend)
+			shellOpts.Mux = muxEP.Restrict(kernel.RightSend)
+			shellOpts.Notify = notifyEP.Restrict(kernel.RightSend)
+			shellOpts.Home = home
+
+			reg.Register("audio", audioEP.Restrict(kernel.RightSend))
+			reg.Register("gpio", gpioEP.Restrict(kernel.RightSend))
+			reg.Register("serial", serialEP.Restrict(kernel.RightSend))
+			reg.Register("consolemux", muxEP.Restrict(kernel.RightSend))
+			reg.Register("notify", notifyEP.Restrict(kernel.RightSend))
+			muxNames := namesClient(k, reg, names.Access{Resolve: []string{"shell", "app.*"}})
+			appNames := namesClient(k, reg, names.Access{
+				Resolve: []string{"vfs", "audio", "time", "gpio", "serial", "notify"},
+				Publish: []string{"app.*"},
+			})
+			notifyNames := namesClient(k, reg, names.Access{Resolve: []string{"consolemux", "audio"}})
+			notifyComp := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+			comp.Serve(notifyComp.Restrict(kernel.RightRecv))
+
+			specs = append(specs,
+				supervisor.Spec{Name: "audio", Policy: proto.SvcPermanent, After: []string{"vfs"}, New: func() kernel.Task {
+					return audio.New(audioEP.Restrict(kernel.RightRecv), vfsSysEP.Restrict(kernel.RightSend), pwmAudio(h))
+				}},
+				supervisor.Spec{Name: "gpio", Policy: proto.SvcPermanent, New: func() kernel.Task {
+					return gpio.New(h.GPIO(), gpioEP.Restrict(kernel.RightRecv))
+				}},
+				supervisor.Spec{Name: "serial", Policy: proto.SvcPermanent, New: func() kernel.Task {
+					return serial.New(h.Serial(), serialEP.Restrict(kernel.RightRecv))
+				}},
+				supervisor.Spec{Name: "appmgr", Policy: proto.SvcPermanent, After: []string{"names", "vfs", "audio", "gpio", "serial", "time", "compositor"}, New: func() kernel.Task {
+					opts := appmgrOptions
+					opts.FullScreen = fullDisp
+					return appmgr.NewWith(disp, appNames, opts)
+				}},
+				supervisor.Spec{Name: "consolemux", Policy: proto.SvcPermanent, After: []string{"names"}, New: func() kernel.Task {
+					return consolemux.New(muxEP.Restrict(kernel.RightRecv), muxEP.Restrict(kernel.RightSend), muxNames, home)
+				}},
+				supervisor.Spec{Name: "notify", Policy: proto.SvcPermanent, After: []string{"compositor", "consolemux", "audio"}, New: func() kernel.Task {
+					return notify.New(notifyEP.Restrict(kernel.RightRecv), notifyComp.Restrict(kernel.RightSend), notifyNames, screenWidth(h))
+				}},
+			)
+		}
+
+		if cfg.Input != nil {
+			specs = append(specs, supervisor.Spec{Name: "input", Policy: proto.SvcTemporary, After: []string{"shell"}, New: func() kernel.Task {
+				return cfg.Input(consoleEP.Restrict(kernel.RightSend))
+			}})
+		} else {
+			specs = append(specs, supervisor.Spec{Name: "termkbd", Policy: proto.SvcPermanent, After: []string{"term"}, New: func() kernel.Task {
+				// Key events are for consolemux and the apps behind it.
+				return termkbd.NewInputWith(h.Input(), consoleEP.Restrict(kernel.RightSend), termkbd.Options{Events: cfg.Full})
+			}})
+		}
+		specs = append(specs, supervisor.Spec{Name: "shell", Policy: proto.SvcPermanent, After: []string{"logger", "time", "term"}, New: func() kernel.Task {
+			return shell.NewWith(shellEP.Restrict(kernel.RightRecv), termEP.Restrict(kernel.RightSend), shellOpts)
+		}})
 	} else if cfg.TermDemo {
-		k.AddTask(term.New(h.Display(), termEP.Restrict(kernel.RightRecv)))
-		k.AddTask(termkbd.New(h.Input(), termEP.Restrict(kernel.RightSend)))
-		k.AddTask(termdemo.New(timeEP.Restrict(kernel.RightSend), termEP.Restrict(kernel.RightSend)))
+		reg.Register("term", termEP.Restrict(kernel.RightSend))
+		specs = append(specs,
+			termSpec,
+			supervisor.Spec{Name: "termkbd", Policy: proto.SvcPermanent, After: []string{"term"}, New: func() kernel.Task {
+				return termkbd.New(h.Input(), termEP.Restrict(kernel.RightSend))
+			}},
+			supervisor.Spec{Name: "termdemo", Policy: proto.SvcTemporary, After: []string{"term", "time"}, New: func() kernel.Task {
+				return termdemo.New(timeEP.Restrict(kernel.RightSend), termEP.Restrict(kernel.RightSend))
+			}},
+		)
 	} else {
-		k.AddTask(ui.New(h.Display(), h.Input()))
+		specs = append(specs, supervisor.Spec{Name: "ui", Policy: proto.SvcPermanent, New: func() kernel.Task {
+			return ui.New(h.Display(), h.Input())
+		}})
+	}
+
+	// The supervisor is the only core task: services it starts are restarted
+	// per policy, but a panic in the supervisor itself stops the system with
+	// the panic screen.
+	if cfg.Shell {
+		bootScreen(h, "init: services")
 	}
+	k.AddTaskWith(supervisor.New(specs, svcEP.Restrict(kernel.RightRecv), logEP.Restrict(kernel.RightSend)), kernel.TaskOptions{Core: true})
 
 	if ht := h.Time(); ht != nil {
 		if ch := ht.Ticks(); ch != nil {
@@ -106,3 +275,28 @@ func newSystem(h hal.HAL, cfg Config) *system {
 
 	return &system{k: k}
 }
+
+// namesClient gives a task its own endpoint to the name service, limited to access.
+func namesClient(k *kernel.Kernel, reg *names.Service, access names.Access) kernel.Capability {
+	ep := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	reg.Serve(ep.Restrict(kernel.RightRecv), access)
+	return ep.Restrict(kernel.RightSend)
+}
+
+// pwmAudio returns the PWM output of h, or nil if it has none.
+func pwmAudio(h hal.HAL) hal.PWMAudio {
+	if a := h.Audio(); a != nil {
+		return a.PWM()
+	}
+	return nil
+}
+
+// screenWidth returns the display width of h in pixels.
+func screenWidth(h hal.HAL) int {
+	if d := h.Display(); d != nil {
+		if fb := d.Framebuffer(); fb != nil {
+			return fb.Width()
+		}
+	}
+	return 0
+}
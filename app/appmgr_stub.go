@@ -0,0 +1,8 @@
+//go:build !tinygo
+
+package app
+
+import "spark/sparkos/services/appmgr"
+
+// On the host memory is plentiful: keep a few apps and their screens around.
+var appmgrOptions = appmgr.Options{MaxBackground: 4, Snapshots: true}
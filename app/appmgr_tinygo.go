@@ -0,0 +1,9 @@
+//go:build tinygo
+
+package app
+
+import "spark/sparkos/services/appmgr"
+
+// A framebuffer snapshot would take a large share of the RP2350 RAM: keep one
+// app in the background and drop it early when the heap runs low.
+var appmgrOptions = appmgr.Options{MaxBackground: 1, MinFreeHeap: 32 << 10}
@@ -0,0 +1,9 @@
+//go:build !tinygo
+
+package app
+
+import "spark/sparkos/services/compositor"
+
+// On the host the screen layer gets its own buffer, so overlays can be hidden
+// without the app redrawing.
+var compositorOptions = compositor.Options{Backing: true}
@@ -0,0 +1,9 @@
+//go:build tinygo
+
+package app
+
+import "spark/sparkos/services/compositor"
+
+// A second 320x320 framebuffer does not fit next to the apps: the screen layer
+// is drawn straight into the framebuffer.
+var compositorOptions = compositor.Options{}
@@ -0,0 +1,244 @@
+//go:build !tinygo
+
+// Command sparktrace prints SparkOS IPC traces (see the shell "trace dump"
+// command) and replays their keyboard input into a headless run booted with
+// the same profile.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"spark/app"
+	"spark/hal"
+	"spark/sparkos/fs/littlefs"
+	"spark/sparkos/kernel"
+	"spark/sparkos/trace"
+)
+
+const flashEraseBytes = 4096
+
+func main() {
+	var (
+		inPath    = flag.String("in", "", "Trace file (host path, or a path inside -flash).")
+		flashPath = flag.String("flash", "", "Read -in from this flash image instead of the host filesystem; a replay boots on a copy of it.")
+		task      = flag.Int("task", 0, "Only print events of this task (0 = all).")
+		replay    = flag.Bool("replay", false, "Re-inject the recorded keyboard input into a headless system booted like the traced one and print its trace.")
+		outPath   = flag.String("out", "", "Write the replay trace to this file instead of printing it.")
+		hz        = flag.Int("hz", 1000, "Tick rate of the replay run.")
+		grace     = flag.Uint64("grace", 500, "Ticks to keep running after the last replayed input.")
+		events    = flag.Int("events", 1024, "Trace ring size of the replay run.")
+	)
+	flag.Parse()
+
+	if *inPath == "" {
+		fatalf("usage: sparktrace -in trace.bin [-flash Flash.bin] [-task N]\n       sparktrace -replay -in trace.bin [-flash Flash.bin] [-out replay.bin] [-hz 1000] [-grace 500]")
+	}
+
+	data, err := readInput(*inPath, *flashPath)
+	if err != nil {
+		fatalf("read: %v", err)
+	}
+	hdr, evs, err := trace.Decode(bytes.NewReader(data))
+	if err != nil {
+		fatalf("decode: %v", err)
+	}
+
+	if *replay {
+		evs, err = runReplay(hdr, trace.Inputs(evs, hdr.Console), *flashPath, *hz, *grace, *events)
+		if err != nil {
+			fatalf("replay: %v", err)
+		}
+		if *outPath != "" {
+			if err := writeTrace(*outPath, hdr, evs); err != nil {
+				fatalf("write: %v", err)
+			}
+			return
+		}
+	}
+
+	for _, ev := range evs {
+		if *task != 0 && int(ev.Task) != *task {
+			continue
+		}
+		fmt.Println(trace.Format(ev))
+	}
+}
+
+func fatalf(format string, args ...any) {
+	_, _ = fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(2)
+}
+
+// runReplay boots the profile of hdr headless with inputs as its keyboard and
+// returns the trace of the run. The system runs on a scratch copy of the
+// flash image at flashPath, or on an empty flash if there is none, so that
+// a login replays against the same users.
+func runReplay(hdr trace.Header, inputs []kernel.TraceEvent, flashPath string, hz int, grace uint64, events int) ([]kernel.TraceEvent, error) {
+	if len(inputs) == 0 {
+		return nil, errors.New("trace has no keyboard input")
+	}
+	scratch, err := scratchFlash(flashPath)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(scratch)
+	if err := os.Setenv("SPARK_FLASH_PATH", scratch); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	result := make(chan []kernel.TraceEvent, 1)
+	done := func(kctx *kernel.Context) {
+		end := kctx.NowTick() + grace
+		for now := kctx.NowTick(); now < end; {
+			now = kctx.WaitTick(now)
+		}
+		result <- kctx.TraceEvents()
+		cancel()
+	}
+
+	cfg := app.Config{
+		Shell:    true,
+		Full:     hdr.Profile&trace.ProfileFull != 0,
+		Launcher: hdr.Profile&trace.ProfileLauncher != 0,
+		Trace:    events,
+		Input: func(console kernel.Capability) kernel.Task {
+			return trace.NewReplay(inputs, console, done)
+		},
+	}
+	err = hal.RunHeadless(ctx, func(h hal.HAL) func() error {
+		return app.NewWithConfig(h, cfg)
+	}, hal.HeadlessConfig{Enabled: true, Hz: hz})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		return nil, err
+	}
+	select {
+	case evs := <-result:
+		return evs, nil
+	default:
+		return nil, errors.New("replay did not finish")
+	}
+}
+
+// scratchFlash returns a temporary file holding a copy of the flash image at
+// path, or an empty one if path is "".
+func scratchFlash(path string) (string, error) {
+	dst, err := os.CreateTemp("", "sparktrace-*.bin")
+	if err != nil {
+		return "", err
+	}
+	if path != "" {
+		src, err := os.Open(path)
+		if err != nil {
+			_ = dst.Close()
+			_ = os.Remove(dst.Name())
+			return "", err
+		}
+		_, err = io.Copy(dst, src)
+		_ = src.Close()
+		if err != nil {
+			_ = dst.Close()
+			_ = os.Remove(dst.Name())
+			return "", err
+		}
+	}
+	if err := dst.Close(); err != nil {
+		_ = os.Remove(dst.Name())
+		return "", err
+	}
+	return dst.Name(), nil
+}
+
+// writeTrace writes the events of a replay. Its header is that of the
+// replayed trace, since the replay booted the same profile.
+func writeTrace(path string, hdr trace.Header, evs []kernel.TraceEvent) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := trace.Encode(f, hdr, evs); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readInput(path, flashPath string) ([]byte, error) {
+	if flashPath == "" {
+		return os.ReadFile(path)
+	}
+
+	f, err := os.Open(flashPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if st.Size() == 0 || st.Size()%flashEraseBytes != 0 || st.Size() > int64(^uint32(0)) {
+		return nil, fmt.Errorf("flash image %q: invalid size %d", flashPath, st.Size())
+	}
+
+	fs, err := littlefs.New(&imageFlash{f: f, size: uint32(st.Size())}, littlefs.Options{})
+	if err != nil {
+		return nil, err
+	}
+	defer fs.Close()
+	if err := fs.Mount(); err != nil {
+		return nil, err
+	}
+
+	var out []byte
+	buf := make([]byte, 4096)
+	for {
+		n, eof, err := fs.ReadAt(path, buf, uint32(len(out)))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, buf[:n]...)
+		if eof || n == 0 {
+			return out, nil
+		}
+	}
+}
+
+// imageFlash is a read-only littlefs.Flash backed by a flash image file.
+type imageFlash struct {
+	f    *os.File
+	size uint32
+}
+
+func (f *imageFlash) SizeBytes() uint32       { return f.size }
+func (f *imageFlash) EraseBlockBytes() uint32 { return flashEraseBytes }
+
+func (f *imageFlash) ReadAt(p []byte, off uint32) (int, error) {
+	if off >= f.size {
+		return 0, fmt.Errorf("flash read at %d: %w", off, os.ErrInvalid)
+	}
+	if maxN := int(f.size - off); len(p) > maxN {
+		p = p[:maxN]
+	}
+	n, err := f.f.ReadAt(p, int64(off))
+	if errors.Is(err, io.EOF) && n == len(p) {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *imageFlash) WriteAt(_ []byte, off uint32) (int, error) {
+	return 0, fmt.Errorf("flash write at %d: read-only image", off)
+}
+
+func (f *imageFlash) Erase(off, _ uint32) error {
+	return fmt.Errorf("flash erase at %d: read-only image", off)
+}
@@ -0,0 +1,102 @@
+; Greets, draws a box that follows the arrow keys, exits on q.
+;
+;   go run ./cmd/spxasm -in cmd/spxasm/examples/hello.s -out rootfs/bin/hello.spx
+
+.service notify
+.mem 1024
+
+.equ X 0
+.equ Y 4
+.equ SIZE 16
+.equ BG 0x0000
+.equ FG 0x07e0
+
+.data
+	.word 40, 60          ; X, Y
+hello:	.ascii "Hello from spx! arrows move, q quits"
+.equ HELLO_LEN 36
+toast:	.ascii "hello.spx started"
+.equ TOAST_LEN 17
+
+.code
+main:
+	push toast
+	push TOAST_LEN
+	sys notify
+	drop
+loop:
+	call draw
+	sys getkey
+	dup
+	push 'q'
+	eq
+	jnz quit
+	call move
+	jmp loop
+quit:
+	push 0
+	sys exit
+
+; key -- : arrow keys arrive as ESC [ A..D; the final letter is enough here.
+move:
+	dup
+	push 'A'
+	eq
+	jz move_down
+	push Y
+	push -4
+	call addvar
+move_down:
+	dup
+	push 'B'
+	eq
+	jz move_right
+	push Y
+	push 4
+	call addvar
+move_right:
+	dup
+	push 'C'
+	eq
+	jz move_left
+	push X
+	push 4
+	call addvar
+move_left:
+	push 'D'
+	eq
+	jz move_done
+	push X
+	push -4
+	call addvar
+move_done:
+	ret
+
+; addr delta -- : mem[addr] += delta
+addvar:
+	over
+	load
+	add
+	swap
+	store
+	ret
+
+draw:
+	push BG
+	sys clear
+	push 4
+	push 4
+	push hello
+	push HELLO_LEN
+	push 0xffff
+	sys text
+	push X
+	load
+	push Y
+	load
+	push SIZE
+	push SIZE
+	push FG
+	sys rect
+	sys present
+	ret
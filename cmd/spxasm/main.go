@@ -0,0 +1,49 @@
+// Command spxasm assembles SparkOS user programs (see package spx).
+//
+//	spxasm -in hello.s -out hello.spx
+//
+// Copy the result to the device filesystem (e.g. rootfs/bin before
+// `make vfs`) and start it with `run /bin/hello.spx`.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"spark/sparkos/spx"
+)
+
+func main() {
+	var (
+		inPath  = flag.String("in", "", "Assembly source (.s).")
+		outPath = flag.String("out", "", "Executable to write (.spx).")
+	)
+	flag.Parse()
+
+	if *inPath == "" || *outPath == "" {
+		fatalf("usage: spxasm -in prog.s -out prog.spx")
+	}
+
+	src, err := os.ReadFile(*inPath)
+	if err != nil {
+		fatalf("read: %v", err)
+	}
+	p, err := spx.Assemble(string(src))
+	if err != nil {
+		fatalf("%s: %v", *inPath, err)
+	}
+	img, err := spx.Encode(p)
+	if err != nil {
+		fatalf("encode: %v", err)
+	}
+	if err := os.WriteFile(*outPath, img, 0o644); err != nil {
+		fatalf("write: %v", err)
+	}
+	fmt.Printf("%s: %d bytes (code %d, data %d, memory %d)\n", *outPath, len(img), len(p.Code), len(p.Data), p.MemSize)
+}
+
+func fatalf(format string, args ...any) {
+	_, _ = fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(2)
+}
@@ -54,13 +54,87 @@ const (
 	KeyF1
 	KeyF2
 	KeyF3
+	KeyF4
+	KeyF5
+	KeyF6
+	KeyF7
+	KeyF8
+	KeyF9
+	KeyF10
+	KeyF11
+	KeyF12
+	KeyPageUp
+	KeyPageDown
+	KeyInsert
+
+	// Modifier keys report their own press and release; their state is also
+	// carried by every event in KeyEvent.Mods.
+	KeyShift
+	KeyCtrl
+	KeyAlt
+)
+
+var keyNames = [...]string{
+	KeyUnknown:   "unknown",
+	KeyUp:        "up",
+	KeyDown:      "down",
+	KeyLeft:      "left",
+	KeyRight:     "right",
+	KeyEnter:     "enter",
+	KeyEscape:    "esc",
+	KeyBackspace: "backspace",
+	KeyTab:       "tab",
+	KeyDelete:    "delete",
+	KeyHome:      "home",
+	KeyEnd:       "end",
+	KeyF1:        "f1",
+	KeyF2:        "f2",
+	KeyF3:        "f3",
+	KeyF4:        "f4",
+	KeyF5:        "f5",
+	KeyF6:        "f6",
+	KeyF7:        "f7",
+	KeyF8:        "f8",
+	KeyF9:        "f9",
+	KeyF10:       "f10",
+	KeyF11:       "f11",
+	KeyF12:       "f12",
+	KeyPageUp:    "pgup",
+	KeyPageDown:  "pgdn",
+	KeyInsert:    "insert",
+	KeyShift:     "shift",
+	KeyCtrl:      "ctrl",
+	KeyAlt:       "alt",
+}
+
+func (c KeyCode) String() string {
+	if int(c) < len(keyNames) {
+		return keyNames[c]
+	}
+	return "unknown"
+}
+
+// Modifier is a set of held modifier keys.
+type Modifier uint8
+
+const (
+	ModShift Modifier = 1 << iota
+	ModCtrl
+	ModAlt
 )
 
 // KeyEvent is a keyboard event.
+//
+// A text key is reported by Rune with Code KeyUnknown; its release may carry
+// no Rune on backends that only see text input.
 type KeyEvent struct {
 	Code  KeyCode
 	Press bool
 	Rune  rune
+	// Mods are the modifiers held when the event happened.
+	Mods Modifier
+	// Scancode is the backend's own code of the key, 0 if unknown.
+	Scancode uint16
 }
 
 // Keyboard provides key events (best-effort on each platform).
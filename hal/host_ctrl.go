@@ -0,0 +1,15 @@
+//go:build !tinygo
+
+package hal
+
+// hostCtrlLetters are the letters the host keyboard reports with Ctrl held
+// as control runes. Ebiten drops control characters from its text input,
+// so each one the system reacts to must be listed here:
+// Ctrl+A/E/U/W edit the line, Ctrl+G is the bell, Ctrl+C interrupts and
+// Ctrl+N cycles consoles.
+const hostCtrlLetters = "aegunwc"
+
+// ctrlRune returns the control rune typed as Ctrl+letter.
+func ctrlRune(letter rune) rune {
+	return letter & 0x1f
+}
@@ -0,0 +1,28 @@
+package hal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHostCtrlRunes(t *testing.T) {
+	for _, tc := range []struct {
+		letter rune
+		want   rune
+	}{
+		{'a', 0x01},
+		{'c', 0x03},
+		{'e', 0x05},
+		{'g', 0x07},
+		{'n', 0x0e},
+		{'u', 0x15},
+		{'w', 0x17},
+	} {
+		if !strings.ContainsRune(hostCtrlLetters, tc.letter) {
+			t.Errorf("Ctrl+%c is not reported by the host keyboard", tc.letter)
+		}
+		if got := ctrlRune(tc.letter); got != tc.want {
+			t.Errorf("ctrlRune(%q) = %#x; want %#x", tc.letter, got, tc.want)
+		}
+	}
+}
@@ -16,10 +16,49 @@ func newHostKeyboard() *hostKeyboard {
 
 func (k *hostKeyboard) Events() <-chan KeyEvent { return k.ch }
 
+// hostKeys maps the non-text keys reported with press and release.
+var hostKeys = []struct {
+	key  ebiten.Key
+	code KeyCode
+}{
+	{ebiten.KeyArrowUp, KeyUp},
+	{ebiten.KeyArrowDown, KeyDown},
+	{ebiten.KeyArrowLeft, KeyLeft},
+	{ebiten.KeyArrowRight, KeyRight},
+	{ebiten.KeyEnter, KeyEnter},
+	{ebiten.KeyEscape, KeyEscape},
+	{ebiten.KeyBackspace, KeyBackspace},
+	{ebiten.KeyTab, KeyTab},
+	{ebiten.KeyDelete, KeyDelete},
+	{ebiten.KeyHome, KeyHome},
+	{ebiten.KeyEnd, KeyEnd},
+	{ebiten.KeyF1, KeyF1},
+	{ebiten.KeyF2, KeyF2},
+	{ebiten.KeyF3, KeyF3},
+	{ebiten.KeyF4, KeyF4},
+	{ebiten.KeyF5, KeyF5},
+	{ebiten.KeyF6, KeyF6},
+	{ebiten.KeyF7, KeyF7},
+	{ebiten.KeyF8, KeyF8},
+	{ebiten.KeyF9, KeyF9},
+	{ebiten.KeyF10, KeyF10},
+	{ebiten.KeyF11, KeyF11},
+	{ebiten.KeyF12, KeyF12},
+	{ebiten.KeyPageUp, KeyPageUp},
+	{ebiten.KeyPageDown, KeyPageDown},
+	{ebiten.KeyInsert, KeyInsert},
+	{ebiten.KeyShiftLeft, KeyShift},
+	{ebiten.KeyShiftRight, KeyShift},
+	{ebiten.KeyControlLeft, KeyCtrl},
+	{ebiten.KeyControlRight, KeyCtrl},
+	{ebiten.KeyAltLeft, KeyAlt},
+	{ebiten.KeyAltRight, KeyAlt},
+}
+
 func (k *hostKeyboard) poll() {
-	emit := func(code KeyCode, press bool) {
+	send := func(ev KeyEvent) {
 		select {
-		case k.ch <- KeyEvent{Code: code, Press: press}:
+		case k.ch <- ev:
 		default:
 		}
 	}
@@ -28,117 +67,58 @@ func (k *hostKeyboard) poll() {
 	alt := ebiten.IsKeyPressed(ebiten.KeyAltLeft) || ebiten.IsKeyPressed(ebiten.KeyAltRight)
 	shift := ebiten.IsKeyPressed(ebiten.KeyShiftLeft) || ebiten.IsKeyPressed(ebiten.KeyShiftRight)
 
-	_ = alt
-	_ = shift
+	var mods Modifier
+	if shift {
+		mods |= ModShift
+	}
+	if ctrl {
+		mods |= ModCtrl
+	}
+	if alt {
+		mods |= ModAlt
+	}
 
 	if ctrl {
-		emitCtrl := func(key ebiten.Key, r rune) {
-			if !inpututil.IsKeyJustPressed(key) {
-				return
-			}
-			select {
-			case k.ch <- KeyEvent{Press: true, Rune: r}:
-			default:
+		for _, letter := range hostCtrlLetters {
+			key := ebiten.KeyA + ebiten.Key(letter-'a')
+			if inpututil.IsKeyJustPressed(key) {
+				send(KeyEvent{Press: true, Rune: ctrlRune(letter), Mods: mods, Scancode: uint16(key)})
 			}
 		}
-		emitCtrl(ebiten.KeyA, 0x01)
-		emitCtrl(ebiten.KeyE, 0x05)
-		emitCtrl(ebiten.KeyG, 0x07)
-		emitCtrl(ebiten.KeyU, 0x15)
-		emitCtrl(ebiten.KeyW, 0x17)
-		emitCtrl(ebiten.KeyC, 0x03)
 	}
 
 	for _, r := range ebiten.AppendInputChars(nil) {
-		select {
-		case k.ch <- KeyEvent{Press: true, Rune: r}:
-		default:
+		send(KeyEvent{Press: true, Rune: r, Mods: mods})
+	}
+
+	// Text arrives above without a key; report the release of letter,
+	// digit and space keys so that held state can be tracked for them too.
+	for _, key := range inpututil.AppendJustReleasedKeys(nil) {
+		if r, ok := hostKeyRune(key); ok {
+			send(KeyEvent{Rune: r, Mods: mods, Scancode: uint16(key)})
 		}
 	}
 
 	// Use only arrow keys for navigation. Letter keys are treated as text input.
-	if inpututil.IsKeyJustPressed(ebiten.KeyArrowUp) {
-		emit(KeyUp, true)
-	}
-	if inpututil.IsKeyJustReleased(ebiten.KeyArrowUp) {
-		emit(KeyUp, false)
-	}
-	if inpututil.IsKeyJustPressed(ebiten.KeyArrowDown) {
-		emit(KeyDown, true)
-	}
-	if inpututil.IsKeyJustReleased(ebiten.KeyArrowDown) {
-		emit(KeyDown, false)
-	}
-	if inpututil.IsKeyJustPressed(ebiten.KeyArrowLeft) {
-		emit(KeyLeft, true)
-	}
-	if inpututil.IsKeyJustReleased(ebiten.KeyArrowLeft) {
-		emit(KeyLeft, false)
-	}
-	if inpututil.IsKeyJustPressed(ebiten.KeyArrowRight) {
-		emit(KeyRight, true)
-	}
-	if inpututil.IsKeyJustReleased(ebiten.KeyArrowRight) {
-		emit(KeyRight, false)
-	}
-	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
-		emit(KeyEnter, true)
-	}
-	if inpututil.IsKeyJustReleased(ebiten.KeyEnter) {
-		emit(KeyEnter, false)
-	}
-	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
-		emit(KeyEscape, true)
-	}
-	if inpututil.IsKeyJustReleased(ebiten.KeyEscape) {
-		emit(KeyEscape, false)
-	}
-	if inpututil.IsKeyJustPressed(ebiten.KeyBackspace) {
-		emit(KeyBackspace, true)
-	}
-	if inpututil.IsKeyJustReleased(ebiten.KeyBackspace) {
-		emit(KeyBackspace, false)
-	}
-	if inpututil.IsKeyJustPressed(ebiten.KeyTab) {
-		emit(KeyTab, true)
-	}
-	if inpututil.IsKeyJustReleased(ebiten.KeyTab) {
-		emit(KeyTab, false)
-	}
-	if inpututil.IsKeyJustPressed(ebiten.KeyDelete) {
-		emit(KeyDelete, true)
-	}
-	if inpututil.IsKeyJustReleased(ebiten.KeyDelete) {
-		emit(KeyDelete, false)
-	}
-	if inpututil.IsKeyJustPressed(ebiten.KeyHome) {
-		emit(KeyHome, true)
-	}
-	if inpututil.IsKeyJustReleased(ebiten.KeyHome) {
-		emit(KeyHome, false)
-	}
-	if inpututil.IsKeyJustPressed(ebiten.KeyEnd) {
-		emit(KeyEnd, true)
-	}
-	if inpututil.IsKeyJustReleased(ebiten.KeyEnd) {
-		emit(KeyEnd, false)
-	}
-	if inpututil.IsKeyJustPressed(ebiten.KeyF1) {
-		emit(KeyF1, true)
-	}
-	if inpututil.IsKeyJustReleased(ebiten.KeyF1) {
-		emit(KeyF1, false)
-	}
-	if inpututil.IsKeyJustPressed(ebiten.KeyF2) {
-		emit(KeyF2, true)
-	}
-	if inpututil.IsKeyJustReleased(ebiten.KeyF2) {
-		emit(KeyF2, false)
-	}
-	if inpututil.IsKeyJustPressed(ebiten.KeyF3) {
-		emit(KeyF3, true)
-	}
-	if inpututil.IsKeyJustReleased(ebiten.KeyF3) {
-		emit(KeyF3, false)
+	for _, hk := range hostKeys {
+		if inpututil.IsKeyJustPressed(hk.key) {
+			send(KeyEvent{Code: hk.code, Press: true, Mods: mods, Scancode: uint16(hk.key)})
+		}
+		if inpututil.IsKeyJustReleased(hk.key) {
+			send(KeyEvent{Code: hk.code, Mods: mods, Scancode: uint16(hk.key)})
+		}
 	}
 }
+
+// hostKeyRune returns the unshifted rune of a letter, digit or space key.
+func hostKeyRune(key ebiten.Key) (rune, bool) {
+	switch {
+	case key >= ebiten.KeyA && key <= ebiten.KeyZ:
+		return 'a' + rune(key-ebiten.KeyA), true
+	case key >= ebiten.KeyDigit0 && key <= ebiten.KeyDigit9:
+		return '0' + rune(key-ebiten.KeyDigit0), true
+	case key == ebiten.KeySpace:
+		return ' ', true
+	}
+	return 0, false
+}
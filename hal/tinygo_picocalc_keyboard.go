@@ -31,6 +31,10 @@ const (
 	picoCalcKeyF10       byte = 0x90 // Oddly not 0x8A on PicoCalc.
 	picoCalcKeyHome      byte = 0xD2
 	picoCalcKeyIns       byte = 0xD1
+	picoCalcKeyPageUp    byte = 0xD6
+	picoCalcKeyPageDown  byte = 0xD7
+	picoCalcKeyShiftL    byte = 0xA2
+	picoCalcKeyShiftR    byte = 0xA3
 	picoCalcKeyLeft      byte = 0xB4
 	picoCalcKeyRight     byte = 0xB7
 	picoCalcKeyUp        byte = 0xB5
@@ -42,8 +46,9 @@ type i2cKeyboard struct {
 	write [1]byte
 	read  [2]byte
 
-	altDown  bool
-	ctrlDown bool
+	altDown   bool
+	ctrlDown  bool
+	shiftDown bool
 }
 
 func initI2CKeyboard() (*i2cKeyboard, error) {
@@ -84,56 +89,67 @@ func (k *i2cKeyboard) readEvent() (KeyEvent, bool) {
 	case 0x01: // key down
 		return k.translate(key, true)
 	case 0x02: // key held (mostly modifiers)
-		switch key {
-		case picoCalcKeyAlt:
-			k.altDown = true
-		case picoCalcKeyCtrl:
-			k.ctrlDown = true
-		}
+		k.setModifier(key, true)
 		return KeyEvent{}, false
 	case 0x03: // key up
-		switch key {
-		case picoCalcKeyAlt:
-			k.altDown = false
-		case picoCalcKeyCtrl:
-			k.ctrlDown = false
-		}
-		return KeyEvent{}, false
+		return k.translate(key, false)
 	default:
-		// key held or unknown: ignore (repeat handled in termkbd).
+		// unknown: ignore (repeat handled in termkbd).
 		return KeyEvent{}, false
 	}
 }
 
-func (k *i2cKeyboard) translate(code byte, press bool) (KeyEvent, bool) {
+// setModifier tracks a modifier key and reports its KeyCode.
+func (k *i2cKeyboard) setModifier(code byte, down bool) (KeyCode, bool) {
 	switch code {
 	case picoCalcKeyAlt:
-		k.altDown = press
-		return KeyEvent{}, false
+		k.altDown = down
+		return KeyAlt, true
 	case picoCalcKeyCtrl:
-		k.ctrlDown = press
-		return KeyEvent{}, false
+		k.ctrlDown = down
+		return KeyCtrl, true
+	case picoCalcKeyShiftL, picoCalcKeyShiftR:
+		k.shiftDown = down
+		return KeyShift, true
+	}
+	return KeyUnknown, false
+}
+
+func (k *i2cKeyboard) mods() Modifier {
+	var m Modifier
+	if k.shiftDown {
+		m |= ModShift
+	}
+	if k.ctrlDown {
+		m |= ModCtrl
+	}
+	if k.altDown {
+		m |= ModAlt
 	}
+	return m
+}
 
-	if !press {
-		return KeyEvent{Press: false, Code: k.mapSpecial(code)}, true
+func (k *i2cKeyboard) translate(code byte, press bool) (KeyEvent, bool) {
+	if kc, ok := k.setModifier(code, press); ok {
+		return KeyEvent{Code: kc, Press: press, Mods: k.mods(), Scancode: uint16(code)}, true
 	}
 
+	ev := KeyEvent{Press: press, Mods: k.mods(), Scancode: uint16(code)}
 	if kc, ok := k.specialKey(code); ok {
-		return KeyEvent{Press: true, Code: kc}, true
+		ev.Code = kc
+		return ev, true
 	}
 
 	r := rune(code)
-	if r == '\r' {
-		return KeyEvent{Press: true, Code: KeyEnter}, true
-	}
-	if r == '\n' {
-		return KeyEvent{Press: true, Code: KeyEnter}, true
-	}
-	if r == 0 {
+	switch r {
+	case 0:
 		return KeyEvent{}, false
+	case '\r', '\n':
+		ev.Code = KeyEnter
+	default:
+		ev.Rune = r
 	}
-	return KeyEvent{Press: true, Rune: r}, true
+	return ev, true
 }
 
 func (k *i2cKeyboard) specialKey(code byte) (KeyCode, bool) {
@@ -169,17 +185,31 @@ func (k *i2cKeyboard) mapSpecial(code byte) KeyCode {
 		return KeyF2
 	case picoCalcKeyF3:
 		return KeyF3
-	case picoCalcKeyF4, picoCalcKeyF5, picoCalcKeyF6, picoCalcKeyF7, picoCalcKeyF8, picoCalcKeyF9, picoCalcKeyF10:
-		// Not mapped currently (termkbd provides VT100 mappings for F1..F3 only).
-		return KeyUnknown
+	case picoCalcKeyF4:
+		return KeyF4
+	case picoCalcKeyF5:
+		return KeyF5
+	case picoCalcKeyF6:
+		return KeyF6
+	case picoCalcKeyF7:
+		return KeyF7
+	case picoCalcKeyF8:
+		return KeyF8
+	case picoCalcKeyF9:
+		return KeyF9
+	case picoCalcKeyF10:
+		return KeyF10
 	case picoCalcKeyIns:
-		// No direct VT100 mapping in termkbd; treat as Tab for now.
-		return KeyTab
+		return KeyInsert
+	case picoCalcKeyPageUp:
+		return KeyPageUp
+	case picoCalcKeyPageDown:
+		return KeyPageDown
 	default:
 		return KeyUnknown
 	}
 }
 
 func (k *i2cKeyboard) String() string {
-	return fmt.Sprintf("alt=%v ctrl=%v", k.altDown, k.ctrlDown)
+	return fmt.Sprintf("alt=%v ctrl=%v shift=%v", k.altDown, k.ctrlDown, k.shiftDown)
 }
@@ -16,18 +16,24 @@ func main() {
 	var cfg hal.HeadlessConfig
 	var termDemo bool
 	var shell bool
+	var full bool
+	var launcher bool
+	var traceEvents int
 	flag.BoolVar(&cfg.Enabled, "headless", false, "Run without a window.")
 	flag.IntVar(&cfg.Hz, "hz", 60, "Tick rate in headless mode.")
 	flag.Uint64Var(&cfg.Ticks, "ticks", 0, "Stop after N ticks in headless mode (0 = run forever).")
 	flag.BoolVar(&termDemo, "term-demo", false, "Run VT100 terminal demo.")
 	flag.BoolVar(&shell, "shell", false, "Run interactive shell.")
+	flag.BoolVar(&full, "full", false, "Run the full system: shell with VFS (Flash.bin), audio, gpio, serial and apps.")
+	flag.BoolVar(&launcher, "launcher", false, "With -full, open the launcher after login.")
+	flag.IntVar(&traceEvents, "trace", 0, "Record the last N IPC messages from boot (0 = off).")
 	flag.Parse()
 
 	if cfg.Enabled {
 		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 		defer stop()
 		if err := hal.RunHeadless(ctx, func(h hal.HAL) func() error {
-			return app.NewWithConfig(h, app.Config{TermDemo: termDemo, Shell: shell})
+			return app.NewWithConfig(h, app.Config{TermDemo: termDemo, Shell: shell, Full: full, Launcher: launcher, Trace: traceEvents})
 		}, cfg); err != nil {
 			if err == context.Canceled {
 				return
@@ -39,7 +45,7 @@ func main() {
 	}
 
 	if err := hal.RunWindow(func(h hal.HAL) func() error {
-		return app.NewWithConfig(h, app.Config{TermDemo: termDemo, Shell: shell})
+		return app.NewWithConfig(h, app.Config{TermDemo: termDemo, Shell: shell, Full: full, Launcher: launcher, Trace: traceEvents})
 	}); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
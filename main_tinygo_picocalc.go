@@ -0,0 +1,14 @@
+//go:build tinygo && picocalc
+
+package main
+
+import (
+	"spark/app"
+	"spark/hal"
+)
+
+// PicoCalc has the keyboard, display and flash for the whole system; it
+// boots into the launcher.
+func main() {
+	app.RunWithConfig(hal.New(), app.Config{Full: true, Launcher: true})
+}
@@ -0,0 +1,217 @@
+// Package apps is the registry of foreground apps.
+//
+// An app is described once by a Descriptor; appmgr starts it from there, the
+// shell derives its command, usage and completion from it, and consolemux
+// reaches it under proto.AppEndpointName(ID). Built-in apps are registered by
+// package spark/sparkos/apps/builtin; any other package can add one with a
+// single Register call from init.
+package apps
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"spark/hal"
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+)
+
+// DefaultUnloadAfterTicks is how long an app may stay in the background
+// before appmgr shuts it down, unless its descriptor says otherwise.
+const DefaultUnloadAfterTicks = 30_000
+
+// LimitWindowTicks is the window over which appmgr measures the rates in
+// Limits.
+const LimitWindowTicks = 2_000
+
+// firstDynamicID is the first AppID handed out to descriptors registered
+// without one; lower IDs are reserved for the proto.App* constants.
+const firstDynamicID proto.AppID = 64
+
+// ErrUsage is returned by an Args hook for malformed arguments; the shell
+// prints the descriptor's Usage.
+var ErrUsage = errors.New("usage")
+
+// Env is what an app factory is given.
+type Env struct {
+	Display hal.Display
+	// EP receives the app's input and control messages.
+	EP kernel.Capability
+
+	caps map[string]kernel.Capability
+}
+
+// NewEnv returns an Env with the resolved service capabilities.
+func NewEnv(disp hal.Display, ep kernel.Capability, caps map[string]kernel.Capability) Env {
+	return Env{Display: disp, EP: ep, caps: caps}
+}
+
+// Cap returns the capability of a service listed in Descriptor.Services,
+// or an invalid one if it could not be resolved.
+func (e Env) Cap(service string) kernel.Capability {
+	return e.caps[service]
+}
+
+// Shell is what an Args hook may ask of the shell running the command.
+type Shell interface {
+	// AbsPath resolves p against the working directory.
+	AbsPath(p string) string
+	// Cwd returns the working directory.
+	Cwd() string
+	// Admin reports whether the shell user has the admin role.
+	Admin() bool
+	// Notice prints an informational line.
+	Notice(line string)
+}
+
+// Descriptor describes an app.
+type Descriptor struct {
+	// ID identifies the app in MsgAppSelect. Zero lets Register pick one.
+	ID proto.AppID
+	// Name is the shell command starting the app.
+	Name    string
+	Aliases []string
+	Usage   string
+	Desc    string
+	// Icon is a one- or two-character glyph launchers draw for the app.
+	Icon string
+
+	// Services lists the name-service entries the app needs ("vfs",
+	// "audio", ...); they are resolved before New and passed in Env.
+	Services []string
+
+	// UnloadAfterTicks overrides DefaultUnloadAfterTicks. KeepLoaded keeps
+	// the app running in the background until it exits.
+	UnloadAfterTicks uint64
+	KeepLoaded       bool
+	// Suspend marks apps that handle MsgAppSuspend and MsgAppResume: appmgr
+	// asks them to save their state (see SaveState) instead of shutting them
+	// down, and hands it back on the next start. Other apps lose their state.
+	Suspend bool
+	// FullScreen gives the app the whole screen: no status bar is drawn over
+	// it while it has focus.
+	FullScreen bool
+
+	// New returns a fresh task for every start.
+	New func(env Env) kernel.Task
+
+	// Args turns shell arguments into the MsgAppSelect argument. activate
+	// false sends the app to the background instead ("rtdemo off").
+	// A nil Args accepts no arguments.
+	Args func(sh Shell, args []string) (arg string, activate bool, err error)
+	// Complete lists the values offered for the first argument.
+	Complete []string
+	// Files marks apps whose argument is a file path: opening one is
+	// remembered in the recent files (see AddRecent).
+	Files bool
+	// InputEvents marks apps that read MsgInputEvent (key press, release
+	// and modifiers, see package spark/sparkos/client/input) besides
+	// MsgTermInput. Other apps are not sent the events.
+	InputEvents bool
+
+	// Limits bounds what the app's task may use; appmgr stops the app when
+	// it goes beyond one and tells the user why.
+	Limits Limits
+}
+
+// Limits are per-app resource quotas, checked by appmgr every
+// LimitWindowTicks against kernel task accounting. Zero fields are not
+// limited.
+//
+// Heap use cannot be charged to a task; memory pressure is handled by
+// stopping background apps instead (appmgr Options.MinFreeHeap).
+type Limits struct {
+	// Endpoints bounds the endpoints the task holds, RegionBytes the size
+	// of its shared-memory regions.
+	Endpoints   int
+	RegionBytes int
+	// Sent bounds the messages the task sends per window.
+	Sent uint32
+	// BusyPercent bounds the share of ticks in a window at which the task
+	// was sampled busy (see kernel.TaskInfo.Busy): an app that stops
+	// reading its mailbox for that long is considered hung. It is not a
+	// CPU limit; compute loops are only seen if they call Context.Yield.
+	BusyPercent int
+}
+
+// UnloadAfter returns the idle time after which appmgr stops the app, or 0
+// if it is never stopped.
+func (d Descriptor) UnloadAfter() uint64 {
+	switch {
+	case d.KeepLoaded:
+		return 0
+	case d.UnloadAfterTicks != 0:
+		return d.UnloadAfterTicks
+	default:
+		return DefaultUnloadAfterTicks
+	}
+}
+
+var (
+	mu     sync.Mutex
+	byID   = make(map[proto.AppID]Descriptor)
+	byName = make(map[string]proto.AppID)
+)
+
+// Register adds an app and returns its ID. It panics on a missing name or
+// factory and on a duplicate ID or name, like other init-time registries.
+func Register(d Descriptor) proto.AppID {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if d.Name == "" || d.New == nil {
+		panic(fmt.Sprintf("apps: register %q: name and factory are required", d.Name))
+	}
+	if _, dup := byName[d.Name]; dup {
+		panic(fmt.Sprintf("apps: register %q: duplicate name", d.Name))
+	}
+	if d.ID == proto.AppNone {
+		id := firstDynamicID
+		for ; byID[id].Name != ""; id++ {
+			if id == ^proto.AppID(0) {
+				panic(fmt.Sprintf("apps: register %q: no free app ID", d.Name))
+			}
+		}
+		d.ID = id
+	}
+	if prev, dup := byID[d.ID]; dup {
+		panic(fmt.Sprintf("apps: register %q: ID %d taken by %q", d.Name, d.ID, prev.Name))
+	}
+
+	byID[d.ID] = d
+	byName[d.Name] = d.ID
+	return d.ID
+}
+
+// All returns the registered apps ordered by ID.
+func All() []Descriptor {
+	mu.Lock()
+	defer mu.Unlock()
+	out := make([]Descriptor, 0, len(byID))
+	for _, d := range byID {
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// ByID returns the app registered under id.
+func ByID(id proto.AppID) (Descriptor, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	d, ok := byID[id]
+	return d, ok
+}
+
+// ByName returns the app registered under name.
+func ByName(name string) (Descriptor, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	id, ok := byName[name]
+	if !ok {
+		return Descriptor{}, false
+	}
+	return byID[id], true
+}
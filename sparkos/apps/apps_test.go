@@ -0,0 +1,98 @@
+package apps
+
+import (
+	"testing"
+
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+)
+
+type nopTask struct{}
+
+func (nopTask) Run(*kernel.Context) {}
+
+func newNop(Env) kernel.Task { return nopTask{} }
+
+func TestRegisterAssignsFreeIDs(t *testing.T) {
+	fixed := Register(Descriptor{ID: firstDynamicID, Name: "apps-test-fixed", New: newNop})
+	id := Register(Descriptor{Name: "apps-test-game", New: newNop, KeepLoaded: true})
+	if fixed != firstDynamicID || id != firstDynamicID+1 {
+		t.Fatalf("got IDs %d and %d, want %d and %d", fixed, id, firstDynamicID, firstDynamicID+1)
+	}
+
+	d, ok := ByName("apps-test-game")
+	if !ok || d.ID != id {
+		t.Fatalf("ByName: got %+v, %v", d, ok)
+	}
+	if d, ok := ByID(id); !ok || d.Name != "apps-test-game" || d.UnloadAfter() != 0 {
+		t.Fatalf("ByID: got %+v, %v", d, ok)
+	}
+	if d, _ := ByID(fixed); d.UnloadAfter() != DefaultUnloadAfterTicks {
+		t.Fatalf("expected the default unload time, got %d", d.UnloadAfter())
+	}
+
+	all := All()
+	for i := 1; i < len(all); i++ {
+		if all[i-1].ID >= all[i].ID {
+			t.Fatalf("All is not ordered by ID: %d before %d", all[i-1].ID, all[i].ID)
+		}
+	}
+}
+
+func TestRegisterRejectsDuplicates(t *testing.T) {
+	Register(Descriptor{ID: proto.AppID(200), Name: "apps-test-dup", New: newNop})
+	for _, d := range []Descriptor{
+		{ID: proto.AppID(201), Name: "apps-test-dup", New: newNop},
+		{ID: proto.AppID(200), Name: "apps-test-other", New: newNop},
+		{Name: "apps-test-nofactory"},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected Register(%q, %d) to panic", d.Name, d.ID)
+				}
+			}()
+			Register(d)
+		}()
+	}
+}
+
+func TestOnOff(t *testing.T) {
+	for _, tc := range []struct {
+		args     []string
+		activate bool
+		err      error
+	}{
+		{nil, true, nil},
+		{[]string{"on"}, true, nil},
+		{[]string{"off"}, false, nil},
+		{[]string{"maybe"}, false, ErrUsage},
+		{[]string{"on", "off"}, false, ErrUsage},
+	} {
+		_, activate, err := OnOff(nil, tc.args)
+		if activate != tc.activate || err != tc.err {
+			t.Errorf("OnOff(%q) = %v, %v; want %v, %v", tc.args, activate, err, tc.activate, tc.err)
+		}
+	}
+}
+
+func TestPushRecent(t *testing.T) {
+	var list []Recent
+	for i := 0; i < MaxRecent+2; i++ {
+		list = pushRecent(list, Recent{App: "vi", Path: "/f" + string(rune('a'+i))})
+	}
+	list = pushRecent(list, Recent{App: "hex", Path: "/fe"})
+
+	got := decodeRecent(encodeRecent(list))
+	if len(got) != MaxRecent {
+		t.Fatalf("got %d entries, want %d", len(got), MaxRecent)
+	}
+	if got[0] != (Recent{App: "hex", Path: "/fe"}) || got[1].Path != "/fj" {
+		t.Fatalf("unexpected order: %+v", got)
+	}
+	for _, r := range got[1:] {
+		if r.Path == "/fe" {
+			t.Fatalf("duplicate entry for /fe: %+v", got)
+		}
+	}
+}
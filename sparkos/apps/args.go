@@ -0,0 +1,66 @@
+package apps
+
+import "strings"
+
+// Common Args hooks.
+
+// NoArgs accepts no arguments.
+func NoArgs(_ Shell, args []string) (string, bool, error) {
+	if len(args) != 0 {
+		return "", false, ErrUsage
+	}
+	return "", true, nil
+}
+
+// Path takes exactly one path.
+func Path(sh Shell, args []string) (string, bool, error) {
+	if len(args) != 1 {
+		return "", false, ErrUsage
+	}
+	return sh.AbsPath(args[0]), true, nil
+}
+
+// OptionalPath takes an optional path.
+func OptionalPath(sh Shell, args []string) (string, bool, error) {
+	switch len(args) {
+	case 0:
+		return "", true, nil
+	case 1:
+		return sh.AbsPath(args[0]), true, nil
+	default:
+		return "", false, ErrUsage
+	}
+}
+
+// OptionalArg passes an optional word through unchanged.
+func OptionalArg(_ Shell, args []string) (string, bool, error) {
+	switch len(args) {
+	case 0:
+		return "", true, nil
+	case 1:
+		return args[0], true, nil
+	default:
+		return "", false, ErrUsage
+	}
+}
+
+// Joined passes all arguments joined by spaces.
+func Joined(_ Shell, args []string) (string, bool, error) {
+	return strings.Join(args, " "), true, nil
+}
+
+// OnOff takes an optional "on" or "off"; "off" sends the app to the background.
+func OnOff(_ Shell, args []string) (string, bool, error) {
+	switch {
+	case len(args) == 0:
+		return "", true, nil
+	case len(args) > 1:
+		return "", false, ErrUsage
+	case args[0] == "on":
+		return "", true, nil
+	case args[0] == "off":
+		return "", false, nil
+	default:
+		return "", false, ErrUsage
+	}
+}
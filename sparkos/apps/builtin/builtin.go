@@ -0,0 +1,297 @@
+// Package builtin registers the apps shipped with SparkOS.
+//
+// Import it for its side effect wherever appmgr is linked in.
+package builtin
+
+import (
+	"errors"
+
+	"spark/sparkos/apps"
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+	archivetask "spark/sparkos/tasks/archive"
+	basictask "spark/sparkos/tasks/basic"
+	calendartask "spark/sparkos/tasks/calendar"
+	fbtesttask "spark/sparkos/tasks/fbtest"
+	gpioscopetask "spark/sparkos/tasks/gpioscope"
+	hexedittask "spark/sparkos/tasks/hexedit"
+	imgviewtask "spark/sparkos/tasks/imgview"
+	launchertask "spark/sparkos/tasks/launcher"
+	mctask "spark/sparkos/tasks/mc"
+	quarkdonuttask "spark/sparkos/tasks/quarkdonut"
+	rfanalyzertask "spark/sparkos/tasks/rfanalyzer"
+	rtdemotask "spark/sparkos/tasks/rtdemo"
+	rtvoxeltask "spark/sparkos/tasks/rtvoxel"
+	serialtermtask "spark/sparkos/tasks/serialterm"
+	snaketask "spark/sparkos/tasks/snake"
+	spxruntask "spark/sparkos/tasks/spxrun"
+	teaplayertask "spark/sparkos/tasks/teaplayer"
+	tetristask "spark/sparkos/tasks/tetris"
+	todotask "spark/sparkos/tasks/todo"
+	userstask "spark/sparkos/tasks/users"
+	vectortask "spark/sparkos/tasks/vector"
+	vitask "spark/sparkos/tasks/vi"
+)
+
+// computeLimits are for apps that can compute without end (a BASIC loop, a
+// CAS expression, a scene, a user program): they are stopped once they leave
+// their input unread for most of a window or flood the system with messages.
+var computeLimits = apps.Limits{Endpoints: 8, Sent: 4000, BusyPercent: 90}
+
+func init() {
+	for _, d := range descriptors {
+		apps.Register(d)
+	}
+}
+
+var descriptors = []apps.Descriptor{
+	{
+		ID: proto.AppVi, Name: "vi", Icon: "Vi",
+		Usage: "vi [file]", Desc: "Edit a file (SparkVi; build with -tags spark_vi).",
+		Services: []string{"vfs"},
+		Args:     viArgs,
+		Files:    true,
+		Suspend:  true,
+		New: func(env apps.Env) kernel.Task {
+			return vitask.New(env.Display, env.EP, env.Cap("vfs"))
+		},
+	},
+	{
+		ID: proto.AppMC, Name: "mc", Icon: "MC",
+		Usage: "mc [dir]", Desc: "Midnight Commander-like file manager (q/ESC to exit).",
+		Services: []string{"vfs"},
+		Args:     mcArgs,
+		New: func(env apps.Env) kernel.Task {
+			return mctask.New(env.Display, env.EP, env.Cap("vfs"))
+		},
+	},
+	{
+		ID: proto.AppBasic, Name: "basic", Icon: "Ba",
+		Usage: "basic [file] | basic run <file>", Desc: "Tiny BASIC IDE (F1 code, F2 io, F3 vars).",
+		Services: []string{"vfs"},
+		Args:     basicArgs,
+		Files:    true,
+		Limits:   computeLimits,
+		New: func(env apps.Env) kernel.Task {
+			return basictask.New(env.Display, env.EP, env.Cap("vfs"))
+		},
+	},
+	{
+		ID: proto.AppHex, Name: "hex", Icon: "Hx",
+		Usage: "hex <file>", Desc: "Hex viewer/editor (q/ESC to exit, w to save).",
+		Services: []string{"vfs"},
+		Args:     apps.Path,
+		Files:    true,
+		New: func(env apps.Env) kernel.Task {
+			return hexedittask.New(env.Display, env.EP, env.Cap("vfs"))
+		},
+	},
+	{
+		ID: proto.AppVector, Name: "vector", Icon: "Vx",
+		Usage: "vector [expr]", Desc: "Math calculator with graphing (g graph, H help).",
+		Services: []string{"vfs"},
+		Args:     apps.Joined,
+		Suspend:  true,
+		Limits:   computeLimits,
+		New: func(env apps.Env) kernel.Task {
+			return vectortask.New(env.Display, env.EP, env.Cap("vfs"))
+		},
+	},
+	{
+		ID: proto.AppGPIOScope, Name: "gpio", Aliases: []string{"scope", "sigview"}, Icon: "Sc",
+		Usage: "gpio", Desc: "GPIO / Signal Viewer (Tab modes, r run, q exit).",
+		Services: []string{"time", "gpio"},
+		Args:     apps.NoArgs,
+		New: func(env apps.Env) kernel.Task {
+			return gpioscopetask.New(env.Display, env.EP, env.Cap("time"), env.Cap("gpio"))
+		},
+	},
+	{
+		ID: proto.AppSnake, Name: "snake", Icon: "Sn",
+		Usage: "snake", Desc: "Snake game (arrows move, p pause, r restart, q quit).",
+		Args: apps.NoArgs,
+		New: func(env apps.Env) kernel.Task {
+			return snaketask.New(env.Display, env.EP)
+		},
+	},
+	{
+		ID: proto.AppTetris, Name: "tetris", Icon: "Te",
+		Usage: "tetris", Desc: "Tetris (arrows move, z/x rotate, c drop, p pause, r restart, q quit).",
+		Services:    []string{"vfs"},
+		Args:        apps.NoArgs,
+		Suspend:     true,
+		InputEvents: true,
+		New: func(env apps.Env) kernel.Task {
+			return tetristask.New(env.Display, env.EP, env.Cap("vfs"))
+		},
+	},
+	{
+		ID: proto.AppCalendar, Name: "cal", Aliases: []string{"calendar"}, Icon: "Ca",
+		Usage: "cal [YYYY-MM[-DD]]", Desc: "Calendar (arrows move, Enter day view, a add, d delete, n/b month, q quit).",
+		Services: []string{"vfs"},
+		Args:     apps.OptionalArg,
+		New: func(env apps.Env) kernel.Task {
+			return calendartask.New(env.Display, env.EP, env.Cap("vfs"))
+		},
+	},
+	{
+		ID: proto.AppTodo, Name: "todo", Icon: "Td",
+		Usage: "todo [all|open|done|search]", Desc: "TODO list (a add, e edit, d delete, p prio, f filter, / search).",
+		Services: []string{"vfs"},
+		Args:     apps.OptionalArg,
+		Complete: []string{"all", "open", "done", "search"},
+		New: func(env apps.Env) kernel.Task {
+			return todotask.New(env.Display, env.EP, env.Cap("vfs"))
+		},
+	},
+	{
+		ID: proto.AppArchive, Name: "arc", Aliases: []string{"archive"}, Icon: "Ar",
+		Usage: "arc <file>", Desc: "Archive manager (tar/zip; x extract, c create).",
+		Services: []string{"vfs"},
+		Args:     apps.Path,
+		Files:    true,
+		New: func(env apps.Env) kernel.Task {
+			return archivetask.New(env.Display, env.EP, env.Cap("vfs"))
+		},
+	},
+	{
+		ID: proto.AppTEA, Name: "tea", Icon: "Tp",
+		Usage: "tea [file|dir]", Desc: "TEA audio player (Enter play, Space pause, s stop, +/- volume).",
+		Services: []string{"vfs", "audio"},
+		Args:     apps.OptionalPath,
+		Files:    true,
+		New: func(env apps.Env) kernel.Task {
+			return teaplayertask.New(env.Display, env.EP, env.Cap("vfs"), env.Cap("audio"))
+		},
+	},
+	{
+		ID: proto.AppRTDemo, Name: "rtdemo", Icon: "Rt",
+		Usage: "rtdemo [on|off]", Desc: "Start raytracing demo (exit with q/ESC).",
+		Args:       apps.OnOff,
+		Complete:   []string{"on", "off"},
+		FullScreen: true,
+		New: func(env apps.Env) kernel.Task {
+			return rtdemotask.New(env.Display, env.EP)
+		},
+	},
+	{
+		ID: proto.AppRTVoxel, Name: "rtvoxel", Icon: "Vo",
+		Usage: "rtvoxel [on|off]", Desc: "Start voxel world demo (exit with q/ESC).",
+		Args:       apps.OnOff,
+		Complete:   []string{"on", "off"},
+		FullScreen: true,
+		Limits:     computeLimits,
+		New: func(env apps.Env) kernel.Task {
+			return rtvoxeltask.New(env.Display, env.EP)
+		},
+	},
+	{
+		ID: proto.AppImgView, Name: "imgview", Icon: "Im",
+		Usage: "imgview <file>", Desc: "View an image (BMP/PNG/JPEG; q/ESC to exit).",
+		Services:   []string{"vfs"},
+		Args:       apps.Path,
+		Files:      true,
+		FullScreen: true,
+		New: func(env apps.Env) kernel.Task {
+			return imgviewtask.New(env.Display, env.EP, env.Cap("vfs"))
+		},
+	},
+	{
+		ID: proto.AppRFAnalyzer, Name: "rf", Icon: "RF",
+		Usage: "rf", Desc: "2.4 GHz RF Analyzer (nRF24 scan + waterfall + sniffer).",
+		Services: []string{"vfs"},
+		Args:     apps.NoArgs,
+		New: func(env apps.Env) kernel.Task {
+			return rfanalyzertask.New(env.Display, env.EP, env.Cap("vfs"))
+		},
+	},
+	{
+		ID: proto.AppFBTest, Name: "fbtest", Icon: "Fb",
+		Usage: "fbtest", Desc: "Framebuffer benchmark (r rerun, q quit).",
+		Args:       apps.NoArgs,
+		FullScreen: true,
+		New: func(env apps.Env) kernel.Task {
+			return fbtesttask.New(env.Display, env.EP)
+		},
+	},
+	{
+		ID: proto.AppSerialTerm, Name: "serial", Icon: "Se",
+		Usage: "serial", Desc: "Serial terminal (Ctrl+Q exit, Ctrl+R clear).",
+		Services: []string{"serial"},
+		Args:     apps.NoArgs,
+		New: func(env apps.Env) kernel.Task {
+			return serialtermtask.New(env.Display, env.Cap("serial"), env.EP)
+		},
+	},
+	{
+		ID: proto.AppUsers, Name: "users", Icon: "Us",
+		Usage: "users", Desc: "User manager (admin only; n new, p password, r role, h home).",
+		Services: []string{"vfs"},
+		Args:     usersArgs,
+		New: func(env apps.Env) kernel.Task {
+			return userstask.New(env.Display, env.EP, env.Cap("vfs"))
+		},
+	},
+	{
+		ID: proto.AppQuarkDonut, Name: "donut", Icon: "Do",
+		Usage: "donut", Desc: "QuarkGL 3D donut demo (q/ESC exit, w wireframe).",
+		Args:       apps.NoArgs,
+		FullScreen: true,
+		New: func(env apps.Env) kernel.Task {
+			return quarkdonuttask.New(env.Display, env.EP)
+		},
+	},
+	{
+		ID: proto.AppLauncher, Name: "home", Aliases: []string{"launcher"}, Icon: "Ho",
+		Usage: "home", Desc: "App launcher (arrows move, Enter open, Tab recent files, q shell).",
+		Services:   []string{"vfs"},
+		Args:       apps.NoArgs,
+		KeepLoaded: true,
+		New: func(env apps.Env) kernel.Task {
+			return launchertask.New(env.Display, env.EP, env.Cap("vfs"))
+		},
+	},
+	{
+		ID: proto.AppRun, Name: "run", Icon: "Rn",
+		Usage: "run <file.spx>", Desc: "Run a user program (spx bytecode; Ctrl+Q stops it).",
+		Services: []string{"vfs", "notify"},
+		Args:     apps.Path,
+		Files:    true,
+		Limits:   computeLimits,
+		New: func(env apps.Env) kernel.Task {
+			return spxruntask.New(env.Display, env.EP, env.Cap("vfs"), env.Cap("notify"))
+		},
+	},
+}
+
+func viArgs(sh apps.Shell, args []string) (string, bool, error) {
+	if !vitask.Enabled {
+		return "", false, errors.New("not enabled in this build (build with -tags spark_vi)")
+	}
+	return apps.OptionalPath(sh, args)
+}
+
+func mcArgs(sh apps.Shell, args []string) (string, bool, error) {
+	if len(args) == 0 {
+		return sh.Cwd(), true, nil
+	}
+	return apps.Path(sh, args)
+}
+
+func basicArgs(sh apps.Shell, args []string) (string, bool, error) {
+	if len(args) == 2 && args[0] == "run" {
+		return "run:" + sh.AbsPath(args[1]), true, nil
+	}
+	return apps.OptionalPath(sh, args)
+}
+
+func usersArgs(sh apps.Shell, args []string) (string, bool, error) {
+	if len(args) != 0 {
+		return "", false, apps.ErrUsage
+	}
+	if sh.Admin() {
+		return "", true, nil
+	}
+	sh.Notice("users: read-only (use `su root` for admin)")
+	return "ro", true, nil
+}
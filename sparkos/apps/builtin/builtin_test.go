@@ -0,0 +1,20 @@
+package builtin
+
+import (
+	"testing"
+
+	"spark/sparkos/apps"
+	"spark/sparkos/proto"
+)
+
+func TestBuiltinsCoverAllAppIDs(t *testing.T) {
+	for id := proto.AppRTDemo; id <= proto.AppQuarkDonut; id++ {
+		d, ok := apps.ByID(id)
+		if !ok {
+			t.Fatalf("app %d is not registered", id)
+		}
+		if d.Usage == "" || d.Icon == "" || d.Args == nil {
+			t.Errorf("app %q: incomplete descriptor", d.Name)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package apps
+
+import (
+	"errors"
+	"strings"
+
+	vfsclient "spark/sparkos/client/vfs"
+	"spark/sparkos/kernel"
+)
+
+// RecentPath lists the files recently opened in an app, newest first, one
+// "app<TAB>path" line each.
+const RecentPath = "/var/recent"
+
+// MaxRecent bounds the recent files list.
+const MaxRecent = 8
+
+const maxRecentBytes = 4 * 1024
+
+// Recent is a file recently opened in an app.
+type Recent struct {
+	// App is the Descriptor.Name of the app.
+	App  string
+	Path string
+}
+
+// LoadRecent returns the recent files, newest first.
+func LoadRecent(ctx *kernel.Context, vfs *vfsclient.Client) ([]Recent, error) {
+	if vfs == nil {
+		return nil, errors.New("vfs unavailable")
+	}
+	data, err := readFile(ctx, vfs, RecentPath, maxRecentBytes)
+	if err != nil {
+		return nil, err
+	}
+	return decodeRecent(data), nil
+}
+
+// AddRecent puts r at the top of the recent files, dropping an older entry
+// for the same file and the oldest entries beyond MaxRecent.
+func AddRecent(ctx *kernel.Context, vfs *vfsclient.Client, r Recent) error {
+	list, err := LoadRecent(ctx, vfs)
+	if err != nil {
+		list = nil
+	}
+	return writeFile(ctx, vfs, RecentPath, encodeRecent(pushRecent(list, r)))
+}
+
+func pushRecent(list []Recent, r Recent) []Recent {
+	out := make([]Recent, 0, MaxRecent)
+	out = append(out, r)
+	for _, e := range list {
+		if len(out) == MaxRecent {
+			break
+		}
+		if e.Path != r.Path {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func encodeRecent(list []Recent) []byte {
+	var b strings.Builder
+	for _, r := range list {
+		b.WriteString(r.App)
+		b.WriteByte('\t')
+		b.WriteString(r.Path)
+		b.WriteByte('\n')
+	}
+	return []byte(b.String())
+}
+
+func decodeRecent(data []byte) []Recent {
+	var out []Recent
+	for _, line := range strings.Split(string(data), "\n") {
+		app, p, ok := strings.Cut(line, "\t")
+		if !ok || app == "" || p == "" {
+			continue
+		}
+		out = append(out, Recent{App: app, Path: p})
+		if len(out) == MaxRecent {
+			break
+		}
+	}
+	return out
+}
@@ -0,0 +1,99 @@
+package apps
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	vfsclient "spark/sparkos/client/vfs"
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+)
+
+// StateDir holds the state of suspended apps, one file per app.
+const StateDir = "/var/appstate"
+
+// MaxStateBytes bounds a saved state.
+const MaxStateBytes = 64 * 1024
+
+// StatePath returns the file the app named name is suspended to.
+func StatePath(name string) string {
+	return StateDir + "/" + name
+}
+
+// SaveState writes data to p, the path of a MsgAppSuspend, creating its
+// directories.
+func SaveState(ctx *kernel.Context, vfs *vfsclient.Client, p string, data []byte) error {
+	if vfs == nil {
+		return errors.New("vfs unavailable")
+	}
+	if len(data) > MaxStateBytes {
+		return fmt.Errorf("state too large (%d bytes)", len(data))
+	}
+	return writeFile(ctx, vfs, p, data)
+}
+
+// writeFile replaces the file at p with data, creating its directories.
+func writeFile(ctx *kernel.Context, vfs *vfsclient.Client, p string, data []byte) error {
+	dir := ""
+	for _, part := range strings.Split(strings.Trim(path.Dir(p), "/"), "/") {
+		if part == "" {
+			continue
+		}
+		dir += "/" + part
+		if err := vfs.Mkdir(ctx, dir); err != nil {
+			if typ, _, statErr := vfs.Stat(ctx, dir); statErr != nil || typ != proto.VFSEntryDir {
+				return fmt.Errorf("mkdir %s: %w", dir, err)
+			}
+		}
+	}
+	if _, err := vfs.Write(ctx, p, proto.VFSWriteTruncate, data); err != nil {
+		return fmt.Errorf("write %s: %w", p, err)
+	}
+	return nil
+}
+
+// LoadState reads and removes the state at p, the path of a MsgAppResume.
+// It returns nil if the app left no state behind.
+func LoadState(ctx *kernel.Context, vfs *vfsclient.Client, p string) ([]byte, error) {
+	if vfs == nil {
+		return nil, errors.New("vfs unavailable")
+	}
+	data, err := readFile(ctx, vfs, p, MaxStateBytes)
+	if data == nil || err != nil {
+		return nil, err
+	}
+	// The state is good for one resume only.
+	_ = vfs.Remove(ctx, p)
+	return data, nil
+}
+
+// readFile reads the file at p, of at most max bytes. It returns nil if
+// there is no such file.
+func readFile(ctx *kernel.Context, vfs *vfsclient.Client, p string, max uint32) ([]byte, error) {
+	typ, size, err := vfs.Stat(ctx, p)
+	if err != nil {
+		if strings.Contains(err.Error(), proto.ErrNotFound.String()) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("stat %s: %w", p, err)
+	}
+	if typ != proto.VFSEntryFile || size > max {
+		return nil, fmt.Errorf("bad file %s", p)
+	}
+
+	out := make([]byte, size)
+	var n int
+	for n < len(out) {
+		m, eof, err := vfs.ReadInto(ctx, p, uint32(n), out[n:])
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", p, err)
+		}
+		n += m
+		if eof || m == 0 {
+			break
+		}
+	}
+	return out[:n], nil
+}
@@ -0,0 +1,125 @@
+package compositor
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+)
+
+const (
+	createTimeoutTicks = 500
+	sendTimeoutTicks   = 100
+)
+
+var nextRequestID uint32
+
+// Surface is an overlay surface. Draw into Pixels (RGB565, W*H, row-major;
+// proto.SurfaceKeyRGB565 is transparent), then call Damage.
+type Surface struct {
+	compCap kernel.Capability
+	region  kernel.Capability
+	id      uint8
+
+	X, Y    int
+	W, H    int
+	Z       uint8
+	Visible bool
+
+	Pixels []byte
+}
+
+// Create allocates a w×h surface at (x, y) with stacking order z (1..255)
+// and shows it. The pixels live in a region owned by the calling task, so the
+// surface disappears when the task exits.
+func Create(ctx *kernel.Context, compCap kernel.Capability, x, y, w, h int, z uint8) (*Surface, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("surface create: nil context")
+	}
+	if !compCap.Valid() {
+		return nil, fmt.Errorf("surface create: no capability")
+	}
+	if w <= 0 || h <= 0 || w > 0xFFFF || h > 0xFFFF || z == 0 {
+		return nil, fmt.Errorf("surface create: bad geometry %dx%d z=%d", w, h, z)
+	}
+
+	region := ctx.NewRegion(w * h * 2)
+	if !region.Valid() {
+		return nil, fmt.Errorf("surface create: no region for %dx%d", w, h)
+	}
+	px, _ := ctx.MapRegion(region, kernel.RightRead|kernel.RightWrite)
+	key := uint16(proto.SurfaceKeyRGB565)
+	for i := 0; i+1 < len(px); i += 2 {
+		px[i], px[i+1] = byte(key), byte(key>>8)
+	}
+
+	requestID := atomic.AddUint32(&nextRequestID, 1)
+	payload := proto.SurfaceCreatePayload(requestID, int16(x), int16(y), uint16(w), uint16(h), z)
+	msg, err := ctx.CallGrant(compCap, uint16(proto.MsgSurfaceCreate), payload, region.Restrict(kernel.RightRead), createTimeoutTicks)
+	if err != nil {
+		ctx.FreeRegion(region)
+		return nil, fmt.Errorf("surface create: %w", err)
+	}
+
+	switch proto.Kind(msg.Kind) {
+	case proto.MsgSurfaceCreateResp:
+		reqID, id, ok := proto.DecodeSurfaceCreateRespPayload(msg.Payload())
+		if !ok || reqID != requestID {
+			ctx.FreeRegion(region)
+			return nil, fmt.Errorf("surface create resp: bad payload")
+		}
+		return &Surface{
+			compCap: compCap, region: region, id: id,
+			X: x, Y: y, W: w, H: h, Z: z, Visible: true,
+			Pixels: px,
+		}, nil
+
+	case proto.MsgError:
+		ctx.FreeRegion(region)
+		code, _, _, ok := proto.DecodeErrorPayload(msg.Payload())
+		if !ok {
+			return nil, fmt.Errorf("surface create error: bad payload")
+		}
+		return nil, fmt.Errorf("surface create: %s", code)
+
+	default:
+		ctx.FreeRegion(region)
+		return nil, fmt.Errorf("surface create: unexpected reply %s", proto.Kind(msg.Kind))
+	}
+}
+
+// Damage asks the compositor to redraw a rectangle of the surface (surface
+// coordinates); w or h 0 redraws all of it.
+func (s *Surface) Damage(ctx *kernel.Context, x, y, w, h int) error {
+	return s.send(ctx, proto.MsgSurfaceDamage, proto.SurfaceDamagePayload(s.id, int16(x), int16(y), uint16(w), uint16(h)))
+}
+
+// Configure moves, restacks, shows or hides the surface.
+func (s *Surface) Configure(ctx *kernel.Context, x, y int, z uint8, visible bool) error {
+	if err := s.send(ctx, proto.MsgSurfaceConfig, proto.SurfaceConfigPayload(s.id, int16(x), int16(y), z, visible)); err != nil {
+		return err
+	}
+	s.X, s.Y, s.Z, s.Visible = x, y, z, visible
+	return nil
+}
+
+// Show and Hide toggle the surface in place.
+func (s *Surface) Show(ctx *kernel.Context) error { return s.Configure(ctx, s.X, s.Y, s.Z, true) }
+func (s *Surface) Hide(ctx *kernel.Context) error { return s.Configure(ctx, s.X, s.Y, s.Z, false) }
+
+// Destroy removes the surface and frees its pixels.
+func (s *Surface) Destroy(ctx *kernel.Context) error {
+	err := s.send(ctx, proto.MsgSurfaceDestroy, proto.SurfaceDestroyPayload(s.id))
+	ctx.FreeRegion(s.region)
+	s.Pixels = nil
+	return err
+}
+
+func (s *Surface) send(ctx *kernel.Context, kind proto.Kind, payload []byte) error {
+	res := ctx.SendBlocking(s.compCap, uint16(kind), payload, kernel.Capability{}, sendTimeoutTicks)
+	if res != kernel.SendOK {
+		return fmt.Errorf("%s: %s", kind, res)
+	}
+	return nil
+}
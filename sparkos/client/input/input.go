@@ -0,0 +1,180 @@
+// Package input decodes keyboard input for apps: the key events of
+// MsgInputEvent and the VT100 bytes of MsgTermInput, and tracks which keys
+// are held, for games that move while a key is down.
+package input
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"spark/hal"
+	"spark/sparkos/proto"
+)
+
+// Event is a key press or release.
+type Event struct {
+	// Code is the key for non-text keys; text keys have KeyUnknown and Rune.
+	Code hal.KeyCode
+	Rune rune
+	Mods hal.Modifier
+	// Press is false for a release. Repeat marks a press repeated while the
+	// key is held.
+	Press  bool
+	Repeat bool
+	// Scancode is the keyboard's own code, 0 if unknown (always for Parse).
+	Scancode uint16
+}
+
+// Decode decodes a MsgInputEvent payload.
+func Decode(b []byte) (Event, bool) {
+	e, ok := proto.DecodeInputEventPayload(b)
+	if !ok {
+		return Event{}, false
+	}
+	return Event{
+		Code:     hal.KeyCode(e.Code),
+		Rune:     e.Rune,
+		Mods:     hal.Modifier(e.Mods),
+		Press:    e.Press,
+		Repeat:   e.Repeat,
+		Scancode: e.Scancode,
+	}, true
+}
+
+// Parse decodes the next key press from MsgTermInput bytes. It returns ok
+// false with n 0 when b ends inside a key; keep the rest and parse again
+// with more input. A lone ESC is reported as KeyEscape.
+//
+// Control bytes other than Enter, Tab and Backspace are reported as their
+// letter with ModCtrl (0x11 is Ctrl+Q).
+func Parse(b []byte) (n int, ev Event, ok bool) {
+	if len(b) == 0 {
+		return 0, Event{}, false
+	}
+	press := func(c hal.KeyCode) Event { return Event{Code: c, Press: true} }
+
+	switch c := b[0]; {
+	case c == 0x1b:
+		return parseEscape(b)
+	case c == '\r' || c == '\n':
+		return 1, press(hal.KeyEnter), true
+	case c == 0x7f || c == 0x08:
+		return 1, press(hal.KeyBackspace), true
+	case c == '\t':
+		return 1, press(hal.KeyTab), true
+	case c < 0x20:
+		return 1, Event{Rune: rune(c) + 'a' - 1, Mods: hal.ModCtrl, Press: true}, true
+	}
+
+	if !utf8.FullRune(b) {
+		return 0, Event{}, false
+	}
+	r, sz := utf8.DecodeRune(b)
+	if r == utf8.RuneError && sz == 1 {
+		return 1, Event{}, true
+	}
+	return sz, Event{Rune: r, Press: true}, true
+}
+
+// tildeKeys maps the number of an ESC [ n ~ sequence.
+var tildeKeys = map[int]hal.KeyCode{
+	1: hal.KeyHome, 2: hal.KeyInsert, 3: hal.KeyDelete, 4: hal.KeyEnd,
+	5: hal.KeyPageUp, 6: hal.KeyPageDown,
+	11: hal.KeyF1, 12: hal.KeyF2, 13: hal.KeyF3, 14: hal.KeyF4, 15: hal.KeyF5,
+	17: hal.KeyF6, 18: hal.KeyF7, 19: hal.KeyF8, 20: hal.KeyF9, 21: hal.KeyF10,
+	23: hal.KeyF11, 24: hal.KeyF12,
+}
+
+func parseEscape(b []byte) (int, Event, bool) {
+	esc := Event{Code: hal.KeyEscape, Press: true}
+	if len(b) < 2 || b[1] != '[' {
+		return 1, esc, true
+	}
+	if len(b) < 3 {
+		return 0, Event{}, false
+	}
+
+	var code hal.KeyCode
+	switch b[2] {
+	case 'A':
+		code = hal.KeyUp
+	case 'B':
+		code = hal.KeyDown
+	case 'C':
+		code = hal.KeyRight
+	case 'D':
+		code = hal.KeyLeft
+	case 'H':
+		code = hal.KeyHome
+	case 'F':
+		code = hal.KeyEnd
+	}
+	if code != hal.KeyUnknown {
+		return 3, Event{Code: code, Press: true}, true
+	}
+
+	num := 0
+	for i := 2; i < len(b) && i < 5; i++ {
+		switch c := b[i]; {
+		case c >= '0' && c <= '9':
+			num = num*10 + int(c-'0')
+		case c == '~' && i > 2:
+			if code, ok := tildeKeys[num]; ok {
+				return i + 1, Event{Code: code, Press: true}, true
+			}
+			return 1, esc, true
+		default:
+			return 1, esc, true
+		}
+	}
+	if len(b) < 5 {
+		return 0, Event{}, false
+	}
+	return 1, esc, true
+}
+
+// numKeys bounds the key codes State tracks.
+const numKeys = int(hal.KeyAlt) + 1
+
+// State tracks held keys from the events of MsgInputEvent.
+//
+// Releases that happen while the app is in the background go to another
+// app: call Reset when the app loses the focus.
+type State struct {
+	keys [numKeys]bool
+	// runes tracks ASCII text keys, folded to lower case.
+	runes [128]bool
+	mods  hal.Modifier
+}
+
+// Apply records ev.
+func (s *State) Apply(ev Event) {
+	s.mods = ev.Mods
+	switch {
+	case ev.Code != hal.KeyUnknown:
+		if int(ev.Code) < numKeys {
+			s.keys[ev.Code] = ev.Press
+		}
+	case ev.Rune != 0:
+		if r := unicode.ToLower(ev.Rune); r < rune(len(s.runes)) {
+			s.runes[r] = ev.Press
+		}
+	}
+}
+
+// Held reports whether the key is down.
+func (s *State) Held(c hal.KeyCode) bool {
+	return int(c) < numKeys && s.keys[c]
+}
+
+// HeldRune reports whether the text key of r is down, regardless of case.
+func (s *State) HeldRune(r rune) bool {
+	r = unicode.ToLower(r)
+	return r >= 0 && r < rune(len(s.runes)) && s.runes[r]
+}
+
+// Mods returns the modifiers of the last event.
+func (s *State) Mods() hal.Modifier { return s.mods }
+
+// Reset forgets every held key.
+func (s *State) Reset() { *s = State{} }
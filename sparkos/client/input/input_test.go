@@ -0,0 +1,65 @@
+package input
+
+import (
+	"testing"
+
+	"spark/hal"
+	"spark/sparkos/proto"
+)
+
+func TestParse(t *testing.T) {
+	in := []byte("a\x1b[A\x1b[21~\x1b[3~\x11\n\x1bx")
+	want := []Event{
+		{Rune: 'a', Press: true},
+		{Code: hal.KeyUp, Press: true},
+		{Code: hal.KeyF10, Press: true},
+		{Code: hal.KeyDelete, Press: true},
+		{Rune: 'q', Mods: hal.ModCtrl, Press: true},
+		{Code: hal.KeyEnter, Press: true},
+		{Code: hal.KeyEscape, Press: true},
+		{Rune: 'x', Press: true},
+	}
+	for i, w := range want {
+		n, ev, ok := Parse(in)
+		if !ok || ev != w {
+			t.Fatalf("key %d: got %+v (ok=%v), want %+v", i, ev, ok, w)
+		}
+		in = in[n:]
+	}
+	if len(in) != 0 {
+		t.Fatalf("%q left over", in)
+	}
+
+	for _, partial := range []string{"\x1b[", "\x1b[2", "\x1b[21", "\xd0"} {
+		if n, _, ok := Parse([]byte(partial)); ok || n != 0 {
+			t.Errorf("%q: expected to wait for more input, got n=%d ok=%v", partial, n, ok)
+		}
+	}
+}
+
+func TestStateTracksHeldKeys(t *testing.T) {
+	var s State
+	for _, e := range []proto.InputEvent{
+		{Code: uint16(hal.KeyLeft), Press: true},
+		{Rune: 'W', Mods: uint8(hal.ModShift), Press: true},
+		{Code: uint16(hal.KeyDown), Press: true},
+		{Code: uint16(hal.KeyDown)},
+	} {
+		ev, ok := Decode(proto.InputEventPayload(e))
+		if !ok {
+			t.Fatalf("decode %+v failed", e)
+		}
+		s.Apply(ev)
+	}
+	if !s.Held(hal.KeyLeft) || s.Held(hal.KeyDown) || !s.HeldRune('w') {
+		t.Fatalf("held left=%v down=%v w=%v", s.Held(hal.KeyLeft), s.Held(hal.KeyDown), s.HeldRune('w'))
+	}
+	s.Apply(Event{Rune: 'w', Mods: hal.ModShift})
+	if s.HeldRune('W') || s.Mods() != hal.ModShift {
+		t.Fatal("release of w did not release W")
+	}
+	s.Reset()
+	if s.Held(hal.KeyLeft) {
+		t.Fatal("Reset kept a held key")
+	}
+}
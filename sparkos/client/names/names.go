@@ -0,0 +1,81 @@
+package names
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+)
+
+const (
+	lookupTimeoutTicks   = 500
+	registerTimeoutTicks = 500
+)
+
+// ErrNotFound is returned by Lookup for names nobody has registered (yet).
+var ErrNotFound = errors.New("name not found")
+
+var nextRequestID uint32
+
+// Lookup resolves name to a send capability.
+func Lookup(ctx *kernel.Context, namesCap kernel.Capability, name string) (kernel.Capability, error) {
+	return LookupRights(ctx, namesCap, name, kernel.RightSend)
+}
+
+// LookupRights resolves name to a capability with at most rights.
+func LookupRights(ctx *kernel.Context, namesCap kernel.Capability, name string, rights kernel.Rights) (kernel.Capability, error) {
+	if ctx == nil {
+		return kernel.Capability{}, fmt.Errorf("names lookup %q: nil context", name)
+	}
+	if !namesCap.Valid() {
+		return kernel.Capability{}, fmt.Errorf("names lookup %q: no capability", name)
+	}
+
+	requestID := atomic.AddUint32(&nextRequestID, 1)
+	payload := proto.NameLookupPayload(requestID, uint8(rights), name)
+	msg, err := ctx.Call(namesCap, uint16(proto.MsgNameLookup), payload, lookupTimeoutTicks)
+	if err != nil {
+		return kernel.Capability{}, fmt.Errorf("names lookup %q: %w", name, err)
+	}
+
+	switch proto.Kind(msg.Kind) {
+	case proto.MsgNameLookupResp:
+		reqID, ok := proto.DecodeNameLookupRespPayload(msg.Payload())
+		if !ok || reqID != requestID || !msg.Cap.Valid() {
+			return kernel.Capability{}, fmt.Errorf("names lookup %q: bad reply", name)
+		}
+		return msg.Cap, nil
+
+	case proto.MsgError:
+		code, _, _, ok := proto.DecodeErrorPayload(msg.Payload())
+		if !ok {
+			return kernel.Capability{}, fmt.Errorf("names lookup %q: bad error payload", name)
+		}
+		if code == proto.ErrNotFound {
+			return kernel.Capability{}, fmt.Errorf("names lookup %q: %w", name, ErrNotFound)
+		}
+		return kernel.Capability{}, fmt.Errorf("names lookup %q: %s", name, code)
+
+	default:
+		return kernel.Capability{}, fmt.Errorf("names lookup %q: unexpected reply %s", name, proto.Kind(msg.Kind))
+	}
+}
+
+// Register publishes c under name. Registration is one-way: the name service
+// drops names the caller may not publish without telling it, and other
+// clients may see the name only a moment later.
+func Register(ctx *kernel.Context, namesCap kernel.Capability, name string, c kernel.Capability) error {
+	if ctx == nil {
+		return fmt.Errorf("names register %q: nil context", name)
+	}
+	if len(name) == 0 || len(name) > proto.MaxNameBytes {
+		return fmt.Errorf("names register %q: bad name", name)
+	}
+	res := ctx.SendBlocking(namesCap, uint16(proto.MsgNameRegister), proto.NameRegisterPayload(name), c, registerTimeoutTicks)
+	if res != kernel.SendOK {
+		return fmt.Errorf("names register %q: %s", name, res)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+// Package notify posts toasts to the notification service and reads its
+// history.
+package notify
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+)
+
+const (
+	sendTimeoutTicks = 100
+	listTimeoutTicks = 500
+)
+
+var nextRequestID uint32
+
+// Entry is a notification from the history.
+type Entry struct {
+	Severity proto.Severity
+	Tick     uint32
+	Text     string
+}
+
+// Post shows text as a toast for timeoutTicks (0 = the service default).
+func Post(ctx *kernel.Context, notifyCap kernel.Capability, sev proto.Severity, timeoutTicks uint16, text string) error {
+	return send(ctx, notifyCap, proto.MsgNotify, proto.NotifyPayload(sev, timeoutTicks, text))
+}
+
+// SetUser shows name as the logged-in user in the status bar.
+func SetUser(ctx *kernel.Context, notifyCap kernel.Capability, name string) error {
+	return send(ctx, notifyCap, proto.MsgNotifyUser, proto.NotifyUserPayload(name))
+}
+
+// List returns the notification history, newest first, and marks it read.
+func List(ctx *kernel.Context, notifyCap kernel.Capability) ([]Entry, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("notify list: nil context")
+	}
+	if !notifyCap.Valid() {
+		return nil, fmt.Errorf("notify list: no capability")
+	}
+	var out []Entry
+	for i := 0; ; i++ {
+		requestID := atomic.AddUint32(&nextRequestID, 1)
+		msg, err := ctx.Call(notifyCap, uint16(proto.MsgNotifyList), proto.NotifyListPayload(requestID, uint8(i)), listTimeoutTicks)
+		if err != nil {
+			return nil, fmt.Errorf("notify list: %w", err)
+		}
+		if proto.Kind(msg.Kind) != proto.MsgNotifyListResp {
+			return nil, fmt.Errorf("notify list: unexpected reply %s", proto.Kind(msg.Kind))
+		}
+		gotID, total, sev, tick, text, ok := proto.DecodeNotifyListRespPayload(msg.Payload())
+		if !ok || gotID != requestID {
+			return nil, fmt.Errorf("notify list: bad reply")
+		}
+		if i >= int(total) {
+			return out, nil
+		}
+		out = append(out, Entry{Severity: sev, Tick: tick, Text: text})
+	}
+}
+
+func send(ctx *kernel.Context, notifyCap kernel.Capability, kind proto.Kind, payload []byte) error {
+	if ctx == nil {
+		return fmt.Errorf("notify %s: nil context", kind)
+	}
+	if !notifyCap.Valid() {
+		return fmt.Errorf("notify %s: no capability", kind)
+	}
+	if res := ctx.SendBlocking(notifyCap, uint16(kind), payload, kernel.Capability{}, sendTimeoutTicks); res != kernel.SendOK {
+		return fmt.Errorf("notify %s: %s", kind, res)
+	}
+	return nil
+}
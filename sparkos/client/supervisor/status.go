@@ -0,0 +1,63 @@
+package supervisor
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+)
+
+const statusTimeoutTicks = 500
+
+var nextRequestID uint32
+
+// List returns the status of every supervised service, in table order.
+func List(ctx *kernel.Context, supCap kernel.Capability) ([]proto.SvcStatus, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("supervisor status: nil context")
+	}
+	if !supCap.Valid() {
+		return nil, fmt.Errorf("supervisor status: no capability")
+	}
+
+	var out []proto.SvcStatus
+	for index := 0; ; index++ {
+		st, err := status(ctx, supCap, uint8(index))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, st)
+		if int(st.Total) <= index+1 {
+			return out, nil
+		}
+	}
+}
+
+func status(ctx *kernel.Context, supCap kernel.Capability, index uint8) (proto.SvcStatus, error) {
+	requestID := atomic.AddUint32(&nextRequestID, 1)
+	payload := proto.SvcStatusPayload(requestID, index)
+	msg, err := ctx.Call(supCap, uint16(proto.MsgSvcStatus), payload, statusTimeoutTicks)
+	if err != nil {
+		return proto.SvcStatus{}, fmt.Errorf("supervisor status: %w", err)
+	}
+
+	switch proto.Kind(msg.Kind) {
+	case proto.MsgSvcStatusResp:
+		reqID, st, ok := proto.DecodeSvcStatusRespPayload(msg.Payload())
+		if !ok || reqID != requestID || st.Index != index {
+			return proto.SvcStatus{}, fmt.Errorf("supervisor status resp: bad payload")
+		}
+		return st, nil
+
+	case proto.MsgError:
+		code, ref, _, ok := proto.DecodeErrorPayload(msg.Payload())
+		if !ok {
+			return proto.SvcStatus{}, fmt.Errorf("supervisor status error: bad payload")
+		}
+		return proto.SvcStatus{}, fmt.Errorf("supervisor status error: code=%s ref=%s", code, ref)
+
+	default:
+		return proto.SvcStatus{}, fmt.Errorf("supervisor status: unexpected reply %s", proto.Kind(msg.Kind))
+	}
+}
@@ -2,19 +2,17 @@ package time
 
 import (
 	"fmt"
-	"sync"
+	"sync/atomic"
 
 	"spark/sparkos/kernel"
 	"spark/sparkos/proto"
 )
 
-type sleepState struct {
-	mu       sync.Mutex
-	replyCap kernel.Capability
-	nextID   uint32
-}
+// sendSlackTicks bounds how long Sleep waits beyond dt for the time service
+// to accept the request and reply.
+const sendSlackTicks = 500
 
-var sleepStates [256]sleepState
+var nextRequestID uint32
 
 // Sleep requests a wakeup after dt ticks via the time service.
 func Sleep(ctx *kernel.Context, timeCap kernel.Capability, dt uint32) error {
@@ -22,71 +20,29 @@ func Sleep(ctx *kernel.Context, timeCap kernel.Capability, dt uint32) error {
 		return fmt.Errorf("time sleep: nil context")
 	}
 
-	st := &sleepStates[ctx.TaskID()]
-	st.mu.Lock()
-	defer st.mu.Unlock()
-	if !st.replyCap.Valid() {
-		st.replyCap = ctx.NewEndpoint(kernel.RightSend | kernel.RightRecv)
-		if !st.replyCap.Valid() {
-			return fmt.Errorf("time sleep: allocate reply endpoint")
-		}
-	}
-
-	replySend := st.replyCap.Restrict(kernel.RightSend)
-	replyRecv := st.replyCap.Restrict(kernel.RightRecv)
-	if !replySend.Valid() || !replyRecv.Valid() {
-		return fmt.Errorf("time sleep: invalid reply capability")
-	}
-
-	st.nextID++
-	if st.nextID == 0 {
-		st.nextID++
-	}
-	requestID := st.nextID
-
+	requestID := atomic.AddUint32(&nextRequestID, 1)
 	payload := proto.SleepPayload(requestID, dt)
-	res := ctx.SendToCapRetry(timeCap, uint16(proto.MsgSleep), payload, replySend, 500)
-	switch res {
-	case kernel.SendOK:
-		goto waitReply
-	case kernel.SendErrQueueFull:
-		return fmt.Errorf("time sleep send: queue full")
-	default:
-		return fmt.Errorf("time sleep send: %s", res)
+	msg, err := ctx.Call(timeCap, uint16(proto.MsgSleep), payload, uint64(dt)+sendSlackTicks)
+	if err != nil {
+		return fmt.Errorf("time sleep: %w", err)
 	}
 
-waitReply:
-	for {
-		msg, ok := ctx.Recv(replyRecv)
-		if !ok {
-			return fmt.Errorf("time sleep: recv")
+	switch proto.Kind(msg.Kind) {
+	case proto.MsgWake:
+		reqID, ok := proto.DecodeWakePayload(msg.Payload())
+		if !ok || reqID != requestID {
+			return fmt.Errorf("time wake: bad payload")
 		}
+		return nil
 
-		switch proto.Kind(msg.Kind) {
-		case proto.MsgWake:
-			reqID, ok := proto.DecodeWakePayload(msg.Payload())
-			if !ok {
-				return fmt.Errorf("time wake: bad payload")
-			}
-			if reqID != requestID {
-				continue
-			}
-			return nil
-
-		case proto.MsgError:
-			code, ref, detail, ok := proto.DecodeErrorPayload(msg.Payload())
-			if !ok {
-				return fmt.Errorf("time error: bad payload")
-			}
-
-			if reqID, _, ok := proto.DecodeErrorDetailWithRequestID(detail); ok && reqID != requestID {
-				continue
-			}
-
-			return fmt.Errorf("time error: code=%s ref=%s", code, ref)
-
-		default:
-			continue
+	case proto.MsgError:
+		code, ref, _, ok := proto.DecodeErrorPayload(msg.Payload())
+		if !ok {
+			return fmt.Errorf("time error: bad payload")
 		}
+		return fmt.Errorf("time error: code=%s ref=%s", code, ref)
+
+	default:
+		return fmt.Errorf("time sleep: unexpected reply %s", proto.Kind(msg.Kind))
 	}
 }
@@ -3,7 +3,12 @@ package vfs
 import (
 	"errors"
 	"fmt"
+	"io"
+	"os"
+	pathpkg "path"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"spark/sparkos/kernel"
 	"spark/sparkos/proto"
@@ -14,8 +19,43 @@ type Entry struct {
 	Name string
 	Type proto.VFSEntryType
 	Size uint32
+	// Mtime and Ctime are the times of the last change of the contents and
+	// of the creation; zero when the filesystem does not keep them.
+	Mtime time.Time
+	Ctime time.Time
+	UID   uint32
+	GID   uint32
+	// Mode holds the permission bits (0o777) and the sticky bit (0o1000).
+	Mode uint16
 }
 
+func newEntry(name string, typ proto.VFSEntryType, size uint32, meta proto.VFSMeta) Entry {
+	e := Entry{Name: name, Type: typ, Size: size, UID: meta.UID, GID: meta.GID, Mode: meta.Mode}
+	if meta.Mtime != 0 {
+		e.Mtime = time.Unix(meta.Mtime, 0)
+	}
+	if meta.Ctime != 0 {
+		e.Ctime = time.Unix(meta.Ctime, 0)
+	}
+	return e
+}
+
+// callTimeoutTicks bounds single-reply requests. Streaming requests (List,
+// Copy, Write) use the client's persistent reply endpoint and wait for as long
+// as the service keeps them going.
+const callTimeoutTicks = 10_000
+
+const (
+	// sharedBytes is the size of the region a client allocates for bulk
+	// transfers (MsgVFSReadShared, MsgVFSWriteShared).
+	sharedBytes = 4096
+	// inlineReadMax is the largest read that fits in a MsgVFSReadResp.
+	inlineReadMax = kernel.MaxMessageBytes - 11
+	// fileInlineMax is the largest chunk of a MsgVFSFileWrite, and a little
+	// less than what fits in a MsgVFSFileReadResp.
+	fileInlineMax = kernel.MaxMessageBytes - 12
+)
+
 type Client struct {
 	vfsCap kernel.Capability
 
@@ -25,6 +65,9 @@ type Client struct {
 
 	nextRequestID uint32
 	opMu          sync.Mutex
+
+	shared   kernel.Capability
+	sharedMu sync.Mutex
 }
 
 type Writer struct {
@@ -34,10 +77,13 @@ type Writer struct {
 	requestID uint32
 	locked    bool
 	closed    bool
+	// err is set when a shared chunk failed: the service has already dropped
+	// the session, so Close must not wait for its reply.
+	err error
 }
 
 func New(vfsCap kernel.Capability) *Client {
-	return &Client{vfsCap: vfsCap, nextRequestID: 1}
+	return &Client{vfsCap: vfsCap}
 }
 
 func (c *Client) ensureReply(ctx *kernel.Context) error {
@@ -65,12 +111,48 @@ func (c *Client) ensureReply(ctx *kernel.Context) error {
 }
 
 func (c *Client) nextID() uint32 {
-	id := c.nextRequestID
-	c.nextRequestID++
-	if c.nextRequestID == 0 {
-		c.nextRequestID = 1
+	for {
+		if id := atomic.AddUint32(&c.nextRequestID, 1); id != 0 {
+			return id
+		}
+	}
+}
+
+// call performs a single-reply request via kernel.Context.CallGrant.
+//
+// Each call gets its own one-shot reply endpoint, so it does not take opMu
+// and never sees replies meant for other requests.
+func (c *Client) call(
+	ctx *kernel.Context,
+	op string,
+	kind proto.Kind,
+	payload []byte,
+	grant kernel.Capability,
+	respKind proto.Kind,
+) (kernel.Message, error) {
+	if ctx == nil {
+		return kernel.Message{}, errors.New("vfs client: nil context")
+	}
+
+	msg, err := ctx.CallGrant(c.vfsCap, uint16(kind), payload, grant, callTimeoutTicks)
+	if err != nil {
+		return kernel.Message{}, fmt.Errorf("vfs %s: %w", op, err)
+	}
+	switch proto.Kind(msg.Kind) {
+	case respKind:
+		return msg, nil
+	case proto.MsgError:
+		code, _, detail, ok := proto.DecodeErrorPayload(msg.Payload())
+		if !ok {
+			return kernel.Message{}, fmt.Errorf("vfs %s: bad error payload", op)
+		}
+		if _, rest, ok := proto.DecodeErrorDetailWithRequestID(detail); ok {
+			detail = rest
+		}
+		return kernel.Message{}, fmt.Errorf("vfs %s: %s: %s", op, code, string(detail))
+	default:
+		return kernel.Message{}, fmt.Errorf("vfs %s: unexpected reply %s", op, proto.Kind(msg.Kind))
 	}
-	return id
 }
 
 func (c *Client) send(ctx *kernel.Context, kind proto.Kind, payload []byte) error {
@@ -133,130 +215,95 @@ func (c *Client) List(ctx *kernel.Context, path string) ([]Entry, error) {
 			}
 			return nil, fmt.Errorf("vfs list: %s: %s", code, string(rest))
 		case proto.MsgVFSListResp:
-			gotID, done, typ, size, name, ok := proto.DecodeVFSListRespPayload(msg.Payload())
+			gotID, done, typ, size, meta, name, ok := proto.DecodeVFSListRespPayload(msg.Payload())
 			if !ok || gotID != reqID {
 				continue
 			}
 			if done {
 				return out, nil
 			}
-			out = append(out, Entry{Name: name, Type: typ, Size: size})
+			out = append(out, newEntry(name, typ, size, meta))
 		}
 	}
 }
 
 func (c *Client) Mkdir(ctx *kernel.Context, path string) error {
-	c.opMu.Lock()
-	defer c.opMu.Unlock()
-	if err := c.ensureReply(ctx); err != nil {
+	reqID := c.nextID()
+	msg, err := c.call(ctx, "mkdir", proto.MsgVFSMkdir, proto.VFSMkdirPayload(reqID, path), kernel.Capability{}, proto.MsgVFSMkdirResp)
+	if err != nil {
 		return err
 	}
+	if gotID, ok := proto.DecodeVFSMkdirRespPayload(msg.Payload()); !ok || gotID != reqID {
+		return errors.New("vfs mkdir: bad reply")
+	}
+	return nil
+}
 
+// Chmod sets the permission and sticky bits (0o1777) of path. Only the owner and admins
+// may change them.
+func (c *Client) Chmod(ctx *kernel.Context, path string, mode uint16) error {
 	reqID := c.nextID()
-	if err := c.send(ctx, proto.MsgVFSMkdir, proto.VFSMkdirPayload(reqID, path)); err != nil {
+	msg, err := c.call(ctx, "chmod", proto.MsgVFSChmod, proto.VFSChmodPayload(reqID, mode, path), kernel.Capability{}, proto.MsgVFSChmodResp)
+	if err != nil {
 		return err
 	}
-
-	for {
-		msg, err := c.recv("mkdir")
-		if err != nil {
-			return err
-		}
-		switch proto.Kind(msg.Kind) {
-		case proto.MsgError:
-			code, ref, detail, ok := proto.DecodeErrorPayload(msg.Payload())
-			if !ok || ref != proto.MsgVFSMkdir {
-				continue
-			}
-			gotID, rest, ok := proto.DecodeErrorDetailWithRequestID(detail)
-			if !ok || gotID != reqID {
-				continue
-			}
-			return fmt.Errorf("vfs mkdir: %s: %s", code, string(rest))
-		case proto.MsgVFSMkdirResp:
-			gotID, ok := proto.DecodeVFSMkdirRespPayload(msg.Payload())
-			if !ok || gotID != reqID {
-				continue
-			}
-			return nil
-		}
+	if gotID, ok := proto.DecodeVFSAttrRespPayload(msg.Payload()); !ok || gotID != reqID {
+		return errors.New("vfs chmod: bad reply")
 	}
+	return nil
 }
 
-func (c *Client) Remove(ctx *kernel.Context, path string) error {
-	c.opMu.Lock()
-	defer c.opMu.Unlock()
-	if err := c.ensureReply(ctx); err != nil {
+// Chown sets the owner and group of path. Only admins may change them.
+func (c *Client) Chown(ctx *kernel.Context, path string, uid, gid uint32) error {
+	reqID := c.nextID()
+	msg, err := c.call(ctx, "chown", proto.MsgVFSChown, proto.VFSChownPayload(reqID, uid, gid, path), kernel.Capability{}, proto.MsgVFSChownResp)
+	if err != nil {
 		return err
 	}
+	if gotID, ok := proto.DecodeVFSAttrRespPayload(msg.Payload()); !ok || gotID != reqID {
+		return errors.New("vfs chown: bad reply")
+	}
+	return nil
+}
 
+// IssueCred asks the VFS auth endpoint for a credential: a VFS endpoint whose
+// requests are checked against cred. Pass it to New. The credential lives as
+// long as the VFS task.
+func IssueCred(ctx *kernel.Context, authCap kernel.Capability, cred proto.VFSCred) (kernel.Capability, error) {
+	c := New(authCap)
 	reqID := c.nextID()
-	if err := c.send(ctx, proto.MsgVFSRemove, proto.VFSRemovePayload(reqID, path)); err != nil {
-		return err
+	msg, err := c.call(ctx, "cred issue", proto.MsgVFSCredIssue, proto.VFSCredIssuePayload(reqID, cred), kernel.Capability{}, proto.MsgVFSCredIssueResp)
+	if err != nil {
+		return kernel.Capability{}, err
 	}
-
-	for {
-		msg, err := c.recv("remove")
-		if err != nil {
-			return err
-		}
-		switch proto.Kind(msg.Kind) {
-		case proto.MsgError:
-			code, ref, detail, ok := proto.DecodeErrorPayload(msg.Payload())
-			if !ok || ref != proto.MsgVFSRemove {
-				continue
-			}
-			gotID, rest, ok := proto.DecodeErrorDetailWithRequestID(detail)
-			if !ok || gotID != reqID {
-				continue
-			}
-			return fmt.Errorf("vfs remove: %s: %s", code, string(rest))
-		case proto.MsgVFSRemoveResp:
-			gotID, ok := proto.DecodeVFSRemoveRespPayload(msg.Payload())
-			if !ok || gotID != reqID {
-				continue
-			}
-			return nil
-		}
+	if gotID, ok := proto.DecodeVFSCredIssueRespPayload(msg.Payload()); !ok || gotID != reqID || !msg.Cap.Valid() {
+		return kernel.Capability{}, errors.New("vfs cred issue: bad reply")
 	}
+	return msg.Cap, nil
 }
 
-func (c *Client) Rename(ctx *kernel.Context, oldPath, newPath string) error {
-	c.opMu.Lock()
-	defer c.opMu.Unlock()
-	if err := c.ensureReply(ctx); err != nil {
+func (c *Client) Remove(ctx *kernel.Context, path string) error {
+	reqID := c.nextID()
+	msg, err := c.call(ctx, "remove", proto.MsgVFSRemove, proto.VFSRemovePayload(reqID, path), kernel.Capability{}, proto.MsgVFSRemoveResp)
+	if err != nil {
 		return err
 	}
+	if gotID, ok := proto.DecodeVFSRemoveRespPayload(msg.Payload()); !ok || gotID != reqID {
+		return errors.New("vfs remove: bad reply")
+	}
+	return nil
+}
 
+func (c *Client) Rename(ctx *kernel.Context, oldPath, newPath string) error {
 	reqID := c.nextID()
-	if err := c.send(ctx, proto.MsgVFSRename, proto.VFSRenamePayload(reqID, oldPath, newPath)); err != nil {
+	msg, err := c.call(ctx, "rename", proto.MsgVFSRename, proto.VFSRenamePayload(reqID, oldPath, newPath), kernel.Capability{}, proto.MsgVFSRenameResp)
+	if err != nil {
 		return err
 	}
-
-	for {
-		msg, err := c.recv("rename")
-		if err != nil {
-			return err
-		}
-		switch proto.Kind(msg.Kind) {
-		case proto.MsgError:
-			code, ref, detail, ok := proto.DecodeErrorPayload(msg.Payload())
-			if !ok || ref != proto.MsgVFSRename {
-				continue
-			}
-			gotID, rest, ok := proto.DecodeErrorDetailWithRequestID(detail)
-			if !ok || gotID != reqID {
-				continue
-			}
-			return fmt.Errorf("vfs rename: %s: %s", code, string(rest))
-		case proto.MsgVFSRenameResp:
-			gotID, ok := proto.DecodeVFSRenameRespPayload(msg.Payload())
-			if !ok || gotID != reqID {
-				continue
-			}
-			return nil
-		}
+	if gotID, ok := proto.DecodeVFSRenameRespPayload(msg.Payload()); !ok || gotID != reqID {
+		return errors.New("vfs rename: bad reply")
 	}
+	return nil
 }
 
 func (c *Client) Copy(ctx *kernel.Context, srcPath, dstPath string) error {
@@ -299,82 +346,173 @@ func (c *Client) Copy(ctx *kernel.Context, srcPath, dstPath string) error {
 	}
 }
 
-func (c *Client) Stat(ctx *kernel.Context, path string) (proto.VFSEntryType, uint32, error) {
+// Mount attaches the filesystem named source ("flash", "sd") at path.
+func (c *Client) Mount(ctx *kernel.Context, source, path string) error {
+	reqID := c.nextID()
+	msg, err := c.call(ctx, "mount", proto.MsgVFSMount, proto.VFSMountPayload(reqID, source, path), kernel.Capability{}, proto.MsgVFSMountResp)
+	if err != nil {
+		return err
+	}
+	if gotID, ok := proto.DecodeVFSMountRespPayload(msg.Payload()); !ok || gotID != reqID {
+		return errors.New("vfs mount: bad reply")
+	}
+	return nil
+}
+
+// Unmount detaches the filesystem mounted at path.
+func (c *Client) Unmount(ctx *kernel.Context, path string) error {
+	reqID := c.nextID()
+	msg, err := c.call(ctx, "unmount", proto.MsgVFSUnmount, proto.VFSUnmountPayload(reqID, path), kernel.Capability{}, proto.MsgVFSUnmountResp)
+	if err != nil {
+		return err
+	}
+	if gotID, ok := proto.DecodeVFSUnmountRespPayload(msg.Payload()); !ok || gotID != reqID {
+		return errors.New("vfs unmount: bad reply")
+	}
+	return nil
+}
+
+// Mounts returns the mount table, sorted by path.
+func (c *Client) Mounts(ctx *kernel.Context) ([]proto.VFSMountInfo, error) {
 	c.opMu.Lock()
 	defer c.opMu.Unlock()
 	if err := c.ensureReply(ctx); err != nil {
-		return 0, 0, err
+		return nil, err
 	}
 
 	reqID := c.nextID()
-	if err := c.send(ctx, proto.MsgVFSStat, proto.VFSStatPayload(reqID, path)); err != nil {
-		return 0, 0, err
+	if err := c.send(ctx, proto.MsgVFSMounts, proto.VFSMountsPayload(reqID)); err != nil {
+		return nil, err
 	}
 
+	var out []proto.VFSMountInfo
 	for {
-		msg, err := c.recv("stat")
+		msg, err := c.recv("mounts")
 		if err != nil {
-			return 0, 0, err
+			return nil, err
 		}
 		switch proto.Kind(msg.Kind) {
 		case proto.MsgError:
 			code, ref, detail, ok := proto.DecodeErrorPayload(msg.Payload())
-			if !ok || ref != proto.MsgVFSStat {
+			if !ok || ref != proto.MsgVFSMounts {
 				continue
 			}
 			gotID, rest, ok := proto.DecodeErrorDetailWithRequestID(detail)
 			if !ok || gotID != reqID {
 				continue
 			}
-			return 0, 0, fmt.Errorf("vfs stat: %s: %s", code, string(rest))
-		case proto.MsgVFSStatResp:
-			gotID, typ, size, ok := proto.DecodeVFSStatRespPayload(msg.Payload())
+			return nil, fmt.Errorf("vfs mounts: %s: %s", code, string(rest))
+		case proto.MsgVFSMountsResp:
+			gotID, done, m, ok := proto.DecodeVFSMountsRespPayload(msg.Payload())
 			if !ok || gotID != reqID {
 				continue
 			}
-			return typ, size, nil
+			if done {
+				return out, nil
+			}
+			out = append(out, m)
 		}
 	}
 }
 
-func (c *Client) ReadAt(ctx *kernel.Context, path string, off uint32, maxBytes uint16) ([]byte, bool, error) {
-	c.opMu.Lock()
-	defer c.opMu.Unlock()
-	if err := c.ensureReply(ctx); err != nil {
-		return nil, false, err
-	}
+func (c *Client) Stat(ctx *kernel.Context, path string) (proto.VFSEntryType, uint32, error) {
+	e, err := c.StatEntry(ctx, path)
+	return e.Type, e.Size, err
+}
 
+// StatEntry returns the type, size, timestamps and owner of path. The Name of
+// the entry is the last element of path.
+func (c *Client) StatEntry(ctx *kernel.Context, path string) (Entry, error) {
 	reqID := c.nextID()
-	if err := c.send(ctx, proto.MsgVFSRead, proto.VFSReadPayload(reqID, path, off, maxBytes)); err != nil {
+	msg, err := c.call(ctx, "stat", proto.MsgVFSStat, proto.VFSStatPayload(reqID, path), kernel.Capability{}, proto.MsgVFSStatResp)
+	if err != nil {
+		return Entry{}, err
+	}
+	gotID, typ, size, meta, ok := proto.DecodeVFSStatRespPayload(msg.Payload())
+	if !ok || gotID != reqID {
+		return Entry{}, errors.New("vfs stat: bad reply")
+	}
+	return newEntry(pathpkg.Base(path), typ, size, meta), nil
+}
+
+// ReadAt reads up to maxBytes at off. Reads larger than one message go
+// through the client's shared region.
+func (c *Client) ReadAt(ctx *kernel.Context, path string, off uint32, maxBytes uint16) ([]byte, bool, error) {
+	if int(maxBytes) <= inlineReadMax {
+		return c.readInline(ctx, path, off, maxBytes)
+	}
+	n := int(maxBytes)
+	if n > sharedBytes {
+		n = sharedBytes
+	}
+	buf := make([]byte, n)
+	n, eof, err := c.ReadInto(ctx, path, off, buf)
+	if err != nil {
 		return nil, false, err
 	}
+	return buf[:n], eof, nil
+}
 
-	for {
-		msg, err := c.recv("read")
-		if err != nil {
-			return nil, false, err
-		}
-		switch proto.Kind(msg.Kind) {
-		case proto.MsgError:
-			code, ref, detail, ok := proto.DecodeErrorPayload(msg.Payload())
-			if !ok || ref != proto.MsgVFSRead {
-				continue
+// ReadInto reads up to len(dst) bytes at off into dst without allocating a
+// result slice. Reads larger than one message go through the client's shared
+// region; if none can be allocated, ReadInto falls back to a single message.
+func (c *Client) ReadInto(ctx *kernel.Context, path string, off uint32, dst []byte) (int, bool, error) {
+	if len(dst) > inlineReadMax {
+		c.sharedMu.Lock()
+		defer c.sharedMu.Unlock()
+		if buf, ok := c.sharedBufLocked(ctx); ok {
+			if len(dst) < len(buf) {
+				buf = buf[:len(dst)]
 			}
-			gotID, rest, ok := proto.DecodeErrorDetailWithRequestID(detail)
-			if !ok || gotID != reqID {
-				continue
+			reqID := c.nextID()
+			payload := proto.VFSReadPayload(reqID, path, off, uint16(len(buf)))
+			msg, err := c.call(ctx, "read", proto.MsgVFSReadShared, payload, c.shared.Restrict(kernel.RightWrite), proto.MsgVFSReadSharedResp)
+			if err != nil {
+				return 0, false, err
 			}
-			return nil, false, fmt.Errorf("vfs read: %s: %s", code, string(rest))
-		case proto.MsgVFSReadResp:
-			gotID, gotOff, eof, data, ok := proto.DecodeVFSReadRespPayload(msg.Payload())
-			if !ok || gotID != reqID || gotOff != off {
-				continue
+			gotID, gotOff, eof, n, ok := proto.DecodeVFSReadSharedRespPayload(msg.Payload())
+			if !ok || gotID != reqID || gotOff != off || int(n) > len(buf) {
+				return 0, false, errors.New("vfs read: bad reply")
 			}
-			out := make([]byte, len(data))
-			copy(out, data)
-			return out, eof, nil
+			return copy(dst, buf[:n]), eof, nil
 		}
 	}
+
+	want := len(dst)
+	if want > inlineReadMax {
+		want = inlineReadMax
+	}
+	data, eof, err := c.readInline(ctx, path, off, uint16(want))
+	if err != nil {
+		return 0, false, err
+	}
+	return copy(dst, data), eof, nil
+}
+
+func (c *Client) readInline(ctx *kernel.Context, path string, off uint32, maxBytes uint16) ([]byte, bool, error) {
+	reqID := c.nextID()
+	msg, err := c.call(ctx, "read", proto.MsgVFSRead, proto.VFSReadPayload(reqID, path, off, maxBytes), kernel.Capability{}, proto.MsgVFSReadResp)
+	if err != nil {
+		return nil, false, err
+	}
+	gotID, gotOff, eof, data, ok := proto.DecodeVFSReadRespPayload(msg.Payload())
+	if !ok || gotID != reqID || gotOff != off {
+		return nil, false, errors.New("vfs read: bad reply")
+	}
+	out := make([]byte, len(data))
+	copy(out, data)
+	return out, eof, nil
+}
+
+// sharedBufLocked maps the client's bulk-transfer region, allocating it on
+// first use (or after the owning task exited). c.sharedMu must be held.
+func (c *Client) sharedBufLocked(ctx *kernel.Context) ([]byte, bool) {
+	const rw = kernel.RightRead | kernel.RightWrite
+	if buf, ok := ctx.MapRegion(c.shared, rw); ok {
+		return buf, true
+	}
+	c.shared = ctx.NewRegion(sharedBytes)
+	return ctx.MapRegion(c.shared, rw)
 }
 
 func (c *Client) Write(ctx *kernel.Context, path string, mode proto.VFSWriteMode, data []byte) (uint32, error) {
@@ -441,11 +579,20 @@ func (w *Writer) Write(p []byte) (int, error) {
 	if w.closed {
 		return 0, errors.New("vfs write: writer is closed")
 	}
+	if w.err != nil {
+		return 0, w.err
+	}
 	if len(p) == 0 {
 		return 0, nil
 	}
 
 	maxChunk := kernel.MaxMessageBytes - 6
+	if len(p) > maxChunk {
+		if n, ok, err := w.writeShared(p); ok {
+			return n, err
+		}
+	}
+
 	written := 0
 	for len(p) > 0 {
 		chunk := p
@@ -461,6 +608,38 @@ func (w *Writer) Write(p []byte) (int, error) {
 	return written, nil
 }
 
+// writeShared sends p through the client's shared region. It reports ok=false
+// if no region is available.
+func (w *Writer) writeShared(p []byte) (written int, ok bool, err error) {
+	c := w.client
+	c.sharedMu.Lock()
+	defer c.sharedMu.Unlock()
+	buf, ok := c.sharedBufLocked(w.ctx)
+	if !ok {
+		return 0, false, nil
+	}
+
+	grant := c.shared.Restrict(kernel.RightRead)
+	for len(p) > 0 {
+		n := copy(buf, p)
+		payload := proto.VFSWriteSharedPayload(w.requestID, uint32(n))
+		msg, err := c.call(w.ctx, "write", proto.MsgVFSWriteShared, payload, grant, proto.MsgVFSWriteResp)
+		if err == nil {
+			gotID, done, got, ok := proto.DecodeVFSWriteRespPayload(msg.Payload())
+			if !ok || gotID != w.requestID || done || got != uint32(n) {
+				err = errors.New("vfs write: bad reply")
+			}
+		}
+		if err != nil {
+			w.err = err
+			return written, true, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, true, nil
+}
+
 func (w *Writer) Close() (uint32, error) {
 	if w.closed {
 		return 0, nil
@@ -470,6 +649,9 @@ func (w *Writer) Close() (uint32, error) {
 		defer w.client.opMu.Unlock()
 		w.locked = false
 	}
+	if w.err != nil {
+		return 0, w.err
+	}
 	if err := w.client.send(w.ctx, proto.MsgVFSWriteClose, proto.VFSWriteClosePayload(w.requestID)); err != nil {
 		return 0, err
 	}
@@ -499,3 +681,212 @@ func (w *Writer) Close() (uint32, error) {
 		}
 	}
 }
+
+// File is a file opened with Client.Open. It implements io.ReadWriteSeeker
+// and io.Closer; the service keeps the file open until Close, or until the
+// task that opened it exits.
+//
+// A File must be used by one goroutine at a time.
+type File struct {
+	client *Client
+	ctx    *kernel.Context
+	handle uint32
+	closed bool
+}
+
+// Open opens path and returns a handle for Read, Write, Seek and Close. The
+// handle belongs to the client's reply endpoint, so it is released when the
+// task exits even if Close is never called.
+func (c *Client) Open(ctx *kernel.Context, path string, flags proto.VFSOpenFlag) (*File, error) {
+	c.opMu.Lock()
+	defer c.opMu.Unlock()
+	if err := c.ensureReply(ctx); err != nil {
+		return nil, err
+	}
+
+	reqID := c.nextID()
+	if err := c.send(ctx, proto.MsgVFSOpen, proto.VFSOpenPayload(reqID, flags, path)); err != nil {
+		return nil, err
+	}
+
+	for {
+		msg, err := c.recv("open")
+		if err != nil {
+			return nil, err
+		}
+		switch proto.Kind(msg.Kind) {
+		case proto.MsgError:
+			code, ref, detail, ok := proto.DecodeErrorPayload(msg.Payload())
+			if !ok || ref != proto.MsgVFSOpen {
+				continue
+			}
+			gotID, rest, ok := proto.DecodeErrorDetailWithRequestID(detail)
+			if !ok || gotID != reqID {
+				continue
+			}
+			return nil, fmt.Errorf("vfs open: %s: %s", code, string(rest))
+		case proto.MsgVFSOpenResp:
+			gotID, handle, ok := proto.DecodeVFSOpenRespPayload(msg.Payload())
+			if !ok || gotID != reqID {
+				continue
+			}
+			return &File{client: c, ctx: ctx, handle: handle}, nil
+		}
+	}
+}
+
+// fileCall performs a single-reply request on the file's handle.
+func (f *File) fileCall(op string, kind proto.Kind, payload []byte, grant kernel.Capability, respKind proto.Kind) (kernel.Message, error) {
+	if f.closed {
+		return kernel.Message{}, fmt.Errorf("vfs %s: %w", op, os.ErrClosed)
+	}
+	return f.client.call(f.ctx, op, kind, payload, grant, respKind)
+}
+
+// fileResp performs a request answered by MsgVFSFileResp and returns its value.
+func (f *File) fileResp(op string, kind proto.Kind, payload []byte, grant kernel.Capability, reqID uint32) (uint64, error) {
+	msg, err := f.fileCall(op, kind, payload, grant, proto.MsgVFSFileResp)
+	if err != nil {
+		return 0, err
+	}
+	gotID, v, ok := proto.DecodeVFSFileRespPayload(msg.Payload())
+	if !ok || gotID != reqID {
+		return 0, fmt.Errorf("vfs %s: bad reply", op)
+	}
+	return v, nil
+}
+
+// Read reads up to len(p) bytes. Reads larger than one message go through
+// the client's shared region. It returns io.EOF at the end of the file.
+func (f *File) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	c := f.client
+	if len(p) > fileInlineMax {
+		c.sharedMu.Lock()
+		defer c.sharedMu.Unlock()
+		if buf, ok := c.sharedBufLocked(f.ctx); ok {
+			if len(p) < len(buf) {
+				buf = buf[:len(p)]
+			}
+			n, eof, err := f.read(uint32(len(buf)), c.shared.Restrict(kernel.RightWrite), buf)
+			if err != nil {
+				return 0, err
+			}
+			copy(p, buf[:n])
+			return n, readErr(n, eof)
+		}
+	}
+
+	want := len(p)
+	if want > fileInlineMax {
+		want = fileInlineMax
+	}
+	n, eof, err := f.read(uint32(want), kernel.Capability{}, p)
+	if err != nil {
+		return 0, err
+	}
+	return n, readErr(n, eof)
+}
+
+// read performs one MsgVFSFileRead. Inline data is copied to dst; shared
+// reads leave it in the region.
+func (f *File) read(max uint32, grant kernel.Capability, dst []byte) (int, bool, error) {
+	reqID := f.client.nextID()
+	msg, err := f.fileCall("read", proto.MsgVFSFileRead, proto.VFSFileReadPayload(reqID, f.handle, max), grant, proto.MsgVFSFileReadResp)
+	if err != nil {
+		return 0, false, err
+	}
+	gotID, eof, n, data, ok := proto.DecodeVFSFileReadRespPayload(msg.Payload())
+	if !ok || gotID != reqID || n > max {
+		return 0, false, errors.New("vfs read: bad reply")
+	}
+	if !grant.Valid() {
+		copy(dst, data)
+	}
+	return int(n), eof, nil
+}
+
+func readErr(n int, eof bool) error {
+	if n == 0 && eof {
+		return io.EOF
+	}
+	return nil
+}
+
+// Write writes all of p, through the shared region when it is larger than
+// one message.
+func (f *File) Write(p []byte) (int, error) {
+	c := f.client
+	written := 0
+	if len(p) > fileInlineMax {
+		c.sharedMu.Lock()
+		defer c.sharedMu.Unlock()
+		if buf, ok := c.sharedBufLocked(f.ctx); ok {
+			grant := c.shared.Restrict(kernel.RightRead)
+			for len(p) > 0 {
+				n := copy(buf, p)
+				reqID := c.nextID()
+				got, err := f.fileResp("write", proto.MsgVFSFileWrite, proto.VFSFileWritePayload(reqID, f.handle, uint32(n), nil), grant, reqID)
+				written += int(got)
+				if err != nil {
+					return written, err
+				}
+				p = p[n:]
+			}
+			return written, nil
+		}
+	}
+
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > fileInlineMax {
+			chunk = chunk[:fileInlineMax]
+		}
+		reqID := c.nextID()
+		payload := proto.VFSFileWritePayload(reqID, f.handle, uint32(len(chunk)), chunk)
+		got, err := f.fileResp("write", proto.MsgVFSFileWrite, payload, kernel.Capability{}, reqID)
+		written += int(got)
+		if err != nil {
+			return written, err
+		}
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// Seek sets the position for the next Read or Write and returns it.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	reqID := f.client.nextID()
+	pos, err := f.fileResp("seek", proto.MsgVFSFileSeek, proto.VFSFileSeekPayload(reqID, f.handle, offset, uint8(whence)), kernel.Capability{}, reqID)
+	return int64(pos), err
+}
+
+// Truncate changes the file size.
+func (f *File) Truncate(size int64) error {
+	if size < 0 {
+		return errors.New("vfs truncate: negative size")
+	}
+	reqID := f.client.nextID()
+	_, err := f.fileResp("truncate", proto.MsgVFSFileTruncate, proto.VFSFileTruncatePayload(reqID, f.handle, uint64(size)), kernel.Capability{}, reqID)
+	return err
+}
+
+// Sync makes written data durable.
+func (f *File) Sync() error {
+	reqID := f.client.nextID()
+	_, err := f.fileResp("sync", proto.MsgVFSFileSync, proto.VFSFileHandlePayload(reqID, f.handle), kernel.Capability{}, reqID)
+	return err
+}
+
+// Close closes the file. Further calls fail with os.ErrClosed.
+func (f *File) Close() error {
+	if f.closed {
+		return nil
+	}
+	reqID := f.client.nextID()
+	_, err := f.fileResp("close", proto.MsgVFSFileClose, proto.VFSFileHandlePayload(reqID, f.handle), kernel.Capability{}, reqID)
+	f.closed = true
+	return err
+}
@@ -21,8 +21,12 @@ import "C"
 import (
 	"errors"
 	"fmt"
+	"io"
+	"os"
 	"runtime/cgo"
+	"strings"
 	"sync"
+	"time"
 	"unsafe"
 )
 
@@ -62,6 +66,8 @@ type Options struct {
 	CacheSize     uint32
 	LookaheadSize uint32
 	BlockCycles   int32
+	// Now is the clock for file timestamps; time.Now if nil.
+	Now func() time.Time
 }
 
 // WriteMode controls how a file is created/updated.
@@ -86,6 +92,8 @@ type FS struct {
 	handle cgo.Handle
 	cctx   *C.spark_lfs_ctx_t
 
+	now func() time.Time
+
 	mounted bool
 }
 
@@ -124,7 +132,7 @@ func New(flash Flash, opts Options) (*FS, error) {
 		opts.BlockCycles = 500
 	}
 
-	fs := &FS{flash: flash}
+	fs := &FS{flash: flash, now: opts.clock()}
 	fs.handle = cgo.NewHandle(fs)
 
 	fs.cctx = (*C.spark_lfs_ctx_t)(C.malloc(C.size_t(unsafe.Sizeof(C.spark_lfs_ctx_t{}))))
@@ -276,6 +284,7 @@ func (fs *FS) Mkdir(path string) error {
 	if rc != 0 {
 		return fmt.Errorf("littlefs mkdir %q: %w", path, decodeErr(int(rc)))
 	}
+	fs.touchLocked(cpath)
 	return nil
 }
 
@@ -330,6 +339,15 @@ func (fs *FS) Rename(oldPath, newPath string) error {
 type Info struct {
 	Type VFSType
 	Size uint32
+	// Mtime and Ctime are the Unix times of the last change of the contents
+	// and of the creation, 0 if unknown. UID and GID are the owner and group.
+	Mtime int64
+	Ctime int64
+	UID   uint32
+	GID   uint32
+	// Mode holds the permission bits (0o777) and ModeSticky; entries
+	// without stored bits get DefaultFileMode or DefaultDirMode.
+	Mode uint16
 }
 
 // VFSType is the file type returned by Stat.
@@ -361,7 +379,59 @@ func (fs *FS) Stat(path string) (Info, error) {
 		return Info{}, fmt.Errorf("littlefs stat %q: %w", path, decodeErr(int(rc)))
 	}
 
-	return Info{Type: decodeType(info._type), Size: uint32(info.size)}, nil
+	inf := Info{Type: decodeType(info._type), Size: uint32(info.size)}
+	readMeta(fs.getter(cpath), &inf)
+	return inf, nil
+}
+
+// Chmod sets the permission bits of path.
+func (fs *FS) Chmod(path string, mode uint16) error {
+	return fs.setAttrs("chmod", path, func(set attrSetter) error { return setMode(set, mode) })
+}
+
+// Chown sets the owner and group of path.
+func (fs *FS) Chown(path string, uid, gid uint32) error {
+	return fs.setAttrs("chown", path, func(set attrSetter) error { return setOwner(set, uid, gid) })
+}
+
+// setAttrs runs fn with a setter for the attributes of an existing path.
+func (fs *FS) setAttrs(op, path string, fn func(set attrSetter) error) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.ensureMountedLocked(); err != nil {
+		return err
+	}
+	cpath, freeFn, err := cString(path)
+	if err != nil {
+		return err
+	}
+	defer freeFn()
+
+	var info C.struct_lfs_info
+	if rc := C.lfs_stat(fs.lfs, cpath, &info); rc != 0 {
+		return fmt.Errorf("littlefs %s %q: %w", op, path, decodeErr(int(rc)))
+	}
+	if err := fn(fs.setter(cpath)); err != nil {
+		return fmt.Errorf("littlefs %s %q: %w", op, path, err)
+	}
+	return nil
+}
+
+// Usage returns the filesystem size and the bytes in use, in whole blocks.
+func (fs *FS) Usage() (total, used uint64, err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.ensureMountedLocked(); err != nil {
+		return 0, 0, err
+	}
+	rc := C.lfs_fs_size(fs.lfs)
+	if rc < 0 {
+		return 0, 0, fmt.Errorf("littlefs usage: %w", decodeErr(int(rc)))
+	}
+	blockSize := uint64(fs.cfg.block_size)
+	return uint64(fs.cfg.block_count) * blockSize, uint64(rc) * blockSize, nil
 }
 
 // ListDir iterates directory entries, stopping when fn returns false.
@@ -400,6 +470,10 @@ func (fs *FS) ListDir(path string, fn func(name string, info Info) bool) error {
 			continue
 		}
 		inf := Info{Type: decodeType(cinfo._type), Size: uint32(cinfo.size)}
+		if centry, freeEntry, err := cString(strings.TrimSuffix(path, "/") + "/" + name); err == nil {
+			readMeta(fs.getter(centry), &inf)
+			freeEntry()
+		}
 		if !fn(name, inf) {
 			return nil
 		}
@@ -540,11 +614,252 @@ func (w *Writer) Close() error {
 	if rc := C.lfs_file_close(w.fs.lfs, w.file); rc != 0 {
 		return fmt.Errorf("littlefs close %q: %w", w.path, decodeErr(int(rc)))
 	}
+	w.fs.touchPathLocked(w.path)
 	return nil
 }
 
 func (w *Writer) BytesWritten() uint32 { return w.written }
 
+// File is a file opened with OpenFile. It keeps the file open between calls,
+// unlike ReadAt, which opens and closes it on every call.
+type File struct {
+	fs     *FS
+	path   string
+	file   *C.lfs_file_t
+	closed bool
+	// dirty is set when the contents changed since the last timestamp.
+	dirty bool
+}
+
+// OpenFile opens path with os.O_* flags (O_RDONLY, O_WRONLY, O_RDWR,
+// O_CREATE, O_EXCL, O_TRUNC, O_APPEND).
+func (fs *FS) OpenFile(path string, flag int) (*File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.ensureMountedLocked(); err != nil {
+		return nil, err
+	}
+	cpath, freeFn, err := cString(path)
+	if err != nil {
+		return nil, err
+	}
+	defer freeFn()
+
+	dirty := flag&os.O_TRUNC != 0
+	if flag&os.O_CREATE != 0 {
+		var info C.struct_lfs_info
+		dirty = dirty || C.lfs_stat(fs.lfs, cpath, &info) == C.LFS_ERR_NOENT
+	}
+
+	f := (*C.lfs_file_t)(C.calloc(1, C.size_t(unsafe.Sizeof(C.lfs_file_t{}))))
+	if f == nil {
+		return nil, errors.New("littlefs: failed to allocate file handle")
+	}
+
+	rc := C.lfs_file_open(fs.lfs, f, cpath, openFlags(flag))
+	if rc != 0 {
+		C.free(unsafe.Pointer(f))
+		return nil, fmt.Errorf("littlefs open %q: %w", path, decodeErr(int(rc)))
+	}
+	return &File{fs: fs, path: path, file: f, dirty: dirty}, nil
+}
+
+func openFlags(flag int) C.int {
+	var f C.int
+	switch {
+	case flag&os.O_RDWR != 0:
+		f = C.int(C.LFS_O_RDWR)
+	case flag&os.O_WRONLY != 0:
+		f = C.int(C.LFS_O_WRONLY)
+	default:
+		f = C.int(C.LFS_O_RDONLY)
+	}
+	if flag&os.O_CREATE != 0 {
+		f |= C.int(C.LFS_O_CREAT)
+	}
+	if flag&os.O_EXCL != 0 {
+		f |= C.int(C.LFS_O_EXCL)
+	}
+	if flag&os.O_TRUNC != 0 {
+		f |= C.int(C.LFS_O_TRUNC)
+	}
+	if flag&os.O_APPEND != 0 {
+		f |= C.int(C.LFS_O_APPEND)
+	}
+	return f
+}
+
+// lockOpen locks the filesystem for an operation on f.
+func (f *File) lockOpen() error {
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.fs.mu.Lock()
+	if err := f.fs.ensureMountedLocked(); err != nil {
+		f.fs.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Read reads from the current position. It returns io.EOF at the end of the file.
+func (f *File) Read(p []byte) (int, error) {
+	if err := f.lockOpen(); err != nil {
+		return 0, err
+	}
+	defer f.fs.mu.Unlock()
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+	rc := C.lfs_file_read(f.fs.lfs, f.file, unsafe.Pointer(unsafe.SliceData(p)), C.lfs_size_t(len(p)))
+	if rc < 0 {
+		return 0, fmt.Errorf("littlefs read %q: %w", f.path, decodeErr(int(rc)))
+	}
+	if rc == 0 {
+		return 0, io.EOF
+	}
+	return int(rc), nil
+}
+
+// Write writes at the current position, or at the end with O_APPEND.
+func (f *File) Write(p []byte) (int, error) {
+	if err := f.lockOpen(); err != nil {
+		return 0, err
+	}
+	defer f.fs.mu.Unlock()
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+	rc := C.lfs_file_write(f.fs.lfs, f.file, unsafe.Pointer(unsafe.SliceData(p)), C.lfs_size_t(len(p)))
+	if rc < 0 {
+		return 0, fmt.Errorf("littlefs write %q: %w", f.path, decodeErr(int(rc)))
+	}
+	f.dirty = true
+	return int(rc), nil
+}
+
+// Seek sets the position for the next Read or Write (io.SeekStart,
+// io.SeekCurrent, io.SeekEnd) and returns it.
+func (f *File) Seek(off int64, whence int) (int64, error) {
+	if err := f.lockOpen(); err != nil {
+		return 0, err
+	}
+	defer f.fs.mu.Unlock()
+
+	var w C.int
+	switch whence {
+	case io.SeekStart:
+		w = C.LFS_SEEK_SET
+	case io.SeekCurrent:
+		w = C.LFS_SEEK_CUR
+	case io.SeekEnd:
+		w = C.LFS_SEEK_END
+	default:
+		return 0, fmt.Errorf("littlefs seek %q: %w", f.path, ErrInvalid)
+	}
+	rc := C.lfs_file_seek(f.fs.lfs, f.file, C.lfs_soff_t(off), w)
+	if rc < 0 {
+		return 0, fmt.Errorf("littlefs seek %q: %w", f.path, decodeErr(int(rc)))
+	}
+	return int64(rc), nil
+}
+
+// Truncate changes the file size. The position is unchanged.
+func (f *File) Truncate(size int64) error {
+	if err := f.lockOpen(); err != nil {
+		return err
+	}
+	defer f.fs.mu.Unlock()
+
+	if size < 0 || size > int64(^uint32(0)) {
+		return fmt.Errorf("littlefs truncate %q: %w", f.path, ErrInvalid)
+	}
+	if rc := C.lfs_file_truncate(f.fs.lfs, f.file, C.lfs_off_t(size)); rc < 0 {
+		return fmt.Errorf("littlefs truncate %q: %w", f.path, decodeErr(int(rc)))
+	}
+	f.dirty = true
+	return nil
+}
+
+// Sync writes buffered data to flash and updates the modification time.
+func (f *File) Sync() error {
+	if err := f.lockOpen(); err != nil {
+		return err
+	}
+	defer f.fs.mu.Unlock()
+
+	if rc := C.lfs_file_sync(f.fs.lfs, f.file); rc < 0 {
+		return fmt.Errorf("littlefs sync %q: %w", f.path, decodeErr(int(rc)))
+	}
+	if f.dirty {
+		f.fs.touchPathLocked(f.path)
+		f.dirty = false
+	}
+	return nil
+}
+
+// Close flushes and closes the file.
+func (f *File) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	defer func() {
+		C.free(unsafe.Pointer(f.file))
+		f.file = nil
+	}()
+
+	if !f.fs.mounted {
+		return ErrNotMounted
+	}
+	if rc := C.lfs_file_close(f.fs.lfs, f.file); rc != 0 {
+		return fmt.Errorf("littlefs close %q: %w", f.path, decodeErr(int(rc)))
+	}
+	if f.dirty {
+		f.fs.touchPathLocked(f.path)
+	}
+	return nil
+}
+
+// getter reads the custom attributes of cpath.
+func (fs *FS) getter(cpath *C.char) attrGetter {
+	return func(typ uint8, buf []byte) bool {
+		rc := C.lfs_getattr(fs.lfs, cpath, C.uint8_t(typ), unsafe.Pointer(unsafe.SliceData(buf)), C.lfs_size_t(len(buf)))
+		return int(rc) == len(buf)
+	}
+}
+
+// touchLocked updates the timestamps of cpath after a change. Timestamps are
+// best effort: failing to store them does not fail the change.
+func (fs *FS) touchLocked(cpath *C.char) {
+	_ = touchMeta(fs.getter(cpath), fs.setter(cpath), fs.now())
+}
+
+// setter writes the custom attributes of cpath.
+func (fs *FS) setter(cpath *C.char) attrSetter {
+	return func(typ uint8, buf []byte) error {
+		if rc := C.lfs_setattr(fs.lfs, cpath, C.uint8_t(typ), unsafe.Pointer(unsafe.SliceData(buf)), C.lfs_size_t(len(buf))); rc < 0 {
+			return decodeErr(int(rc))
+		}
+		return nil
+	}
+}
+
+func (fs *FS) touchPathLocked(path string) {
+	cpath, freeFn, err := cString(path)
+	if err != nil {
+		return
+	}
+	defer freeFn()
+	fs.touchLocked(cpath)
+}
+
 func (fs *FS) ensureMountedLocked() error {
 	if fs.mounted {
 		return nil
@@ -2,7 +2,10 @@
 
 package littlefs
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var (
 	// ErrNotMounted indicates that the filesystem is not mounted.
@@ -39,6 +42,8 @@ type Options struct {
 	CacheSize     uint32
 	LookaheadSize uint32
 	BlockCycles   int32
+	// Now is the clock for file timestamps; time.Now if nil.
+	Now func() time.Time
 }
 
 type WriteMode uint8
@@ -58,6 +63,15 @@ const (
 type Info struct {
 	Type Type
 	Size uint32
+	// Mtime and Ctime are the Unix times of the last change of the contents
+	// and of the creation, 0 if unknown. UID and GID are the owner and group.
+	Mtime int64
+	Ctime int64
+	UID   uint32
+	GID   uint32
+	// Mode holds the permission bits (0o777) and ModeSticky; entries
+	// without stored bits get DefaultFileMode or DefaultDirMode.
+	Mode uint16
 }
 
 type FS struct{}
@@ -78,6 +92,15 @@ func (fs *FS) Mkdir(string) error          { return errors.New("littlefs: requir
 func (fs *FS) Remove(string) error         { return errors.New("littlefs: requires cgo") }
 func (fs *FS) Rename(string, string) error { return errors.New("littlefs: requires cgo") }
 func (fs *FS) Stat(string) (Info, error)   { return Info{}, errors.New("littlefs: requires cgo") }
+func (fs *FS) Chmod(string, uint16) error {
+	return errors.New("littlefs: requires cgo")
+}
+func (fs *FS) Chown(string, uint32, uint32) error {
+	return errors.New("littlefs: requires cgo")
+}
+func (fs *FS) Usage() (uint64, uint64, error) {
+	return 0, 0, errors.New("littlefs: requires cgo")
+}
 func (fs *FS) ReadAt(string, []byte, uint32) (int, bool, error) {
 	return 0, false, errors.New("littlefs: requires cgo")
 }
@@ -85,6 +108,19 @@ func (fs *FS) OpenWriter(string, WriteMode) (*Writer, error) {
 	return nil, errors.New("littlefs: requires cgo")
 }
 
+func (fs *FS) OpenFile(string, int) (*File, error) {
+	return nil, errors.New("littlefs: requires cgo")
+}
+
+type File struct{}
+
+func (f *File) Read([]byte) (int, error)       { return 0, errors.New("littlefs: requires cgo") }
+func (f *File) Write([]byte) (int, error)      { return 0, errors.New("littlefs: requires cgo") }
+func (f *File) Seek(int64, int) (int64, error) { return 0, errors.New("littlefs: requires cgo") }
+func (f *File) Truncate(int64) error           { return errors.New("littlefs: requires cgo") }
+func (f *File) Sync() error                    { return errors.New("littlefs: requires cgo") }
+func (f *File) Close() error                   { return nil }
+
 type Writer struct{}
 
 func (w *Writer) Write([]byte) (int, error) { return 0, errors.New("littlefs: requires cgo") }
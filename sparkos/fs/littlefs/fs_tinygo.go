@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"time"
 
 	"tinygo.org/x/tinyfs"
 	tlfs "tinygo.org/x/tinyfs/littlefs"
@@ -38,6 +40,8 @@ type Options struct {
 	CacheSize     uint32
 	LookaheadSize uint32
 	BlockCycles   int32
+	// Now is the clock for file timestamps; time.Now if nil.
+	Now func() time.Time
 }
 
 type WriteMode uint8
@@ -58,15 +62,92 @@ const (
 type Info struct {
 	Type VFSType
 	Size uint32
+	// Mtime and Ctime are the Unix times of the last change of the contents
+	// and of the creation, 0 if unknown. UID and GID are the owner and group.
+	Mtime int64
+	Ctime int64
+	UID   uint32
+	GID   uint32
+	// Mode holds the permission bits (0o777) and ModeSticky; entries
+	// without stored bits get DefaultFileMode or DefaultDirMode.
+	Mode uint16
 }
 
 type Writer struct {
+	fs      *FS
+	path    string
 	file    tinyfs.File
 	written uint32
 }
 
 type FS struct {
 	lfs *tlfs.LFS
+
+	size      uint32
+	blockSize uint32
+
+	now func() time.Time
+}
+
+// attrLFS is implemented by tinyfs versions that expose littlefs custom
+// attributes. Without them timestamps and owners are not stored.
+type attrLFS interface {
+	Getattr(path string, typ uint8, buf []byte) (int, error)
+	Setattr(path string, typ uint8, buf []byte) error
+}
+
+// statMeta fills the timestamps, owner and mode of info from path.
+func (fs *FS) statMeta(path string, info *Info) {
+	a, ok := any(fs.lfs).(attrLFS)
+	if !ok {
+		readMeta(func(uint8, []byte) bool { return false }, info)
+		return
+	}
+	readMeta(func(typ uint8, buf []byte) bool {
+		n, err := a.Getattr(path, typ, buf)
+		return err == nil && n == len(buf)
+	}, info)
+}
+
+// Chmod sets the permission bits of path.
+func (fs *FS) Chmod(path string, mode uint16) error {
+	return fs.setAttrs("chmod", path, func(set attrSetter) error { return setMode(set, mode) })
+}
+
+// Chown sets the owner and group of path.
+func (fs *FS) Chown(path string, uid, gid uint32) error {
+	return fs.setAttrs("chown", path, func(set attrSetter) error { return setOwner(set, uid, gid) })
+}
+
+// setAttrs runs fn with a setter for the attributes of an existing path.
+func (fs *FS) setAttrs(op, path string, fn func(set attrSetter) error) error {
+	if fs == nil || fs.lfs == nil {
+		return errors.New("littlefs: nil fs")
+	}
+	a, ok := any(fs.lfs).(attrLFS)
+	if !ok {
+		return errors.New("littlefs: attributes not supported")
+	}
+	if _, err := fs.lfs.Stat(path); err != nil {
+		return wrapErr(op, err)
+	}
+	if err := fn(func(typ uint8, buf []byte) error { return a.Setattr(path, typ, buf) }); err != nil {
+		return wrapErr(op, err)
+	}
+	return nil
+}
+
+// touch updates the timestamps of path after a change, best effort.
+func (fs *FS) touch(path string) {
+	a, ok := any(fs.lfs).(attrLFS)
+	if !ok {
+		return
+	}
+	get := func(typ uint8, buf []byte) bool {
+		n, err := a.Getattr(path, typ, buf)
+		return err == nil && n == len(buf)
+	}
+	_ = touchMeta(get, func(typ uint8, buf []byte) error { return a.Setattr(path, typ, buf) }, fs.now())
 }
 
 func New(flash Flash, opts Options) (*FS, error) {
@@ -102,7 +183,7 @@ func New(flash Flash, opts Options) (*FS, error) {
 		LookaheadSize: opts.LookaheadSize,
 		BlockCycles:   opts.BlockCycles,
 	})
-	return &FS{lfs: lfs}, nil
+	return &FS{lfs: lfs, size: flash.SizeBytes(), blockSize: blockSize, now: opts.clock()}, nil
 }
 
 func (fs *FS) Format() error {
@@ -145,6 +226,7 @@ func (fs *FS) Mkdir(path string) error {
 	if err := fs.lfs.Mkdir(path, 0o777); err != nil {
 		return wrapErr("mkdir", err)
 	}
+	fs.touch(path)
 	return nil
 }
 
@@ -180,7 +262,21 @@ func (fs *FS) Stat(path string) (Info, error) {
 	if fi.IsDir() {
 		typ = TypeDir
 	}
-	return Info{Type: typ, Size: uint32(fi.Size())}, nil
+	info := Info{Type: typ, Size: uint32(fi.Size())}
+	fs.statMeta(path, &info)
+	return info, nil
+}
+
+// Usage returns the filesystem size and the bytes in use, in whole blocks.
+func (fs *FS) Usage() (total, used uint64, err error) {
+	if fs == nil || fs.lfs == nil {
+		return 0, 0, errors.New("littlefs: nil fs")
+	}
+	blocks, err := fs.lfs.Size()
+	if err != nil {
+		return 0, 0, wrapErr("usage", err)
+	}
+	return uint64(fs.size), uint64(blocks) * uint64(fs.blockSize), nil
 }
 
 func (fs *FS) ListDir(path string, fn func(name string, info Info) bool) error {
@@ -207,7 +303,9 @@ func (fs *FS) ListDir(path string, fn func(name string, info Info) bool) error {
 		if e.IsDir() {
 			typ = TypeDir
 		}
-		if !fn(name, Info{Type: typ, Size: uint32(e.Size())}) {
+		info := Info{Type: typ, Size: uint32(e.Size())}
+		fs.statMeta(strings.TrimSuffix(path, "/")+"/"+name, &info)
+		if !fn(name, info) {
 			return nil
 		}
 	}
@@ -260,7 +358,7 @@ func (fs *FS) OpenWriter(path string, mode WriteMode) (*Writer, error) {
 	if err != nil {
 		return nil, wrapErr("open writer", err)
 	}
-	return &Writer{file: f}, nil
+	return &Writer{fs: fs, path: path, file: f}, nil
 }
 
 func (w *Writer) Write(p []byte) (int, error) {
@@ -281,6 +379,7 @@ func (w *Writer) Close() error {
 	if err != nil {
 		return wrapErr("close", err)
 	}
+	w.fs.touch(w.path)
 	return nil
 }
 
@@ -291,6 +390,118 @@ func (w *Writer) BytesWritten() uint32 {
 	return w.written
 }
 
+// File is a file opened with OpenFile. It keeps the file open between calls,
+// unlike ReadAt, which opens and closes it on every call.
+type File struct {
+	fs   *FS
+	file tinyfs.File
+	path string
+	// dirty is set when the contents changed since the last timestamp.
+	dirty bool
+}
+
+// OpenFile opens path with os.O_* flags.
+func (fs *FS) OpenFile(path string, flag int) (*File, error) {
+	if fs == nil || fs.lfs == nil {
+		return nil, errors.New("littlefs: nil fs")
+	}
+	dirty := flag&os.O_TRUNC != 0
+	if flag&os.O_CREATE != 0 {
+		_, err := fs.lfs.Stat(path)
+		dirty = dirty || err != nil
+	}
+	f, err := fs.lfs.OpenFile(path, flag)
+	if err != nil {
+		return nil, wrapErr("open", err)
+	}
+	return &File{fs: fs, file: f, path: path, dirty: dirty}, nil
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	n, err := f.file.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return n, wrapErr("read", err)
+	}
+	if n == 0 && len(p) > 0 && err == nil {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	n, err := f.file.Write(p)
+	if n > 0 {
+		f.dirty = true
+	}
+	if err != nil {
+		return n, wrapErr("write", err)
+	}
+	return n, nil
+}
+
+func (f *File) Seek(off int64, whence int) (int64, error) {
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	pos, err := f.file.Seek(off, whence)
+	if err != nil {
+		return 0, wrapErr("seek", err)
+	}
+	return pos, nil
+}
+
+func (f *File) Truncate(size int64) error {
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	t, ok := f.file.(interface{ Truncate(int64) error })
+	if !ok {
+		return fmt.Errorf("littlefs truncate %q: %w", f.path, ErrInvalid)
+	}
+	if err := t.Truncate(size); err != nil {
+		return wrapErr("truncate", err)
+	}
+	f.dirty = true
+	return nil
+}
+
+func (f *File) Sync() error {
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	if s, ok := f.file.(interface{ Sync() error }); ok {
+		if err := s.Sync(); err != nil {
+			return wrapErr("sync", err)
+		}
+	}
+	if f.dirty {
+		f.fs.touch(f.path)
+		f.dirty = false
+	}
+	return nil
+}
+
+func (f *File) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	if err != nil {
+		return wrapErr("close", err)
+	}
+	if f.dirty {
+		f.fs.touch(f.path)
+	}
+	return nil
+}
+
 type flashBlockDevice struct {
 	flash Flash
 }
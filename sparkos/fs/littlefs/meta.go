@@ -0,0 +1,101 @@
+package littlefs
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// Custom attributes keeping the metadata littlefs does not store itself.
+const (
+	attrMtime = 'm' // i64 Unix seconds of the last change of the contents
+	attrCtime = 'c' // i64 Unix seconds of the creation
+	attrUID   = 'u' // u32 owner
+	attrGID   = 'g' // u32 group
+	attrMode  = 'p' // u16 permission bits
+)
+
+// Permission bits of entries that have none stored.
+const (
+	DefaultFileMode = 0o644
+	DefaultDirMode  = 0o755
+)
+
+// ModeSticky on a directory lets only the owners of its entries, and of the
+// directory, remove or rename them. ModeBits are all the bits a mode holds.
+const (
+	ModeSticky = 0o1000
+	ModeBits   = 0o1777
+)
+
+// attrGetter reads attribute typ into buf, reporting whether it has exactly
+// len(buf) bytes.
+type attrGetter func(typ uint8, buf []byte) bool
+
+// attrSetter writes attribute typ.
+type attrSetter func(typ uint8, buf []byte) error
+
+// readMeta fills the timestamps, owner and mode of info, whose Type must be
+// set. Missing attributes, as on files written before they were kept, leave
+// the fields zero and the mode at its default.
+func readMeta(get attrGetter, info *Info) {
+	info.Mode = DefaultFileMode
+	if info.Type == TypeDir {
+		info.Mode = DefaultDirMode
+	}
+	var buf [8]byte
+	if get(attrMtime, buf[:8]) {
+		info.Mtime = int64(binary.LittleEndian.Uint64(buf[:8]))
+	}
+	if get(attrCtime, buf[:8]) {
+		info.Ctime = int64(binary.LittleEndian.Uint64(buf[:8]))
+	}
+	if get(attrUID, buf[:4]) {
+		info.UID = binary.LittleEndian.Uint32(buf[:4])
+	}
+	if get(attrGID, buf[:4]) {
+		info.GID = binary.LittleEndian.Uint32(buf[:4])
+	}
+	if get(attrMode, buf[:2]) {
+		info.Mode = binary.LittleEndian.Uint16(buf[:2]) & ModeBits
+	}
+}
+
+// setMode stores the permission bits.
+func setMode(set attrSetter, mode uint16) error {
+	var buf [2]byte
+	binary.LittleEndian.PutUint16(buf[:], mode&ModeBits)
+	return set(attrMode, buf[:])
+}
+
+// setOwner stores the owner and group.
+func setOwner(set attrSetter, uid, gid uint32) error {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], uid)
+	if err := set(attrUID, buf[:]); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(buf[:], gid)
+	return set(attrGID, buf[:])
+}
+
+// touchMeta records a change of the contents at now and, the first time, the
+// creation.
+func touchMeta(get attrGetter, set attrSetter, now time.Time) error {
+	var buf, old [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(now.Unix()))
+	if err := set(attrMtime, buf[:]); err != nil {
+		return err
+	}
+	if !get(attrCtime, old[:]) {
+		return set(attrCtime, buf[:])
+	}
+	return nil
+}
+
+// clock returns the time source of opts.
+func (opts Options) clock() func() time.Time {
+	if opts.Now != nil {
+		return opts.Now
+	}
+	return time.Now
+}
@@ -0,0 +1,528 @@
+// Package tmpfs is a filesystem kept in RAM, for scratch files that should
+// not wear the flash. File contents and NodeBytes per file or directory
+// count against its byte budget; everything is lost when the FS is dropped.
+//
+// It reports entries and errors with the littlefs types so VFS serves it
+// like the flash.
+package tmpfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	pathpkg "path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"spark/sparkos/fs/littlefs"
+)
+
+// RootMode is the permission of the root directory: anyone may create
+// files in it, and only their owners may remove or rename them.
+const RootMode = 0o777 | littlefs.ModeSticky
+
+// NodeBytes is charged for each file and directory besides its contents,
+// so that empty entries cannot grow the heap without bound.
+const NodeBytes = 64
+
+type node struct {
+	dir      bool
+	data     []byte
+	children map[string]*node
+
+	mode         uint16
+	uid, gid     uint32
+	mtime, ctime int64
+	// removed marks a file deleted while open. Its data is dropped, and
+	// handles still open on it read nothing and cannot write.
+	removed bool
+}
+
+// FS is an in-memory filesystem charging at most limit bytes for its
+// entries and their data.
+type FS struct {
+	mu    sync.Mutex
+	root  *node
+	limit uint64
+	used  uint64
+	now   func() time.Time
+}
+
+// New returns an empty filesystem with a budget of limit bytes.
+func New(limit uint64) *FS {
+	fs := &FS{limit: limit, now: time.Now}
+	fs.root = fs.newNode(true, RootMode)
+	return fs
+}
+
+func (fs *FS) newNode(dir bool, mode uint16) *node {
+	t := fs.now().Unix()
+	n := &node{dir: dir, mode: mode, mtime: t, ctime: t}
+	if dir {
+		n.children = make(map[string]*node)
+	}
+	return n
+}
+
+func (n *node) info() littlefs.Info {
+	info := littlefs.Info{
+		Type:  littlefs.TypeFile,
+		Size:  uint32(len(n.data)),
+		Mtime: n.mtime,
+		Ctime: n.ctime,
+		UID:   n.uid,
+		GID:   n.gid,
+		Mode:  n.mode,
+	}
+	if n.dir {
+		info.Type = littlefs.TypeDir
+		info.Size = 0
+	}
+	return info
+}
+
+// split cleans path and returns its parent directory and base name. The
+// root has an empty name.
+func split(path string) (dir, name string) {
+	p := pathpkg.Clean("/" + path)
+	if p == "/" {
+		return "/", ""
+	}
+	return pathpkg.Dir(p), pathpkg.Base(p)
+}
+
+func (fs *FS) lookupLocked(path string) (*node, error) {
+	n := fs.root
+	for _, part := range strings.Split(pathpkg.Clean("/"+path), "/") {
+		if part == "" {
+			continue
+		}
+		if !n.dir {
+			return nil, fmt.Errorf("tmpfs %q: %w", path, littlefs.ErrNotDir)
+		}
+		child, ok := n.children[part]
+		if !ok {
+			return nil, fmt.Errorf("tmpfs %q: %w", path, littlefs.ErrNotFound)
+		}
+		n = child
+	}
+	return n, nil
+}
+
+// parentLocked returns the directory that holds path and the name in it.
+func (fs *FS) parentLocked(path string) (*node, string, error) {
+	dir, name := split(path)
+	if name == "" {
+		return nil, "", fmt.Errorf("tmpfs %q: %w", path, littlefs.ErrInvalid)
+	}
+	parent, err := fs.lookupLocked(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	if !parent.dir {
+		return nil, "", fmt.Errorf("tmpfs %q: %w", path, littlefs.ErrNotDir)
+	}
+	return parent, name, nil
+}
+
+// resizeLocked sets the length of the data of n, within the budget.
+func (fs *FS) resizeLocked(n *node, size int) error {
+	if n.removed {
+		return fmt.Errorf("tmpfs: %w", littlefs.ErrNotFound)
+	}
+	old := len(n.data)
+	if size > old && fs.used+uint64(size-old) > fs.limit {
+		return fmt.Errorf("tmpfs: %w", littlefs.ErrNoSpace)
+	}
+	switch {
+	case size == 0:
+		// Give the memory back rather than keep it for a rewrite.
+		n.data = nil
+	case size <= old:
+		n.data = n.data[:size]
+	case size <= cap(n.data):
+		n.data = n.data[:size]
+		clear(n.data[old:])
+	default:
+		grown := make([]byte, size, size+size/4)
+		copy(grown, n.data)
+		n.data = grown
+	}
+	fs.used = fs.used + uint64(size) - uint64(old)
+	return nil
+}
+
+// addLocked charges a new node and links it into parent as name.
+func (fs *FS) addLocked(parent *node, name string, dir bool, mode uint16) (*node, error) {
+	if fs.used+NodeBytes > fs.limit {
+		return nil, fmt.Errorf("tmpfs: %w", littlefs.ErrNoSpace)
+	}
+	fs.used += NodeBytes
+	n := fs.newNode(dir, mode)
+	parent.children[name] = n
+	return n, nil
+}
+
+// dropLocked releases a node unlinked from the tree.
+func (fs *FS) dropLocked(n *node) {
+	fs.used -= NodeBytes + uint64(len(n.data))
+	n.data = nil
+	n.removed = true
+}
+
+// Usage returns the byte budget and the bytes charged so far.
+func (fs *FS) Usage() (total, used uint64, err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.limit, fs.used, nil
+}
+
+func (fs *FS) Stat(path string) (littlefs.Info, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	n, err := fs.lookupLocked(path)
+	if err != nil {
+		return littlefs.Info{}, err
+	}
+	return n.info(), nil
+}
+
+// ListDir calls fn for the entries of path in name order until it returns
+// false.
+func (fs *FS) ListDir(path string, fn func(name string, info littlefs.Info) bool) error {
+	fs.mu.Lock()
+	n, err := fs.lookupLocked(path)
+	if err == nil && !n.dir {
+		err = fmt.Errorf("tmpfs %q: %w", path, littlefs.ErrNotDir)
+	}
+	if err != nil {
+		fs.mu.Unlock()
+		return err
+	}
+	names := make([]string, 0, len(n.children))
+	infos := make(map[string]littlefs.Info, len(n.children))
+	for name, child := range n.children {
+		names = append(names, name)
+		infos[name] = child.info()
+	}
+	fs.mu.Unlock()
+
+	sort.Strings(names)
+	for _, name := range names {
+		if !fn(name, infos[name]) {
+			break
+		}
+	}
+	return nil
+}
+
+func (fs *FS) Mkdir(path string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	parent, name, err := fs.parentLocked(path)
+	if err != nil {
+		return err
+	}
+	if _, ok := parent.children[name]; ok {
+		return fmt.Errorf("tmpfs mkdir %q: %w", path, littlefs.ErrExists)
+	}
+	_, err = fs.addLocked(parent, name, true, littlefs.DefaultDirMode)
+	return err
+}
+
+// Remove deletes a file or an empty directory.
+func (fs *FS) Remove(path string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	parent, name, err := fs.parentLocked(path)
+	if err != nil {
+		return err
+	}
+	n, ok := parent.children[name]
+	if !ok {
+		return fmt.Errorf("tmpfs remove %q: %w", path, littlefs.ErrNotFound)
+	}
+	if n.dir && len(n.children) > 0 {
+		return fmt.Errorf("tmpfs remove %q: %w", path, littlefs.ErrNotEmpty)
+	}
+	delete(parent.children, name)
+	fs.dropLocked(n)
+	return nil
+}
+
+// Rename moves oldPath to newPath, replacing a file or an empty directory
+// there.
+func (fs *FS) Rename(oldPath, newPath string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	oldParent, oldName, err := fs.parentLocked(oldPath)
+	if err != nil {
+		return err
+	}
+	n, ok := oldParent.children[oldName]
+	if !ok {
+		return fmt.Errorf("tmpfs rename %q: %w", oldPath, littlefs.ErrNotFound)
+	}
+	newParent, newName, err := fs.parentLocked(newPath)
+	if err != nil {
+		return err
+	}
+	if n.dir {
+		// A directory cannot move below itself.
+		for p := pathpkg.Clean("/" + newPath); p != "/"; p = pathpkg.Dir(p) {
+			if p == pathpkg.Clean("/"+oldPath) {
+				return fmt.Errorf("tmpfs rename %q: %w", oldPath, littlefs.ErrInvalid)
+			}
+		}
+	}
+	if old, ok := newParent.children[newName]; ok && old != n {
+		switch {
+		case old.dir && !n.dir:
+			return fmt.Errorf("tmpfs rename %q: %w", newPath, littlefs.ErrIsDir)
+		case !old.dir && n.dir:
+			return fmt.Errorf("tmpfs rename %q: %w", newPath, littlefs.ErrNotDir)
+		case old.dir && len(old.children) > 0:
+			return fmt.Errorf("tmpfs rename %q: %w", newPath, littlefs.ErrNotEmpty)
+		}
+		fs.dropLocked(old)
+	}
+	delete(oldParent.children, oldName)
+	newParent.children[newName] = n
+	return nil
+}
+
+// Chmod sets the permission bits of path.
+func (fs *FS) Chmod(path string, mode uint16) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	n, err := fs.lookupLocked(path)
+	if err != nil {
+		return err
+	}
+	n.mode = mode & littlefs.ModeBits
+	return nil
+}
+
+// Chown sets the owner and group of path.
+func (fs *FS) Chown(path string, uid, gid uint32) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	n, err := fs.lookupLocked(path)
+	if err != nil {
+		return err
+	}
+	n.uid, n.gid = uid, gid
+	return nil
+}
+
+// ReadAt reads up to len(p) bytes from the file at off.
+func (fs *FS) ReadAt(path string, p []byte, off uint32) (n int, eof bool, err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	f, err := fs.lookupLocked(path)
+	if err != nil {
+		return 0, false, err
+	}
+	if f.dir {
+		return 0, false, fmt.Errorf("tmpfs read %q: %w", path, littlefs.ErrIsDir)
+	}
+	if int(off) >= len(f.data) {
+		return 0, len(p) > 0, nil
+	}
+	n = copy(p, f.data[off:])
+	return n, n < len(p), nil
+}
+
+// openLocked returns the file at path, creating it if create is set.
+func (fs *FS) openLocked(path string, create, excl bool) (*node, error) {
+	parent, name, err := fs.parentLocked(path)
+	if err != nil {
+		return nil, err
+	}
+	n, ok := parent.children[name]
+	switch {
+	case ok && create && excl:
+		return nil, fmt.Errorf("tmpfs open %q: %w", path, littlefs.ErrExists)
+	case ok && n.dir:
+		return nil, fmt.Errorf("tmpfs open %q: %w", path, littlefs.ErrIsDir)
+	case ok:
+		return n, nil
+	case !create:
+		return nil, fmt.Errorf("tmpfs open %q: %w", path, littlefs.ErrNotFound)
+	}
+	return fs.addLocked(parent, name, false, littlefs.DefaultFileMode)
+}
+
+// Writer appends to a file opened with OpenWriter.
+type Writer struct {
+	fs      *FS
+	node    *node
+	written uint32
+	closed  bool
+}
+
+// OpenWriter opens a file for incremental writes, creating it if needed.
+func (fs *FS) OpenWriter(path string, mode littlefs.WriteMode) (*Writer, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	n, err := fs.openLocked(path, true, false)
+	if err != nil {
+		return nil, err
+	}
+	if mode == littlefs.WriteTruncate {
+		_ = fs.resizeLocked(n, 0)
+		n.mtime = fs.now().Unix()
+	}
+	return &Writer{fs: fs, node: n}, nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("tmpfs: write on closed writer")
+	}
+	w.fs.mu.Lock()
+	defer w.fs.mu.Unlock()
+	off := len(w.node.data)
+	if err := w.fs.resizeLocked(w.node, off+len(p)); err != nil {
+		return 0, err
+	}
+	copy(w.node.data[off:], p)
+	w.node.mtime = w.fs.now().Unix()
+	w.written += uint32(len(p))
+	return len(p), nil
+}
+
+func (w *Writer) Close() error {
+	w.closed = true
+	return nil
+}
+
+func (w *Writer) BytesWritten() uint32 { return w.written }
+
+// File is a file opened with OpenFile.
+type File struct {
+	fs          *FS
+	node        *node
+	pos         int64
+	read, write bool
+	append      bool
+	closed      bool
+}
+
+// OpenFile opens path with os.O_* flags.
+func (fs *FS) OpenFile(path string, flag int) (*File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	n, err := fs.openLocked(path, flag&os.O_CREATE != 0, flag&os.O_EXCL != 0)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{fs: fs, node: n, append: flag&os.O_APPEND != 0}
+	switch flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR) {
+	case os.O_WRONLY:
+		f.write = true
+	case os.O_RDWR:
+		f.read, f.write = true, true
+	default:
+		f.read = true
+	}
+	if flag&os.O_TRUNC != 0 && f.write {
+		_ = fs.resizeLocked(n, 0)
+		n.mtime = fs.now().Unix()
+	}
+	return f, nil
+}
+
+func (f *File) check(write bool) error {
+	switch {
+	case f.closed:
+		return os.ErrClosed
+	case write && !f.write, !write && !f.read:
+		return fmt.Errorf("tmpfs: %w", littlefs.ErrInvalid)
+	}
+	return nil
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	if err := f.check(false); err != nil {
+		return 0, err
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.pos >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[f.pos:])
+	f.pos += int64(n)
+	return n, nil
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	if err := f.check(true); err != nil {
+		return 0, err
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.append {
+		f.pos = int64(len(f.node.data))
+	}
+	if end := f.pos + int64(len(p)); end > int64(len(f.node.data)) {
+		if err := f.fs.resizeLocked(f.node, int(end)); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(f.node.data[f.pos:], p)
+	f.pos += int64(n)
+	f.node.mtime = f.fs.now().Unix()
+	return n, nil
+}
+
+func (f *File) Seek(off int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	switch whence {
+	case io.SeekCurrent:
+		off += f.pos
+	case io.SeekEnd:
+		off += int64(len(f.node.data))
+	}
+	if off < 0 {
+		return 0, fmt.Errorf("tmpfs seek: %w", littlefs.ErrInvalid)
+	}
+	f.pos = off
+	return off, nil
+}
+
+func (f *File) Truncate(size int64) error {
+	if err := f.check(true); err != nil {
+		return err
+	}
+	if size < 0 {
+		return fmt.Errorf("tmpfs truncate: %w", littlefs.ErrInvalid)
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.fs.resizeLocked(f.node, int(size)); err != nil {
+		return err
+	}
+	f.node.mtime = f.fs.now().Unix()
+	return nil
+}
+
+func (f *File) Sync() error {
+	if f.closed {
+		return os.ErrClosed
+	}
+	return nil
+}
+
+func (f *File) Close() error {
+	f.closed = true
+	return nil
+}
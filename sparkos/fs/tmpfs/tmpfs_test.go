@@ -0,0 +1,137 @@
+package tmpfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"spark/sparkos/fs/littlefs"
+)
+
+func used(t *testing.T, fs *FS) uint64 {
+	t.Helper()
+	_, n, err := fs.Usage()
+	if err != nil {
+		t.Fatalf("Usage: %v", err)
+	}
+	return n
+}
+
+func TestBudget(t *testing.T) {
+	fs := New(2*NodeBytes + 10)
+
+	w, err := fs.OpenWriter("/a", littlefs.WriteTruncate)
+	if err != nil {
+		t.Fatalf("OpenWriter: %v", err)
+	}
+	if _, err := w.Write([]byte("12345678")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	f, err := fs.OpenFile("/b", os.O_RDWR|os.O_CREATE)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if _, err := f.Write([]byte("xy")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got := used(t, fs); got != 2*NodeBytes+10 {
+		t.Fatalf("used = %d; want %d", got, 2*NodeBytes+10)
+	}
+	if _, err := w.Write([]byte("9")); !errors.Is(err, littlefs.ErrNoSpace) {
+		t.Fatalf("Write past the budget = %v; want ErrNoSpace", err)
+	}
+	_ = w.Close()
+	if err := f.Truncate(3); !errors.Is(err, littlefs.ErrNoSpace) {
+		t.Fatalf("Truncate past the budget = %v; want ErrNoSpace", err)
+	}
+
+	// Empty entries are charged too.
+	if err := fs.Mkdir("/d"); !errors.Is(err, littlefs.ErrNoSpace) {
+		t.Fatalf("Mkdir past the budget = %v; want ErrNoSpace", err)
+	}
+
+	// Removing releases the entry, and its open handles can no longer
+	// grow it.
+	if err := fs.Remove("/b"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, err := f.Write([]byte("z")); err == nil {
+		t.Fatal("wrote to a removed file")
+	}
+	_ = f.Close()
+	if got := used(t, fs); got != NodeBytes+8 {
+		t.Fatalf("used after remove = %d; want %d", got, NodeBytes+8)
+	}
+	if _, err := fs.OpenWriter("/a", littlefs.WriteTruncate); err != nil {
+		t.Fatalf("OpenWriter(truncate): %v", err)
+	}
+	if got := used(t, fs); got != NodeBytes {
+		t.Fatalf("used after truncate = %d; want %d", got, NodeBytes)
+	}
+}
+
+func TestTree(t *testing.T) {
+	fs := New(4 * NodeBytes)
+
+	if err := fs.Mkdir("/d"); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	if err := fs.Mkdir("/d"); !errors.Is(err, littlefs.ErrExists) {
+		t.Fatalf("Mkdir twice = %v; want ErrExists", err)
+	}
+	f, err := fs.OpenFile("/d/f", os.O_WRONLY|os.O_CREATE)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	_, _ = f.Write([]byte("hello"))
+	if _, err := f.Seek(1, io.SeekStart); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	_, _ = f.Write([]byte("E"))
+	_ = f.Close()
+
+	buf := make([]byte, 8)
+	n, eof, err := fs.ReadAt("/d/f", buf, 0)
+	if err != nil || !eof || string(buf[:n]) != "hEllo" {
+		t.Fatalf("ReadAt = %q, eof=%v, %v; want hEllo", buf[:n], eof, err)
+	}
+
+	if err := fs.Remove("/d"); !errors.Is(err, littlefs.ErrNotEmpty) {
+		t.Fatalf("Remove(non-empty dir) = %v; want ErrNotEmpty", err)
+	}
+	if err := fs.Rename("/d", "/d/e"); !errors.Is(err, littlefs.ErrInvalid) {
+		t.Fatalf("Rename into itself = %v; want ErrInvalid", err)
+	}
+	if err := fs.Rename("/d/f", "/g"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if _, err := fs.Stat("/d/f"); !errors.Is(err, littlefs.ErrNotFound) {
+		t.Fatalf("Stat(old name) = %v; want ErrNotFound", err)
+	}
+
+	var names []string
+	if err := fs.ListDir("/", func(name string, _ littlefs.Info) bool {
+		names = append(names, name)
+		return true
+	}); err != nil {
+		t.Fatalf("ListDir: %v", err)
+	}
+	if len(names) != 2 || names[0] != "d" || names[1] != "g" {
+		t.Fatalf("ListDir(/) = %v; want [d g]", names)
+	}
+
+	if err := fs.Chown("/g", 1000, 100); err != nil {
+		t.Fatalf("Chown: %v", err)
+	}
+	if err := fs.Chmod("/g", 0o600); err != nil {
+		t.Fatalf("Chmod: %v", err)
+	}
+	info, err := fs.Stat("/g")
+	if err != nil || info.Size != 5 || info.UID != 1000 || info.GID != 100 || info.Mode != 0o600 {
+		t.Fatalf("Stat(/g) = %+v, %v", info, err)
+	}
+	if root, _ := fs.Stat("/"); root.Type != littlefs.TypeDir || root.Mode != 0o777|littlefs.ModeSticky {
+		t.Fatalf("Stat(/) = %+v; want a sticky directory open to all", root)
+	}
+}
@@ -22,8 +22,45 @@ const (
 	MaxUsers   = 32
 	MaxNameLen = 32
 	MaxHomeLen = 128
+
+	// FirstUID is the first uid given to users other than root, which has 0.
+	FirstUID = 1000
+)
+
+// Groups are fixed by role: admins are in GroupAdmin, everyone else in
+// GroupUsers.
+const (
+	GroupAdmin uint32 = 0
+	GroupUsers uint32 = 100
 )
 
+// GroupName returns the name of a gid, or its number.
+func GroupName(gid uint32) string {
+	switch gid {
+	case GroupAdmin:
+		return "admin"
+	case GroupUsers:
+		return "users"
+	default:
+		return fmt.Sprint(gid)
+	}
+}
+
+// ParseGroup parses a group name or number.
+func ParseGroup(s string) (uint32, bool) {
+	switch s {
+	case "admin":
+		return GroupAdmin, true
+	case "users":
+		return GroupUsers, true
+	}
+	n, err := parseInt(s)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(n), true
+}
+
 type Role uint8
 
 const (
@@ -85,7 +122,9 @@ func (s PasswordScheme) String() string {
 }
 
 type Record struct {
-	Name   string
+	Name string
+	// UID is the file owner id: 0 for root, FirstUID and up for the rest.
+	UID    uint32
 	Role   Role
 	Home   string
 	Scheme PasswordScheme
@@ -94,6 +133,34 @@ type Record struct {
 	Hash   [32]byte
 }
 
+// GID returns the group of the user's role.
+func (r Record) GID() uint32 {
+	if r.Role == RoleAdmin {
+		return GroupAdmin
+	}
+	return GroupUsers
+}
+
+// AssignUIDs gives every user other than root that has uid 0, such as
+// records from before uids were kept, the lowest free uid from FirstUID.
+func AssignUIDs(users []Record) {
+	used := make(map[uint32]bool, len(users))
+	for _, u := range users {
+		used[u.UID] = true
+	}
+	next := uint32(FirstUID)
+	for i := range users {
+		if users[i].UID != 0 || users[i].Name == "root" {
+			continue
+		}
+		for used[next] {
+			next++
+		}
+		users[i].UID = next
+		used[next] = true
+	}
+}
+
 func (r Record) VerifyPassword(pass []byte) bool {
 	want := r.Hash
 
@@ -180,6 +247,7 @@ func ParseUsersFile(b []byte) ([]Record, error) {
 	if len(out) == 0 {
 		return nil, errors.New("no users")
 	}
+	AssignUIDs(out)
 	return out, nil
 }
 
@@ -192,6 +260,7 @@ func FormatUsersFile(users []Record) ([]byte, error) {
 	}
 	cp := append([]Record(nil), users...)
 	sort.Slice(cp, func(i, j int) bool { return cp[i].Name < cp[j].Name })
+	AssignUIDs(cp)
 
 	seen := make(map[string]struct{}, len(cp))
 	var b strings.Builder
@@ -206,7 +275,7 @@ func FormatUsersFile(users []Record) ([]byte, error) {
 
 		fmt.Fprintf(
 			&b,
-			"%s:%s:%s:%s:%d:%s:%s\n",
+			"%s:%s:%s:%s:%d:%s:%s:%d\n",
 			u.Name,
 			u.Role.String(),
 			u.Home,
@@ -214,6 +283,7 @@ func FormatUsersFile(users []Record) ([]byte, error) {
 			u.Iter,
 			hex.EncodeToString(u.Salt[:]),
 			hex.EncodeToString(u.Hash[:]),
+			u.UID,
 		)
 	}
 	if b.Len() > MaxFileBytes {
@@ -231,9 +301,11 @@ func Find(users []Record, name string) (Record, bool) {
 	return Record{}, false
 }
 
+// parseUserLine parses name:role:home:scheme:iter:salt:hash:uid. Records
+// written before uids were kept lack the uid.
 func parseUserLine(line string) (Record, error) {
 	parts := strings.Split(line, ":")
-	if len(parts) != 7 {
+	if len(parts) != 7 && len(parts) != 8 {
 		return Record{}, errors.New("bad record")
 	}
 	name := parts[0]
@@ -265,6 +337,13 @@ func parseUserLine(line string) (Record, error) {
 		return Record{}, errors.New("bad hash")
 	}
 	var rec Record
+	if len(parts) == 8 {
+		uid, err := parseInt(parts[7])
+		if err != nil {
+			return Record{}, errors.New("bad uid")
+		}
+		rec.UID = uint32(uid)
+	}
 	rec.Name = name
 	rec.Role = role
 	rec.Home = home
@@ -110,3 +110,36 @@ func TestFormatUsersFileIsDeterministic(t *testing.T) {
 		t.Fatalf("FormatUsersFile not deterministic")
 	}
 }
+
+func TestLegacyRecordsGetUIDs(t *testing.T) {
+	zero16 := "00000000000000000000000000000000"
+	zero32 := zero16 + zero16
+	in := []byte("alice:user:/home/alice:pbkdf2-sha256:1:" + zero16 + ":" + zero32 + "\n" +
+		"bob:user:/home/bob:pbkdf2-sha256:1:" + zero16 + ":" + zero32 + ":1000\n" +
+		"root:admin:/:pbkdf2-sha256:1:" + zero16 + ":" + zero32 + "\n")
+	users, err := ParseUsersFile(in)
+	if err != nil {
+		t.Fatalf("ParseUsersFile: %v", err)
+	}
+	want := map[string]uint32{"alice": 1001, "bob": 1000, "root": 0}
+	for _, u := range users {
+		if u.UID != want[u.Name] {
+			t.Errorf("%s: uid %d, want %d", u.Name, u.UID, want[u.Name])
+		}
+	}
+	if root, _ := Find(users, "root"); root.GID() != GroupAdmin {
+		t.Errorf("root gid %d, want %d", root.GID(), GroupAdmin)
+	}
+
+	b, err := FormatUsersFile(users)
+	if err != nil {
+		t.Fatalf("FormatUsersFile: %v", err)
+	}
+	again, err := ParseUsersFile(b)
+	if err != nil {
+		t.Fatalf("ParseUsersFile(formatted): %v", err)
+	}
+	if alice, _ := Find(again, "alice"); alice.UID != 1001 {
+		t.Errorf("alice uid %d after a round trip, want 1001", alice.UID)
+	}
+}
@@ -0,0 +1,105 @@
+package kernel
+
+import "errors"
+
+var (
+	// ErrCallTimeout is returned by Context.Call when no reply arrived in time.
+	ErrCallTimeout = errors.New("kernel: call timed out")
+	// ErrCallAborted is returned by Context.Call when the reply endpoint was
+	// revoked before a reply arrived.
+	ErrCallAborted = errors.New("kernel: call aborted")
+	// ErrNoEndpoints is returned when no endpoint slot is free.
+	ErrNoEndpoints = errors.New("kernel: no free endpoints")
+)
+
+// Error makes a failed SendResult usable as an error value.
+func (r SendResult) Error() string { return "kernel: send: " + r.String() }
+
+// Call sends a request and blocks until the single reply arrives.
+//
+// The kernel allocates a one-shot reply endpoint for the call and passes its
+// send capability in the request's Cap field. The endpoint accepts exactly one
+// message: later sends through the reply capability fail with SendErrStaleCap,
+// and the endpoint is freed when Call returns.
+//
+// The request is sent like SendBlocking. timeoutTicks bounds the whole call,
+// waiting for queue space included; 0 waits forever. On failure the error is
+// ErrCallTimeout, ErrCallAborted, ErrNoEndpoints or the SendResult of the
+// rejected request.
+func (c *Context) Call(toCap Capability, kind uint16, payload []byte, timeoutTicks uint64) (Message, error) {
+	return c.call(toCap, kind, payload, Capability{}, timeoutTicks)
+}
+
+func (c *Context) call(toCap Capability, kind uint16, payload []byte, grant Capability, timeoutTicks uint64) (Message, error) {
+	if c == nil || c.k == nil {
+		return Message{}, SendErrNoEndpoint
+	}
+	c.exitIfKilled()
+
+	k := c.k
+	reply := k.allocEndpoint(RightSend|RightRecv, c.taskID, EndpointOptions{}, true)
+	if !reply.valid() {
+		return Message{}, ErrNoEndpoints
+	}
+	defer k.freeEndpoint(reply)
+
+	k.mu.Lock()
+	ch := k.endpoints[reply.ep].ch
+	k.mu.Unlock()
+	if ch == nil {
+		// Revoked between allocation and lookup: the task was killed.
+		c.exitIfKilled()
+		return Message{}, ErrCallAborted
+	}
+
+	o := c.blockingOpts(timeoutTicks)
+	o.grant = grant
+	switch res := c.sendTo(toCap, kind, payload, reply.Restrict(RightSend), o); res {
+	case SendOK:
+	case SendErrTimeout:
+		return Message{}, ErrCallTimeout
+	default:
+		return Message{}, res
+	}
+
+	if c.gen != 0 {
+		k.setState(c.taskID, c.gen, TaskCall, reply.ep)
+		defer k.setState(c.taskID, c.gen, TaskRunning, 0)
+	}
+	for {
+		now, tick := k.tickChan()
+		if o.deadline != 0 && now >= o.deadline {
+			return Message{}, ErrCallTimeout
+		}
+		if o.deadline == 0 {
+			tick = nil
+		}
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				c.exitIfKilled()
+				return Message{}, ErrCallAborted
+			}
+			return msg, nil
+		case <-tick:
+		}
+	}
+}
+
+// freeEndpoint releases an endpoint allocated by the kernel on behalf of a task.
+//
+// It is a no-op if the endpoint was already released (for example because
+// its owner was killed).
+func (k *Kernel) freeEndpoint(epCap Capability) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if int(epCap.ep) >= maxEndpoints {
+		return
+	}
+	ep := &k.endpoints[epCap.ep]
+	if ep.ch == nil || ep.gen != epCap.gen {
+		return
+	}
+	k.freeEndpointLocked(ep)
+}
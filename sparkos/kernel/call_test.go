@@ -0,0 +1,117 @@
+package kernel
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// echoServer replies to every request on srv with the request payload and
+// reports the result of a second reply through the same capability.
+func echoServer(k *Kernel, srv Capability, second chan<- SendResult) {
+	ctx := &Context{k: k}
+	for {
+		msg, ok := ctx.Recv(srv.Restrict(RightRecv))
+		if !ok {
+			return
+		}
+		ctx.SendToCapResult(msg.Cap, msg.Kind+1, msg.Payload(), Capability{})
+		second <- ctx.SendToCapResult(msg.Cap, msg.Kind+1, []byte("again"), Capability{})
+	}
+}
+
+func TestCallReturnsReply(t *testing.T) {
+	k := New()
+	srv := k.NewEndpoint(RightSend | RightRecv)
+	second := make(chan SendResult, 1)
+	go echoServer(k, srv, second)
+
+	ctx := &Context{k: k}
+	msg, err := ctx.Call(srv.Restrict(RightSend), 10, []byte("ping"), 0)
+	if err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if msg.Kind != 11 || string(msg.Payload()) != "ping" {
+		t.Fatalf("unexpected reply kind=%d %q", msg.Kind, msg.Payload())
+	}
+	if res := <-second; res != SendErrStaleCap && res != SendErrNoEndpoint {
+		t.Fatalf("expected second reply to be rejected, got %s", res)
+	}
+	if got := k.liveEndpoints(); got != 1 {
+		t.Fatalf("expected reply endpoint to be freed, %d live", got)
+	}
+}
+
+func TestOneShotEndpointAcceptsSingleMessage(t *testing.T) {
+	k := New()
+	reply := k.allocEndpoint(RightSend|RightRecv, NoTask, EndpointOptions{}, true)
+
+	ctx := &Context{k: k}
+	if res := ctx.SendToCapResult(reply.Restrict(RightSend), 1, nil, Capability{}); res != SendOK {
+		t.Fatalf("expected first send to succeed, got %s", res)
+	}
+	if res := ctx.SendToCapResult(reply.Restrict(RightSend), 1, nil, Capability{}); res != SendErrStaleCap {
+		t.Fatalf("expected SendErrStaleCap on second send, got %s", res)
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	k := New()
+	srv := k.NewEndpoint(RightSend | RightRecv)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for seq := uint64(1); ; seq++ {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				k.TickTo(seq)
+			}
+		}
+	}()
+
+	ctx := &Context{k: k}
+	_, err := ctx.Call(srv.Restrict(RightSend), 1, nil, 5)
+	if !errors.Is(err, ErrCallTimeout) {
+		t.Fatalf("expected ErrCallTimeout, got %v", err)
+	}
+	if got := k.liveEndpoints(); got != 1 {
+		t.Fatalf("expected reply endpoint to be freed, %d live", got)
+	}
+}
+
+func TestCallReportsSendError(t *testing.T) {
+	k := New()
+	srv := k.NewEndpoint(RightSend | RightRecv)
+
+	ctx := &Context{k: k}
+	_, err := ctx.Call(srv.Restrict(RightRecv), 1, nil, 0)
+	if !errors.Is(err, SendErrToNoSendRight) {
+		t.Fatalf("expected SendErrToNoSendRight, got %v", err)
+	}
+	_, err = ctx.Call(srv.Restrict(RightSend), 1, make([]byte, MaxMessageBytes+1), 0)
+	if !errors.Is(err, SendErrPayloadTooLarge) {
+		t.Fatalf("expected SendErrPayloadTooLarge, got %v", err)
+	}
+}
+
+func TestKillAbortsCall(t *testing.T) {
+	k := New()
+	srv := k.NewEndpoint(RightSend | RightRecv)
+
+	id := k.AddTask(taskFunc(func(ctx *Context) {
+		_, _ = ctx.Call(srv.Restrict(RightSend), 1, nil, 0)
+		t.Error("Call returned after kill")
+	}))
+	if _, ok := (&Context{k: k}).Recv(srv.Restrict(RightRecv)); !ok {
+		t.Fatal("expected request")
+	}
+
+	k.Kill(id)
+	waitFor(t, "task reap", func() bool { return k.liveTasks() == 0 })
+	if got := k.liveEndpoints(); got != 1 {
+		t.Fatalf("expected reply endpoint to be freed, %d live", got)
+	}
+}
@@ -1,20 +1,103 @@
 package kernel
 
+import "runtime"
+
 // Context provides task-local access to kernel operations.
 type Context struct {
 	k      *Kernel
 	taskID TaskID
+	gen    uint32
 }
 
 // TaskID returns the current task ID.
 func (c *Context) TaskID() TaskID { return c.taskID }
 
-// AddTask starts a new task in the kernel and returns its ID.
+// AddTask starts a new child task in the kernel and returns its ID.
+//
+// The calling task becomes the parent and may terminate the child with Kill.
 func (c *Context) AddTask(t Task) TaskID {
 	if c.k == nil {
-		return 0
+		return NoTask
+	}
+	c.exitIfKilled()
+	return c.k.spawn(t, c.taskID, TaskOptions{})
+}
+
+// Kill terminates a child task started by the calling task.
+//
+// It reports false if id is not a live child of the caller. See Kernel.Kill
+// for the termination semantics.
+func (c *Context) Kill(id TaskID) bool {
+	if c == nil || c.k == nil {
+		return false
+	}
+	return c.k.kill(id, c.taskID, true)
+}
+
+// Exit terminates the calling task and does not return.
+//
+// Deferred calls of the calling goroutine run, every endpoint and region the
+// task allocated is released and the task slot becomes available for reuse.
+// Returning from Task.Run has the same effect.
+func (c *Context) Exit() {
+	if c != nil && c.k != nil && c.gen != 0 {
+		c.k.mu.Lock()
+		c.k.releaseEndpointsLocked(c.taskID, false)
+		c.k.releaseRegionsLocked(c.taskID)
+		c.k.mu.Unlock()
+	}
+	runtime.Goexit()
+}
+
+// Go runs fn on a new goroutine of the calling task.
+//
+// A panic in fn is contained like one in Task.Run: the task is killed and its
+// supervisor is told that it panicked. The goroutine is unwound with the rest
+// of the task at its next blocking kernel call; see Kernel.Kill.
+func (c *Context) Go(fn func()) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil && c.k != nil {
+				c.k.contain(c, r)
+			}
+		}()
+		fn()
+	}()
+}
+
+// Yield is a check point for loops that compute without calling the kernel.
+//
+// Killing a task takes effect at its goroutines' next blocking kernel call;
+// Yield is one that does not block. It unwinds the calling goroutine if its
+// task was killed, counts the task busy at the next tick (see TaskInfo.Busy)
+// and lets other goroutines run.
+func (c *Context) Yield() {
+	if c == nil || c.k == nil {
+		return
+	}
+	if c.gen != 0 {
+		c.k.mu.Lock()
+		dead := c.k.deadLocked(c.taskID, c.gen)
+		if !dead {
+			c.k.taskLocked(c.taskID).yielded = true
+		}
+		c.k.mu.Unlock()
+		if dead {
+			runtime.Goexit()
+		}
+	}
+	runtime.Gosched()
+}
+
+// exitIfKilled unwinds the calling goroutine if its task was killed or has
+// already exited.
+func (c *Context) exitIfKilled() {
+	if c.gen == 0 {
+		return
+	}
+	if c.k.dead(c.taskID, c.gen) {
+		runtime.Goexit()
 	}
-	return c.k.AddTask(t)
 }
 
 // RecvChan returns the inbound message channel for an endpoint capability.
@@ -25,13 +108,22 @@ func (c *Context) RecvChan(epCap Capability) (<-chan Message, bool) {
 	if !epCap.valid() || !epCap.canRecv() {
 		return nil, false
 	}
+	c.exitIfKilled()
 
 	c.k.mu.Lock()
-	if epCap.ep >= c.k.endpointCount {
+	if int(epCap.ep) >= maxEndpoints {
 		c.k.mu.Unlock()
 		return nil, false
 	}
-	ch := c.k.endpoints[epCap.ep].ch
+	ep := &c.k.endpoints[epCap.ep]
+	if ep.gen != epCap.gen {
+		c.k.mu.Unlock()
+		return nil, false
+	}
+	ch := ep.ch
+	if ch != nil && c.gen != 0 {
+		ep.receiver = c.taskID
+	}
 	c.k.mu.Unlock()
 	if ch == nil {
 		return nil, false
@@ -48,10 +140,15 @@ func (c *Context) Recv(epCap Capability) (Message, bool) {
 	if !ok {
 		return Message{}, false
 	}
+	if c.gen != 0 {
+		c.k.setState(c.taskID, c.gen, TaskRecv, epCap.ep)
+		defer c.k.setState(c.taskID, c.gen, TaskRunning, 0)
+	}
 	msg, ok := <-ch
 	if !ok {
 		return Message{}, false
 	}
+	c.k.traceMsg(TraceRecv, c.taskID, &msg, SendOK)
 	return msg, true
 }
 
@@ -69,6 +166,7 @@ func (c *Context) TryRecv(epCap Capability) (Message, bool) {
 		if !ok {
 			return Message{}, false
 		}
+		c.k.traceMsg(TraceRecv, c.taskID, &msg, SendOK)
 		return msg, true
 	default:
 		return Message{}, false
@@ -81,7 +179,9 @@ func (c *Context) BlockOnTick() {
 		return
 	}
 	after := c.k.nowTick()
-	_ = c.k.waitTick(after)
+	if _, ok := c.k.waitTick(after, c.taskID, c.gen); !ok {
+		runtime.Goexit()
+	}
 }
 
 // Send sends a message to the capability endpoint.
@@ -111,7 +211,10 @@ func (c *Context) SendCapResult(fromCap, toCap Capability, kind uint16, payload
 	if !toCap.canSend() {
 		return SendErrToNoSendRight
 	}
-	return c.k.send(fromCap.ep, toCap.ep, kind, payload, xfer)
+	if c.gen != 0 && c.k.dead(c.taskID, c.gen) {
+		return SendErrTaskExited
+	}
+	return c.k.sendWith(fromCap.ep, toCap, kind, payload, xfer, sendOpts{id: c.taskID, gen: c.gen})
 }
 
 // SendTo sends a message to the capability endpoint.
@@ -132,6 +235,39 @@ func (c *Context) SendToCap(toCap Capability, kind uint16, payload []byte, xfer
 //
 // The message From field is set to 0 (unknown).
 func (c *Context) SendToCapResult(toCap Capability, kind uint16, payload []byte, xfer Capability) SendResult {
+	return c.sendTo(toCap, kind, payload, xfer, sendOpts{})
+}
+
+// SendBlocking sends a message, parking the task while the destination queue is full.
+//
+// timeoutTicks bounds the wait; 0 waits forever. It returns SendErrTimeout if
+// the queue stayed full and SendErrTaskExited if the task was killed while waiting.
+func (c *Context) SendBlocking(toCap Capability, kind uint16, payload []byte, xfer Capability, timeoutTicks uint64) SendResult {
+	return c.sendTo(toCap, kind, payload, xfer, c.blockingOpts(timeoutTicks))
+}
+
+// SendUrgent is SendBlocking on the destination's urgent lane.
+//
+// Use it for control messages (shutdown, focus changes) that must not wait
+// behind bulk traffic. If the endpoint has no urgent lane, the regular lane is used.
+func (c *Context) SendUrgent(toCap Capability, kind uint16, payload []byte, xfer Capability, timeoutTicks uint64) SendResult {
+	o := c.blockingOpts(timeoutTicks)
+	o.urgent = true
+	return c.sendTo(toCap, kind, payload, xfer, o)
+}
+
+func (c *Context) blockingOpts(timeoutTicks uint64) sendOpts {
+	o := sendOpts{block: true}
+	if c != nil && c.k != nil {
+		o.id, o.gen = c.taskID, c.gen
+		if timeoutTicks != 0 {
+			o.deadline = c.k.nowTick() + timeoutTicks
+		}
+	}
+	return o
+}
+
+func (c *Context) sendTo(toCap Capability, kind uint16, payload []byte, xfer Capability, o sendOpts) SendResult {
 	if c == nil || c.k == nil {
 		return SendErrNoEndpoint
 	}
@@ -141,7 +277,15 @@ func (c *Context) SendToCapResult(toCap Capability, kind uint16, payload []byte,
 	if !toCap.canSend() {
 		return SendErrToNoSendRight
 	}
-	return c.k.send(0, toCap.ep, kind, payload, xfer)
+	if c.gen != 0 && c.k.dead(c.taskID, c.gen) {
+		return SendErrTaskExited
+	}
+	o.id, o.gen = c.taskID, c.gen
+	if o.block && c.gen != 0 {
+		c.k.setState(c.taskID, c.gen, TaskSend, toCap.ep)
+		defer c.k.setState(c.taskID, c.gen, TaskRunning, 0)
+	}
+	return c.k.sendWith(0, toCap, kind, payload, xfer, o)
 }
 
 // SendToCapRetry sends a message, retrying on a full queue up to retryLimit times.
@@ -175,12 +319,57 @@ func (c *Context) SendToCapRetry(
 	}
 }
 
-// NewEndpoint allocates a new endpoint and returns a capability for it.
+// NewEndpoint allocates a new endpoint owned by the calling task and returns a capability for it.
+//
+// The endpoint is released when the task exits or is killed.
 func (c *Context) NewEndpoint(rights Rights) Capability {
 	if c.k == nil {
 		return Capability{}
 	}
-	return c.k.NewEndpoint(rights)
+	c.exitIfKilled()
+	return c.k.allocEndpoint(rights, c.taskID, EndpointOptions{}, false)
+}
+
+// NewEndpointWith is NewEndpoint with a configured mailbox.
+func (c *Context) NewEndpointWith(rights Rights, opts EndpointOptions) Capability {
+	if c.k == nil {
+		return Capability{}
+	}
+	c.exitIfKilled()
+	return c.k.allocEndpoint(rights, c.taskID, opts, false)
+}
+
+// FreeEndpoint frees an endpoint the calling task allocated, before the task
+// exits. Capabilities for it turn stale and its mailbox is closed.
+//
+// It reports false if epCap is not a live endpoint owned by the caller.
+func (c *Context) FreeEndpoint(epCap Capability) bool {
+	if c == nil || c.k == nil || !epCap.valid() || epCap.isRegion() {
+		return false
+	}
+	c.k.mu.Lock()
+	defer c.k.mu.Unlock()
+	if c.k.lookupLocked(epCap) != SendOK {
+		return false
+	}
+	ep := &c.k.endpoints[epCap.ep]
+	if ep.owner != c.taskID {
+		return false
+	}
+	c.k.freeEndpointLocked(ep)
+	return true
+}
+
+// Alive reports whether epCap still names an allocated endpoint. It turns
+// false once the endpoint is freed, e.g. when its owner exits, which lets a
+// service drop state it keeps for a client's reply endpoint.
+func (c *Context) Alive(epCap Capability) bool {
+	if c.k == nil || !epCap.valid() || epCap.isRegion() {
+		return false
+	}
+	c.k.mu.Lock()
+	defer c.k.mu.Unlock()
+	return c.k.lookupLocked(epCap) == SendOK
 }
 
 // NowTick returns the last observed tick value.
@@ -196,5 +385,9 @@ func (c *Context) WaitTick(after uint64) uint64 {
 	if c.k == nil {
 		return 0
 	}
-	return c.k.waitTick(after)
+	seq, ok := c.k.waitTick(after, c.taskID, c.gen)
+	if !ok {
+		runtime.Goexit()
+	}
+	return seq
 }
@@ -0,0 +1,117 @@
+package kernel
+
+import "testing"
+
+// reuseEndpoint frees an endpoint owned by a short-lived task and allocates
+// endpoints until the same slot comes back. It returns the stale and the fresh capability.
+func reuseEndpoint(t *testing.T, k *Kernel) (stale, fresh Capability) {
+	t.Helper()
+
+	capCh := make(chan Capability, 1)
+	k.AddTask(taskFunc(func(ctx *Context) {
+		capCh <- ctx.NewEndpoint(RightSend | RightRecv)
+	}))
+	stale = <-capCh
+	if !stale.Valid() {
+		t.Fatal("expected valid endpoint")
+	}
+	waitFor(t, "task reap", func() bool { return k.liveTasks() == 0 })
+
+	for i := 0; i < maxEndpoints; i++ {
+		c := k.NewEndpoint(RightSend | RightRecv)
+		if !c.Valid() {
+			t.Fatal("ran out of endpoints before the slot was reused")
+		}
+		if c.ep == stale.ep {
+			return stale, c
+		}
+	}
+	t.Fatal("endpoint slot was never reused")
+	return Capability{}, Capability{}
+}
+
+func TestStaleCapabilityRejectedAfterReuse(t *testing.T) {
+	k := New()
+	stale, fresh := reuseEndpoint(t, k)
+	if stale.gen == fresh.gen {
+		t.Fatalf("expected a new generation, both are %d", stale.gen)
+	}
+
+	ctx := &Context{k: k}
+	if res := ctx.SendToCapResult(stale.Restrict(RightSend), 1, []byte("old"), Capability{}); res != SendErrStaleCap {
+		t.Fatalf("expected SendErrStaleCap, got %s", res)
+	}
+	if res := ctx.SendCapResult(fresh, stale.Restrict(RightSend), 1, nil, Capability{}); res != SendErrStaleCap {
+		t.Fatalf("expected SendErrStaleCap via SendCapResult, got %s", res)
+	}
+	if _, ok := ctx.TryRecv(fresh.Restrict(RightRecv)); ok {
+		t.Fatal("stale send must not reach the new owner")
+	}
+
+	if res := ctx.SendToCapResult(fresh.Restrict(RightSend), 1, []byte("new"), Capability{}); res != SendOK {
+		t.Fatalf("expected SendOK on fresh capability, got %s", res)
+	}
+	msg, ok := ctx.TryRecv(fresh.Restrict(RightRecv))
+	if !ok || string(msg.Payload()) != "new" {
+		t.Fatalf("expected message on fresh capability, got ok=%v %q", ok, msg.Payload())
+	}
+}
+
+func TestStaleCapabilityCannotReceive(t *testing.T) {
+	k := New()
+	stale, fresh := reuseEndpoint(t, k)
+
+	ctx := &Context{k: k}
+	if _, ok := ctx.RecvChan(stale.Restrict(RightRecv)); ok {
+		t.Fatal("expected RecvChan to reject a stale capability")
+	}
+	if _, ok := ctx.RecvChan(fresh.Restrict(RightRecv)); !ok {
+		t.Fatal("expected RecvChan to accept the fresh capability")
+	}
+}
+
+func TestAliveFollowsEndpointLifetime(t *testing.T) {
+	k := New()
+	stale, fresh := reuseEndpoint(t, k)
+
+	ctx := &Context{k: k}
+	if ctx.Alive(stale.Restrict(RightSend)) {
+		t.Fatal("endpoint of an exited task reported alive")
+	}
+	if !ctx.Alive(fresh.Restrict(RightSend)) {
+		t.Fatal("allocated endpoint reported dead")
+	}
+	if ctx.Alive(Capability{}) {
+		t.Fatal("zero capability reported alive")
+	}
+}
+
+func TestRestrictKeepsGeneration(t *testing.T) {
+	k := New()
+	stale, fresh := reuseEndpoint(t, k)
+
+	if got := fresh.Restrict(RightSend).gen; got != fresh.gen {
+		t.Fatalf("Restrict changed generation: %d != %d", got, fresh.gen)
+	}
+	if got := stale.Restrict(RightSend).gen; got != stale.gen {
+		t.Fatalf("Restrict changed generation: %d != %d", got, stale.gen)
+	}
+}
+
+func TestTransferredStaleCapabilityRejected(t *testing.T) {
+	k := New()
+	inbox := k.NewEndpoint(RightSend | RightRecv)
+	stale, _ := reuseEndpoint(t, k)
+
+	ctx := &Context{k: k}
+	if res := ctx.SendToCapResult(inbox.Restrict(RightSend), 1, nil, stale.Restrict(RightSend)); res != SendOK {
+		t.Fatalf("transfer send: %s", res)
+	}
+	msg, ok := ctx.TryRecv(inbox.Restrict(RightRecv))
+	if !ok {
+		t.Fatal("expected transfer message")
+	}
+	if res := ctx.SendToCapResult(msg.Cap, 1, nil, Capability{}); res != SendErrStaleCap {
+		t.Fatalf("expected transferred stale capability to be rejected, got %s", res)
+	}
+}
@@ -0,0 +1,326 @@
+package kernel
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TaskState describes what a task is doing at the moment of a snapshot.
+type TaskState uint8
+
+const (
+	// TaskRunning means the task is not parked in a kernel call.
+	TaskRunning TaskState = iota
+	// TaskRecv means the task waits for a message on BlockedOn.
+	TaskRecv
+	// TaskSend means the task is parked in SendBlocking on a full BlockedOn.
+	TaskSend
+	// TaskCall means the task waits for the reply of a Call; BlockedOn is
+	// the reply endpoint.
+	TaskCall
+	// TaskSleep means the task waits for a tick (BlockOnTick, WaitTick).
+	TaskSleep
+	// TaskKilled means the task was killed and has not unwound yet.
+	TaskKilled
+)
+
+func (s TaskState) String() string {
+	switch s {
+	case TaskRunning:
+		return "run"
+	case TaskRecv:
+		return "recv"
+	case TaskSend:
+		return "send"
+	case TaskCall:
+		return "call"
+	case TaskSleep:
+		return "sleep"
+	case TaskKilled:
+		return "killed"
+	default:
+		return "unknown"
+	}
+}
+
+// TaskInfo is a read-only view of a live task.
+type TaskInfo struct {
+	ID     TaskID
+	Parent TaskID
+	Name   string
+	State  TaskState
+	// BlockedOn is the endpoint the task waits on for TaskRecv, TaskSend and TaskCall.
+	BlockedOn Endpoint
+
+	// Sent counts messages the task queued, Received messages queued for it
+	// and Dropped sends rejected with a full queue or a timeout.
+	Sent     uint32
+	Received uint32
+	Dropped  uint32
+
+	// Endpoints is the number of endpoints the task allocated and still
+	// holds, RegionBytes the size of its shared-memory regions.
+	Endpoints   int
+	RegionBytes int
+
+	// Busy counts the ticks at which the task was sampled busy, out of
+	// Samples ticks since it started. A task is busy when it is not parked
+	// in a kernel call and its mailbox is not empty, or when it called
+	// Context.Yield since the previous tick. This is a hung-mailbox detector,
+	// not CPU accounting: a task computing with nothing queued for it and
+	// without calling Yield is indistinguishable from an idle one.
+	Busy    uint32
+	Samples uint32
+}
+
+// EndpointInfo is a read-only view of an allocated endpoint.
+type EndpointInfo struct {
+	ID       Endpoint
+	Gen      uint16
+	Owner    TaskID
+	Receiver TaskID
+
+	Depth  int
+	Urgent bool
+	// Queued is the number of messages waiting in the mailbox, HighWater the
+	// largest value observed since allocation.
+	Queued    int
+	HighWater int
+
+	Sent    uint32
+	Dropped uint32
+	OneShot bool
+}
+
+// Namer may be implemented by a Task to name itself in Kernel.Tasks.
+//
+// Without it the task is named after its type: *shell.Service becomes "shell".
+type Namer interface {
+	Name() string
+}
+
+func taskName(t Task) string {
+	if n, ok := t.(Namer); ok {
+		return n.Name()
+	}
+	name := strings.TrimPrefix(fmt.Sprintf("%T", t), "*")
+	for _, suffix := range []string{".Service", ".Task"} {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix)
+		}
+	}
+	return name
+}
+
+// Tasks reports every live task, ordered by ID.
+//
+// Tasks that read their mailbox through RecvChan are not tracked while they
+// wait; such a task is reported as TaskRecv when it is not parked elsewhere
+// and the mailbox it last obtained is empty.
+func (k *Kernel) Tasks() []TaskInfo {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	var eps, regionBytes [maxTasks]int
+	for i := range k.endpoints {
+		if ep := &k.endpoints[i]; ep.ch != nil && ep.owner != NoTask {
+			eps[ep.owner-1]++
+		}
+	}
+	for i := range k.regions {
+		if r := &k.regions[i]; r.buf != nil && r.owner != NoTask {
+			regionBytes[r.owner-1] += len(r.buf)
+		}
+	}
+
+	out := make([]TaskInfo, 0, k.taskCount)
+	for i := range k.tasks {
+		st := &k.tasks[i]
+		if st.task == nil {
+			continue
+		}
+		info := TaskInfo{
+			ID:        TaskID(i + 1),
+			Parent:    st.parent,
+			Name:      st.name,
+			State:     st.state,
+			BlockedOn: st.blockedOn,
+			Sent:      st.sent,
+			Received:  st.received,
+			Dropped:   st.dropped,
+
+			Endpoints:   eps[i],
+			RegionBytes: regionBytes[i],
+			Busy:        st.busy,
+			Samples:     st.samples,
+		}
+		switch {
+		case st.killed:
+			info.State = TaskKilled
+		case info.State == TaskRunning:
+			if ep, ok := k.idleMailboxLocked(info.ID); ok {
+				info.State, info.BlockedOn = TaskRecv, ep
+			}
+		}
+		out = append(out, info)
+	}
+	return out
+}
+
+// Endpoints reports every allocated endpoint, ordered by ID.
+func (k *Kernel) Endpoints() []EndpointInfo {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	out := make([]EndpointInfo, 0, k.endpointCount)
+	for i := range k.endpoints {
+		ep := &k.endpoints[i]
+		if ep.ch == nil {
+			continue
+		}
+		out = append(out, EndpointInfo{
+			ID:        Endpoint(i),
+			Gen:       ep.gen,
+			Owner:     ep.owner,
+			Receiver:  ep.receiver,
+			Depth:     ep.depth,
+			Urgent:    ep.urgent != nil,
+			Queued:    ep.queued(),
+			HighWater: ep.highWater,
+			Sent:      ep.sent,
+			Dropped:   ep.dropped,
+			OneShot:   ep.oneShot,
+		})
+	}
+	return out
+}
+
+// Tasks is Kernel.Tasks for the kernel the task runs on.
+func (c *Context) Tasks() []TaskInfo {
+	if c == nil || c.k == nil {
+		return nil
+	}
+	return c.k.Tasks()
+}
+
+// Endpoints is Kernel.Endpoints for the kernel the task runs on.
+func (c *Context) Endpoints() []EndpointInfo {
+	if c == nil || c.k == nil {
+		return nil
+	}
+	return c.k.Endpoints()
+}
+
+func (ep *endpointState) queued() int {
+	n := len(ep.in)
+	if ep.urgent != nil {
+		n += len(ep.urgent)
+	}
+	return n
+}
+
+// idleMailboxLocked returns the first endpoint the task receives from if it is empty.
+func (k *Kernel) idleMailboxLocked(id TaskID) (Endpoint, bool) {
+	for i := range k.endpoints {
+		ep := &k.endpoints[i]
+		if ep.ch == nil || ep.receiver != id {
+			continue
+		}
+		return Endpoint(i), ep.queued() == 0
+	}
+	return 0, false
+}
+
+// sampleLocked charges the current tick to every live task and counts it as
+// busy for the tasks that yielded since the previous tick and those that are
+// busy now, with the rule Tasks uses to tell whether a task waits on
+// RecvChan: its first mailbox is empty.
+func (k *Kernel) sampleLocked() {
+	var seen, idle [maxTasks]bool
+	for i := range k.endpoints {
+		ep := &k.endpoints[i]
+		if ep.ch == nil || ep.receiver == NoTask || int(ep.receiver) > maxTasks {
+			continue
+		}
+		j := ep.receiver - 1
+		if !seen[j] {
+			seen[j] = true
+			idle[j] = ep.queued() == 0
+		}
+	}
+	for i := range k.tasks {
+		st := &k.tasks[i]
+		if st.task == nil || st.killed {
+			continue
+		}
+		st.samples++
+		if st.yielded || (st.state == TaskRunning && !idle[i]) {
+			st.busy++
+		}
+		st.yielded = false
+	}
+}
+
+// setState records what the task (id, gen) is parked on. Detached contexts
+// (gen 0) are not tracked.
+func (k *Kernel) setState(id TaskID, gen uint32, s TaskState, ep Endpoint) {
+	k.mu.Lock()
+	k.setStateLocked(id, gen, s, ep)
+	k.mu.Unlock()
+}
+
+func (k *Kernel) setStateLocked(id TaskID, gen uint32, s TaskState, ep Endpoint) {
+	if gen == 0 {
+		return
+	}
+	st := k.taskLocked(id)
+	if st == nil || st.gen != gen || st.task == nil {
+		return
+	}
+	st.state, st.blockedOn = s, ep
+}
+
+// noteSend updates the endpoint and task counters after a send to toCap by
+// the task (id, gen).
+func (k *Kernel) noteSend(toCap Capability, id TaskID, gen uint32, res SendResult) {
+	k.mu.Lock()
+	k.noteSendLocked(toCap, id, gen, res)
+	k.mu.Unlock()
+}
+
+func (k *Kernel) noteSendLocked(toCap Capability, id TaskID, gen uint32, res SendResult) {
+	if res != SendOK && res != SendErrQueueFull && res != SendErrTimeout {
+		return
+	}
+	var sender *taskState
+	if gen != 0 {
+		if st := k.taskLocked(id); st != nil && st.gen == gen && st.task != nil {
+			sender = st
+		}
+	}
+
+	ep := &k.endpoints[toCap.ep]
+	live := ep.ch != nil && ep.gen == toCap.gen
+	if res != SendOK {
+		if live {
+			ep.dropped++
+		}
+		if sender != nil {
+			sender.dropped++
+		}
+		return
+	}
+	if sender != nil {
+		sender.sent++
+	}
+	if !live {
+		return
+	}
+	ep.sent++
+	if q := ep.queued(); q > ep.highWater {
+		ep.highWater = q
+	}
+	if st := k.taskLocked(ep.receiver); st != nil && st.task != nil {
+		st.received++
+	}
+}
@@ -0,0 +1,212 @@
+package kernel
+
+import (
+	"testing"
+	"time"
+)
+
+type namedTask struct{ release chan struct{} }
+
+func (n namedTask) Name() string     { return "worker" }
+func (n namedTask) Run(ctx *Context) { <-n.release }
+
+func taskInfo(k *Kernel, id TaskID) (TaskInfo, bool) {
+	for _, ti := range k.Tasks() {
+		if ti.ID == id {
+			return ti, true
+		}
+	}
+	return TaskInfo{}, false
+}
+
+func endpointInfo(k *Kernel, ep Endpoint) (EndpointInfo, bool) {
+	for _, ei := range k.Endpoints() {
+		if ei.ID == ep {
+			return ei, true
+		}
+	}
+	return EndpointInfo{}, false
+}
+
+func TestTasksReportNamesAndParents(t *testing.T) {
+	k := New()
+	release := make(chan struct{})
+	defer close(release)
+
+	childCh := make(chan TaskID, 1)
+	parent := k.AddTask(taskFunc(func(ctx *Context) {
+		childCh <- ctx.AddTask(namedTask{release: release})
+		<-release
+	}))
+	child := <-childCh
+
+	pi, ok := taskInfo(k, parent)
+	if !ok || pi.Name != "kernel.taskFunc" || pi.Parent != NoTask {
+		t.Fatalf("unexpected parent info %+v (found=%v)", pi, ok)
+	}
+	ci, ok := taskInfo(k, child)
+	if !ok || ci.Name != "worker" || ci.Parent != parent {
+		t.Fatalf("unexpected child info %+v (found=%v)", ci, ok)
+	}
+}
+
+func TestTasksReportBlockedOn(t *testing.T) {
+	k := New()
+	ticker(t, k)
+	srv := k.NewEndpointWith(RightSend|RightRecv, EndpointOptions{Depth: 1})
+	fill(t, &Context{k: k}, srv.Restrict(RightSend), 1)
+
+	inbox := k.NewEndpoint(RightSend | RightRecv)
+	sender := k.AddTask(taskFunc(func(ctx *Context) {
+		ctx.SendBlocking(srv.Restrict(RightSend), 1, nil, Capability{}, 0)
+	}))
+	receiver := k.AddTask(taskFunc(func(ctx *Context) {
+		ctx.Recv(inbox.Restrict(RightRecv))
+	}))
+	sleeper := k.AddTask(taskFunc(func(ctx *Context) {
+		ctx.WaitTick(ctx.NowTick() + 1_000_000)
+	}))
+
+	for _, tc := range []struct {
+		id    TaskID
+		state TaskState
+		ep    Endpoint
+	}{
+		{sender, TaskSend, srv.ep},
+		{receiver, TaskRecv, inbox.ep},
+		{sleeper, TaskSleep, 0},
+	} {
+		waitFor(t, "task state "+tc.state.String(), func() bool {
+			ti, ok := taskInfo(k, tc.id)
+			return ok && ti.State == tc.state && ti.BlockedOn == tc.ep
+		})
+	}
+
+	k.Kill(sleeper)
+	waitFor(t, "sleeper reap", func() bool {
+		_, ok := taskInfo(k, sleeper)
+		return !ok
+	})
+}
+
+func TestEndpointCounters(t *testing.T) {
+	k := New()
+	ep := k.NewEndpointWith(RightSend|RightRecv, EndpointOptions{Depth: 2})
+
+	done := make(chan struct{})
+	id := k.AddTask(taskFunc(func(ctx *Context) {
+		fill(t, ctx, ep.Restrict(RightSend), 2)
+		ctx.SendToCapResult(ep.Restrict(RightSend), 1, nil, Capability{})
+		close(done)
+		ctx.WaitTick(ctx.NowTick() + 1_000_000)
+	}))
+	<-done
+
+	ei, ok := endpointInfo(k, ep.ep)
+	if !ok {
+		t.Fatal("endpoint missing from Endpoints")
+	}
+	if ei.Depth != 2 || ei.Queued != 2 || ei.HighWater != 2 || ei.Sent != 2 || ei.Dropped != 1 {
+		t.Fatalf("unexpected endpoint info %+v", ei)
+	}
+	ti, _ := taskInfo(k, id)
+	if ti.Sent != 2 || ti.Dropped != 1 {
+		t.Fatalf("unexpected sender counters %+v", ti)
+	}
+
+	ctx := &Context{k: k}
+	ctx.TryRecv(ep.Restrict(RightRecv))
+	if ei, _ = endpointInfo(k, ep.ep); ei.Queued != 1 || ei.HighWater != 2 {
+		t.Fatalf("expected high-water mark to stick, got %+v", ei)
+	}
+	k.Kill(id)
+}
+
+func TestReceivedCountsPerTask(t *testing.T) {
+	k := New()
+	capCh := make(chan Capability, 1)
+	got := make(chan struct{})
+	id := k.AddTask(taskFunc(func(ctx *Context) {
+		inbox := ctx.NewEndpoint(RightSend | RightRecv)
+		capCh <- inbox
+		for i := 0; i < 3; i++ {
+			ctx.Recv(inbox.Restrict(RightRecv))
+		}
+		close(got)
+		ctx.WaitTick(ctx.NowTick() + 1_000_000)
+	}))
+	inbox := <-capCh
+	waitFor(t, "receiver", func() bool {
+		ei, _ := endpointInfo(k, inbox.ep)
+		return ei.Receiver == id
+	})
+	fill(t, &Context{k: k}, inbox.Restrict(RightSend), 3)
+	<-got
+
+	ti, _ := taskInfo(k, id)
+	if ti.Received != 3 {
+		t.Fatalf("expected 3 received, got %+v", ti)
+	}
+	k.Kill(id)
+}
+
+func TestTaskUsage(t *testing.T) {
+	k := New()
+	release := make(chan struct{})
+	defer close(release)
+
+	ready := make(chan struct{}, 2)
+	busy := k.AddTask(taskFunc(func(ctx *Context) {
+		ctx.NewEndpoint(RightSend | RightRecv)
+		ctx.NewEndpoint(RightSend | RightRecv)
+		ctx.NewRegion(100)
+		ready <- struct{}{}
+		<-release
+	}))
+	sleeper := k.AddTask(taskFunc(func(ctx *Context) {
+		ready <- struct{}{}
+		ctx.WaitTick(ctx.NowTick() + 1_000_000)
+	}))
+	<-ready
+	<-ready
+	waitFor(t, "sleeper parked", func() bool {
+		ti, _ := taskInfo(k, sleeper)
+		return ti.State == TaskSleep
+	})
+	for seq := uint64(1); seq <= 10; seq++ {
+		k.TickTo(seq)
+	}
+
+	bi, _ := taskInfo(k, busy)
+	if bi.Endpoints != 2 || bi.RegionBytes != 100 || bi.Busy != 10 || bi.Samples != 10 {
+		t.Fatalf("unexpected busy task usage %+v", bi)
+	}
+	si, _ := taskInfo(k, sleeper)
+	if si.Endpoints != 0 || si.Busy != 0 || si.Samples != 10 {
+		t.Fatalf("unexpected sleeper usage %+v", si)
+	}
+	k.Kill(sleeper)
+}
+
+func TestYieldCountsBusyAndUnwindsKill(t *testing.T) {
+	k := New()
+	running := make(chan struct{})
+	id := k.AddTask(taskFunc(func(ctx *Context) {
+		close(running)
+		for {
+			ctx.Yield()
+		}
+	}))
+	<-running
+	for seq := uint64(1); seq <= 10; seq++ {
+		time.Sleep(time.Millisecond)
+		k.TickTo(seq)
+	}
+
+	ti, _ := taskInfo(k, id)
+	if ti.Busy == 0 || ti.Samples != 10 {
+		t.Fatalf("expected a yielding task to be sampled busy, got %+v", ti)
+	}
+	k.Kill(id)
+	waitFor(t, "killed task unwound", func() bool { return k.liveTasks() == 0 })
+}
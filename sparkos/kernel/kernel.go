@@ -3,29 +3,48 @@ package kernel
 import "sync"
 
 const (
-	maxTasks     = 32
-	maxEndpoints = 64
-	mailboxSlots = 8
+	maxTasks = 32
+	// maxEndpoints is sized for the full profile: about 42 endpoints at boot,
+	// 22 of them appmgr's app proxies, plus one for each loaded app and those
+	// its task allocates, plus a one-shot reply per Context.Call in flight.
+	maxEndpoints    = 96
+	mailboxSlots    = 8
+	maxMailboxSlots = 64
+	urgentSlots     = 4
 )
 
+// TaskID identifies a task slot. IDs start at 1; NoTask is never a running task.
 type TaskID uint8
 
+// NoTask is the zero TaskID.
+const NoTask TaskID = 0
+
 // Rights define which operations are allowed for a capability.
 type Rights uint8
 
 const (
 	RightSend Rights = 1 << iota
 	RightRecv
+
+	// RightRead and RightWrite apply to shared-memory region capabilities.
+	RightRead
+	RightWrite
 )
 
 // Endpoint identifies an IPC destination.
 type Endpoint uint8
 
-// Capability grants access to an IPC endpoint.
+// Capability grants access to an IPC endpoint or a shared-memory region.
 //
 // It is opaque by construction (no exported fields) and may be transferred via IPC.
+// The generation pins the capability to one allocation of the endpoint: once the
+// endpoint is freed and reused, old capabilities are rejected as stale.
+//
+// Region capabilities carry RightRead/RightWrite instead of RightSend/RightRecv;
+// ep is then the region slot.
 type Capability struct {
 	ep     Endpoint
+	gen    uint16
 	rights Rights
 }
 
@@ -35,8 +54,12 @@ func (c Capability) valid() bool {
 
 func (c Capability) Valid() bool { return c.valid() }
 
-func (c Capability) canSend() bool { return c.rights&RightSend != 0 }
-func (c Capability) canRecv() bool { return c.rights&RightRecv != 0 }
+// Endpoint returns the endpoint c refers to, as trace events and ipcs name it.
+func (c Capability) Endpoint() Endpoint { return c.ep }
+
+func (c Capability) canSend() bool  { return c.rights&RightSend != 0 }
+func (c Capability) canRecv() bool  { return c.rights&RightRecv != 0 }
+func (c Capability) isRegion() bool { return c.rights&(RightRead|RightWrite) != 0 }
 
 // Restrict returns a capability with a reduced set of rights.
 func (c Capability) Restrict(rights Rights) Capability {
@@ -47,9 +70,20 @@ func (c Capability) Restrict(rights Rights) Capability {
 	if r == 0 {
 		return Capability{}
 	}
-	return Capability{ep: c.ep, rights: r}
+	return Capability{ep: c.ep, gen: c.gen, rights: r}
 }
 
+// Sender identifies the task that sent a message. It includes the task's
+// generation, so a task that reuses the slot of an exited one is a different
+// Sender. The zero Sender is a send from outside any task.
+type Sender struct {
+	id  TaskID
+	gen uint32
+}
+
+// Task returns the ID of the sending task, NoTask if there was none.
+func (s Sender) Task() TaskID { return s.id }
+
 // Message is a fixed-size IPC envelope.
 type Message struct {
 	From Endpoint
@@ -58,6 +92,11 @@ type Message struct {
 	Len  uint16
 	Data [MaxMessageBytes]byte
 	Cap  Capability
+	// Grant is an optional shared-memory region capability (see Context.NewRegion).
+	Grant Capability
+	// Sender is set by the kernel and cannot be forged, unlike From, so
+	// services can tie state to the client that created it.
+	Sender Sender
 }
 
 // Payload returns the message payload slice.
@@ -88,6 +127,10 @@ const (
 	SendErrNoEndpoint
 	SendErrPayloadTooLarge
 	SendErrQueueFull
+	SendErrTaskExited
+	SendErrStaleCap
+	SendErrTimeout
+	SendErrInvalidGrant
 )
 
 func (r SendResult) String() string {
@@ -108,6 +151,14 @@ func (r SendResult) String() string {
 		return "payload too large"
 	case SendErrQueueFull:
 		return "queue full"
+	case SendErrTaskExited:
+		return "sender task has exited"
+	case SendErrStaleCap:
+		return "stale capability (endpoint was reused)"
+	case SendErrTimeout:
+		return "timed out waiting for queue space"
+	case SendErrInvalidGrant:
+		return "grant is not a region capability"
 	default:
 		return "unknown"
 	}
@@ -119,11 +170,32 @@ type Task interface {
 }
 
 type endpointState struct {
+	// ch is the receive side of the mailbox.
 	ch chan Message
-}
-
-type taskState struct {
-	task Task
+	// in is the regular lane senders write to; it is ch itself unless the
+	// endpoint has an urgent lane.
+	in chan Message
+	// urgent is the urgent lane, or nil. It is drained before in.
+	urgent chan Message
+	depth  int
+
+	// gen is bumped on every allocation of the endpoint slot.
+	gen uint16
+
+	// owner is the task that allocated the endpoint via Context.NewEndpoint.
+	// Endpoints allocated with Kernel.NewEndpoint have no owner and are never reclaimed.
+	owner TaskID
+	// receiver is the last task that obtained the receive channel.
+	receiver TaskID
+
+	// oneShot endpoints accept a single message; spent is set once it is delivered.
+	oneShot bool
+	spent   bool
+
+	// Introspection, see Kernel.Endpoints.
+	highWater int
+	sent      uint32
+	dropped   uint32
 }
 
 // Kernel is a minimal IPC router plus endpoint allocator.
@@ -131,24 +203,51 @@ type Kernel struct {
 	mu sync.Mutex
 
 	endpoints     [maxEndpoints]endpointState
-	endpointCount Endpoint
+	endpointCount int
+	nextEndpoint  int
+
+	regions     [maxRegions]regionState
+	regionBytes int
 
 	tasks     [maxTasks]taskState
-	taskCount TaskID
+	taskCount int
+	nextTask  int
 
 	tick     uint64
 	tickCond *sync.Cond
+	// tickWake is closed and replaced on every tick (and on kills), for
+	// waiters that need to select on a tick together with a channel.
+	tickWake chan struct{}
+
+	// trace is the IPC trace ring; tracing gates recording without taking mu.
+	trace   *traceRing
+	tracing uint32
+
+	// supervisor receives exit notices for tasks without a parent.
+	supervisor supervisorRef
 }
 
 // New creates a kernel instance.
 func New() *Kernel {
-	k := &Kernel{}
+	k := &Kernel{tickWake: make(chan struct{})}
 	k.tickCond = sync.NewCond(&k.mu)
 	return k
 }
 
 // NewEndpoint allocates a new endpoint and returns a capability for it.
+//
+// The endpoint has no owner task and lives for the lifetime of the kernel.
 func (k *Kernel) NewEndpoint(rights Rights) Capability {
+	return k.allocEndpoint(rights, NoTask, EndpointOptions{}, false)
+}
+
+// NewEndpointWith is NewEndpoint with a configured mailbox.
+func (k *Kernel) NewEndpointWith(rights Rights, opts EndpointOptions) Capability {
+	return k.allocEndpoint(rights, NoTask, opts, false)
+}
+
+func (k *Kernel) allocEndpoint(rights Rights, owner TaskID, opts EndpointOptions, oneShot bool) Capability {
+	rights &= RightSend | RightRecv
 	if rights == 0 {
 		return Capability{}
 	}
@@ -157,76 +256,36 @@ func (k *Kernel) NewEndpoint(rights Rights) Capability {
 	if k.endpointCount >= maxEndpoints {
 		return Capability{}
 	}
-	ep := k.endpointCount
-	k.endpointCount++
-	k.endpoints[ep] = endpointState{ch: make(chan Message, mailboxSlots)}
-	return Capability{ep: ep, rights: rights}
-}
 
-// AddTask registers a task and returns its ID.
-func (k *Kernel) AddTask(t Task) TaskID {
-	k.mu.Lock()
-	if k.taskCount >= maxTasks {
-		k.mu.Unlock()
-		return 0
-	}
-	id := k.taskCount
-	k.taskCount++
-	k.tasks[id] = taskState{task: t}
-	k.mu.Unlock()
-
-	if t != nil {
-		go func(id TaskID) {
-			defer func() {
-				if r := recover(); r != nil {
-					triggerPanic(PanicInfo{TaskID: id, Value: r})
-				}
-			}()
-			t.Run(&Context{k: k, taskID: id})
-		}(id)
+	// Allocate round-robin so a freed endpoint is reused as late as possible.
+	for i := 0; i < maxEndpoints; i++ {
+		idx := (k.nextEndpoint + i) % maxEndpoints
+		if k.endpoints[idx].ch != nil {
+			continue
+		}
+		k.nextEndpoint = (idx + 1) % maxEndpoints
+		k.endpointCount++
+		gen := k.endpoints[idx].gen + 1
+		if gen == 0 {
+			gen = 1
+		}
+		ep := &k.endpoints[idx]
+		*ep = endpointState{gen: gen, owner: owner, oneShot: oneShot}
+		ep.openMailbox(opts)
+		return Capability{ep: Endpoint(idx), gen: gen, rights: rights}
 	}
-	return id
+	return Capability{}
 }
 
-func (k *Kernel) send(from Endpoint, to Endpoint, kind uint16, payload []byte, xfer Capability) (res SendResult) {
-	if InPanicMode() {
-		return SendErrQueueFull
-	}
-
-	k.mu.Lock()
-	if to >= k.endpointCount || k.endpoints[to].ch == nil {
-		k.mu.Unlock()
-		return SendErrNoEndpoint
-	}
-	ch := k.endpoints[to].ch
-	k.mu.Unlock()
-
-	if len(payload) > MaxMessageBytes {
-		return SendErrPayloadTooLarge
-	}
-
-	var msg Message
-	msg.From = from
-	msg.To = to
-	msg.Kind = kind
-	msg.Len = uint16(len(payload))
-	copy(msg.Data[:], payload)
-	msg.Cap = xfer
-
-	defer func() {
-		if r := recover(); r != nil {
-			// A closed endpoint channel can panic on send.
-			// Treat it as a missing endpoint instead of crashing the sender.
-			res = SendErrNoEndpoint
-		}
-	}()
+// AddTask registers a task and starts it. It returns NoTask if no slot is free.
+//
+// Tasks started this way have no parent and can only be killed via Kernel.Kill.
+func (k *Kernel) AddTask(t Task) TaskID {
+	return k.spawn(t, NoTask, TaskOptions{})
+}
 
-	select {
-	case ch <- msg:
-		return SendOK
-	default:
-		return SendErrQueueFull
-	}
+func (k *Kernel) send(from Endpoint, toCap Capability, kind uint16, payload []byte, xfer Capability) SendResult {
+	return k.sendWith(from, toCap, kind, payload, xfer, sendOpts{})
 }
 
 // TickTo broadcasts a new tick value to tick-waiters.
@@ -241,27 +300,51 @@ func (k *Kernel) TickTo(seq uint64) {
 		return
 	}
 	k.tick = seq
-	k.tickCond.Broadcast()
+	k.sampleLocked()
+	k.wakeLocked()
 	k.mu.Unlock()
 }
 
+// wakeLocked wakes every tick waiter.
+func (k *Kernel) wakeLocked() {
+	k.tickCond.Broadcast()
+	close(k.tickWake)
+	k.tickWake = make(chan struct{})
+}
+
+// tickChan returns the current tick and a channel that is closed on the next tick.
+func (k *Kernel) tickChan() (uint64, <-chan struct{}) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.tick, k.tickWake
+}
+
 func (k *Kernel) nowTick() uint64 {
 	k.mu.Lock()
 	defer k.mu.Unlock()
 	return k.tick
 }
 
-func (k *Kernel) waitTick(after uint64) uint64 {
+// waitTick blocks until the tick advances past after.
+//
+// It returns ok=false if the waiting task was killed in the meantime.
+func (k *Kernel) waitTick(after uint64, id TaskID, gen uint32) (seq uint64, ok bool) {
 	k.mu.Lock()
 	if InPanicMode() {
 		for {
 			k.tickCond.Wait()
 		}
 	}
+	k.setStateLocked(id, gen, TaskSleep, 0)
 	for k.tick <= after {
+		if k.deadLocked(id, gen) {
+			k.mu.Unlock()
+			return 0, false
+		}
 		k.tickCond.Wait()
 	}
-	seq := k.tick
+	k.setStateLocked(id, gen, TaskRunning, 0)
+	seq = k.tick
 	k.mu.Unlock()
-	return seq
+	return seq, true
 }
@@ -0,0 +1,183 @@
+package kernel
+
+import (
+	"testing"
+	"time"
+)
+
+type taskFunc func(ctx *Context)
+
+func (f taskFunc) Run(ctx *Context) { f(ctx) }
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (k *Kernel) liveTasks() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.taskCount
+}
+
+func (k *Kernel) liveEndpoints() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.endpointCount
+}
+
+func TestTaskReturnReleasesSlotAndEndpoints(t *testing.T) {
+	k := New()
+
+	capCh := make(chan Capability, 1)
+	id := k.AddTask(taskFunc(func(ctx *Context) {
+		capCh <- ctx.NewEndpoint(RightSend | RightRecv)
+	}))
+	if id == NoTask {
+		t.Fatal("expected task to start")
+	}
+	ep := <-capCh
+	if !ep.Valid() {
+		t.Fatal("expected valid endpoint")
+	}
+
+	waitFor(t, "task reap", func() bool { return k.liveTasks() == 0 })
+	if got := k.liveEndpoints(); got != 0 {
+		t.Fatalf("expected owned endpoint to be released, %d live", got)
+	}
+
+	ctx := &Context{k: k}
+	if res := ctx.SendToCapResult(ep.Restrict(RightSend), 1, nil, Capability{}); res != SendErrNoEndpoint {
+		t.Fatalf("expected SendErrNoEndpoint after owner exit, got %s", res)
+	}
+}
+
+func TestAddTaskChurnReusesSlots(t *testing.T) {
+	k := New()
+
+	for i := 0; i < maxTasks*4; i++ {
+		done := make(chan struct{})
+		id := k.AddTask(taskFunc(func(ctx *Context) {
+			_ = ctx.NewEndpoint(RightSend | RightRecv)
+			close(done)
+		}))
+		if id == NoTask {
+			t.Fatalf("AddTask %d: no free slot", i)
+		}
+		<-done
+		waitFor(t, "task reap", func() bool { return k.liveTasks() == 0 })
+	}
+	if got := k.liveEndpoints(); got != 0 {
+		t.Fatalf("expected no leaked endpoints, %d live", got)
+	}
+}
+
+func TestContextExitReleasesEndpoints(t *testing.T) {
+	k := New()
+
+	capCh := make(chan Capability, 1)
+	k.AddTask(taskFunc(func(ctx *Context) {
+		capCh <- ctx.NewEndpoint(RightSend | RightRecv)
+		ctx.Exit()
+		t.Error("Exit returned")
+	}))
+	<-capCh
+
+	waitFor(t, "task reap", func() bool { return k.liveTasks() == 0 })
+	if got := k.liveEndpoints(); got != 0 {
+		t.Fatalf("expected endpoints to be released, %d live", got)
+	}
+}
+
+func TestKillUnblocksWaitTick(t *testing.T) {
+	k := New()
+
+	started := make(chan struct{})
+	id := k.AddTask(taskFunc(func(ctx *Context) {
+		close(started)
+		for {
+			ctx.BlockOnTick()
+		}
+	}))
+	<-started
+
+	if !k.Kill(id) {
+		t.Fatal("expected Kill to find the task")
+	}
+	waitFor(t, "task reap", func() bool { return k.liveTasks() == 0 })
+	if k.Kill(id) {
+		t.Fatal("expected second Kill to fail")
+	}
+}
+
+func TestKillResetsSharedReceiveEndpoint(t *testing.T) {
+	k := New()
+	shared := k.NewEndpoint(RightSend | RightRecv)
+
+	started := make(chan struct{})
+	exited := make(chan struct{})
+	id := k.AddTask(taskFunc(func(ctx *Context) {
+		defer close(exited)
+		ch, ok := ctx.RecvChan(shared.Restrict(RightRecv))
+		if !ok {
+			t.Error("expected recv channel")
+			return
+		}
+		close(started)
+		for range ch {
+		}
+	}))
+	<-started
+
+	k.Kill(id)
+	select {
+	case <-exited:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("killed task kept reading the shared endpoint")
+	}
+
+	ctx := &Context{k: k}
+	if res := ctx.SendToCapResult(shared.Restrict(RightSend), 1, []byte("x"), Capability{}); res != SendOK {
+		t.Fatalf("expected shared endpoint to stay usable, got %s", res)
+	}
+	if _, ok := ctx.TryRecv(shared.Restrict(RightRecv)); !ok {
+		t.Fatal("expected message on the fresh mailbox")
+	}
+}
+
+func TestContextKillRequiresParent(t *testing.T) {
+	k := New()
+
+	block := make(chan struct{})
+	defer close(block)
+
+	childCh := make(chan TaskID, 1)
+	parent := k.AddTask(taskFunc(func(ctx *Context) {
+		childCh <- ctx.AddTask(taskFunc(func(*Context) { <-block }))
+		<-block
+	}))
+	child := <-childCh
+	if child == NoTask {
+		t.Fatal("expected child to start")
+	}
+
+	resCh := make(chan bool, 1)
+	k.AddTask(taskFunc(func(ctx *Context) { resCh <- ctx.Kill(child) }))
+	if <-resCh {
+		t.Fatal("expected Kill from a non-parent to fail")
+	}
+
+	k.mu.Lock()
+	gen := k.tasks[parent-1].gen
+	k.mu.Unlock()
+	parentCtx := &Context{k: k, taskID: parent, gen: gen}
+	if !parentCtx.Kill(child) {
+		t.Fatal("expected Kill from the parent to succeed")
+	}
+}
@@ -0,0 +1,215 @@
+package kernel
+
+// EndpointOptions configures an endpoint mailbox.
+type EndpointOptions struct {
+	// Depth is the queue capacity. 0 selects the default (8); values are
+	// clamped to 64.
+	Depth int
+
+	// Urgent adds a small separate lane for messages sent with SendUrgent.
+	// The receiver gets urgent messages before any queued regular ones, so
+	// control traffic is not stuck behind bulk data.
+	Urgent bool
+}
+
+func (ep *endpointState) openMailbox(opts EndpointOptions) {
+	depth := opts.Depth
+	if depth <= 0 {
+		depth = mailboxSlots
+	}
+	if depth > maxMailboxSlots {
+		depth = maxMailboxSlots
+	}
+	ep.depth = depth
+
+	if !opts.Urgent {
+		ep.ch = make(chan Message, depth)
+		ep.in = ep.ch
+		ep.urgent = nil
+		return
+	}
+	// The receive side is unbuffered: the pump picks the next message only
+	// when the receiver is ready for it, so an urgent message overtakes
+	// everything still queued on the regular lane.
+	ep.ch = make(chan Message)
+	ep.in = make(chan Message, depth)
+	ep.urgent = make(chan Message, urgentSlots)
+	go pump(ep.in, ep.urgent, ep.ch)
+}
+
+// closeMailbox closes every channel of the mailbox. Pending messages are dropped.
+func (ep *endpointState) closeMailbox() {
+	close(ep.ch)
+	if ep.urgent != nil {
+		close(ep.in)
+		close(ep.urgent)
+	}
+}
+
+// pump feeds out from the two lanes of an endpoint, urgent first.
+// It exits once the mailbox is closed.
+func pump(in, urgent <-chan Message, out chan<- Message) {
+	defer func() {
+		// out was closed while a message was in hand.
+		_ = recover()
+	}()
+
+	for {
+		var msg Message
+		var ok bool
+		select {
+		case msg, ok = <-urgent:
+		default:
+			select {
+			case msg, ok = <-urgent:
+			case msg, ok = <-in:
+			}
+		}
+		if !ok {
+			return
+		}
+		out <- msg
+	}
+}
+
+type sendOpts struct {
+	urgent bool
+	grant  Capability
+
+	// block parks the sender until the lane has room, the deadline tick is
+	// reached (0 = never) or the sending task (id, gen) is killed. id and gen
+	// also attribute the send in Kernel.Tasks and fill Message.Sender.
+	block    bool
+	deadline uint64
+	id       TaskID
+	gen      uint32
+}
+
+func (k *Kernel) sendWith(from Endpoint, toCap Capability, kind uint16, payload []byte, xfer Capability, o sendOpts) SendResult {
+	if InPanicMode() {
+		return SendErrQueueFull
+	}
+	var msg Message
+	msg.From = from
+	msg.To = toCap.ep
+	msg.Kind = kind
+	msg.Len = uint16(len(payload))
+	copy(msg.Data[:], payload)
+	msg.Cap = xfer
+	msg.Grant = o.grant
+	msg.Sender = Sender{id: o.id, gen: o.gen}
+
+	res := k.deliverMsg(toCap, msg, len(payload), o)
+	k.traceMsg(TraceSend, o.id, &msg, res)
+	return res
+}
+
+func (k *Kernel) deliverMsg(toCap Capability, msg Message, size int, o sendOpts) SendResult {
+	var closedLane chan Message
+	for {
+		k.mu.Lock()
+		if res := k.lookupLocked(toCap); res != SendOK {
+			k.mu.Unlock()
+			return res
+		}
+		if size > MaxMessageBytes {
+			k.mu.Unlock()
+			return SendErrPayloadTooLarge
+		}
+		ep := &k.endpoints[toCap.ep]
+		if ep.oneShot {
+			res := ep.deliverOnceLocked(msg)
+			k.noteSendLocked(toCap, o.id, o.gen, res)
+			k.mu.Unlock()
+			return res
+		}
+		lane := ep.in
+		if o.urgent && ep.urgent != nil {
+			lane = ep.urgent
+		}
+		if lane == closedLane {
+			// Closed but not replaced by the kernel.
+			k.mu.Unlock()
+			return SendErrNoEndpoint
+		}
+		var wake <-chan struct{}
+		if o.block {
+			if o.deadline != 0 && k.tick >= o.deadline {
+				k.noteSendLocked(toCap, o.id, o.gen, SendErrTimeout)
+				k.mu.Unlock()
+				return SendErrTimeout
+			}
+			if k.deadLocked(o.id, o.gen) {
+				k.mu.Unlock()
+				return SendErrTaskExited
+			}
+			wake = k.tickWake
+		}
+		k.mu.Unlock()
+
+		sent, closed := deliver(lane, msg, wake)
+		if sent {
+			k.noteSend(toCap, o.id, o.gen, SendOK)
+			return SendOK
+		}
+		if closed {
+			closedLane = lane
+		} else if !o.block {
+			k.noteSend(toCap, o.id, o.gen, SendErrQueueFull)
+			return SendErrQueueFull
+		}
+		// Woken by a tick, or the mailbox was closed (endpoint freed or its
+		// receiver reset): look the endpoint up again.
+	}
+}
+
+func (k *Kernel) lookupLocked(toCap Capability) SendResult {
+	if int(toCap.ep) >= maxEndpoints || k.endpoints[toCap.ep].ch == nil {
+		return SendErrNoEndpoint
+	}
+	if k.endpoints[toCap.ep].gen != toCap.gen {
+		return SendErrStaleCap
+	}
+	return SendOK
+}
+
+// deliverOnceLocked delivers to a one-shot endpoint. It runs under the kernel
+// lock so that exactly one sender wins the endpoint.
+func (ep *endpointState) deliverOnceLocked(msg Message) SendResult {
+	if ep.spent {
+		return SendErrStaleCap
+	}
+	select {
+	case ep.in <- msg:
+		ep.spent = true
+		return SendOK
+	default:
+		return SendErrQueueFull
+	}
+}
+
+// deliver puts msg on lane. With a nil wake it never blocks; otherwise it
+// blocks until the message is queued or wake is closed.
+func deliver(lane chan<- Message, msg Message, wake <-chan struct{}) (sent, closed bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			// A closed mailbox panics on send.
+			sent, closed = false, true
+		}
+	}()
+
+	if wake == nil {
+		select {
+		case lane <- msg:
+			return true, false
+		default:
+			return false, false
+		}
+	}
+	select {
+	case lane <- msg:
+		return true, false
+	case <-wake:
+		return false, false
+	}
+}
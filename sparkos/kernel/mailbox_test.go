@@ -0,0 +1,224 @@
+package kernel
+
+import (
+	"testing"
+	"time"
+)
+
+// ticker advances the kernel tick every millisecond until the test ends.
+func ticker(t *testing.T, k *Kernel) {
+	t.Helper()
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	go func() {
+		for seq := uint64(1); ; seq++ {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				k.TickTo(seq)
+			}
+		}
+	}()
+}
+
+func fill(t *testing.T, ctx *Context, to Capability, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if res := ctx.SendToCapResult(to, 1, []byte{byte(i)}, Capability{}); res != SendOK {
+			t.Fatalf("send %d: expected SendOK, got %s", i, res)
+		}
+	}
+}
+
+func TestEndpointDepth(t *testing.T) {
+	k := New()
+	ctx := &Context{k: k}
+
+	for _, tc := range []struct{ depth, want int }{
+		{0, mailboxSlots},
+		{16, 16},
+		{1000, maxMailboxSlots},
+	} {
+		ep := k.NewEndpointWith(RightSend|RightRecv, EndpointOptions{Depth: tc.depth})
+		to := ep.Restrict(RightSend)
+		fill(t, ctx, to, tc.want)
+		if res := ctx.SendToCapResult(to, 1, nil, Capability{}); res != SendErrQueueFull {
+			t.Fatalf("depth %d: expected SendErrQueueFull after %d messages, got %s", tc.depth, tc.want, res)
+		}
+	}
+}
+
+func TestSendBlockingWaitsForSpace(t *testing.T) {
+	k := New()
+	ep := k.NewEndpoint(RightSend | RightRecv)
+	ctx := &Context{k: k}
+	fill(t, ctx, ep.Restrict(RightSend), mailboxSlots)
+
+	resCh := make(chan SendResult, 1)
+	go func() {
+		resCh <- ctx.SendBlocking(ep.Restrict(RightSend), 2, []byte("late"), Capability{}, 0)
+	}()
+	select {
+	case res := <-resCh:
+		t.Fatalf("SendBlocking returned %s on a full queue", res)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if _, ok := ctx.TryRecv(ep.Restrict(RightRecv)); !ok {
+		t.Fatal("expected queued message")
+	}
+	select {
+	case res := <-resCh:
+		if res != SendOK {
+			t.Fatalf("expected SendOK, got %s", res)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("SendBlocking did not wake up after the queue drained")
+	}
+}
+
+func TestSendBlockingTimeout(t *testing.T) {
+	k := New()
+	ticker(t, k)
+	ep := k.NewEndpoint(RightSend | RightRecv)
+	ctx := &Context{k: k}
+	fill(t, ctx, ep.Restrict(RightSend), mailboxSlots)
+
+	if res := ctx.SendBlocking(ep.Restrict(RightSend), 1, nil, Capability{}, 3); res != SendErrTimeout {
+		t.Fatalf("expected SendErrTimeout, got %s", res)
+	}
+}
+
+func TestUrgentLaneOvertakesBulk(t *testing.T) {
+	k := New()
+	ep := k.NewEndpointWith(RightSend|RightRecv, EndpointOptions{Urgent: true})
+	ctx := &Context{k: k}
+	to := ep.Restrict(RightSend)
+
+	fill(t, ctx, to, mailboxSlots)
+	// The regular lane may still have room for one more message while the
+	// pump holds the first one; fill it up completely.
+	waitFor(t, "regular lane full", func() bool {
+		return ctx.SendToCapResult(to, 1, []byte{0xff}, Capability{}) == SendErrQueueFull
+	})
+	if res := ctx.SendUrgent(to, 2, nil, Capability{}, 0); res != SendOK {
+		t.Fatalf("expected urgent send to bypass the full regular lane, got %s", res)
+	}
+
+	ch, ok := ctx.RecvChan(ep.Restrict(RightRecv))
+	if !ok {
+		t.Fatal("expected recv channel")
+	}
+	// At most the message already picked by the pump comes first.
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-ch:
+			if msg.Kind == 2 {
+				return
+			}
+		case <-time.After(500 * time.Millisecond):
+			t.Fatal("timed out waiting for messages")
+		}
+	}
+	t.Fatal("urgent message did not overtake the queued bulk messages")
+}
+
+func TestUrgentFallsBackToRegularLane(t *testing.T) {
+	k := New()
+	ep := k.NewEndpoint(RightSend | RightRecv)
+	ctx := &Context{k: k}
+
+	if res := ctx.SendUrgent(ep.Restrict(RightSend), 2, nil, Capability{}, 0); res != SendOK {
+		t.Fatalf("expected SendOK, got %s", res)
+	}
+	if msg, ok := ctx.TryRecv(ep.Restrict(RightRecv)); !ok || msg.Kind != 2 {
+		t.Fatalf("expected urgent message on the regular lane, got ok=%v", ok)
+	}
+}
+
+func TestKillUnblocksSendBlocking(t *testing.T) {
+	k := New()
+	ep := k.NewEndpoint(RightSend | RightRecv)
+	fill(t, &Context{k: k}, ep.Restrict(RightSend), mailboxSlots)
+
+	resCh := make(chan SendResult, 1)
+	started := make(chan struct{})
+	id := k.AddTask(taskFunc(func(ctx *Context) {
+		close(started)
+		resCh <- ctx.SendBlocking(ep.Restrict(RightSend), 1, nil, Capability{}, 0)
+	}))
+	<-started
+
+	k.Kill(id)
+	select {
+	case res := <-resCh:
+		if res != SendErrTaskExited {
+			t.Fatalf("expected SendErrTaskExited, got %s", res)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("killed task stayed blocked in SendBlocking")
+	}
+	waitFor(t, "task reap", func() bool { return k.liveTasks() == 0 })
+}
+
+func TestFreeUrgentEndpointStopsPump(t *testing.T) {
+	k := New()
+	capCh := make(chan Capability, 1)
+	k.AddTask(taskFunc(func(ctx *Context) {
+		ep := ctx.NewEndpointWith(RightSend|RightRecv, EndpointOptions{Urgent: true})
+		ctx.SendToCapResult(ep.Restrict(RightSend), 1, nil, Capability{})
+		capCh <- ep
+	}))
+	ep := <-capCh
+	waitFor(t, "task reap", func() bool { return k.liveTasks() == 0 })
+
+	ctx := &Context{k: k}
+	if res := ctx.SendUrgent(ep.Restrict(RightSend), 1, nil, Capability{}, 0); res != SendErrNoEndpoint {
+		t.Fatalf("expected SendErrNoEndpoint after free, got %s", res)
+	}
+}
+
+func TestMessageSenderIdentifiesTask(t *testing.T) {
+	k := New()
+	ep := k.NewEndpoint(RightSend | RightRecv)
+
+	ids := make(chan TaskID, 2)
+	for i := 0; i < 2; i++ {
+		k.AddTask(taskFunc(func(ctx *Context) {
+			ids <- ctx.taskID
+			ctx.SendToCapResult(ep.Restrict(RightSend), 1, nil, Capability{})
+			// Call passes its own reply endpoint; the sender is still the task.
+			_, _ = ctx.Call(ep.Restrict(RightSend), 2, nil, 0)
+		}))
+	}
+
+	ctx := &Context{k: k}
+	senders := make(map[Sender]int)
+	for i := 0; i < 4; i++ {
+		msg, ok := ctx.Recv(ep.Restrict(RightRecv))
+		if !ok {
+			t.Fatal("Recv failed")
+		}
+		senders[msg.Sender]++
+		if msg.Kind == 2 {
+			ctx.SendToCapResult(msg.Cap, 3, nil, Capability{})
+		}
+	}
+	if len(senders) != 2 {
+		t.Fatalf("senders = %v; want two tasks with two messages each", senders)
+	}
+	want := map[TaskID]bool{<-ids: true, <-ids: true}
+	for s, n := range senders {
+		if n != 2 || !want[s.Task()] {
+			t.Errorf("sender %v sent %d messages; want one of %v with 2", s, n, want)
+		}
+	}
+
+	if res := ctx.SendToCapResult(ep.Restrict(RightSend), 3, nil, Capability{}); res != SendOK {
+		t.Fatalf("send: %s", res)
+	}
+	if msg, _ := ctx.Recv(ep.Restrict(RightRecv)); msg.Sender != (Sender{}) {
+		t.Errorf("send outside a task has sender %v; want the zero Sender", msg.Sender)
+	}
+}
@@ -19,14 +19,17 @@ var (
 	panicHandler atomic.Value // func(PanicInfo)
 )
 
-// InPanicMode reports whether the kernel is in panic mode.
+// InPanicMode reports whether the kernel is in panic mode, entered when a
+// core task panics.
 func InPanicMode() bool {
 	return panicActive.Load()
 }
 
 // SetPanicHandler installs a process-wide panic handler.
 //
-// The handler is invoked at most once (on the first panic). It must not panic.
+// The handler is invoked at most once, on the first panic of a core task
+// (see TaskOptions.Core); panics of other tasks are reported to their
+// supervisor instead. It must not panic.
 func SetPanicHandler(fn func(PanicInfo)) {
 	panicHandler.Store(fn)
 }
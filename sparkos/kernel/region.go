@@ -0,0 +1,140 @@
+package kernel
+
+const (
+	maxRegions = 16
+	// maxRegionBytes is the total size of all live regions.
+	maxRegionBytes = 256 << 10
+)
+
+type regionState struct {
+	// buf is nil for a free slot. Every allocation gets a fresh array, so a
+	// view kept past the region's lifetime never aliases a later region.
+	buf   []byte
+	gen   uint16
+	owner TaskID
+}
+
+// NewRegion allocates a zeroed shared-memory region of size bytes and returns
+// a read-write capability for it.
+//
+// The region has no owner task and lives until the kernel is discarded.
+func (k *Kernel) NewRegion(size int) Capability {
+	return k.allocRegion(size, NoTask)
+}
+
+func (k *Kernel) allocRegion(size int, owner TaskID) Capability {
+	if size <= 0 {
+		return Capability{}
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.regionBytes+size > maxRegionBytes {
+		return Capability{}
+	}
+	for i := range k.regions {
+		r := &k.regions[i]
+		if r.buf != nil {
+			continue
+		}
+		gen := r.gen + 1
+		if gen == 0 {
+			gen = 1
+		}
+		*r = regionState{buf: make([]byte, size), gen: gen, owner: owner}
+		k.regionBytes += size
+		return Capability{ep: Endpoint(i), gen: gen, rights: RightRead | RightWrite}
+	}
+	return Capability{}
+}
+
+func (k *Kernel) regionLocked(c Capability) *regionState {
+	if !c.isRegion() || int(c.ep) >= maxRegions {
+		return nil
+	}
+	r := &k.regions[c.ep]
+	if r.buf == nil || r.gen != c.gen {
+		return nil
+	}
+	return r
+}
+
+func (k *Kernel) freeRegionLocked(r *regionState) {
+	k.regionBytes -= len(r.buf)
+	*r = regionState{gen: r.gen}
+}
+
+// releaseRegionsLocked frees every region owned by the task.
+func (k *Kernel) releaseRegionsLocked(id TaskID) {
+	for i := range k.regions {
+		if r := &k.regions[i]; r.buf != nil && r.owner == id {
+			k.freeRegionLocked(r)
+		}
+	}
+}
+
+// NewRegion allocates a shared-memory region owned by the calling task.
+//
+// The returned capability has RightRead|RightWrite. Grant access to another
+// task by restricting it and attaching it to a message (SendGrant, CallGrant).
+// The region is freed by FreeRegion or when the task exits or is killed.
+func (c *Context) NewRegion(size int) Capability {
+	if c.k == nil {
+		return Capability{}
+	}
+	c.exitIfKilled()
+	return c.k.allocRegion(size, c.taskID)
+}
+
+// MapRegion returns a []byte view of the region if the capability carries all
+// of the requested rights (RightRead, RightWrite).
+//
+// There is no memory protection: a view mapped for RightRead only must not be
+// written to. A view must not be used after the region is freed; a stale
+// capability fails to map.
+func (c *Context) MapRegion(region Capability, rights Rights) ([]byte, bool) {
+	if c == nil || c.k == nil {
+		return nil, false
+	}
+	if rights&^(RightRead|RightWrite) != 0 || region.rights&rights != rights {
+		return nil, false
+	}
+	c.k.mu.Lock()
+	defer c.k.mu.Unlock()
+	r := c.k.regionLocked(region)
+	if r == nil {
+		return nil, false
+	}
+	return r.buf[:len(r.buf):len(r.buf)], true
+}
+
+// FreeRegion frees a region owned by the calling task.
+func (c *Context) FreeRegion(region Capability) bool {
+	if c == nil || c.k == nil {
+		return false
+	}
+	c.k.mu.Lock()
+	defer c.k.mu.Unlock()
+	r := c.k.regionLocked(region)
+	if r == nil || r.owner != c.taskID {
+		return false
+	}
+	c.k.freeRegionLocked(r)
+	return true
+}
+
+// SendGrant is SendToCapResult with a shared-memory region grant attached in
+// Message.Grant. grant must be a region capability.
+func (c *Context) SendGrant(toCap Capability, kind uint16, payload []byte, xfer, grant Capability) SendResult {
+	if grant.valid() && !grant.isRegion() {
+		return SendErrInvalidGrant
+	}
+	return c.sendTo(toCap, kind, payload, xfer, sendOpts{grant: grant})
+}
+
+// CallGrant is Call with a shared-memory region grant attached in Message.Grant.
+func (c *Context) CallGrant(toCap Capability, kind uint16, payload []byte, grant Capability, timeoutTicks uint64) (Message, error) {
+	if grant.valid() && !grant.isRegion() {
+		return Message{}, SendErrInvalidGrant
+	}
+	return c.call(toCap, kind, payload, grant, timeoutTicks)
+}
@@ -0,0 +1,95 @@
+package kernel
+
+import "testing"
+
+func TestRegionGrantSharesMemory(t *testing.T) {
+	k := New()
+	inbox := k.NewEndpoint(RightSend | RightRecv)
+	ctx := &Context{k: k}
+
+	region := k.NewRegion(256)
+	buf, ok := ctx.MapRegion(region, RightRead|RightWrite)
+	if !ok || len(buf) != 256 {
+		t.Fatalf("expected 256-byte view, got ok=%v len=%d", ok, len(buf))
+	}
+	copy(buf, "hello")
+
+	if res := ctx.SendGrant(inbox.Restrict(RightSend), 1, nil, Capability{}, region.Restrict(RightRead)); res != SendOK {
+		t.Fatalf("SendGrant: %s", res)
+	}
+	msg, ok := ctx.TryRecv(inbox.Restrict(RightRecv))
+	if !ok {
+		t.Fatal("expected message")
+	}
+	if _, ok := ctx.MapRegion(msg.Grant, RightWrite); ok {
+		t.Fatal("expected read-only grant to refuse a writable mapping")
+	}
+	view, ok := ctx.MapRegion(msg.Grant, RightRead)
+	if !ok || string(view[:5]) != "hello" {
+		t.Fatalf("expected shared contents, got ok=%v", ok)
+	}
+}
+
+func TestSendGrantRejectsEndpointCapability(t *testing.T) {
+	k := New()
+	inbox := k.NewEndpoint(RightSend | RightRecv)
+	ctx := &Context{k: k}
+
+	if res := ctx.SendGrant(inbox.Restrict(RightSend), 1, nil, Capability{}, inbox); res != SendErrInvalidGrant {
+		t.Fatalf("expected SendErrInvalidGrant, got %s", res)
+	}
+	if _, ok := ctx.MapRegion(inbox, RightRead); ok {
+		t.Fatal("expected an endpoint capability not to map")
+	}
+}
+
+func TestRegionReleasedWithOwner(t *testing.T) {
+	k := New()
+	capCh := make(chan Capability, 1)
+	k.AddTask(taskFunc(func(ctx *Context) {
+		capCh <- ctx.NewRegion(maxRegionBytes)
+	}))
+	region := <-capCh
+	if !region.Valid() {
+		t.Fatal("expected region")
+	}
+	waitFor(t, "task reap", func() bool { return k.liveTasks() == 0 })
+
+	ctx := &Context{k: k}
+	if _, ok := ctx.MapRegion(region, RightRead); ok {
+		t.Fatal("expected stale region capability to fail")
+	}
+	if !k.NewRegion(maxRegionBytes).Valid() {
+		t.Fatal("expected the byte budget to be returned")
+	}
+}
+
+func TestRegionBudget(t *testing.T) {
+	k := New()
+	if !k.NewRegion(maxRegionBytes - 10).Valid() {
+		t.Fatal("expected region within budget")
+	}
+	if k.NewRegion(11).Valid() {
+		t.Fatal("expected allocation over budget to fail")
+	}
+	if k.NewRegion(0).Valid() {
+		t.Fatal("expected empty region to be rejected")
+	}
+}
+
+func TestFreeRegionRequiresOwner(t *testing.T) {
+	k := New()
+	region := k.NewRegion(16)
+
+	other := &Context{k: k, taskID: 3}
+	if other.FreeRegion(region) {
+		t.Fatal("expected FreeRegion by a non-owner to fail")
+	}
+	owner := &Context{k: k}
+	if !owner.FreeRegion(region) {
+		t.Fatal("expected FreeRegion by the owner to succeed")
+	}
+	if _, ok := owner.MapRegion(region, RightRead); ok {
+		t.Fatal("expected freed region not to map")
+	}
+}
@@ -0,0 +1,208 @@
+package kernel
+
+import "fmt"
+
+const (
+	// exitNotifyTicks bounds how long an exiting task waits for room in its
+	// supervisor's mailbox.
+	exitNotifyTicks = 100
+	// maxExitStackBytes caps the panic stack attached to an exit notice.
+	maxExitStackBytes = 4 << 10
+)
+
+// ExitReason tells why a task stopped.
+type ExitReason uint8
+
+const (
+	// ExitNormal means Run returned or the task called Context.Exit.
+	ExitNormal ExitReason = iota
+	// ExitKilled means the task was killed.
+	ExitKilled
+	// ExitPanic means the task panicked.
+	ExitPanic
+)
+
+func (r ExitReason) String() string {
+	switch r {
+	case ExitNormal:
+		return "exit"
+	case ExitKilled:
+		return "killed"
+	case ExitPanic:
+		return "panic"
+	default:
+		return "unknown"
+	}
+}
+
+// TaskExit describes an exited task to its supervisor.
+type TaskExit struct {
+	Task   TaskID
+	Parent TaskID
+	Name   string
+	Reason ExitReason
+	// Value is the panic value, formatted with %v.
+	Value string
+	// StackLen is the size of the panic stack in the notice's Grant region
+	// (0 = no stack attached).
+	StackLen uint32
+}
+
+// ExitEncoder turns an exit into the kind and payload of the notice sent to
+// a supervisor. The kernel knows no message protocol; the supervising
+// service supplies it.
+type ExitEncoder func(TaskExit) (kind uint16, payload []byte)
+
+// supervisorRef is where a supervisor's exit notices go and how they are
+// encoded.
+type supervisorRef struct {
+	ep  Capability
+	enc ExitEncoder
+}
+
+// TaskOptions configures a task started with AddTaskWith.
+type TaskOptions struct {
+	// Core marks a task the system cannot run without. A panic in a core
+	// task switches the whole system to panic mode (see SetPanicHandler);
+	// a panic in any other task only terminates that task.
+	Core bool
+}
+
+// AddTaskWith is AddTask with options.
+func (k *Kernel) AddTaskWith(t Task, opts TaskOptions) TaskID {
+	return k.spawn(t, NoTask, opts)
+}
+
+// AddTaskWith is AddTask with options.
+func (c *Context) AddTaskWith(t Task, opts TaskOptions) TaskID {
+	if c.k == nil {
+		return NoTask
+	}
+	c.exitIfKilled()
+	return c.k.spawn(t, c.taskID, opts)
+}
+
+// SetSupervisor registers the endpoint that receives an exit notice, encoded
+// by enc, when a task without a parent exits, including tasks orphaned by
+// their parent. An invalid capability unregisters it.
+func (k *Kernel) SetSupervisor(epCap Capability, enc ExitEncoder) {
+	if enc == nil {
+		epCap = Capability{}
+	}
+	k.mu.Lock()
+	k.supervisor = supervisorRef{ep: epCap, enc: enc}
+	k.mu.Unlock()
+}
+
+// SetSupervisor registers the endpoint that receives an exit notice, encoded
+// by enc, when one of the calling task's children exits. An invalid
+// capability unregisters it.
+//
+// The notice carries the exit reason, the task name and, for panics, the
+// panic value. The panic stack is attached as a read-only region grant owned
+// by the task receiving on epCap (or else the endpoint's owner); the receiver
+// should FreeRegion it.
+func (c *Context) SetSupervisor(epCap Capability, enc ExitEncoder) bool {
+	if c == nil || c.k == nil || c.gen == 0 {
+		return false
+	}
+	if epCap.valid() && (!epCap.canSend() || enc == nil) {
+		return false
+	}
+	c.k.mu.Lock()
+	defer c.k.mu.Unlock()
+	st := c.k.taskLocked(c.taskID)
+	if st == nil || st.gen != c.gen || st.task == nil {
+		return false
+	}
+	st.supervisor = supervisorRef{ep: epCap, enc: enc}
+	return true
+}
+
+func (k *Kernel) isCore(id TaskID, gen uint32) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	st := k.taskLocked(id)
+	return st != nil && st.gen == gen && st.core
+}
+
+type taskExit struct {
+	id     TaskID
+	parent TaskID
+	name   string
+	killed bool
+	panic  *PanicInfo
+}
+
+// notifyExit sends an exit notice to the supervisor of a reaped task.
+func (k *Kernel) notifyExit(exit taskExit) {
+	if InPanicMode() {
+		return
+	}
+
+	k.mu.Lock()
+	sup := k.supervisor
+	if st := k.taskLocked(exit.parent); st != nil && st.task != nil {
+		sup = st.supervisor
+	}
+	to := sup.ep
+	var owner TaskID
+	if to.valid() && int(to.ep) < maxEndpoints {
+		if ep := &k.endpoints[to.ep]; ep.gen == to.gen {
+			owner = ep.receiver
+			if owner == NoTask {
+				owner = ep.owner
+			}
+		}
+	}
+	deadline := k.tick + exitNotifyTicks
+	k.mu.Unlock()
+	if !to.valid() {
+		return
+	}
+
+	e := TaskExit{Task: exit.id, Parent: exit.parent, Name: exit.name}
+	var grant Capability
+	switch {
+	case exit.panic != nil:
+		e.Reason = ExitPanic
+		e.Value = fmt.Sprint(exit.panic.Value)
+		var n int
+		grant, n = k.stackRegion(exit.panic.Stack, owner)
+		e.StackLen = uint32(n)
+	case exit.killed:
+		e.Reason = ExitKilled
+	}
+
+	kind, payload := sup.enc(e)
+	res := k.sendWith(0, to, kind, payload, Capability{},
+		sendOpts{grant: grant.Restrict(RightRead), block: true, deadline: deadline})
+	if res != SendOK && grant.valid() {
+		k.mu.Lock()
+		if r := k.regionLocked(grant); r != nil {
+			k.freeRegionLocked(r)
+		}
+		k.mu.Unlock()
+	}
+}
+
+// stackRegion copies a panic stack into a new region owned by owner and
+// returns it with the number of bytes copied.
+func (k *Kernel) stackRegion(stack []byte, owner TaskID) (Capability, int) {
+	if len(stack) == 0 || owner == NoTask {
+		return Capability{}, 0
+	}
+	if len(stack) > maxExitStackBytes {
+		stack = stack[:maxExitStackBytes]
+	}
+	grant := k.allocRegion(len(stack), owner)
+	if !grant.valid() {
+		return Capability{}, 0
+	}
+	k.mu.Lock()
+	if r := k.regionLocked(grant); r != nil {
+		copy(r.buf, stack)
+	}
+	k.mu.Unlock()
+	return grant, len(stack)
+}
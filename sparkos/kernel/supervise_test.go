@@ -0,0 +1,124 @@
+package kernel
+
+import (
+	"strings"
+	"testing"
+)
+
+// exitKind is the kind of the exit notices in these tests.
+const exitKind = 7
+
+// exitRecorder is an ExitEncoder that hands every exit to the test as well.
+func exitRecorder(exits chan<- TaskExit) ExitEncoder {
+	return func(e TaskExit) (uint16, []byte) {
+		exits <- e
+		return exitKind, nil
+	}
+}
+
+func TestPanicIsContainedAndReported(t *testing.T) {
+	k := New()
+	other := k.NewEndpoint(RightSend | RightRecv)
+
+	type report struct {
+		exit  TaskExit
+		stack string
+		ok    bool
+	}
+	exits := make(chan TaskExit, 1)
+	reports := make(chan report, 1)
+	k.AddTask(taskFunc(func(ctx *Context) {
+		inbox := ctx.NewEndpoint(RightSend | RightRecv)
+		ctx.SetSupervisor(inbox.Restrict(RightSend), exitRecorder(exits))
+		ctx.AddTask(taskFunc(func(ctx *Context) {
+			ctx.NewEndpoint(RightSend | RightRecv)
+			panic("boom")
+		}))
+		msg, _ := ctx.Recv(inbox.Restrict(RightRecv))
+		r := report{exit: <-exits, ok: msg.Kind == exitKind}
+		if buf, mapped := ctx.MapRegion(msg.Grant, RightRead); mapped {
+			r.stack = string(buf)
+			ctx.FreeRegion(msg.Grant)
+		}
+		reports <- r
+		ctx.WaitTick(ctx.NowTick() + 1_000_000)
+	}))
+
+	r := <-reports
+	if !r.ok || r.exit.Reason != ExitPanic || r.exit.Value != "boom" || r.exit.Name != "kernel.taskFunc" {
+		t.Fatalf("unexpected report %+v", r)
+	}
+	if r.exit.StackLen == 0 || int(r.exit.StackLen) != len(r.stack) || !strings.Contains(r.stack, "goroutine") {
+		t.Fatalf("expected the panic stack in the grant, got %d bytes: %q", r.exit.StackLen, r.stack)
+	}
+
+	if InPanicMode() {
+		t.Fatal("a non-core panic must not switch the system to panic mode")
+	}
+	waitFor(t, "task reap", func() bool { return k.liveTasks() == 1 })
+	if got := k.liveEndpoints(); got != 2 {
+		t.Fatalf("expected the panicking task's endpoint to be released, %d live", got)
+	}
+	ctx := &Context{k: k}
+	if res := ctx.SendToCapResult(other.Restrict(RightSend), 1, nil, Capability{}); res != SendOK {
+		t.Fatalf("expected the system to keep running, send returned %s", res)
+	}
+}
+
+func TestWorkerPanicEndsItsTask(t *testing.T) {
+	k := New()
+	sup := k.NewEndpoint(RightSend | RightRecv)
+	exits := make(chan TaskExit, 1)
+	k.SetSupervisor(sup.Restrict(RightSend), exitRecorder(exits))
+
+	id := k.AddTask(taskFunc(func(ctx *Context) {
+		inbox := ctx.NewEndpoint(RightSend | RightRecv)
+		ctx.Go(func() { panic("worker") })
+		ctx.Recv(inbox.Restrict(RightRecv))
+	}))
+
+	ctx := &Context{k: k}
+	msg, ok := ctx.Recv(sup.Restrict(RightRecv))
+	if !ok || msg.Kind != exitKind {
+		t.Fatalf("expected an exit notice, got ok=%v kind=%d", ok, msg.Kind)
+	}
+	if e := <-exits; e.Reason != ExitPanic || e.Task != id || e.Value != "worker" {
+		t.Fatalf("expected task %d to exit with the worker's panic, got %+v", id, e)
+	}
+	if msg.Grant.Valid() {
+		ctx.FreeRegion(msg.Grant)
+	}
+	if InPanicMode() {
+		t.Fatal("a worker panic must not switch the system to panic mode")
+	}
+	waitFor(t, "task reap", func() bool { return k.liveTasks() == 0 })
+}
+
+func TestExitReasonsGoToKernelSupervisor(t *testing.T) {
+	k := New()
+	ticker(t, k)
+	sup := k.NewEndpointWith(RightSend|RightRecv, EndpointOptions{Depth: 4})
+	exits := make(chan TaskExit, 4)
+	k.SetSupervisor(sup.Restrict(RightSend), exitRecorder(exits))
+
+	k.AddTask(taskFunc(func(ctx *Context) {}))
+	id := k.AddTask(taskFunc(func(ctx *Context) { ctx.BlockOnTick(); ctx.WaitTick(ctx.NowTick() + 1_000_000) }))
+
+	ctx := &Context{k: k}
+	recv := func() TaskExit {
+		t.Helper()
+		msg, ok := ctx.Recv(sup.Restrict(RightRecv))
+		if !ok || msg.Kind != exitKind {
+			t.Fatalf("expected an exit notice, got ok=%v kind=%d", ok, msg.Kind)
+		}
+		return <-exits
+	}
+
+	if e := recv(); e.Reason != ExitNormal {
+		t.Fatalf("expected a normal exit, got %+v", e)
+	}
+	k.Kill(id)
+	if e := recv(); e.Reason != ExitKilled || e.Task != id {
+		t.Fatalf("expected task %d killed, got %+v", id, e)
+	}
+}
@@ -0,0 +1,225 @@
+package kernel
+
+type taskState struct {
+	task Task
+
+	// gen is bumped every time the slot is reused so that a Context of an
+	// exited task can never act on behalf of the slot's next occupant.
+	gen    uint32
+	parent TaskID
+	killed bool
+	// core tasks switch the whole system to panic mode when they panic.
+	core bool
+	// supervisor receives exit notices for the task's children.
+	supervisor supervisorRef
+	// panic is the first panic of any of the task's goroutines.
+	panic *PanicInfo
+
+	// Introspection, see Kernel.Tasks.
+	name      string
+	state     TaskState
+	blockedOn Endpoint
+	sent      uint32
+	received  uint32
+	dropped   uint32
+	// busy counts the ticks at which the task was sampled busy, samples
+	// every tick sampled since it started (see sampleLocked).
+	busy    uint32
+	samples uint32
+	// yielded is set by Context.Yield and cleared by the next sample.
+	yielded bool
+}
+
+func (k *Kernel) spawn(t Task, parent TaskID, opts TaskOptions) TaskID {
+	if t == nil {
+		return NoTask
+	}
+
+	k.mu.Lock()
+	if k.taskCount >= maxTasks {
+		k.mu.Unlock()
+		return NoTask
+	}
+	slot := -1
+	for i := 0; i < maxTasks; i++ {
+		idx := (k.nextTask + i) % maxTasks
+		if k.tasks[idx].task == nil {
+			slot = idx
+			break
+		}
+	}
+	if slot < 0 {
+		k.mu.Unlock()
+		return NoTask
+	}
+	k.nextTask = (slot + 1) % maxTasks
+	k.taskCount++
+
+	st := &k.tasks[slot]
+	st.gen++
+	if st.gen == 0 {
+		st.gen++
+	}
+	*st = taskState{task: t, gen: st.gen, parent: parent, core: opts.Core, name: taskName(t)}
+
+	ctx := &Context{k: k, taskID: TaskID(slot + 1), gen: st.gen}
+	k.mu.Unlock()
+
+	go k.runTask(ctx, t)
+	return ctx.taskID
+}
+
+func (k *Kernel) runTask(ctx *Context, t Task) {
+	// Registered first so it runs last: the slot is reclaimed after the task
+	// returns, calls Context.Exit, or is unwound after a kill or a panic.
+	defer func() {
+		if exit, ok := k.reap(ctx.taskID, ctx.gen); ok {
+			k.notifyExit(exit)
+		}
+	}()
+	defer func() {
+		if r := recover(); r != nil {
+			k.contain(ctx, r)
+		}
+	}()
+	t.Run(ctx)
+}
+
+// contain handles a panic r of a goroutine of ctx's task. A core task switches
+// the system to panic mode. Any other records the panic for its exit notice
+// and is killed, which revokes its endpoints and regions and unwinds its
+// other goroutines.
+func (k *Kernel) contain(ctx *Context, r any) {
+	info := PanicInfo{TaskID: ctx.taskID, Value: r}
+	if k.isCore(ctx.taskID, ctx.gen) {
+		triggerPanic(info)
+		return
+	}
+	info.Stack = captureStack()
+
+	k.mu.Lock()
+	if st := k.taskLocked(ctx.taskID); st != nil && st.gen == ctx.gen && st.task != nil && st.panic == nil {
+		st.panic = &info
+	}
+	k.mu.Unlock()
+	k.kill(ctx.taskID, NoTask, false)
+}
+
+// reap frees the task slot and every endpoint and region the task owned.
+func (k *Kernel) reap(id TaskID, gen uint32) (exit taskExit, ok bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	st := k.taskLocked(id)
+	if st == nil || st.gen != gen || st.task == nil {
+		return taskExit{}, false
+	}
+	exit = taskExit{id: id, parent: st.parent, name: st.name, killed: st.killed, panic: st.panic}
+	k.releaseEndpointsLocked(id, st.killed)
+	k.releaseRegionsLocked(id)
+	st.task = nil
+	st.parent = NoTask
+	st.killed = false
+	st.supervisor = supervisorRef{}
+	st.panic = nil
+	k.taskCount--
+
+	for i := range k.tasks {
+		if k.tasks[i].task != nil && k.tasks[i].parent == id {
+			k.tasks[i].parent = NoTask
+		}
+	}
+	return exit, true
+}
+
+// Kill terminates a task regardless of its parent.
+//
+// Termination is cooperative: the task's endpoints are revoked immediately,
+// and its goroutines unwind at their next blocking kernel call
+// (Recv, BlockOnTick, WaitTick) or Context.Yield. A goroutine that computes
+// without either never unwinds. The slot is reclaimed once the task's Run
+// goroutine has unwound.
+//
+// Kill reports whether a live task was found.
+func (k *Kernel) Kill(id TaskID) bool {
+	return k.kill(id, NoTask, false)
+}
+
+func (k *Kernel) kill(id TaskID, by TaskID, checkParent bool) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	st := k.taskLocked(id)
+	if st == nil || st.task == nil || st.killed {
+		return false
+	}
+	if checkParent && st.parent != by {
+		return false
+	}
+	st.killed = true
+	k.releaseEndpointsLocked(id, true)
+	k.releaseRegionsLocked(id)
+	k.wakeLocked()
+	return true
+}
+
+// releaseEndpointsLocked frees every endpoint owned by the task.
+//
+// If reset is set, endpoints owned by someone else that the task was receiving
+// from get a fresh mailbox: the old channel is closed so that goroutines left
+// behind by the task stop reading, and the endpoint (and every capability for
+// it) keeps working for the next receiver. Pending messages are discarded.
+func (k *Kernel) releaseEndpointsLocked(id TaskID, reset bool) {
+	for i := range k.endpoints {
+		ep := &k.endpoints[i]
+		if ep.ch == nil {
+			continue
+		}
+		switch {
+		case ep.owner == id:
+			k.freeEndpointLocked(ep)
+		case reset && ep.receiver == id:
+			ep.closeMailbox()
+			ep.openMailbox(EndpointOptions{Depth: ep.depth, Urgent: ep.urgent != nil})
+			ep.receiver = NoTask
+		case ep.receiver == id:
+			ep.receiver = NoTask
+		}
+	}
+}
+
+// freeEndpointLocked closes the endpoint's mailbox and returns the slot to the
+// allocator. The generation is kept so the next allocation can bump it.
+func (k *Kernel) freeEndpointLocked(ep *endpointState) {
+	ep.closeMailbox()
+	*ep = endpointState{gen: ep.gen}
+	k.endpointCount--
+}
+
+func (k *Kernel) taskLocked(id TaskID) *taskState {
+	if id == NoTask || int(id) > maxTasks {
+		return nil
+	}
+	return &k.tasks[id-1]
+}
+
+// deadLocked reports whether the task identified by (id, gen) was killed or has
+// already been reaped.
+//
+// A zero gen marks a detached context (not started via AddTask); it is never dead.
+func (k *Kernel) deadLocked(id TaskID, gen uint32) bool {
+	if gen == 0 {
+		return false
+	}
+	st := k.taskLocked(id)
+	if st == nil {
+		return true
+	}
+	return st.gen != gen || st.task == nil || st.killed
+}
+
+func (k *Kernel) dead(id TaskID, gen uint32) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.deadLocked(id, gen)
+}
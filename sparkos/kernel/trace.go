@@ -0,0 +1,177 @@
+package kernel
+
+import "sync/atomic"
+
+const (
+	// TracePrefixBytes is how much of each payload a trace event keeps.
+	TracePrefixBytes = 32
+
+	defaultTraceEvents = 128
+	maxTraceEvents     = 1024
+)
+
+// TraceOp identifies a traced IPC operation.
+type TraceOp uint8
+
+const (
+	TraceSend TraceOp = iota + 1
+	TraceRecv
+)
+
+func (op TraceOp) String() string {
+	switch op {
+	case TraceSend:
+		return "send"
+	case TraceRecv:
+		return "recv"
+	default:
+		return "unknown"
+	}
+}
+
+// TraceEvent is one recorded send or receive.
+type TraceEvent struct {
+	Tick uint64
+	Op   TraceOp
+	// Task is the sending or receiving task; NoTask for the kernel and
+	// detached contexts.
+	Task TaskID
+	From Endpoint
+	To   Endpoint
+	Kind uint16
+	Len  uint16
+	// Prefix holds the first TracePrefixBytes of the payload.
+	Prefix [TracePrefixBytes]byte
+	// Cap and Grant report a capability transfer and a region grant.
+	Cap   bool
+	Grant bool
+	// Result is the outcome of a send; it is SendOK for receives.
+	Result SendResult
+}
+
+// Payload returns the recorded part of the payload.
+func (e TraceEvent) Payload() []byte {
+	n := int(e.Len)
+	if n > TracePrefixBytes {
+		n = TracePrefixBytes
+	}
+	return e.Prefix[:n]
+}
+
+// Truncated reports whether the payload was longer than the recorded prefix.
+func (e TraceEvent) Truncated() bool { return int(e.Len) > TracePrefixBytes }
+
+type traceRing struct {
+	buf  []TraceEvent
+	next int
+	full bool
+}
+
+func (r *traceRing) add(ev TraceEvent) {
+	r.buf[r.next] = ev
+	r.next++
+	if r.next == len(r.buf) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+func (r *traceRing) events() []TraceEvent {
+	if !r.full {
+		return append([]TraceEvent(nil), r.buf[:r.next]...)
+	}
+	out := make([]TraceEvent, 0, len(r.buf))
+	out = append(out, r.buf[r.next:]...)
+	return append(out, r.buf[:r.next]...)
+}
+
+// StartTrace starts recording IPC events into a ring buffer of n events,
+// discarding any previous trace. n <= 0 selects the default (128); n is
+// clamped to 1024.
+//
+// Sends are recorded in the kernel send path, receives in Context.Recv and
+// Context.TryRecv. Messages read directly from a RecvChan channel are not
+// recorded.
+func (k *Kernel) StartTrace(n int) {
+	if n <= 0 {
+		n = defaultTraceEvents
+	}
+	if n > maxTraceEvents {
+		n = maxTraceEvents
+	}
+	k.mu.Lock()
+	k.trace = &traceRing{buf: make([]TraceEvent, n)}
+	atomic.StoreUint32(&k.tracing, 1)
+	k.mu.Unlock()
+}
+
+// StopTrace stops recording. The recorded events stay available to TraceEvents.
+func (k *Kernel) StopTrace() {
+	atomic.StoreUint32(&k.tracing, 0)
+}
+
+// Tracing reports whether IPC events are being recorded.
+func (k *Kernel) Tracing() bool { return atomic.LoadUint32(&k.tracing) != 0 }
+
+// TraceEvents returns the recorded events, oldest first.
+func (k *Kernel) TraceEvents() []TraceEvent {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.trace == nil {
+		return nil
+	}
+	return k.trace.events()
+}
+
+// StartTrace is Kernel.StartTrace for the kernel the task runs on.
+func (c *Context) StartTrace(n int) {
+	if c != nil && c.k != nil {
+		c.k.StartTrace(n)
+	}
+}
+
+// StopTrace is Kernel.StopTrace for the kernel the task runs on.
+func (c *Context) StopTrace() {
+	if c != nil && c.k != nil {
+		c.k.StopTrace()
+	}
+}
+
+// Tracing is Kernel.Tracing for the kernel the task runs on.
+func (c *Context) Tracing() bool {
+	return c != nil && c.k != nil && c.k.Tracing()
+}
+
+// TraceEvents is Kernel.TraceEvents for the kernel the task runs on.
+func (c *Context) TraceEvents() []TraceEvent {
+	if c == nil || c.k == nil {
+		return nil
+	}
+	return c.k.TraceEvents()
+}
+
+// traceMsg records msg if tracing is on.
+func (k *Kernel) traceMsg(op TraceOp, task TaskID, msg *Message, res SendResult) {
+	if atomic.LoadUint32(&k.tracing) == 0 {
+		return
+	}
+	ev := TraceEvent{
+		Op:     op,
+		Task:   task,
+		From:   msg.From,
+		To:     msg.To,
+		Kind:   msg.Kind,
+		Len:    msg.Len,
+		Cap:    msg.Cap.valid(),
+		Grant:  msg.Grant.valid(),
+		Result: res,
+	}
+	copy(ev.Prefix[:], msg.Payload())
+
+	k.mu.Lock()
+	if k.trace != nil && atomic.LoadUint32(&k.tracing) != 0 {
+		ev.Tick = k.tick
+		k.trace.add(ev)
+	}
+	k.mu.Unlock()
+}
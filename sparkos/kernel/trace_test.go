@@ -0,0 +1,62 @@
+package kernel
+
+import "testing"
+
+func TestTraceRecordsSendAndRecv(t *testing.T) {
+	k := New()
+	ep := k.NewEndpointWith(RightSend|RightRecv, EndpointOptions{Depth: 1})
+	ctx := &Context{k: k}
+
+	ctx.SendToCapResult(ep.Restrict(RightSend), 1, []byte("untraced"), Capability{})
+	ctx.TryRecv(ep.Restrict(RightRecv))
+
+	k.StartTrace(0)
+	k.TickTo(7)
+	long := make([]byte, MaxMessageBytes)
+	for i := range long {
+		long[i] = byte(i)
+	}
+	ctx.SendToCapResult(ep.Restrict(RightSend), 2, long, ep.Restrict(RightSend))
+	ctx.SendToCapResult(ep.Restrict(RightSend), 3, []byte("full"), Capability{})
+	ctx.TryRecv(ep.Restrict(RightRecv))
+	k.StopTrace()
+	ctx.SendToCapResult(ep.Restrict(RightSend), 4, nil, Capability{})
+
+	evs := k.TraceEvents()
+	if len(evs) != 3 {
+		t.Fatalf("expected 3 events, got %d: %+v", len(evs), evs)
+	}
+	send, full, recv := evs[0], evs[1], evs[2]
+	if send.Op != TraceSend || send.Kind != 2 || send.Tick != 7 || send.To != ep.ep || !send.Cap || send.Result != SendOK {
+		t.Fatalf("unexpected send event %+v", send)
+	}
+	if !send.Truncated() || len(send.Payload()) != TracePrefixBytes || send.Payload()[5] != 5 {
+		t.Fatalf("expected a truncated payload prefix, got %v", send.Payload())
+	}
+	if full.Kind != 3 || full.Result != SendErrQueueFull || string(full.Payload()) != "full" {
+		t.Fatalf("unexpected queue-full event %+v", full)
+	}
+	if recv.Op != TraceRecv || recv.Kind != 2 {
+		t.Fatalf("unexpected recv event %+v", recv)
+	}
+}
+
+func TestTraceRingKeepsNewest(t *testing.T) {
+	k := New()
+	ep := k.NewEndpointWith(RightSend|RightRecv, EndpointOptions{Depth: 64})
+	ctx := &Context{k: k}
+
+	k.StartTrace(4)
+	for i := 0; i < 10; i++ {
+		ctx.SendToCapResult(ep.Restrict(RightSend), uint16(i), nil, Capability{})
+	}
+	evs := k.TraceEvents()
+	if len(evs) != 4 {
+		t.Fatalf("expected 4 events, got %d", len(evs))
+	}
+	for i, ev := range evs {
+		if want := uint16(6 + i); ev.Kind != want {
+			t.Fatalf("event %d: expected kind %d, got %d", i, want, ev.Kind)
+		}
+	}
+}
@@ -25,6 +25,8 @@ const (
 	AppSerialTerm AppID = 18
 	AppUsers      AppID = 19
 	AppQuarkDonut AppID = 20
+	AppLauncher   AppID = 21
+	AppRun        AppID = 22
 )
 
 // AppSelectPayload encodes an app selection request.
@@ -0,0 +1,18 @@
+package proto
+
+// AppStatePayload encodes MsgAppSuspend and MsgAppResume: the VFS path the
+// app saves its state to before it exits, or restores it from after a start.
+//
+// Payload format:
+//
+//	path[]byte
+func AppStatePayload(path string) []byte {
+	return []byte(path)
+}
+
+func DecodeAppStatePayload(b []byte) (path string, ok bool) {
+	if len(b) == 0 {
+		return "", false
+	}
+	return string(b), true
+}
@@ -0,0 +1,135 @@
+package proto
+
+import "encoding/binary"
+
+// SurfaceKeyRGB565 is the color key of overlay surfaces: pixels of this
+// value are not drawn, so the layers below show through.
+const SurfaceKeyRGB565 = 0xF81F
+
+// SurfaceCreatePayload encodes an overlay surface request.
+//
+// Payload format (little-endian):
+//
+//	u32 requestID
+//	i16 x, i16 y   // top-left corner on screen
+//	u16 w, u16 h
+//	u8  z          // 1..255, higher is on top of lower; 0 is the screen
+//
+// The pixels live in a region granted in Message.Grant (RGB565, w*h*2 bytes,
+// RightRead at least); the reply capability is in Message.Cap. The reply is
+// MsgSurfaceCreateResp, or MsgError with ErrBadMessage, ErrTooLarge or ErrBusy.
+func SurfaceCreatePayload(requestID uint32, x, y int16, w, h uint16, z uint8) []byte {
+	b := make([]byte, 13)
+	binary.LittleEndian.PutUint32(b[0:4], requestID)
+	putRect(b[4:12], x, y, w, h)
+	b[12] = z
+	return b
+}
+
+func DecodeSurfaceCreatePayload(b []byte) (requestID uint32, x, y int16, w, h uint16, z uint8, ok bool) {
+	if len(b) != 13 {
+		return 0, 0, 0, 0, 0, 0, false
+	}
+	x, y, w, h = getRect(b[4:12])
+	return binary.LittleEndian.Uint32(b[0:4]), x, y, w, h, b[12], true
+}
+
+// SurfaceCreateRespPayload encodes a surface creation response.
+//
+// Payload format (little-endian):
+//
+//	u32 requestID
+//	u8  surfaceID
+func SurfaceCreateRespPayload(requestID uint32, id uint8) []byte {
+	b := make([]byte, 5)
+	binary.LittleEndian.PutUint32(b[0:4], requestID)
+	b[4] = id
+	return b
+}
+
+func DecodeSurfaceCreateRespPayload(b []byte) (requestID uint32, id uint8, ok bool) {
+	if len(b) != 5 {
+		return 0, 0, false
+	}
+	return binary.LittleEndian.Uint32(b[0:4]), b[4], true
+}
+
+// SurfaceDamagePayload encodes a one-way redraw request for a rectangle of a
+// surface, in surface coordinates. w or h 0 means the whole surface.
+//
+// Payload format (little-endian):
+//
+//	u8  surfaceID
+//	i16 x, i16 y
+//	u16 w, u16 h
+func SurfaceDamagePayload(id uint8, x, y int16, w, h uint16) []byte {
+	b := make([]byte, 9)
+	b[0] = id
+	putRect(b[1:9], x, y, w, h)
+	return b
+}
+
+func DecodeSurfaceDamagePayload(b []byte) (id uint8, x, y int16, w, h uint16, ok bool) {
+	if len(b) != 9 {
+		return 0, 0, 0, 0, 0, false
+	}
+	x, y, w, h = getRect(b[1:9])
+	return b[0], x, y, w, h, true
+}
+
+// SurfaceConfigPayload encodes a one-way move/restack/show/hide request.
+//
+// Payload format (little-endian):
+//
+//	u8  surfaceID
+//	i16 x, i16 y
+//	u8  z
+//	u8  visible (0/1)
+func SurfaceConfigPayload(id uint8, x, y int16, z uint8, visible bool) []byte {
+	b := make([]byte, 7)
+	b[0] = id
+	binary.LittleEndian.PutUint16(b[1:3], uint16(x))
+	binary.LittleEndian.PutUint16(b[3:5], uint16(y))
+	b[5] = z
+	if visible {
+		b[6] = 1
+	}
+	return b
+}
+
+func DecodeSurfaceConfigPayload(b []byte) (id uint8, x, y int16, z uint8, visible bool, ok bool) {
+	if len(b) != 7 {
+		return 0, 0, 0, 0, false, false
+	}
+	x = int16(binary.LittleEndian.Uint16(b[1:3]))
+	y = int16(binary.LittleEndian.Uint16(b[3:5]))
+	return b[0], x, y, b[5], b[6] != 0, true
+}
+
+// SurfaceDestroyPayload encodes a one-way surface removal.
+//
+// Payload format:
+//
+//	u8 surfaceID
+func SurfaceDestroyPayload(id uint8) []byte {
+	return []byte{id}
+}
+
+func DecodeSurfaceDestroyPayload(b []byte) (id uint8, ok bool) {
+	if len(b) != 1 {
+		return 0, false
+	}
+	return b[0], true
+}
+
+func putRect(b []byte, x, y int16, w, h uint16) {
+	binary.LittleEndian.PutUint16(b[0:2], uint16(x))
+	binary.LittleEndian.PutUint16(b[2:4], uint16(y))
+	binary.LittleEndian.PutUint16(b[4:6], w)
+	binary.LittleEndian.PutUint16(b[6:8], h)
+}
+
+func getRect(b []byte) (x, y int16, w, h uint16) {
+	return int16(binary.LittleEndian.Uint16(b[0:2])), int16(binary.LittleEndian.Uint16(b[2:4])),
+		binary.LittleEndian.Uint16(b[4:6]), binary.LittleEndian.Uint16(b[6:8])
+}
@@ -30,8 +30,9 @@ func DecodeMuxStatusPayload(b []byte) (requestID uint32, ok bool) {
 //	u8  activeAppID
 //	u8  focusApp   (0/1)
 //	u8  hasApp     (0/1)  // selected app capability exists in this build
-func MuxStatusRespPayload(requestID uint32, activeAppID AppID, focusApp bool, hasApp bool) []byte {
-	b := make([]byte, 7)
+//	u8  consoles[] // apps with a virtual console, in console order (1..n)
+func MuxStatusRespPayload(requestID uint32, activeAppID AppID, focusApp bool, hasApp bool, consoles []AppID) []byte {
+	b := make([]byte, 7+len(consoles))
 	binary.LittleEndian.PutUint32(b[0:4], requestID)
 	b[4] = byte(activeAppID)
 	if focusApp {
@@ -40,12 +41,35 @@ func MuxStatusRespPayload(requestID uint32, activeAppID AppID, focusApp bool, ha
 	if hasApp {
 		b[6] = 1
 	}
+	for i, id := range consoles {
+		b[7+i] = byte(id)
+	}
 	return b
 }
 
-func DecodeMuxStatusRespPayload(b []byte) (requestID uint32, activeAppID AppID, focusApp bool, hasApp bool, ok bool) {
-	if len(b) != 7 {
-		return 0, 0, false, false, false
+func DecodeMuxStatusRespPayload(b []byte) (requestID uint32, activeAppID AppID, focusApp bool, hasApp bool, consoles []AppID, ok bool) {
+	if len(b) < 7 {
+		return 0, 0, false, false, nil, false
+	}
+	for _, id := range b[7:] {
+		consoles = append(consoles, AppID(id))
+	}
+	return binary.LittleEndian.Uint32(b[0:4]), AppID(b[4]), b[5] != 0, b[6] != 0, consoles, true
+}
+
+// MuxSwitchPayload encodes a request to focus a virtual console: the app id,
+// or AppNone for the shell.
+//
+// Payload format:
+//
+//	u8 appID
+func MuxSwitchPayload(id AppID) []byte {
+	return []byte{byte(id)}
+}
+
+func DecodeMuxSwitchPayload(b []byte) (id AppID, ok bool) {
+	if len(b) != 1 {
+		return AppNone, false
 	}
-	return binary.LittleEndian.Uint32(b[0:4]), AppID(b[4]), b[5] != 0, b[6] != 0, true
+	return AppID(b[0]), true
 }
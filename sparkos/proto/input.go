@@ -0,0 +1,60 @@
+package proto
+
+import "encoding/binary"
+
+// InputEvent is one key event of MsgInputEvent. Code and Mods carry
+// hal.KeyCode and hal.Modifier values; Scancode is the keyboard's own code.
+type InputEvent struct {
+	Code     uint16
+	Rune     rune
+	Scancode uint16
+	Mods     uint8
+	Press    bool
+	// Repeat marks a press generated by key repeat while the key is held.
+	Repeat bool
+}
+
+const (
+	inputEventBytes = 10
+
+	inputFlagPress  = 1 << 0
+	inputFlagRepeat = 1 << 1
+)
+
+// InputEventPayload encodes MsgInputEvent.
+//
+// Payload format:
+//
+//	u16 code
+//	u32 rune
+//	u16 scancode
+//	u8  mods
+//	u8  flags (bit0 press, bit1 repeat)
+func InputEventPayload(e InputEvent) []byte {
+	b := make([]byte, inputEventBytes)
+	binary.LittleEndian.PutUint16(b[0:2], e.Code)
+	binary.LittleEndian.PutUint32(b[2:6], uint32(e.Rune))
+	binary.LittleEndian.PutUint16(b[6:8], e.Scancode)
+	b[8] = e.Mods
+	if e.Press {
+		b[9] |= inputFlagPress
+	}
+	if e.Repeat {
+		b[9] |= inputFlagRepeat
+	}
+	return b
+}
+
+func DecodeInputEventPayload(b []byte) (InputEvent, bool) {
+	if len(b) != inputEventBytes {
+		return InputEvent{}, false
+	}
+	return InputEvent{
+		Code:     binary.LittleEndian.Uint16(b[0:2]),
+		Rune:     rune(binary.LittleEndian.Uint32(b[2:6])),
+		Scancode: binary.LittleEndian.Uint16(b[6:8]),
+		Mods:     b[8],
+		Press:    b[9]&inputFlagPress != 0,
+		Repeat:   b[9]&inputFlagRepeat != 0,
+	}, true
+}
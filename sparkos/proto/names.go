@@ -0,0 +1,76 @@
+package proto
+
+import (
+	"encoding/binary"
+	"strconv"
+)
+
+// MaxNameBytes bounds a name in the name service.
+const MaxNameBytes = 32
+
+// AppEndpointName is the name under which an app's input endpoint is
+// published in the name service.
+func AppEndpointName(id AppID) string {
+	return "app." + strconv.Itoa(int(id))
+}
+
+// NameLookupPayload encodes a name service lookup.
+//
+// Payload format (little-endian):
+//
+//	u32 requestID
+//	u8  rights wanted (kernel.Rights; 0 = send only)
+//	name bytes (rest)
+//
+// The reply capability must be transferred in Message.Cap. The reply is
+// MsgNameLookupResp, or MsgError with ErrNotFound or ErrUnauthorized.
+func NameLookupPayload(requestID uint32, rights uint8, name string) []byte {
+	b := make([]byte, 5, 5+len(name))
+	binary.LittleEndian.PutUint32(b[0:4], requestID)
+	b[4] = rights
+	return append(b, name...)
+}
+
+func DecodeNameLookupPayload(b []byte) (requestID uint32, rights uint8, name string, ok bool) {
+	if len(b) < 6 || len(b)-5 > MaxNameBytes {
+		return 0, 0, "", false
+	}
+	return binary.LittleEndian.Uint32(b[0:4]), b[4], string(b[5:]), true
+}
+
+// NameLookupRespPayload encodes a lookup response. The resolved capability
+// is transferred in Message.Cap.
+//
+// Payload format (little-endian):
+//
+//	u32 requestID
+func NameLookupRespPayload(requestID uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, requestID)
+	return b
+}
+
+func DecodeNameLookupRespPayload(b []byte) (requestID uint32, ok bool) {
+	if len(b) != 4 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(b), true
+}
+
+// NameRegisterPayload encodes a registration. The capability to publish is
+// transferred in Message.Cap; registration is one-way and replaces an
+// earlier entry with the same name.
+//
+// Payload format:
+//
+//	name bytes
+func NameRegisterPayload(name string) []byte {
+	return []byte(name)
+}
+
+func DecodeNameRegisterPayload(b []byte) (name string, ok bool) {
+	if len(b) == 0 || len(b) > MaxNameBytes {
+		return "", false
+	}
+	return string(b), true
+}
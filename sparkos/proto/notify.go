@@ -0,0 +1,121 @@
+package proto
+
+import "encoding/binary"
+
+// Severity ranks a notification.
+type Severity uint8
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarn
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarn:
+		return "warn"
+	case SeverityError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// MaxNotifyBytes bounds the text of a notification.
+const MaxNotifyBytes = 96
+
+// NotifyPayload encodes a MsgNotify toast.
+//
+// Payload format (little-endian):
+//
+//	u8  severity
+//	u16 timeoutTicks (0 = service default)
+//	text bytes (rest)
+func NotifyPayload(sev Severity, timeoutTicks uint16, text string) []byte {
+	if len(text) > MaxNotifyBytes {
+		text = text[:MaxNotifyBytes]
+	}
+	b := make([]byte, 3, 3+len(text))
+	b[0] = byte(sev)
+	binary.LittleEndian.PutUint16(b[1:3], timeoutTicks)
+	return append(b, text...)
+}
+
+func DecodeNotifyPayload(b []byte) (sev Severity, timeoutTicks uint16, text string, ok bool) {
+	if len(b) < 4 || len(b)-3 > MaxNotifyBytes || Severity(b[0]) > SeverityError {
+		return 0, 0, "", false
+	}
+	return Severity(b[0]), binary.LittleEndian.Uint16(b[1:3]), string(b[3:]), true
+}
+
+// NotifyUserPayload encodes MsgNotifyUser: the logged-in user, empty when
+// nobody is.
+//
+// Payload format:
+//
+//	name bytes
+func NotifyUserPayload(name string) []byte {
+	if len(name) > MaxNameBytes {
+		name = name[:MaxNameBytes]
+	}
+	return []byte(name)
+}
+
+func DecodeNotifyUserPayload(b []byte) (name string, ok bool) {
+	if len(b) > MaxNameBytes {
+		return "", false
+	}
+	return string(b), true
+}
+
+// NotifyListPayload encodes a request for one entry of the notification
+// history, newest first. Listing entry 0 marks all notifications read.
+//
+// Payload format (little-endian):
+//
+//	u32 requestID
+//	u8  index
+//
+// The reply capability must be transferred in Message.Cap; the reply is
+// MsgNotifyListResp.
+func NotifyListPayload(requestID uint32, index uint8) []byte {
+	b := make([]byte, 5)
+	binary.LittleEndian.PutUint32(b[0:4], requestID)
+	b[4] = index
+	return b
+}
+
+func DecodeNotifyListPayload(b []byte) (requestID uint32, index uint8, ok bool) {
+	if len(b) != 5 {
+		return 0, 0, false
+	}
+	return binary.LittleEndian.Uint32(b[0:4]), b[4], true
+}
+
+// NotifyListRespPayload encodes one history entry.
+//
+// Payload format (little-endian):
+//
+//	u32 requestID
+//	u8  total entries in the history
+//	u8  severity
+//	u32 tick the notification was posted at (low 32 bits)
+//	text bytes (rest; empty if index >= total)
+func NotifyListRespPayload(requestID uint32, total uint8, sev Severity, tick uint32, text string) []byte {
+	b := make([]byte, 10, 10+len(text))
+	binary.LittleEndian.PutUint32(b[0:4], requestID)
+	b[4] = total
+	b[5] = byte(sev)
+	binary.LittleEndian.PutUint32(b[6:10], tick)
+	return append(b, text...)
+}
+
+func DecodeNotifyListRespPayload(b []byte) (requestID uint32, total uint8, sev Severity, tick uint32, text string, ok bool) {
+	if len(b) < 10 {
+		return 0, 0, 0, 0, "", false
+	}
+	return binary.LittleEndian.Uint32(b[0:4]), b[4], Severity(b[5]), binary.LittleEndian.Uint32(b[6:10]), string(b[10:]), true
+}
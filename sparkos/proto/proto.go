@@ -53,6 +53,50 @@ const (
 	MsgSerialData
 	MsgMuxStatus
 	MsgMuxStatusResp
+	MsgVFSReadShared
+	MsgVFSReadSharedResp
+	MsgVFSWriteShared
+	MsgTaskExited
+	MsgSvcStatus
+	MsgSvcStatusResp
+	MsgNameLookup
+	MsgNameLookupResp
+	MsgNameRegister
+	MsgMuxSwitch
+	MsgSurfaceCreate
+	MsgSurfaceCreateResp
+	MsgSurfaceDamage
+	MsgSurfaceConfig
+	MsgSurfaceDestroy
+	MsgAppSuspend
+	MsgAppResume
+	MsgNotify
+	MsgNotifyUser
+	MsgNotifyList
+	MsgNotifyListResp
+	MsgInputEvent
+	MsgVFSMount
+	MsgVFSMountResp
+	MsgVFSUnmount
+	MsgVFSUnmountResp
+	MsgVFSMounts
+	MsgVFSMountsResp
+	MsgVFSOpen
+	MsgVFSOpenResp
+	MsgVFSFileRead
+	MsgVFSFileReadResp
+	MsgVFSFileWrite
+	MsgVFSFileSeek
+	MsgVFSFileTruncate
+	MsgVFSFileSync
+	MsgVFSFileClose
+	MsgVFSFileResp
+	MsgVFSChmod
+	MsgVFSChmodResp
+	MsgVFSChown
+	MsgVFSChownResp
+	MsgVFSCredIssue
+	MsgVFSCredIssueResp
 )
 
 // ErrCode is a generic error category for MsgError responses.
@@ -192,6 +236,94 @@ func (k Kind) String() string {
 		return "mux_status"
 	case MsgMuxStatusResp:
 		return "mux_status_resp"
+	case MsgVFSReadShared:
+		return "vfs_read_shared"
+	case MsgVFSReadSharedResp:
+		return "vfs_read_shared_resp"
+	case MsgVFSWriteShared:
+		return "vfs_write_shared"
+	case MsgTaskExited:
+		return "task_exited"
+	case MsgSvcStatus:
+		return "svc_status"
+	case MsgSvcStatusResp:
+		return "svc_status_resp"
+	case MsgNameLookup:
+		return "name_lookup"
+	case MsgNameLookupResp:
+		return "name_lookup_resp"
+	case MsgNameRegister:
+		return "name_register"
+	case MsgMuxSwitch:
+		return "mux_switch"
+	case MsgSurfaceCreate:
+		return "surface_create"
+	case MsgSurfaceCreateResp:
+		return "surface_create_resp"
+	case MsgSurfaceDamage:
+		return "surface_damage"
+	case MsgSurfaceConfig:
+		return "surface_config"
+	case MsgSurfaceDestroy:
+		return "surface_destroy"
+	case MsgAppSuspend:
+		return "app_suspend"
+	case MsgAppResume:
+		return "app_resume"
+	case MsgNotify:
+		return "notify"
+	case MsgNotifyUser:
+		return "notify_user"
+	case MsgNotifyList:
+		return "notify_list"
+	case MsgNotifyListResp:
+		return "notify_list_resp"
+	case MsgInputEvent:
+		return "input_event"
+	case MsgVFSMount:
+		return "vfs_mount"
+	case MsgVFSMountResp:
+		return "vfs_mount_resp"
+	case MsgVFSUnmount:
+		return "vfs_unmount"
+	case MsgVFSUnmountResp:
+		return "vfs_unmount_resp"
+	case MsgVFSMounts:
+		return "vfs_mounts"
+	case MsgVFSMountsResp:
+		return "vfs_mounts_resp"
+	case MsgVFSOpen:
+		return "vfs_open"
+	case MsgVFSOpenResp:
+		return "vfs_open_resp"
+	case MsgVFSFileRead:
+		return "vfs_file_read"
+	case MsgVFSFileReadResp:
+		return "vfs_file_read_resp"
+	case MsgVFSFileWrite:
+		return "vfs_file_write"
+	case MsgVFSFileSeek:
+		return "vfs_file_seek"
+	case MsgVFSFileTruncate:
+		return "vfs_file_truncate"
+	case MsgVFSFileSync:
+		return "vfs_file_sync"
+	case MsgVFSFileClose:
+		return "vfs_file_close"
+	case MsgVFSFileResp:
+		return "vfs_file_resp"
+	case MsgVFSChmod:
+		return "vfs_chmod"
+	case MsgVFSChmodResp:
+		return "vfs_chmod_resp"
+	case MsgVFSChown:
+		return "vfs_chown"
+	case MsgVFSChownResp:
+		return "vfs_chown_resp"
+	case MsgVFSCredIssue:
+		return "vfs_cred_issue"
+	case MsgVFSCredIssueResp:
+		return "vfs_cred_issue_resp"
 	default:
 		return "unknown"
 	}
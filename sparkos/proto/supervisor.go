@@ -0,0 +1,137 @@
+package proto
+
+import "encoding/binary"
+
+// SvcPolicy tells the supervisor when to restart a service.
+type SvcPolicy uint8
+
+const (
+	// SvcPermanent services are always restarted.
+	SvcPermanent SvcPolicy = iota
+	// SvcTransient services are restarted only after a panic or a kill.
+	SvcTransient
+	// SvcTemporary services are never restarted.
+	SvcTemporary
+)
+
+func (p SvcPolicy) String() string {
+	switch p {
+	case SvcPermanent:
+		return "permanent"
+	case SvcTransient:
+		return "transient"
+	case SvcTemporary:
+		return "temporary"
+	default:
+		return "unknown"
+	}
+}
+
+// SvcState is the supervisor's view of a service.
+type SvcState uint8
+
+const (
+	// SvcRunning means the service task is alive.
+	SvcRunning SvcState = iota
+	// SvcBackoff means the service exited and waits to be restarted.
+	SvcBackoff
+	// SvcStopped means the service exited and its policy does not restart it.
+	SvcStopped
+	// SvcFailed means the service crashed too often and is no longer restarted.
+	SvcFailed
+)
+
+func (s SvcState) String() string {
+	switch s {
+	case SvcRunning:
+		return "running"
+	case SvcBackoff:
+		return "backoff"
+	case SvcStopped:
+		return "stopped"
+	case SvcFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// SvcStatus describes one supervised service.
+type SvcStatus struct {
+	Index    uint8
+	Total    uint8
+	State    SvcState
+	Policy   SvcPolicy
+	Task     uint8
+	Restarts uint16
+	// LastExit is the reason of the last exit; meaningless if Restarts is 0
+	// and the service is running.
+	LastExit ExitReason
+	Name     string
+}
+
+// SvcStatusPayload encodes a supervisor status request for the service at index.
+//
+// Payload format (little-endian):
+//
+//	u32 requestID
+//	u8  index
+//
+// The reply capability must be transferred in Message.Cap. An index past the
+// end is answered with MsgError (ErrNotFound).
+func SvcStatusPayload(requestID uint32, index uint8) []byte {
+	b := make([]byte, 5)
+	binary.LittleEndian.PutUint32(b[0:4], requestID)
+	b[4] = index
+	return b
+}
+
+func DecodeSvcStatusPayload(b []byte) (requestID uint32, index uint8, ok bool) {
+	if len(b) != 5 {
+		return 0, 0, false
+	}
+	return binary.LittleEndian.Uint32(b[0:4]), b[4], true
+}
+
+// SvcStatusRespPayload encodes a supervisor status response.
+//
+// Payload format (little-endian):
+//
+//	u32 requestID
+//	u8  index
+//	u8  total
+//	u8  state
+//	u8  policy
+//	u8  task ID (0 = not running)
+//	u16 restarts
+//	u8  last exit reason
+//	name bytes (rest)
+func SvcStatusRespPayload(requestID uint32, st SvcStatus) []byte {
+	b := make([]byte, 12, 12+len(st.Name))
+	binary.LittleEndian.PutUint32(b[0:4], requestID)
+	b[4] = st.Index
+	b[5] = st.Total
+	b[6] = byte(st.State)
+	b[7] = byte(st.Policy)
+	b[8] = st.Task
+	binary.LittleEndian.PutUint16(b[9:11], st.Restarts)
+	b[11] = byte(st.LastExit)
+	return append(b, st.Name...)
+}
+
+func DecodeSvcStatusRespPayload(b []byte) (requestID uint32, st SvcStatus, ok bool) {
+	if len(b) < 12 {
+		return 0, SvcStatus{}, false
+	}
+	st = SvcStatus{
+		Index:    b[4],
+		Total:    b[5],
+		State:    SvcState(b[6]),
+		Policy:   SvcPolicy(b[7]),
+		Task:     b[8],
+		Restarts: binary.LittleEndian.Uint16(b[9:11]),
+		LastExit: ExitReason(b[11]),
+		Name:     string(b[12:]),
+	}
+	return binary.LittleEndian.Uint32(b[0:4]), st, true
+}
@@ -0,0 +1,97 @@
+package proto
+
+import (
+	"encoding/binary"
+
+	"spark/sparkos/kernel"
+)
+
+// ExitReason tells why a task stopped (see MsgTaskExited).
+type ExitReason = kernel.ExitReason
+
+const (
+	ExitNormal = kernel.ExitNormal
+	ExitKilled = kernel.ExitKilled
+	ExitPanic  = kernel.ExitPanic
+)
+
+const (
+	taskExitedMaxBytes = kernel.MaxMessageBytes
+	taskExitedHeader   = 8
+	taskExitedMaxName  = 24
+)
+
+// TaskExited describes a MsgTaskExited notification.
+type TaskExited struct {
+	Task   uint8
+	Parent uint8
+	Reason ExitReason
+	// StackLen is the size of the panic stack in the message's Grant region
+	// (0 = no stack attached).
+	StackLen uint32
+	Name     string
+	// Value is the panic value, formatted with %v and truncated to fit.
+	Value string
+}
+
+// TaskExitedNotice is the kernel.ExitEncoder of supervisors receiving
+// MsgTaskExited.
+func TaskExitedNotice(e kernel.TaskExit) (uint16, []byte) {
+	return uint16(MsgTaskExited), TaskExitedPayload(TaskExited{
+		Task:     uint8(e.Task),
+		Parent:   uint8(e.Parent),
+		Reason:   e.Reason,
+		StackLen: e.StackLen,
+		Name:     e.Name,
+		Value:    e.Value,
+	})
+}
+
+// TaskExitedPayload encodes a MsgTaskExited payload.
+//
+// Layout (little-endian):
+//   - u8: task ID
+//   - u8: parent task ID
+//   - u8: reason (ExitReason)
+//   - u32: stack length
+//   - u8: name length
+//   - name bytes (at most 24)
+//   - panic value bytes (rest)
+func TaskExitedPayload(e TaskExited) []byte {
+	name := e.Name
+	if len(name) > taskExitedMaxName {
+		name = name[:taskExitedMaxName]
+	}
+	value := e.Value
+	if max := taskExitedMaxBytes - taskExitedHeader - len(name); len(value) > max {
+		value = value[:max]
+	}
+
+	buf := make([]byte, taskExitedHeader, taskExitedHeader+len(name)+len(value))
+	buf[0] = e.Task
+	buf[1] = e.Parent
+	buf[2] = byte(e.Reason)
+	binary.LittleEndian.PutUint32(buf[3:7], e.StackLen)
+	buf[7] = byte(len(name))
+	buf = append(buf, name...)
+	return append(buf, value...)
+}
+
+// DecodeTaskExitedPayload decodes a TaskExitedPayload.
+func DecodeTaskExitedPayload(b []byte) (TaskExited, bool) {
+	if len(b) < taskExitedHeader {
+		return TaskExited{}, false
+	}
+	n := int(b[7])
+	if len(b) < taskExitedHeader+n {
+		return TaskExited{}, false
+	}
+	return TaskExited{
+		Task:     b[0],
+		Parent:   b[1],
+		Reason:   ExitReason(b[2]),
+		StackLen: binary.LittleEndian.Uint32(b[3:7]),
+		Name:     string(b[taskExitedHeader : taskExitedHeader+n]),
+		Value:    string(b[taskExitedHeader+n:]),
+	}, true
+}
@@ -0,0 +1,20 @@
+package proto
+
+import (
+	"strings"
+	"testing"
+
+	"spark/sparkos/kernel"
+)
+
+func TestTaskExitedPayloadTruncates(t *testing.T) {
+	e := TaskExited{Task: 3, Parent: 1, Reason: ExitPanic, StackLen: 900, Name: strings.Repeat("n", 40), Value: strings.Repeat("v", 200)}
+	b := TaskExitedPayload(e)
+	if len(b) != kernel.MaxMessageBytes {
+		t.Fatalf("expected payload to fill a message, got %d bytes", len(b))
+	}
+	got, ok := DecodeTaskExitedPayload(b)
+	if !ok || got.Task != 3 || got.Parent != 1 || got.StackLen != 900 || len(got.Name) != 24 {
+		t.Fatalf("unexpected decode %+v", got)
+	}
+}
@@ -11,6 +11,41 @@ const (
 	VFSEntryDir
 )
 
+// VFSModeSticky in a directory's mode lets only the owners of its entries,
+// and of the directory, remove or rename them.
+const VFSModeSticky = 0o1000
+
+// VFSMeta is the metadata of an entry besides its type and size. Times are
+// Unix seconds, 0 when the filesystem does not know them. Mode holds the
+// permission bits (0o777) and VFSModeSticky.
+type VFSMeta struct {
+	Mtime int64
+	Ctime int64
+	UID   uint32
+	GID   uint32
+	Mode  uint16
+}
+
+const vfsMetaBytes = 26
+
+func putVFSMeta(b []byte, m VFSMeta) {
+	binary.LittleEndian.PutUint64(b[0:8], uint64(m.Mtime))
+	binary.LittleEndian.PutUint64(b[8:16], uint64(m.Ctime))
+	binary.LittleEndian.PutUint32(b[16:20], m.UID)
+	binary.LittleEndian.PutUint32(b[20:24], m.GID)
+	binary.LittleEndian.PutUint16(b[24:26], m.Mode)
+}
+
+func decodeVFSMeta(b []byte) VFSMeta {
+	return VFSMeta{
+		Mtime: int64(binary.LittleEndian.Uint64(b[0:8])),
+		Ctime: int64(binary.LittleEndian.Uint64(b[8:16])),
+		UID:   binary.LittleEndian.Uint32(b[16:20]),
+		GID:   binary.LittleEndian.Uint32(b[20:24]),
+		Mode:  binary.LittleEndian.Uint16(b[24:26]),
+	}
+}
+
 // VFSWriteMode selects how writes are applied.
 type VFSWriteMode uint8
 
@@ -53,37 +88,44 @@ func DecodeVFSListPayload(b []byte) (requestID uint32, path string, ok bool) {
 //   - u8: done flag (0/1)
 //   - u8: entry type (VFSEntryType)
 //   - u32: entry size (bytes, 0 for directories)
+//   - i64: mtime (Unix seconds, 0 if unknown)
+//   - i64: ctime (Unix seconds, 0 if unknown)
+//   - u32: owner uid
+//   - u32: group gid
+//   - u16: permission bits
 //   - u16: name length
 //   - bytes: name (UTF-8)
-func VFSListRespPayload(requestID uint32, done bool, typ VFSEntryType, size uint32, name string) []byte {
+func VFSListRespPayload(requestID uint32, done bool, typ VFSEntryType, size uint32, meta VFSMeta, name string) []byte {
 	n := []byte(name)
-	buf := make([]byte, 12+len(n))
+	buf := make([]byte, 38+len(n))
 	binary.LittleEndian.PutUint32(buf[0:4], requestID)
 	if done {
 		buf[4] = 1
 	}
 	buf[5] = uint8(typ)
 	binary.LittleEndian.PutUint32(buf[6:10], size)
-	binary.LittleEndian.PutUint16(buf[10:12], uint16(len(n)))
-	copy(buf[12:], n)
+	putVFSMeta(buf[10:36], meta)
+	binary.LittleEndian.PutUint16(buf[36:38], uint16(len(n)))
+	copy(buf[38:], n)
 	return buf
 }
 
 func DecodeVFSListRespPayload(
 	b []byte,
-) (requestID uint32, done bool, typ VFSEntryType, size uint32, name string, ok bool) {
-	if len(b) < 12 {
-		return 0, false, 0, 0, "", false
+) (requestID uint32, done bool, typ VFSEntryType, size uint32, meta VFSMeta, name string, ok bool) {
+	if len(b) < 38 {
+		return 0, false, 0, 0, VFSMeta{}, "", false
 	}
 	requestID = binary.LittleEndian.Uint32(b[0:4])
 	done = b[4] != 0
 	typ = VFSEntryType(b[5])
 	size = binary.LittleEndian.Uint32(b[6:10])
-	nameLen := int(binary.LittleEndian.Uint16(b[10:12]))
-	if 12+nameLen != len(b) {
-		return 0, false, 0, 0, "", false
+	meta = decodeVFSMeta(b[10:36])
+	nameLen := int(binary.LittleEndian.Uint16(b[36:38]))
+	if 38+nameLen != len(b) {
+		return 0, false, 0, 0, VFSMeta{}, "", false
 	}
-	return requestID, done, typ, size, string(b[12:]), true
+	return requestID, done, typ, size, meta, string(b[38:]), true
 }
 
 // VFSMkdirPayload encodes a MsgVFSMkdir request.
@@ -329,22 +371,28 @@ func DecodeVFSStatPayload(b []byte) (requestID uint32, path string, ok bool) {
 //   - u32: request id
 //   - u8: entry type (VFSEntryType)
 //   - u32: size
-func VFSStatRespPayload(requestID uint32, typ VFSEntryType, size uint32) []byte {
-	buf := make([]byte, 9)
+//   - i64: mtime (Unix seconds, 0 if unknown)
+//   - i64: ctime (Unix seconds, 0 if unknown)
+//   - u32: owner uid
+//   - u32: group gid
+//   - u16: permission bits
+func VFSStatRespPayload(requestID uint32, typ VFSEntryType, size uint32, meta VFSMeta) []byte {
+	buf := make([]byte, 9+vfsMetaBytes)
 	binary.LittleEndian.PutUint32(buf[0:4], requestID)
 	buf[4] = uint8(typ)
 	binary.LittleEndian.PutUint32(buf[5:9], size)
+	putVFSMeta(buf[9:], meta)
 	return buf
 }
 
-func DecodeVFSStatRespPayload(b []byte) (requestID uint32, typ VFSEntryType, size uint32, ok bool) {
-	if len(b) != 9 {
-		return 0, 0, 0, false
+func DecodeVFSStatRespPayload(b []byte) (requestID uint32, typ VFSEntryType, size uint32, meta VFSMeta, ok bool) {
+	if len(b) != 9+vfsMetaBytes {
+		return 0, 0, 0, VFSMeta{}, false
 	}
 	requestID = binary.LittleEndian.Uint32(b[0:4])
 	typ = VFSEntryType(b[4])
 	size = binary.LittleEndian.Uint32(b[5:9])
-	return requestID, typ, size, true
+	return requestID, typ, size, decodeVFSMeta(b[9:]), true
 }
 
 // VFSReadPayload encodes a MsgVFSRead request.
@@ -438,6 +486,38 @@ func DecodeVFSReadRespPayload(
 	return requestID, off, eof, b[11:], true
 }
 
+// VFSReadSharedRespPayload encodes a MsgVFSReadSharedResp response.
+//
+// The data itself is in the region granted with the MsgVFSReadShared request
+// (which uses the MsgVFSRead payload layout).
+//
+// Layout (little-endian):
+//   - u32: request id
+//   - u32: offset
+//   - u8: eof flag (0/1)
+//   - u32: data length
+func VFSReadSharedRespPayload(requestID uint32, off uint32, eof bool, n uint32) []byte {
+	buf := make([]byte, 13)
+	binary.LittleEndian.PutUint32(buf[0:4], requestID)
+	binary.LittleEndian.PutUint32(buf[4:8], off)
+	if eof {
+		buf[8] = 1
+	}
+	binary.LittleEndian.PutUint32(buf[9:13], n)
+	return buf
+}
+
+func DecodeVFSReadSharedRespPayload(b []byte) (requestID uint32, off uint32, eof bool, n uint32, ok bool) {
+	if len(b) != 13 {
+		return 0, 0, false, 0, false
+	}
+	requestID = binary.LittleEndian.Uint32(b[0:4])
+	off = binary.LittleEndian.Uint32(b[4:8])
+	eof = b[8] != 0
+	n = binary.LittleEndian.Uint32(b[9:13])
+	return requestID, off, eof, n, true
+}
+
 // VFSWriteOpenPayload encodes a MsgVFSWriteOpen request.
 //
 // Layout (little-endian):
@@ -494,6 +574,28 @@ func DecodeVFSWriteChunkPayload(b []byte) (requestID uint32, data []byte, ok boo
 	return requestID, b[6:], true
 }
 
+// VFSWriteSharedPayload encodes a MsgVFSWriteShared request.
+//
+// The first n bytes of the granted region are appended to the write session.
+// The service acknowledges with MsgVFSWriteResp (done=0, bytes = n).
+//
+// Layout (little-endian):
+//   - u32: request id
+//   - u32: data length
+func VFSWriteSharedPayload(requestID uint32, n uint32) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint32(buf[0:4], requestID)
+	binary.LittleEndian.PutUint32(buf[4:8], n)
+	return buf
+}
+
+func DecodeVFSWriteSharedPayload(b []byte) (requestID uint32, n uint32, ok bool) {
+	if len(b) != 8 {
+		return 0, 0, false
+	}
+	return binary.LittleEndian.Uint32(b[0:4]), binary.LittleEndian.Uint32(b[4:8]), true
+}
+
 // VFSWriteClosePayload encodes a MsgVFSWriteClose request.
 //
 // Layout (little-endian):
@@ -516,7 +618,8 @@ func DecodeVFSWriteClosePayload(b []byte) (requestID uint32, ok bool) {
 // Layout (little-endian):
 //   - u32: request id
 //   - u8: done flag (0/1)
-//   - u32: total bytes written (only valid when done=1)
+//   - u32: total bytes written (valid when done=1), or the chunk size when
+//     acknowledging MsgVFSWriteShared
 func VFSWriteRespPayload(requestID uint32, done bool, n uint32) []byte {
 	buf := make([]byte, 9)
 	binary.LittleEndian.PutUint32(buf[0:4], requestID)
@@ -536,3 +639,570 @@ func DecodeVFSWriteRespPayload(b []byte) (requestID uint32, done bool, n uint32,
 	n = binary.LittleEndian.Uint32(b[5:9])
 	return requestID, done, n, true
 }
+
+// VFSMountPayload encodes a MsgVFSMount request.
+//
+// Layout (little-endian):
+//   - u32: request id
+//   - u16: source length
+//   - bytes: source name (UTF-8), e.g. "sd"
+//   - u16: path length
+//   - bytes: mount point (UTF-8)
+func VFSMountPayload(requestID uint32, source, path string) []byte {
+	src := []byte(source)
+	p := []byte(path)
+	buf := make([]byte, 8+len(src)+len(p))
+	binary.LittleEndian.PutUint32(buf[0:4], requestID)
+	binary.LittleEndian.PutUint16(buf[4:6], uint16(len(src)))
+	copy(buf[6:], src)
+	base := 6 + len(src)
+	binary.LittleEndian.PutUint16(buf[base:base+2], uint16(len(p)))
+	copy(buf[base+2:], p)
+	return buf
+}
+
+func DecodeVFSMountPayload(b []byte) (requestID uint32, source, path string, ok bool) {
+	if len(b) < 8 {
+		return 0, "", "", false
+	}
+	requestID = binary.LittleEndian.Uint32(b[0:4])
+	srcLen := int(binary.LittleEndian.Uint16(b[4:6]))
+	base := 6 + srcLen
+	if base+2 > len(b) {
+		return 0, "", "", false
+	}
+	pathLen := int(binary.LittleEndian.Uint16(b[base : base+2]))
+	if base+2+pathLen != len(b) {
+		return 0, "", "", false
+	}
+	return requestID, string(b[6:base]), string(b[base+2:]), true
+}
+
+// VFSMountRespPayload encodes a MsgVFSMountResp response.
+//
+// Layout (little-endian):
+//   - u32: request id
+func VFSMountRespPayload(requestID uint32) []byte {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf[0:4], requestID)
+	return buf
+}
+
+func DecodeVFSMountRespPayload(b []byte) (requestID uint32, ok bool) {
+	if len(b) != 4 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(b[0:4]), true
+}
+
+// VFSUnmountPayload encodes a MsgVFSUnmount request.
+//
+// Layout (little-endian):
+//   - u32: request id
+//   - u16: path length
+//   - bytes: mount point (UTF-8)
+func VFSUnmountPayload(requestID uint32, path string) []byte {
+	p := []byte(path)
+	buf := make([]byte, 6+len(p))
+	binary.LittleEndian.PutUint32(buf[0:4], requestID)
+	binary.LittleEndian.PutUint16(buf[4:6], uint16(len(p)))
+	copy(buf[6:], p)
+	return buf
+}
+
+func DecodeVFSUnmountPayload(b []byte) (requestID uint32, path string, ok bool) {
+	if len(b) < 6 {
+		return 0, "", false
+	}
+	requestID = binary.LittleEndian.Uint32(b[0:4])
+	pathLen := int(binary.LittleEndian.Uint16(b[4:6]))
+	if 6+pathLen != len(b) {
+		return 0, "", false
+	}
+	return requestID, string(b[6:]), true
+}
+
+// VFSUnmountRespPayload encodes a MsgVFSUnmountResp response.
+//
+// Layout (little-endian):
+//   - u32: request id
+func VFSUnmountRespPayload(requestID uint32) []byte {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf[0:4], requestID)
+	return buf
+}
+
+func DecodeVFSUnmountRespPayload(b []byte) (requestID uint32, ok bool) {
+	if len(b) != 4 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(b[0:4]), true
+}
+
+// VFSMountsPayload encodes a MsgVFSMounts request.
+//
+// Layout (little-endian):
+//   - u32: request id
+func VFSMountsPayload(requestID uint32) []byte {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf[0:4], requestID)
+	return buf
+}
+
+func DecodeVFSMountsPayload(b []byte) (requestID uint32, ok bool) {
+	if len(b) != 4 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(b[0:4]), true
+}
+
+// VFSMountInfo describes one entry of the mount table.
+type VFSMountInfo struct {
+	Path   string
+	Source string
+	// Type is the filesystem type, e.g. "littlefs" or "fat".
+	Type string
+	// Total and Used are in bytes, valid if HasUsage is set.
+	Total    uint64
+	Used     uint64
+	HasUsage bool
+}
+
+// VFSMountsRespPayload encodes a MsgVFSMountsResp response. The service
+// sends one per mount and a final one with done set and an empty entry.
+//
+// Layout (little-endian):
+//   - u32: request id
+//   - u8: done flag (0/1)
+//   - u8: usage flag (0/1)
+//   - u64: total bytes
+//   - u64: used bytes
+//   - u8: path length, bytes: path
+//   - u8: source length, bytes: source
+//   - u8: type length, bytes: type
+func VFSMountsRespPayload(requestID uint32, done bool, m VFSMountInfo) []byte {
+	buf := make([]byte, 22, 25+len(m.Path)+len(m.Source)+len(m.Type))
+	binary.LittleEndian.PutUint32(buf[0:4], requestID)
+	if done {
+		buf[4] = 1
+	}
+	if m.HasUsage {
+		buf[5] = 1
+	}
+	binary.LittleEndian.PutUint64(buf[6:14], m.Total)
+	binary.LittleEndian.PutUint64(buf[14:22], m.Used)
+	for _, s := range []string{m.Path, m.Source, m.Type} {
+		if len(s) > 0xff {
+			s = s[:0xff]
+		}
+		buf = append(buf, uint8(len(s)))
+		buf = append(buf, s...)
+	}
+	return buf
+}
+
+func DecodeVFSMountsRespPayload(b []byte) (requestID uint32, done bool, m VFSMountInfo, ok bool) {
+	if len(b) < 25 {
+		return 0, false, VFSMountInfo{}, false
+	}
+	requestID = binary.LittleEndian.Uint32(b[0:4])
+	done = b[4] != 0
+	m.HasUsage = b[5] != 0
+	m.Total = binary.LittleEndian.Uint64(b[6:14])
+	m.Used = binary.LittleEndian.Uint64(b[14:22])
+
+	rest := b[22:]
+	var strs [3]string
+	for i := range strs {
+		if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+			return 0, false, VFSMountInfo{}, false
+		}
+		n := int(rest[0])
+		strs[i] = string(rest[1 : 1+n])
+		rest = rest[1+n:]
+	}
+	if len(rest) != 0 {
+		return 0, false, VFSMountInfo{}, false
+	}
+	m.Path, m.Source, m.Type = strs[0], strs[1], strs[2]
+	return requestID, done, m, true
+}
+
+// VFSOpenFlag selects how MsgVFSOpen opens a file.
+type VFSOpenFlag uint32
+
+const (
+	VFSOpenRead VFSOpenFlag = 1 << iota
+	VFSOpenWrite
+	// VFSOpenCreate creates the file if it does not exist.
+	VFSOpenCreate
+	// VFSOpenExcl fails if VFSOpenCreate finds the file.
+	VFSOpenExcl
+	VFSOpenTruncate
+	// VFSOpenAppend makes every write go to the end of the file.
+	VFSOpenAppend
+)
+
+// VFSOpenPayload encodes a MsgVFSOpen request.
+//
+// Layout (little-endian):
+//   - u32: request id
+//   - u32: flags (VFSOpenFlag)
+//   - u16: path length
+//   - bytes: path (UTF-8)
+func VFSOpenPayload(requestID uint32, flags VFSOpenFlag, path string) []byte {
+	p := []byte(path)
+	buf := make([]byte, 10+len(p))
+	binary.LittleEndian.PutUint32(buf[0:4], requestID)
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(flags))
+	binary.LittleEndian.PutUint16(buf[8:10], uint16(len(p)))
+	copy(buf[10:], p)
+	return buf
+}
+
+func DecodeVFSOpenPayload(b []byte) (requestID uint32, flags VFSOpenFlag, path string, ok bool) {
+	if len(b) < 10 {
+		return 0, 0, "", false
+	}
+	requestID = binary.LittleEndian.Uint32(b[0:4])
+	flags = VFSOpenFlag(binary.LittleEndian.Uint32(b[4:8]))
+	pathLen := int(binary.LittleEndian.Uint16(b[8:10]))
+	if 10+pathLen != len(b) {
+		return 0, 0, "", false
+	}
+	return requestID, flags, string(b[10:]), true
+}
+
+// VFSOpenRespPayload encodes a MsgVFSOpenResp response.
+//
+// Layout (little-endian):
+//   - u32: request id
+//   - u32: file handle
+func VFSOpenRespPayload(requestID uint32, handle uint32) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint32(buf[0:4], requestID)
+	binary.LittleEndian.PutUint32(buf[4:8], handle)
+	return buf
+}
+
+func DecodeVFSOpenRespPayload(b []byte) (requestID uint32, handle uint32, ok bool) {
+	if len(b) != 8 {
+		return 0, 0, false
+	}
+	return binary.LittleEndian.Uint32(b[0:4]), binary.LittleEndian.Uint32(b[4:8]), true
+}
+
+// VFSFileReadPayload encodes a MsgVFSFileRead request. With a writable
+// grant the data goes to the region, otherwise into the response.
+//
+// Layout (little-endian):
+//   - u32: request id
+//   - u32: file handle
+//   - u32: max bytes
+func VFSFileReadPayload(requestID uint32, handle uint32, maxBytes uint32) []byte {
+	buf := make([]byte, 12)
+	binary.LittleEndian.PutUint32(buf[0:4], requestID)
+	binary.LittleEndian.PutUint32(buf[4:8], handle)
+	binary.LittleEndian.PutUint32(buf[8:12], maxBytes)
+	return buf
+}
+
+func DecodeVFSFileReadPayload(b []byte) (requestID uint32, handle uint32, maxBytes uint32, ok bool) {
+	if len(b) != 12 {
+		return 0, 0, 0, false
+	}
+	requestID = binary.LittleEndian.Uint32(b[0:4])
+	handle = binary.LittleEndian.Uint32(b[4:8])
+	maxBytes = binary.LittleEndian.Uint32(b[8:12])
+	return requestID, handle, maxBytes, true
+}
+
+// VFSFileReadRespPayload encodes a MsgVFSFileReadResp response. data is
+// empty when the bytes were read into a granted region.
+//
+// Layout (little-endian):
+//   - u32: request id
+//   - u8: eof flag (0/1), set when the read reached the end of the file
+//   - u32: bytes read
+//   - bytes: data
+func VFSFileReadRespPayload(requestID uint32, eof bool, n uint32, data []byte) []byte {
+	buf := make([]byte, 9+len(data))
+	binary.LittleEndian.PutUint32(buf[0:4], requestID)
+	if eof {
+		buf[4] = 1
+	}
+	binary.LittleEndian.PutUint32(buf[5:9], n)
+	copy(buf[9:], data)
+	return buf
+}
+
+func DecodeVFSFileReadRespPayload(b []byte) (requestID uint32, eof bool, n uint32, data []byte, ok bool) {
+	if len(b) < 9 {
+		return 0, false, 0, nil, false
+	}
+	requestID = binary.LittleEndian.Uint32(b[0:4])
+	eof = b[4] != 0
+	n = binary.LittleEndian.Uint32(b[5:9])
+	data = b[9:]
+	if len(data) != 0 && len(data) != int(n) {
+		return 0, false, 0, nil, false
+	}
+	return requestID, eof, n, data, true
+}
+
+// VFSFileWritePayload encodes a MsgVFSFileWrite request. Without data the
+// first n bytes of the readable grant are written.
+//
+// Layout (little-endian):
+//   - u32: request id
+//   - u32: file handle
+//   - u32: bytes to write
+//   - bytes: data (empty or n bytes)
+func VFSFileWritePayload(requestID uint32, handle uint32, n uint32, data []byte) []byte {
+	buf := make([]byte, 12+len(data))
+	binary.LittleEndian.PutUint32(buf[0:4], requestID)
+	binary.LittleEndian.PutUint32(buf[4:8], handle)
+	binary.LittleEndian.PutUint32(buf[8:12], n)
+	copy(buf[12:], data)
+	return buf
+}
+
+func DecodeVFSFileWritePayload(b []byte) (requestID uint32, handle uint32, n uint32, data []byte, ok bool) {
+	if len(b) < 12 {
+		return 0, 0, 0, nil, false
+	}
+	requestID = binary.LittleEndian.Uint32(b[0:4])
+	handle = binary.LittleEndian.Uint32(b[4:8])
+	n = binary.LittleEndian.Uint32(b[8:12])
+	data = b[12:]
+	if len(data) != 0 && len(data) != int(n) {
+		return 0, 0, 0, nil, false
+	}
+	return requestID, handle, n, data, true
+}
+
+// VFSFileSeekPayload encodes a MsgVFSFileSeek request.
+//
+// Layout (little-endian):
+//   - u32: request id
+//   - u32: file handle
+//   - i64: offset
+//   - u8: whence (io.SeekStart, io.SeekCurrent, io.SeekEnd)
+func VFSFileSeekPayload(requestID uint32, handle uint32, off int64, whence uint8) []byte {
+	buf := make([]byte, 17)
+	binary.LittleEndian.PutUint32(buf[0:4], requestID)
+	binary.LittleEndian.PutUint32(buf[4:8], handle)
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(off))
+	buf[16] = whence
+	return buf
+}
+
+func DecodeVFSFileSeekPayload(b []byte) (requestID uint32, handle uint32, off int64, whence uint8, ok bool) {
+	if len(b) != 17 {
+		return 0, 0, 0, 0, false
+	}
+	requestID = binary.LittleEndian.Uint32(b[0:4])
+	handle = binary.LittleEndian.Uint32(b[4:8])
+	off = int64(binary.LittleEndian.Uint64(b[8:16]))
+	return requestID, handle, off, b[16], true
+}
+
+// VFSFileTruncatePayload encodes a MsgVFSFileTruncate request.
+//
+// Layout (little-endian):
+//   - u32: request id
+//   - u32: file handle
+//   - u64: new size
+func VFSFileTruncatePayload(requestID uint32, handle uint32, size uint64) []byte {
+	buf := make([]byte, 16)
+	binary.LittleEndian.PutUint32(buf[0:4], requestID)
+	binary.LittleEndian.PutUint32(buf[4:8], handle)
+	binary.LittleEndian.PutUint64(buf[8:16], size)
+	return buf
+}
+
+func DecodeVFSFileTruncatePayload(b []byte) (requestID uint32, handle uint32, size uint64, ok bool) {
+	if len(b) != 16 {
+		return 0, 0, 0, false
+	}
+	requestID = binary.LittleEndian.Uint32(b[0:4])
+	handle = binary.LittleEndian.Uint32(b[4:8])
+	size = binary.LittleEndian.Uint64(b[8:16])
+	return requestID, handle, size, true
+}
+
+// VFSFileHandlePayload encodes a MsgVFSFileSync or MsgVFSFileClose request.
+//
+// Layout (little-endian):
+//   - u32: request id
+//   - u32: file handle
+func VFSFileHandlePayload(requestID uint32, handle uint32) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint32(buf[0:4], requestID)
+	binary.LittleEndian.PutUint32(buf[4:8], handle)
+	return buf
+}
+
+func DecodeVFSFileHandlePayload(b []byte) (requestID uint32, handle uint32, ok bool) {
+	if len(b) != 8 {
+		return 0, 0, false
+	}
+	return binary.LittleEndian.Uint32(b[0:4]), binary.LittleEndian.Uint32(b[4:8]), true
+}
+
+// VFSFileRespPayload encodes a MsgVFSFileResp response to MsgVFSFileWrite
+// (bytes written), MsgVFSFileSeek (new position), MsgVFSFileTruncate,
+// MsgVFSFileSync and MsgVFSFileClose (0).
+//
+// Layout (little-endian):
+//   - u32: request id
+//   - u64: value
+func VFSFileRespPayload(requestID uint32, value uint64) []byte {
+	buf := make([]byte, 12)
+	binary.LittleEndian.PutUint32(buf[0:4], requestID)
+	binary.LittleEndian.PutUint64(buf[4:12], value)
+	return buf
+}
+
+func DecodeVFSFileRespPayload(b []byte) (requestID uint32, value uint64, ok bool) {
+	if len(b) != 12 {
+		return 0, 0, false
+	}
+	return binary.LittleEndian.Uint32(b[0:4]), binary.LittleEndian.Uint64(b[4:12]), true
+}
+
+// VFSChmodPayload encodes a MsgVFSChmod request.
+//
+// Layout (little-endian):
+//   - u32: request id
+//   - u16: permission bits
+//   - u16: path length
+//   - bytes: path (UTF-8)
+func VFSChmodPayload(requestID uint32, mode uint16, path string) []byte {
+	p := []byte(path)
+	buf := make([]byte, 8+len(p))
+	binary.LittleEndian.PutUint32(buf[0:4], requestID)
+	binary.LittleEndian.PutUint16(buf[4:6], mode)
+	binary.LittleEndian.PutUint16(buf[6:8], uint16(len(p)))
+	copy(buf[8:], p)
+	return buf
+}
+
+func DecodeVFSChmodPayload(b []byte) (requestID uint32, mode uint16, path string, ok bool) {
+	if len(b) < 8 {
+		return 0, 0, "", false
+	}
+	requestID = binary.LittleEndian.Uint32(b[0:4])
+	mode = binary.LittleEndian.Uint16(b[4:6])
+	pathLen := int(binary.LittleEndian.Uint16(b[6:8]))
+	if 8+pathLen != len(b) {
+		return 0, 0, "", false
+	}
+	return requestID, mode, string(b[8:]), true
+}
+
+// VFSChownPayload encodes a MsgVFSChown request.
+//
+// Layout (little-endian):
+//   - u32: request id
+//   - u32: owner uid
+//   - u32: group gid
+//   - u16: path length
+//   - bytes: path (UTF-8)
+func VFSChownPayload(requestID uint32, uid, gid uint32, path string) []byte {
+	p := []byte(path)
+	buf := make([]byte, 14+len(p))
+	binary.LittleEndian.PutUint32(buf[0:4], requestID)
+	binary.LittleEndian.PutUint32(buf[4:8], uid)
+	binary.LittleEndian.PutUint32(buf[8:12], gid)
+	binary.LittleEndian.PutUint16(buf[12:14], uint16(len(p)))
+	copy(buf[14:], p)
+	return buf
+}
+
+func DecodeVFSChownPayload(b []byte) (requestID uint32, uid, gid uint32, path string, ok bool) {
+	if len(b) < 14 {
+		return 0, 0, 0, "", false
+	}
+	requestID = binary.LittleEndian.Uint32(b[0:4])
+	uid = binary.LittleEndian.Uint32(b[4:8])
+	gid = binary.LittleEndian.Uint32(b[8:12])
+	pathLen := int(binary.LittleEndian.Uint16(b[12:14]))
+	if 14+pathLen != len(b) {
+		return 0, 0, 0, "", false
+	}
+	return requestID, uid, gid, string(b[14:]), true
+}
+
+// VFSAttrRespPayload encodes a MsgVFSChmodResp or MsgVFSChownResp response.
+//
+// Layout (little-endian):
+//   - u32: request id
+func VFSAttrRespPayload(requestID uint32) []byte {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf[0:4], requestID)
+	return buf
+}
+
+func DecodeVFSAttrRespPayload(b []byte) (requestID uint32, ok bool) {
+	if len(b) != 4 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(b[0:4]), true
+}
+
+// VFSCred is the identity VFS checks the requests of a credential against.
+// Admin credentials pass every check.
+type VFSCred struct {
+	UID   uint32
+	GID   uint32
+	Admin bool
+}
+
+// VFSCredIssuePayload encodes a MsgVFSCredIssue request, sent to the VFS
+// auth endpoint.
+//
+// Layout (little-endian):
+//   - u32: request id
+//   - u32: uid
+//   - u32: gid
+//   - u8: admin flag (0/1)
+func VFSCredIssuePayload(requestID uint32, cred VFSCred) []byte {
+	buf := make([]byte, 13)
+	binary.LittleEndian.PutUint32(buf[0:4], requestID)
+	binary.LittleEndian.PutUint32(buf[4:8], cred.UID)
+	binary.LittleEndian.PutUint32(buf[8:12], cred.GID)
+	if cred.Admin {
+		buf[12] = 1
+	}
+	return buf
+}
+
+func DecodeVFSCredIssuePayload(b []byte) (requestID uint32, cred VFSCred, ok bool) {
+	if len(b) != 13 {
+		return 0, VFSCred{}, false
+	}
+	return binary.LittleEndian.Uint32(b[0:4]), VFSCred{
+		UID:   binary.LittleEndian.Uint32(b[4:8]),
+		GID:   binary.LittleEndian.Uint32(b[8:12]),
+		Admin: b[12] != 0,
+	}, true
+}
+
+// VFSCredIssueRespPayload encodes a MsgVFSCredIssueResp response. The
+// message carries the credential, a send-only VFS endpoint, in Cap.
+//
+// Layout (little-endian):
+//   - u32: request id
+func VFSCredIssueRespPayload(requestID uint32) []byte {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf[0:4], requestID)
+	return buf
+}
+
+func DecodeVFSCredIssueRespPayload(b []byte) (requestID uint32, ok bool) {
+	if len(b) != 4 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(b[0:4]), true
+}
@@ -0,0 +1,116 @@
+package appmgr
+
+import (
+	"fmt"
+
+	"spark/sparkos/apps"
+	notifyclient "spark/sparkos/client/notify"
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+)
+
+// usage is a task's share of one LimitWindowTicks window.
+type usage struct {
+	endpoints   int
+	regionBytes int
+	sent        uint32
+	busy        uint32
+	samples     uint32
+}
+
+// exceeded returns why u goes beyond l, or "" if it does not.
+func exceeded(l apps.Limits, u usage) string {
+	switch {
+	case l.Endpoints > 0 && u.endpoints > l.Endpoints:
+		return fmt.Sprintf("holds %d endpoints (limit %d)", u.endpoints, l.Endpoints)
+	case l.RegionBytes > 0 && u.regionBytes > l.RegionBytes:
+		return fmt.Sprintf("holds %d bytes of shared memory (limit %d)", u.regionBytes, l.RegionBytes)
+	case l.Sent > 0 && u.sent > l.Sent:
+		return fmt.Sprintf("sent %d messages in %d ticks (limit %d)", u.sent, apps.LimitWindowTicks, l.Sent)
+	}
+	// A task younger than half a window has too few samples to judge.
+	if l.BusyPercent > 0 && u.samples >= apps.LimitWindowTicks/2 {
+		if pct := int(uint64(u.busy) * 100 / uint64(u.samples)); pct > l.BusyPercent {
+			return fmt.Sprintf("busy %d%% of the time (limit %d%%)", pct, l.BusyPercent)
+		}
+	}
+	return ""
+}
+
+// checkQuotas compares every app task with its descriptor's Limits over the
+// window since the previous check and stops the apps that went beyond them.
+func (s *Service) checkQuotas(ctx *kernel.Context) {
+	infos := ctx.Tasks()
+
+	type over struct {
+		app    proto.AppID
+		task   kernel.TaskID
+		reason string
+	}
+	var stop []over
+
+	s.mu.Lock()
+	prev := s.usage
+	s.usage = make(map[kernel.TaskID]kernel.TaskInfo, len(infos))
+	for _, t := range infos {
+		s.usage[t.ID] = t
+		appID, ok := s.tasks[t.ID]
+		a := s.apps[appID]
+		if !ok || a == nil {
+			continue
+		}
+		u := usage{
+			endpoints:   t.Endpoints,
+			regionBytes: t.RegionBytes,
+			sent:        t.Sent,
+			busy:        t.Busy,
+			samples:     t.Samples,
+		}
+		if p, ok := prev[t.ID]; ok && p.Name == t.Name && p.Samples <= t.Samples {
+			u.sent -= p.Sent
+			u.busy -= p.Busy
+			u.samples -= p.Samples
+		}
+		if why := exceeded(a.desc.Limits, u); why != "" {
+			stop = append(stop, over{app: appID, task: t.ID, reason: why})
+		}
+	}
+	s.mu.Unlock()
+
+	for _, o := range stop {
+		s.kill(ctx, o.app, o.task, o.reason)
+	}
+}
+
+// kill stops an app that went beyond its limits. Unlike stop it does not
+// ask the app: its task is killed, and the app is not started again until
+// the task has unwound (see kernel.Context.Yield). If the app had the focus,
+// consolemux is told it gave the focus up, as if it had exited.
+func (s *Service) kill(ctx *kernel.Context, appID proto.AppID, task kernel.TaskID, reason string) {
+	if !ctx.Kill(task) {
+		return
+	}
+
+	s.mu.Lock()
+	a := s.apps[appID]
+	name := a.desc.Name
+	active := a.active
+	a.running = false
+	a.killed = task
+	a.snap = nil
+	a.setActive(false, ctx.NowTick())
+	muxCap := s.muxCap
+	s.mu.Unlock()
+
+	if active && muxCap.Valid() {
+		_ = ctx.SendToCapRetry(muxCap, uint16(proto.MsgAppControl), proto.AppControlPayload(false), kernel.Capability{}, proxySendRetryLimit)
+	}
+	s.notify(ctx, fmt.Sprintf("%s stopped: %s", name, reason))
+}
+
+// notify tells the user about a quota kill with an error notification.
+func (s *Service) notify(ctx *kernel.Context, text string) {
+	if notifyCap := s.resolve(ctx, []string{"notify"})["notify"]; notifyCap.Valid() {
+		_ = notifyclient.Post(ctx, notifyCap, proto.SeverityError, 0, text)
+	}
+}
@@ -1,307 +1,238 @@
 package appmgr
 
 import (
+	"runtime"
 	"sync"
 
 	"spark/hal"
+	"spark/sparkos/apps"
+	namesclient "spark/sparkos/client/names"
 	"spark/sparkos/kernel"
 	"spark/sparkos/proto"
-	archivetask "spark/sparkos/tasks/archive"
-	basictask "spark/sparkos/tasks/basic"
-	calendartask "spark/sparkos/tasks/calendar"
-	fbtesttask "spark/sparkos/tasks/fbtest"
-	gpioscopetask "spark/sparkos/tasks/gpioscope"
-	hexedittask "spark/sparkos/tasks/hexedit"
-	imgviewtask "spark/sparkos/tasks/imgview"
-	mctask "spark/sparkos/tasks/mc"
-	quarkdonuttask "spark/sparkos/tasks/quarkdonut"
-	rfanalyzertask "spark/sparkos/tasks/rfanalyzer"
-	rtdemotask "spark/sparkos/tasks/rtdemo"
-	rtvoxeltask "spark/sparkos/tasks/rtvoxel"
-	serialtermtask "spark/sparkos/tasks/serialterm"
-	snaketask "spark/sparkos/tasks/snake"
-	teaplayertask "spark/sparkos/tasks/teaplayer"
-	tetristask "spark/sparkos/tasks/tetris"
-	todotask "spark/sparkos/tasks/todo"
-	userstask "spark/sparkos/tasks/users"
-	vectortask "spark/sparkos/tasks/vector"
-	vitask "spark/sparkos/tasks/vi"
 )
 
-// autoUnloadAfterTicks controls how long an app may stay inactive before being shutdown.
-//
-// The tick duration is platform-defined, but on TinyGo builds it is currently 1ms.
-const autoUnloadAfterTicks = 30_000
+// shutdownTimeoutTicks bounds how long stop waits for room in an app's mailbox.
+const shutdownTimeoutTicks = 100
+
+// suspendWaitTicks bounds how long a start waits for the previous task of a
+// suspended app to save its state and exit.
+const suspendWaitTicks = 500
+
+// memCheckTicks is how often the watchdog looks at the heap when
+// Options.MinFreeHeap is set.
+const memCheckTicks = 250
+
+// Options tunes how many apps appmgr keeps in the background.
+type Options struct {
+	// MaxBackground is how many apps may stay loaded in the background; the
+	// least recently used one is stopped beyond that. 0 means no limit.
+	MaxBackground int
+	// MinFreeHeap stops the least recently used background app while less
+	// than this many heap bytes are free after a GC. 0 disables the check.
+	MinFreeHeap uint64
+	// Snapshots keeps a copy of the framebuffer of every background app and
+	// puts it back on screen when the app is focused again, so switching
+	// consoles shows the app at once. Each copy costs a full framebuffer.
+	Snapshots bool
+	// FullScreen is the display of apps with Descriptor.FullScreen when disp
+	// leaves room for a status bar. Nil means disp.
+	FullScreen hal.Display
+}
+
+// app is appmgr's state for one registered app.
+type app struct {
+	desc apps.Descriptor
+
+	// ep is the endpoint the app task receives on. It is created when the
+	// app starts and freed once its last task has exited, so apps that are
+	// not loaded hold no kernel endpoint.
+	ep kernel.Capability
+	// starting is set while ensureRunning starts the app; ep is kept then.
+	starting bool
+	// vfs is the VFS identity the app was last selected with; the app gets
+	// it as its "vfs" service instead of the public endpoint.
+	vfs kernel.Capability
+
+	running bool
+	active  bool
+	// killed is the task a quota kill stopped, until it has unwound. No new
+	// instance starts meanwhile, so a runaway loop never runs twice.
+	killed kernel.TaskID
+	// inactiveSince is when the app last lost focus; it orders background
+	// apps for least-recently-used eviction.
+	inactiveSince uint64
+
+	// snap is the framebuffer as the app left it (Options.Snapshots).
+	snap []byte
+}
 
+// Service starts the apps of the apps registry on demand and stops them once
+// they have been in the background for their descriptor's UnloadAfter, or
+// earlier, least recently used first, when Options limit the background.
+// Apps with Descriptor.Suspend are suspended to apps.StatePath instead and
+// resumed from there on their next start. An app going beyond its
+// Descriptor.Limits is killed and the user is told why with a notification.
+//
+// Each app gets a proxy endpoint published as proto.AppEndpointName(ID) in
+// the name service; consolemux sends to it and the first message starts the app.
+// MsgAppSelect carries the VFS credential of the user opening the app, and the
+// app runs with it.
 type Service struct {
-	disp      hal.Display
-	vfsCap    kernel.Capability
-	audioCap  kernel.Capability
-	timeCap   kernel.Capability
-	gpioCap   kernel.Capability
-	serialCap kernel.Capability
-
-	rtdemoProxyCap     kernel.Capability
-	rtvoxelProxyCap    kernel.Capability
-	imgviewProxyCap    kernel.Capability
-	hexProxyCap        kernel.Capability
-	snakeProxyCap      kernel.Capability
-	tetrisProxyCap     kernel.Capability
-	calendarProxyCap   kernel.Capability
-	todoProxyCap       kernel.Capability
-	archiveProxyCap    kernel.Capability
-	viProxyCap         kernel.Capability
-	mcProxyCap         kernel.Capability
-	vectorProxyCap     kernel.Capability
-	teaProxyCap        kernel.Capability
-	basicProxyCap      kernel.Capability
-	rfAnalyzerProxyCap kernel.Capability
-	gpioscopeProxyCap  kernel.Capability
-	fbtestProxyCap     kernel.Capability
-	serialtermProxyCap kernel.Capability
-	usersProxyCap      kernel.Capability
-	donutProxyCap      kernel.Capability
-
-	rtdemoCap     kernel.Capability
-	rtvoxelCap    kernel.Capability
-	imgviewCap    kernel.Capability
-	hexCap        kernel.Capability
-	snakeCap      kernel.Capability
-	tetrisCap     kernel.Capability
-	calendarCap   kernel.Capability
-	todoCap       kernel.Capability
-	archiveCap    kernel.Capability
-	viCap         kernel.Capability
-	mcCap         kernel.Capability
-	vectorCap     kernel.Capability
-	teaCap        kernel.Capability
-	basicCap      kernel.Capability
-	rfAnalyzerCap kernel.Capability
-	gpioscopeCap  kernel.Capability
-	fbtestCap     kernel.Capability
-	serialtermCap kernel.Capability
-	usersCap      kernel.Capability
-	donutCap      kernel.Capability
-
-	rtdemoEP     kernel.Capability
-	rtvoxelEP    kernel.Capability
-	imgviewEP    kernel.Capability
-	hexEP        kernel.Capability
-	snakeEP      kernel.Capability
-	tetrisEP     kernel.Capability
-	calendarEP   kernel.Capability
-	todoEP       kernel.Capability
-	archiveEP    kernel.Capability
-	viEP         kernel.Capability
-	mcEP         kernel.Capability
-	vectorEP     kernel.Capability
-	teaEP        kernel.Capability
-	basicEP      kernel.Capability
-	rfAnalyzerEP kernel.Capability
-	gpioscopeEP  kernel.Capability
-	fbtestEP     kernel.Capability
-	serialtermEP kernel.Capability
-	usersEP      kernel.Capability
-	donutEP      kernel.Capability
+	disp     hal.Display
+	namesCap kernel.Capability
+	opts     Options
 
 	mu sync.Mutex
 
-	rtdemoRunning     bool
-	rtvoxelRunning    bool
-	imgviewRunning    bool
-	hexRunning        bool
-	snakeRunning      bool
-	tetrisRunning     bool
-	calendarRunning   bool
-	todoRunning       bool
-	archiveRunning    bool
-	viRunning         bool
-	mcRunning         bool
-	vectorRunning     bool
-	teaRunning        bool
-	basicRunning      bool
-	rfAnalyzerRunning bool
-	gpioscopeRunning  bool
-	fbtestRunning     bool
-	serialtermRunning bool
-	usersRunning      bool
-	donutRunning      bool
-
-	rtdemoActive     bool
-	rtvoxelActive    bool
-	imgviewActive    bool
-	hexActive        bool
-	snakeActive      bool
-	tetrisActive     bool
-	calendarActive   bool
-	todoActive       bool
-	archiveActive    bool
-	viActive         bool
-	mcActive         bool
-	vectorActive     bool
-	teaActive        bool
-	basicActive      bool
-	rfAnalyzerActive bool
-	gpioscopeActive  bool
-	fbtestActive     bool
-	serialtermActive bool
-	usersActive      bool
-	donutActive      bool
-
-	rtdemoInactiveSince     uint64
-	rtvoxelInactiveSince    uint64
-	imgviewInactiveSince    uint64
-	hexInactiveSince        uint64
-	snakeInactiveSince      uint64
-	tetrisInactiveSince     uint64
-	calendarInactiveSince   uint64
-	todoInactiveSince       uint64
-	archiveInactiveSince    uint64
-	viInactiveSince         uint64
-	mcInactiveSince         uint64
-	vectorInactiveSince     uint64
-	teaInactiveSince        uint64
-	basicInactiveSince      uint64
-	rfAnalyzerInactiveSince uint64
-	gpioscopeInactiveSince  uint64
-	fbtestInactiveSince     uint64
-	serialtermInactiveSince uint64
-	usersInactiveSince      uint64
-	donutInactiveSince      uint64
+	apps map[proto.AppID]*app
+	// caps caches service capabilities resolved for Descriptor.Services.
+	caps map[string]kernel.Capability
+	// tasks maps running app tasks to their app, for MsgTaskExited.
+	tasks map[kernel.TaskID]proto.AppID
+	// usage is the task accounting at the last quota check.
+	usage map[kernel.TaskID]kernel.TaskInfo
+	// muxCap is consolemux's control endpoint, as handed to focused apps.
+	muxCap kernel.Capability
+}
+
+// New returns an app manager drawing on disp. App services are resolved and
+// app endpoints published through namesCap.
+func New(disp hal.Display, namesCap kernel.Capability) *Service {
+	return NewWith(disp, namesCap, Options{})
 }
 
-func New(disp hal.Display, vfsCap, audioCap, timeCap, gpioCap, serialCap, rtdemoProxyCap, rtvoxelProxyCap, imgviewProxyCap, hexProxyCap, snakeProxyCap, tetrisProxyCap, calendarProxyCap, todoProxyCap, archiveProxyCap, viProxyCap, mcProxyCap, vectorProxyCap, teaProxyCap, basicProxyCap, rfAnalyzerProxyCap, gpioscopeProxyCap, fbtestProxyCap, serialtermProxyCap, usersProxyCap, donutProxyCap, rtdemoCap, rtvoxelCap, imgviewCap, hexCap, snakeCap, tetrisCap, calendarCap, todoCap, archiveCap, viCap, mcCap, vectorCap, teaCap, basicCap, rfAnalyzerCap, gpioscopeCap, fbtestCap, serialtermCap, usersCap, donutCap, rtdemoEP, rtvoxelEP, imgviewEP, hexEP, snakeEP, tetrisEP, calendarEP, todoEP, archiveEP, viEP, mcEP, vectorEP, teaEP, basicEP, rfAnalyzerEP, gpioscopeEP, fbtestEP, serialtermEP, usersEP, donutEP kernel.Capability) *Service {
+// NewWith is New with background limits and snapshots.
+func NewWith(disp hal.Display, namesCap kernel.Capability, opts Options) *Service {
 	return &Service{
-		disp:               disp,
-		vfsCap:             vfsCap,
-		audioCap:           audioCap,
-		timeCap:            timeCap,
-		gpioCap:            gpioCap,
-		serialCap:          serialCap,
-		rtdemoProxyCap:     rtdemoProxyCap,
-		rtvoxelProxyCap:    rtvoxelProxyCap,
-		imgviewProxyCap:    imgviewProxyCap,
-		hexProxyCap:        hexProxyCap,
-		snakeProxyCap:      snakeProxyCap,
-		tetrisProxyCap:     tetrisProxyCap,
-		calendarProxyCap:   calendarProxyCap,
-		todoProxyCap:       todoProxyCap,
-		archiveProxyCap:    archiveProxyCap,
-		viProxyCap:         viProxyCap,
-		mcProxyCap:         mcProxyCap,
-		vectorProxyCap:     vectorProxyCap,
-		teaProxyCap:        teaProxyCap,
-		basicProxyCap:      basicProxyCap,
-		rfAnalyzerProxyCap: rfAnalyzerProxyCap,
-		gpioscopeProxyCap:  gpioscopeProxyCap,
-		fbtestProxyCap:     fbtestProxyCap,
-		serialtermProxyCap: serialtermProxyCap,
-		usersProxyCap:      usersProxyCap,
-		donutProxyCap:      donutProxyCap,
-		rtdemoCap:          rtdemoCap,
-		rtvoxelCap:         rtvoxelCap,
-		imgviewCap:         imgviewCap,
-		hexCap:             hexCap,
-		snakeCap:           snakeCap,
-		tetrisCap:          tetrisCap,
-		calendarCap:        calendarCap,
-		todoCap:            todoCap,
-		archiveCap:         archiveCap,
-		viCap:              viCap,
-		mcCap:              mcCap,
-		vectorCap:          vectorCap,
-		teaCap:             teaCap,
-		basicCap:           basicCap,
-		rfAnalyzerCap:      rfAnalyzerCap,
-		gpioscopeCap:       gpioscopeCap,
-		fbtestCap:          fbtestCap,
-		serialtermCap:      serialtermCap,
-		usersCap:           usersCap,
-		donutCap:           donutCap,
-		rtdemoEP:           rtdemoEP,
-		rtvoxelEP:          rtvoxelEP,
-		imgviewEP:          imgviewEP,
-		hexEP:              hexEP,
-		snakeEP:            snakeEP,
-		tetrisEP:           tetrisEP,
-		calendarEP:         calendarEP,
-		todoEP:             todoEP,
-		archiveEP:          archiveEP,
-		viEP:               viEP,
-		mcEP:               mcEP,
-		vectorEP:           vectorEP,
-		teaEP:              teaEP,
-		basicEP:            basicEP,
-		rfAnalyzerEP:       rfAnalyzerEP,
-		gpioscopeEP:        gpioscopeEP,
-		fbtestEP:           fbtestEP,
-		serialtermEP:       serialtermEP,
-		usersEP:            usersEP,
-		donutEP:            donutEP,
+		disp:     disp,
+		namesCap: namesCap,
+		opts:     opts,
+		apps:     make(map[proto.AppID]*app),
+		caps:     make(map[string]kernel.Capability),
+		tasks:    make(map[kernel.TaskID]proto.AppID),
 	}
 }
 
 func (s *Service) Run(ctx *kernel.Context) {
+	descs := apps.All()
+	s.mu.Lock()
+	for _, d := range descs {
+		s.apps[d.ID] = &app{desc: d}
+	}
+	s.mu.Unlock()
+
+	exitCap := ctx.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	if ctx.SetSupervisor(exitCap.Restrict(kernel.RightSend), proto.TaskExitedNotice) {
+		go s.watchExits(ctx, exitCap.Restrict(kernel.RightRecv))
+	}
 	go s.watchdog(ctx)
-	go s.runProxy(ctx, s.rtdemoProxyCap, proto.AppRTDemo)
-	go s.runProxy(ctx, s.rtvoxelProxyCap, proto.AppRTVoxel)
-	go s.runProxy(ctx, s.imgviewProxyCap, proto.AppImgView)
-	go s.runProxy(ctx, s.hexProxyCap, proto.AppHex)
-	go s.runProxy(ctx, s.snakeProxyCap, proto.AppSnake)
-	go s.runProxy(ctx, s.tetrisProxyCap, proto.AppTetris)
-	go s.runProxy(ctx, s.calendarProxyCap, proto.AppCalendar)
-	go s.runProxy(ctx, s.todoProxyCap, proto.AppTodo)
-	go s.runProxy(ctx, s.archiveProxyCap, proto.AppArchive)
-	go s.runProxy(ctx, s.viProxyCap, proto.AppVi)
-	go s.runProxy(ctx, s.mcProxyCap, proto.AppMC)
-	go s.runProxy(ctx, s.vectorProxyCap, proto.AppVector)
-	go s.runProxy(ctx, s.teaProxyCap, proto.AppTEA)
-	go s.runProxy(ctx, s.basicProxyCap, proto.AppBasic)
-	go s.runProxy(ctx, s.rfAnalyzerProxyCap, proto.AppRFAnalyzer)
-	go s.runProxy(ctx, s.gpioscopeProxyCap, proto.AppGPIOScope)
-	go s.runProxy(ctx, s.fbtestProxyCap, proto.AppFBTest)
-	go s.runProxy(ctx, s.serialtermProxyCap, proto.AppSerialTerm)
-	go s.runProxy(ctx, s.usersProxyCap, proto.AppUsers)
-	go s.runProxy(ctx, s.donutProxyCap, proto.AppQuarkDonut)
+	for _, d := range descs {
+		// consolemux sends focus changes to the proxy on the urgent lane.
+		proxy := ctx.NewEndpointWith(kernel.RightSend|kernel.RightRecv, kernel.EndpointOptions{Urgent: true})
+		if !proxy.Valid() {
+			continue
+		}
+		if err := namesclient.Register(ctx, s.namesCap, proto.AppEndpointName(d.ID), proxy.Restrict(kernel.RightSend)); err != nil {
+			continue
+		}
+		go s.runProxy(ctx, proxy.Restrict(kernel.RightRecv), d.ID)
+	}
 	select {}
 }
 
 func (s *Service) watchdog(ctx *kernel.Context) {
-	if autoUnloadAfterTicks == 0 {
-		return
-	}
-
 	last := ctx.NowTick()
+	lastMem, lastQuota := last, last
 	for {
 		last = ctx.WaitTick(last)
 		s.shutdownIdle(ctx, last)
+		if last-lastQuota >= apps.LimitWindowTicks {
+			lastQuota = last
+			s.checkQuotas(ctx)
+		}
+		if s.opts.MinFreeHeap != 0 && last-lastMem >= memCheckTicks {
+			lastMem = last
+			if heapLow(s.opts.MinFreeHeap) {
+				s.evictOne(ctx)
+			}
+		}
+	}
+}
+
+// heapLow reports whether less than min heap bytes are free. It collects
+// garbage first so that unreferenced memory does not count as pressure.
+func heapLow(min uint64) bool {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	if ms.HeapSys-ms.HeapAlloc >= min {
+		return false
 	}
+	runtime.GC()
+	runtime.ReadMemStats(&ms)
+	return ms.HeapSys-ms.HeapAlloc < min
+}
+
+// evictOne stops the least recently used background app. Apps that keep
+// running in the background (KeepLoaded) and apps that never had focus yet
+// are left alone.
+func (s *Service) evictOne(ctx *kernel.Context) bool {
+	s.mu.Lock()
+	lru := proto.AppNone
+	var since uint64
+	for id, a := range s.apps {
+		if !a.running || a.active || a.inactiveSince == 0 || a.desc.KeepLoaded {
+			continue
+		}
+		if lru == proto.AppNone || a.inactiveSince < since {
+			lru, since = id, a.inactiveSince
+		}
+	}
+	s.mu.Unlock()
+
+	if lru == proto.AppNone {
+		return false
+	}
+	s.stop(ctx, lru)
+	return true
+}
+
+// trimBackground enforces Options.MaxBackground.
+func (s *Service) trimBackground(ctx *kernel.Context) {
+	if s.opts.MaxBackground <= 0 {
+		return
+	}
+	for s.background() > s.opts.MaxBackground {
+		if !s.evictOne(ctx) {
+			return
+		}
+	}
+}
+
+func (s *Service) background() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, a := range s.apps {
+		if a.running && !a.active {
+			n++
+		}
+	}
+	return n
 }
 
 func (s *Service) shutdownIdle(ctx *kernel.Context, now uint64) {
 	var stop []proto.AppID
 
 	s.mu.Lock()
-	stop = s.appendStopIfIdle(stop, proto.AppRTDemo, s.rtdemoRunning, s.rtdemoActive, s.rtdemoInactiveSince, now)
-	stop = s.appendStopIfIdle(stop, proto.AppRTVoxel, s.rtvoxelRunning, s.rtvoxelActive, s.rtvoxelInactiveSince, now)
-	stop = s.appendStopIfIdle(stop, proto.AppImgView, s.imgviewRunning, s.imgviewActive, s.imgviewInactiveSince, now)
-	stop = s.appendStopIfIdle(stop, proto.AppHex, s.hexRunning, s.hexActive, s.hexInactiveSince, now)
-	stop = s.appendStopIfIdle(stop, proto.AppSnake, s.snakeRunning, s.snakeActive, s.snakeInactiveSince, now)
-	stop = s.appendStopIfIdle(stop, proto.AppTetris, s.tetrisRunning, s.tetrisActive, s.tetrisInactiveSince, now)
-	stop = s.appendStopIfIdle(stop, proto.AppCalendar, s.calendarRunning, s.calendarActive, s.calendarInactiveSince, now)
-	stop = s.appendStopIfIdle(stop, proto.AppTodo, s.todoRunning, s.todoActive, s.todoInactiveSince, now)
-	stop = s.appendStopIfIdle(stop, proto.AppArchive, s.archiveRunning, s.archiveActive, s.archiveInactiveSince, now)
-	stop = s.appendStopIfIdle(stop, proto.AppVi, s.viRunning, s.viActive, s.viInactiveSince, now)
-	stop = s.appendStopIfIdle(stop, proto.AppMC, s.mcRunning, s.mcActive, s.mcInactiveSince, now)
-	stop = s.appendStopIfIdle(stop, proto.AppVector, s.vectorRunning, s.vectorActive, s.vectorInactiveSince, now)
-	stop = s.appendStopIfIdle(stop, proto.AppTEA, s.teaRunning, s.teaActive, s.teaInactiveSince, now)
-	stop = s.appendStopIfIdle(stop, proto.AppBasic, s.basicRunning, s.basicActive, s.basicInactiveSince, now)
-	stop = s.appendStopIfIdle(stop, proto.AppRFAnalyzer, s.rfAnalyzerRunning, s.rfAnalyzerActive, s.rfAnalyzerInactiveSince, now)
-	stop = s.appendStopIfIdle(stop, proto.AppGPIOScope, s.gpioscopeRunning, s.gpioscopeActive, s.gpioscopeInactiveSince, now)
-	stop = s.appendStopIfIdle(stop, proto.AppFBTest, s.fbtestRunning, s.fbtestActive, s.fbtestInactiveSince, now)
-	stop = s.appendStopIfIdle(stop, proto.AppSerialTerm, s.serialtermRunning, s.serialtermActive, s.serialtermInactiveSince, now)
-	stop = s.appendStopIfIdle(stop, proto.AppUsers, s.usersRunning, s.usersActive, s.usersInactiveSince, now)
-	stop = s.appendStopIfIdle(stop, proto.AppQuarkDonut, s.donutRunning, s.donutActive, s.donutInactiveSince, now)
+	for id, a := range s.apps {
+		after := a.desc.UnloadAfter()
+		if !a.running || a.active || a.inactiveSince == 0 || after == 0 {
+			continue
+		}
+		if now-a.inactiveSince >= after {
+			stop = append(stop, id)
+		}
+	}
 	s.mu.Unlock()
 
 	for _, id := range stop {
@@ -309,14 +240,61 @@ func (s *Service) shutdownIdle(ctx *kernel.Context, now uint64) {
 	}
 }
 
-func (s *Service) appendStopIfIdle(out []proto.AppID, appID proto.AppID, running, active bool, inactiveSince, now uint64) []proto.AppID {
-	if !running || active || inactiveSince == 0 {
-		return out
+// watchExits marks an app as stopped when its task exits on its own (for
+// example after a panic), so the next select starts it again. Once an app
+// that is not running has no task left, its endpoint is freed.
+func (s *Service) watchExits(ctx *kernel.Context, exitCap kernel.Capability) {
+	ch, ok := ctx.RecvChan(exitCap)
+	if !ok {
+		return
 	}
-	if now-inactiveSince < autoUnloadAfterTicks {
-		return out
+	for msg := range ch {
+		if proto.Kind(msg.Kind) != proto.MsgTaskExited {
+			continue
+		}
+		if msg.Grant.Valid() {
+			ctx.FreeRegion(msg.Grant)
+		}
+		exit, ok := proto.DecodeTaskExitedPayload(msg.Payload())
+		if !ok {
+			continue
+		}
+
+		s.mu.Lock()
+		appID, tracked := s.tasks[kernel.TaskID(exit.Task)]
+		delete(s.tasks, kernel.TaskID(exit.Task))
+		if a := s.apps[appID]; tracked && a != nil && a.killed == kernel.TaskID(exit.Task) {
+			a.killed = kernel.NoTask
+		}
+		if a := s.apps[appID]; tracked && a != nil && a.running && !s.hasTaskLocked(appID) {
+			a.running = false
+			a.snap = nil
+			a.setActive(false, ctx.NowTick())
+		}
+		if a := s.apps[appID]; tracked && a != nil && !a.running && !a.starting && !s.hasTaskLocked(appID) && a.ep.Valid() {
+			ctx.FreeEndpoint(a.ep)
+			a.ep = kernel.Capability{}
+		}
+		s.mu.Unlock()
 	}
-	return append(out, appID)
+}
+
+func (s *Service) track(appID proto.AppID, id kernel.TaskID) {
+	if id == kernel.NoTask {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks[id] = appID
+}
+
+func (s *Service) hasTaskLocked(appID proto.AppID) bool {
+	for _, a := range s.tasks {
+		if a == appID {
+			return true
+		}
+	}
+	return false
 }
 
 func (s *Service) runProxy(ctx *kernel.Context, proxyCap kernel.Capability, appID proto.AppID) {
@@ -327,6 +305,7 @@ func (s *Service) runProxy(ctx *kernel.Context, proxyCap kernel.Capability, appI
 	for msg := range ch {
 		switch proto.Kind(msg.Kind) {
 		case proto.MsgAppSelect:
+			s.setVFS(ctx, appID, msg.Cap)
 			s.ensureRunning(ctx, appID)
 			_ = ctx.SendToCapRetry(
 				s.appCapByID(appID),
@@ -342,14 +321,22 @@ func (s *Service) runProxy(ctx *kernel.Context, proxyCap kernel.Capability, appI
 				continue
 			}
 			if active {
+				if msg.Cap.Valid() {
+					s.mu.Lock()
+					s.muxCap = msg.Cap
+					s.mu.Unlock()
+				}
 				now := ctx.NowTick()
 				s.ensureRunning(ctx, appID)
 				s.setActive(appID, true, now)
+				s.restore(appID)
 				_ = ctx.SendToCapRetry(s.appCapByID(appID), msg.Kind, msg.Payload(), msg.Cap, proxySendRetryLimit)
 				continue
 			}
 
+			s.snapshot(appID)
 			s.setActive(appID, false, ctx.NowTick())
+			s.trimBackground(ctx)
 			if s.isRunning(appID) {
 				_ = ctx.SendToCapRetry(
 					s.appCapByID(appID),
@@ -360,6 +347,13 @@ func (s *Service) runProxy(ctx *kernel.Context, proxyCap kernel.Capability, appI
 				)
 			}
 
+		case proto.MsgInputEvent:
+			// Events never start an app: the bytes of the same key do.
+			if !s.wantsEvents(appID) {
+				continue
+			}
+			_ = ctx.SendToCapRetry(s.appCapByID(appID), msg.Kind, msg.Payload(), kernel.Capability{}, proxySendRetryLimit)
+
 		case proto.MsgTermInput:
 			s.ensureRunning(ctx, appID)
 			_ = ctx.SendToCapRetry(
@@ -377,431 +371,236 @@ const proxySendRetryLimit = 50
 
 func (s *Service) ensureRunning(ctx *kernel.Context, appID proto.AppID) {
 	s.mu.Lock()
-	running := s.isRunningLocked(appID)
-	s.mu.Unlock()
-	if running {
+	a := s.apps[appID]
+	if a == nil || a.running {
+		s.mu.Unlock()
 		return
 	}
-
-	switch appID {
-	case proto.AppRTDemo:
-		ctx.AddTask(rtdemotask.New(s.disp, s.rtdemoEP))
-		s.mu.Lock()
-		s.rtdemoRunning = true
-		s.mu.Unlock()
-
-	case proto.AppRTVoxel:
-		ctx.AddTask(rtvoxeltask.New(s.disp, s.rtvoxelEP))
-		s.mu.Lock()
-		s.rtvoxelRunning = true
-		s.mu.Unlock()
-
-	case proto.AppImgView:
-		ctx.AddTask(imgviewtask.New(s.disp, s.imgviewEP, s.vfsCap))
-		s.mu.Lock()
-		s.imgviewRunning = true
-		s.mu.Unlock()
-
-	case proto.AppHex:
-		ctx.AddTask(hexedittask.New(s.disp, s.hexEP, s.vfsCap))
-		s.mu.Lock()
-		s.hexRunning = true
-		s.mu.Unlock()
-
-	case proto.AppSnake:
-		ctx.AddTask(snaketask.New(s.disp, s.snakeEP))
-		s.mu.Lock()
-		s.snakeRunning = true
-		s.mu.Unlock()
-
-	case proto.AppTetris:
-		ctx.AddTask(tetristask.New(s.disp, s.tetrisEP))
-		s.mu.Lock()
-		s.tetrisRunning = true
-		s.mu.Unlock()
-
-	case proto.AppCalendar:
-		ctx.AddTask(calendartask.New(s.disp, s.calendarEP, s.vfsCap))
-		s.mu.Lock()
-		s.calendarRunning = true
-		s.mu.Unlock()
-
-	case proto.AppTodo:
-		ctx.AddTask(todotask.New(s.disp, s.todoEP, s.vfsCap))
-		s.mu.Lock()
-		s.todoRunning = true
+	if a.killed != kernel.NoTask {
+		name := a.desc.Name
 		s.mu.Unlock()
-
-	case proto.AppArchive:
-		ctx.AddTask(archivetask.New(s.disp, s.archiveEP, s.vfsCap))
-		s.mu.Lock()
-		s.archiveRunning = true
-		s.mu.Unlock()
-
-	case proto.AppVi:
-		ctx.AddTask(vitask.New(s.disp, s.viEP, s.vfsCap))
-		s.mu.Lock()
-		s.viRunning = true
-		s.mu.Unlock()
-
-	case proto.AppMC:
-		ctx.AddTask(mctask.New(s.disp, s.mcEP, s.vfsCap))
-		s.mu.Lock()
-		s.mcRunning = true
-		s.mu.Unlock()
-
-	case proto.AppVector:
-		ctx.AddTask(vectortask.New(s.disp, s.vectorEP, s.vfsCap))
-		s.mu.Lock()
-		s.vectorRunning = true
-		s.mu.Unlock()
-
-	case proto.AppTEA:
-		ctx.AddTask(teaplayertask.New(s.disp, s.teaEP, s.vfsCap, s.audioCap))
-		s.mu.Lock()
-		s.teaRunning = true
-		s.mu.Unlock()
-
-	case proto.AppBasic:
-		ctx.AddTask(basictask.New(s.disp, s.basicEP, s.vfsCap))
+		s.notify(ctx, name+" is still stopping")
+		return
+	}
+	desc, vfsCap := a.desc, a.vfs
+	a.starting = true
+	s.mu.Unlock()
+	defer func() {
 		s.mu.Lock()
-		s.basicRunning = true
+		a.starting = false
 		s.mu.Unlock()
+	}()
 
-	case proto.AppRFAnalyzer:
-		ctx.AddTask(rfanalyzertask.New(s.disp, s.rfAnalyzerEP, s.vfsCap))
-		s.mu.Lock()
-		s.rfAnalyzerRunning = true
-		s.mu.Unlock()
+	ep := s.appEP(ctx, appID)
+	if !ep.Valid() {
+		return
+	}
+	if desc.Suspend {
+		s.waitExited(ctx, appID)
+	}
+	caps := s.resolve(ctx, desc.Services)
+	if _, ok := caps["vfs"]; ok && vfsCap.Valid() {
+		caps["vfs"] = vfsCap
+	}
+	env := apps.NewEnv(s.display(desc), ep, caps)
+	s.track(appID, ctx.AddTask(desc.New(env)))
 
-	case proto.AppGPIOScope:
-		ctx.AddTask(gpioscopetask.New(s.disp, s.gpioscopeEP, s.timeCap, s.gpioCap))
-		s.mu.Lock()
-		s.gpioscopeRunning = true
-		s.mu.Unlock()
+	s.mu.Lock()
+	a.running = true
+	s.mu.Unlock()
 
-	case proto.AppFBTest:
-		ctx.AddTask(fbtesttask.New(s.disp, s.fbtestEP))
-		s.mu.Lock()
-		s.fbtestRunning = true
-		s.mu.Unlock()
+	if desc.Suspend {
+		// Queued ahead of the message that started the app.
+		_ = ctx.SendToCapRetry(s.appCapByID(appID), uint16(proto.MsgAppResume), proto.AppStatePayload(apps.StatePath(desc.Name)), kernel.Capability{}, proxySendRetryLimit)
+	}
+}
 
-	case proto.AppSerialTerm:
-		ctx.AddTask(serialtermtask.New(s.disp, s.serialCap, s.serialtermEP))
-		s.mu.Lock()
-		s.serialtermRunning = true
+// setVFS records vfsCap as the VFS identity of appID. An app running with
+// another identity is stopped first, so that it never acts for the wrong user.
+func (s *Service) setVFS(ctx *kernel.Context, appID proto.AppID, vfsCap kernel.Capability) {
+	if !vfsCap.Valid() {
+		return
+	}
+	s.mu.Lock()
+	a := s.apps[appID]
+	if a == nil || a.vfs == vfsCap {
 		s.mu.Unlock()
+		return
+	}
+	a.vfs = vfsCap
+	running := a.running
+	s.mu.Unlock()
+	if running {
+		s.stop(ctx, appID)
+		s.waitExited(ctx, appID)
+	}
+}
 
-	case proto.AppUsers:
-		ctx.AddTask(userstask.New(s.disp, s.usersEP, s.vfsCap))
+// waitExited waits for the previous task of appID, which may still be
+// saving its state, so that the new one resumes from it.
+func (s *Service) waitExited(ctx *kernel.Context, appID proto.AppID) {
+	start := ctx.NowTick()
+	last := start
+	for {
 		s.mu.Lock()
-		s.usersRunning = true
+		busy := s.hasTaskLocked(appID)
 		s.mu.Unlock()
+		if !busy || last-start >= suspendWaitTicks {
+			return
+		}
+		last = ctx.WaitTick(last)
+	}
+}
 
-	case proto.AppQuarkDonut:
-		ctx.AddTask(quarkdonuttask.New(s.disp, s.donutEP))
+// resolve looks up the services an app needs. Failed lookups are retried on
+// the next start; the app gets an invalid capability meanwhile.
+func (s *Service) resolve(ctx *kernel.Context, services []string) map[string]kernel.Capability {
+	out := make(map[string]kernel.Capability, len(services))
+	for _, name := range services {
 		s.mu.Lock()
-		s.donutRunning = true
+		c, ok := s.caps[name]
 		s.mu.Unlock()
+		if !ok {
+			var err error
+			c, err = namesclient.Lookup(ctx, s.namesCap, name)
+			if err == nil {
+				s.mu.Lock()
+				s.caps[name] = c
+				s.mu.Unlock()
+			}
+		}
+		out[name] = c
 	}
+	return out
 }
 
 func (s *Service) stop(ctx *kernel.Context, appID proto.AppID) {
 	s.mu.Lock()
-	running := s.isRunningLocked(appID)
+	a := s.apps[appID]
+	running := a != nil && a.running
 	if running {
-		s.setRunningLocked(appID, false)
-		s.setActiveLocked(appID, false, ctx.NowTick())
+		a.running = false
+		a.snap = nil
+		a.setActive(false, ctx.NowTick())
 	}
 	s.mu.Unlock()
 	if !running {
 		return
 	}
 
-	switch appID {
-	case proto.AppRTDemo:
-		_ = ctx.SendToCapResult(s.rtdemoCap, uint16(proto.MsgAppShutdown), nil, kernel.Capability{})
-
-	case proto.AppRTVoxel:
-		_ = ctx.SendToCapResult(s.rtvoxelCap, uint16(proto.MsgAppShutdown), nil, kernel.Capability{})
-
-	case proto.AppImgView:
-		_ = ctx.SendToCapResult(s.imgviewCap, uint16(proto.MsgAppShutdown), nil, kernel.Capability{})
-
-	case proto.AppHex:
-		_ = ctx.SendToCapResult(s.hexCap, uint16(proto.MsgAppShutdown), nil, kernel.Capability{})
-
-	case proto.AppSnake:
-		_ = ctx.SendToCapResult(s.snakeCap, uint16(proto.MsgAppShutdown), nil, kernel.Capability{})
-
-	case proto.AppTetris:
-		_ = ctx.SendToCapResult(s.tetrisCap, uint16(proto.MsgAppShutdown), nil, kernel.Capability{})
-
-	case proto.AppCalendar:
-		_ = ctx.SendToCapResult(s.calendarCap, uint16(proto.MsgAppShutdown), nil, kernel.Capability{})
-
-	case proto.AppTodo:
-		_ = ctx.SendToCapResult(s.todoCap, uint16(proto.MsgAppShutdown), nil, kernel.Capability{})
-
-	case proto.AppArchive:
-		_ = ctx.SendToCapResult(s.archiveCap, uint16(proto.MsgAppShutdown), nil, kernel.Capability{})
-
-	case proto.AppVi:
-		_ = ctx.SendToCapResult(s.viCap, uint16(proto.MsgAppShutdown), nil, kernel.Capability{})
-
-	case proto.AppMC:
-		_ = ctx.SendToCapResult(s.mcCap, uint16(proto.MsgAppShutdown), nil, kernel.Capability{})
-
-	case proto.AppVector:
-		_ = ctx.SendToCapResult(s.vectorCap, uint16(proto.MsgAppShutdown), nil, kernel.Capability{})
-
-	case proto.AppTEA:
-		_ = ctx.SendToCapResult(s.teaCap, uint16(proto.MsgAppShutdown), nil, kernel.Capability{})
+	if a.desc.Suspend {
+		_ = ctx.SendUrgent(s.appCapByID(appID), uint16(proto.MsgAppSuspend), proto.AppStatePayload(apps.StatePath(a.desc.Name)), kernel.Capability{}, shutdownTimeoutTicks)
+		return
+	}
+	_ = ctx.SendUrgent(s.appCapByID(appID), uint16(proto.MsgAppShutdown), nil, kernel.Capability{}, shutdownTimeoutTicks)
+}
 
-	case proto.AppBasic:
-		_ = ctx.SendToCapResult(s.basicCap, uint16(proto.MsgAppShutdown), nil, kernel.Capability{})
+// appEP returns the receive endpoint for appID's task, creating it on first use.
+func (s *Service) appEP(ctx *kernel.Context, appID proto.AppID) kernel.Capability {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.apps[appID]
+	if a == nil {
+		return kernel.Capability{}
+	}
+	if !a.ep.Valid() {
+		// stop's shutdown and suspend go on the urgent lane, past a mailbox
+		// full of input the app is not reading.
+		a.ep = ctx.NewEndpointWith(kernel.RightSend|kernel.RightRecv, kernel.EndpointOptions{Urgent: true})
+	}
+	return a.ep.Restrict(kernel.RightRecv)
+}
 
-	case proto.AppRFAnalyzer:
-		_ = ctx.SendToCapResult(s.rfAnalyzerCap, uint16(proto.MsgAppShutdown), nil, kernel.Capability{})
-	case proto.AppGPIOScope:
-		_ = ctx.SendToCapResult(s.gpioscopeCap, uint16(proto.MsgAppShutdown), nil, kernel.Capability{})
+// snapshot copies the framebuffer into appID's snapshot while the app is
+// still the one on screen.
+func (s *Service) snapshot(appID proto.AppID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.apps[appID]
+	if a == nil || !a.running || !a.active {
+		return
+	}
+	if fb := s.framebuffer(a.desc); fb != nil {
+		a.snap = append(a.snap[:0], fb.Buffer()...)
+	}
+}
 
-	case proto.AppFBTest:
-		_ = ctx.SendToCapResult(s.fbtestCap, uint16(proto.MsgAppShutdown), nil, kernel.Capability{})
+// restore puts appID's snapshot back on screen.
+func (s *Service) restore(appID proto.AppID) {
+	s.mu.Lock()
+	var snap []byte
+	var fb hal.Framebuffer
+	if a := s.apps[appID]; a != nil {
+		snap = a.snap
+		fb = s.framebuffer(a.desc)
+	}
+	s.mu.Unlock()
+	if fb == nil {
+		return
+	}
 
-	case proto.AppSerialTerm:
-		_ = ctx.SendToCapResult(s.serialtermCap, uint16(proto.MsgAppShutdown), nil, kernel.Capability{})
+	buf := fb.Buffer()
+	if len(snap) == 0 || len(snap) != len(buf) {
+		return
+	}
+	copy(buf, snap)
+	_ = fb.Present()
+}
 
-	case proto.AppUsers:
-		_ = ctx.SendToCapResult(s.usersCap, uint16(proto.MsgAppShutdown), nil, kernel.Capability{})
+func (s *Service) framebuffer(desc apps.Descriptor) hal.Framebuffer {
+	disp := s.display(desc)
+	if !s.opts.Snapshots || disp == nil {
+		return nil
+	}
+	return disp.Framebuffer()
+}
 
-	case proto.AppQuarkDonut:
-		_ = ctx.SendToCapResult(s.donutCap, uint16(proto.MsgAppShutdown), nil, kernel.Capability{})
+// display returns the display the app described by desc draws on.
+func (s *Service) display(desc apps.Descriptor) hal.Display {
+	if desc.FullScreen && s.opts.FullScreen != nil {
+		return s.opts.FullScreen
 	}
+	return s.disp
 }
 
 func (s *Service) appCapByID(appID proto.AppID) kernel.Capability {
-	switch appID {
-	case proto.AppRTDemo:
-		return s.rtdemoCap
-	case proto.AppRTVoxel:
-		return s.rtvoxelCap
-	case proto.AppImgView:
-		return s.imgviewCap
-	case proto.AppHex:
-		return s.hexCap
-	case proto.AppSnake:
-		return s.snakeCap
-	case proto.AppTetris:
-		return s.tetrisCap
-	case proto.AppCalendar:
-		return s.calendarCap
-	case proto.AppTodo:
-		return s.todoCap
-	case proto.AppArchive:
-		return s.archiveCap
-	case proto.AppVi:
-		return s.viCap
-	case proto.AppMC:
-		return s.mcCap
-	case proto.AppVector:
-		return s.vectorCap
-	case proto.AppTEA:
-		return s.teaCap
-	case proto.AppBasic:
-		return s.basicCap
-	case proto.AppRFAnalyzer:
-		return s.rfAnalyzerCap
-	case proto.AppGPIOScope:
-		return s.gpioscopeCap
-	case proto.AppFBTest:
-		return s.fbtestCap
-	case proto.AppSerialTerm:
-		return s.serialtermCap
-	case proto.AppUsers:
-		return s.usersCap
-	case proto.AppQuarkDonut:
-		return s.donutCap
-	default:
-		return kernel.Capability{}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a := s.apps[appID]; a != nil {
+		return a.ep.Restrict(kernel.RightSend)
 	}
+	return kernel.Capability{}
 }
 
 func (s *Service) isRunning(appID proto.AppID) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.isRunningLocked(appID)
-}
-
-func (s *Service) isRunningLocked(appID proto.AppID) bool {
-	switch appID {
-	case proto.AppRTDemo:
-		return s.rtdemoRunning
-	case proto.AppRTVoxel:
-		return s.rtvoxelRunning
-	case proto.AppImgView:
-		return s.imgviewRunning
-	case proto.AppHex:
-		return s.hexRunning
-	case proto.AppSnake:
-		return s.snakeRunning
-	case proto.AppTetris:
-		return s.tetrisRunning
-	case proto.AppCalendar:
-		return s.calendarRunning
-	case proto.AppTodo:
-		return s.todoRunning
-	case proto.AppArchive:
-		return s.archiveRunning
-	case proto.AppVi:
-		return s.viRunning
-	case proto.AppMC:
-		return s.mcRunning
-	case proto.AppVector:
-		return s.vectorRunning
-	case proto.AppTEA:
-		return s.teaRunning
-	case proto.AppBasic:
-		return s.basicRunning
-	case proto.AppRFAnalyzer:
-		return s.rfAnalyzerRunning
-	case proto.AppGPIOScope:
-		return s.gpioscopeRunning
-	case proto.AppFBTest:
-		return s.fbtestRunning
-	case proto.AppSerialTerm:
-		return s.serialtermRunning
-	case proto.AppUsers:
-		return s.usersRunning
-	case proto.AppQuarkDonut:
-		return s.donutRunning
-	default:
-		return false
-	}
+	a := s.apps[appID]
+	return a != nil && a.running
 }
 
-func (s *Service) setRunningLocked(appID proto.AppID, running bool) {
-	switch appID {
-	case proto.AppRTDemo:
-		s.rtdemoRunning = running
-	case proto.AppRTVoxel:
-		s.rtvoxelRunning = running
-	case proto.AppImgView:
-		s.imgviewRunning = running
-	case proto.AppHex:
-		s.hexRunning = running
-	case proto.AppSnake:
-		s.snakeRunning = running
-	case proto.AppTetris:
-		s.tetrisRunning = running
-	case proto.AppCalendar:
-		s.calendarRunning = running
-	case proto.AppTodo:
-		s.todoRunning = running
-	case proto.AppArchive:
-		s.archiveRunning = running
-	case proto.AppVi:
-		s.viRunning = running
-	case proto.AppMC:
-		s.mcRunning = running
-	case proto.AppVector:
-		s.vectorRunning = running
-	case proto.AppTEA:
-		s.teaRunning = running
-	case proto.AppBasic:
-		s.basicRunning = running
-	case proto.AppRFAnalyzer:
-		s.rfAnalyzerRunning = running
-	case proto.AppGPIOScope:
-		s.gpioscopeRunning = running
-	case proto.AppFBTest:
-		s.fbtestRunning = running
-	case proto.AppSerialTerm:
-		s.serialtermRunning = running
-	case proto.AppUsers:
-		s.usersRunning = running
-	case proto.AppQuarkDonut:
-		s.donutRunning = running
-	}
+// wantsEvents reports whether appID is running and reads MsgInputEvent.
+func (s *Service) wantsEvents(appID proto.AppID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.apps[appID]
+	return a != nil && a.running && a.desc.InputEvents
 }
 
 func (s *Service) setActive(appID proto.AppID, active bool, now uint64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.setActiveLocked(appID, active, now)
-}
-
-func (s *Service) setActiveLocked(appID proto.AppID, active bool, now uint64) {
-	switch appID {
-	case proto.AppRTDemo:
-		s.rtdemoActive = active
-		s.rtdemoInactiveSince = inactiveSince(active, now, s.rtdemoInactiveSince)
-	case proto.AppRTVoxel:
-		s.rtvoxelActive = active
-		s.rtvoxelInactiveSince = inactiveSince(active, now, s.rtvoxelInactiveSince)
-	case proto.AppImgView:
-		s.imgviewActive = active
-		s.imgviewInactiveSince = inactiveSince(active, now, s.imgviewInactiveSince)
-	case proto.AppHex:
-		s.hexActive = active
-		s.hexInactiveSince = inactiveSince(active, now, s.hexInactiveSince)
-	case proto.AppSnake:
-		s.snakeActive = active
-		s.snakeInactiveSince = inactiveSince(active, now, s.snakeInactiveSince)
-	case proto.AppTetris:
-		s.tetrisActive = active
-		s.tetrisInactiveSince = inactiveSince(active, now, s.tetrisInactiveSince)
-	case proto.AppCalendar:
-		s.calendarActive = active
-		s.calendarInactiveSince = inactiveSince(active, now, s.calendarInactiveSince)
-	case proto.AppTodo:
-		s.todoActive = active
-		s.todoInactiveSince = inactiveSince(active, now, s.todoInactiveSince)
-	case proto.AppArchive:
-		s.archiveActive = active
-		s.archiveInactiveSince = inactiveSince(active, now, s.archiveInactiveSince)
-	case proto.AppVi:
-		s.viActive = active
-		s.viInactiveSince = inactiveSince(active, now, s.viInactiveSince)
-	case proto.AppMC:
-		s.mcActive = active
-		s.mcInactiveSince = inactiveSince(active, now, s.mcInactiveSince)
-	case proto.AppVector:
-		s.vectorActive = active
-		s.vectorInactiveSince = inactiveSince(active, now, s.vectorInactiveSince)
-	case proto.AppTEA:
-		s.teaActive = active
-		s.teaInactiveSince = inactiveSince(active, now, s.teaInactiveSince)
-	case proto.AppBasic:
-		s.basicActive = active
-		s.basicInactiveSince = inactiveSince(active, now, s.basicInactiveSince)
-	case proto.AppRFAnalyzer:
-		s.rfAnalyzerActive = active
-		s.rfAnalyzerInactiveSince = inactiveSince(active, now, s.rfAnalyzerInactiveSince)
-	case proto.AppGPIOScope:
-		s.gpioscopeActive = active
-		s.gpioscopeInactiveSince = inactiveSince(active, now, s.gpioscopeInactiveSince)
-	case proto.AppFBTest:
-		s.fbtestActive = active
-		s.fbtestInactiveSince = inactiveSince(active, now, s.fbtestInactiveSince)
-	case proto.AppSerialTerm:
-		s.serialtermActive = active
-		s.serialtermInactiveSince = inactiveSince(active, now, s.serialtermInactiveSince)
-	case proto.AppUsers:
-		s.usersActive = active
-		s.usersInactiveSince = inactiveSince(active, now, s.usersInactiveSince)
-	case proto.AppQuarkDonut:
-		s.donutActive = active
-		s.donutInactiveSince = inactiveSince(active, now, s.donutInactiveSince)
+	if a := s.apps[appID]; a != nil {
+		a.setActive(active, now)
 	}
 }
 
-func inactiveSince(active bool, now, prev uint64) uint64 {
-	if active {
-		return 0
-	}
-	if prev != 0 {
-		return prev
+func (a *app) setActive(active bool, now uint64) {
+	a.active = active
+	switch {
+	case active:
+		a.inactiveSince = 0
+	case a.inactiveSince == 0:
+		a.inactiveSince = now
 	}
-	return now
 }
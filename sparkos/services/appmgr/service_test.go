@@ -0,0 +1,474 @@
+package appmgr
+
+import (
+	"testing"
+	"time"
+
+	"spark/sparkos/apps"
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+)
+
+type funcTask func(ctx *kernel.Context)
+
+func (f funcTask) Run(ctx *kernel.Context) { f(ctx) }
+
+func TestTrimBackgroundEvictsLeastRecentlyUsed(t *testing.T) {
+	k := kernel.New()
+	s := NewWith(nil, kernel.Capability{}, Options{MaxBackground: 1})
+
+	// Four loaded apps: three in the background, focused last at ticks
+	// 30, 10 and 20, and one in front.
+	for _, a := range []struct {
+		id     proto.AppID
+		active bool
+		since  uint64
+	}{
+		{proto.AppSnake, false, 30},
+		{proto.AppTetris, false, 10},
+		{proto.AppTodo, false, 20},
+		{proto.AppMC, true, 0},
+	} {
+		s.apps[a.id] = &app{
+			desc:          apps.Descriptor{ID: a.id},
+			ep:            k.NewEndpoint(kernel.RightSend | kernel.RightRecv),
+			running:       true,
+			active:        a.active,
+			inactiveSince: a.since,
+		}
+	}
+
+	done := make(chan struct{})
+	k.AddTask(funcTask(func(ctx *kernel.Context) {
+		s.trimBackground(ctx)
+		close(done)
+	}))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("trimBackground did not return")
+	}
+
+	for id, want := range map[proto.AppID]bool{
+		proto.AppSnake:  true,
+		proto.AppTetris: false,
+		proto.AppTodo:   false,
+		proto.AppMC:     true,
+	} {
+		if got := s.isRunning(id); got != want {
+			t.Errorf("app %d running=%v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestStopSuspendsAndStartResumes(t *testing.T) {
+	k := kernel.New()
+	s := NewWith(nil, kernel.Capability{}, Options{})
+
+	started := make(chan kernel.Message, 4)
+	for _, d := range []apps.Descriptor{
+		{ID: proto.AppTetris, Name: "tetris", Suspend: true},
+		{ID: proto.AppSnake, Name: "snake"},
+	} {
+		d.New = func(env apps.Env) kernel.Task {
+			return funcTask(func(ctx *kernel.Context) {
+				if msg, ok := ctx.Recv(env.EP); ok {
+					started <- msg
+				}
+			})
+		}
+		s.apps[d.ID] = &app{
+			desc:          d,
+			ep:            k.NewEndpoint(kernel.RightSend | kernel.RightRecv),
+			running:       true,
+			inactiveSince: 1,
+		}
+	}
+
+	done := make(chan struct{})
+	k.AddTask(funcTask(func(ctx *kernel.Context) {
+		defer close(done)
+		for _, id := range []proto.AppID{proto.AppTetris, proto.AppSnake} {
+			s.stop(ctx, id)
+		}
+		for id, want := range map[proto.AppID]proto.Kind{
+			proto.AppTetris: proto.MsgAppSuspend,
+			proto.AppSnake:  proto.MsgAppShutdown,
+		} {
+			msg, ok := ctx.TryRecv(s.apps[id].ep.Restrict(kernel.RightRecv))
+			if !ok || proto.Kind(msg.Kind) != want {
+				t.Errorf("app %d: got %s, want %s", id, proto.Kind(msg.Kind), want)
+				continue
+			}
+			if want == proto.MsgAppSuspend {
+				if p, _ := proto.DecodeAppStatePayload(msg.Payload()); p != "/var/appstate/tetris" {
+					t.Errorf("suspend path = %q", p)
+				}
+			}
+		}
+		s.ensureRunning(ctx, proto.AppTetris)
+		s.ensureRunning(ctx, proto.AppSnake)
+	}))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stop/start did not return")
+	}
+
+	select {
+	case msg := <-started:
+		if proto.Kind(msg.Kind) != proto.MsgAppResume {
+			t.Fatalf("first message = %s, want app_resume", proto.Kind(msg.Kind))
+		}
+		if p, _ := proto.DecodeAppStatePayload(msg.Payload()); p != "/var/appstate/tetris" {
+			t.Fatalf("resume path = %q", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no resume")
+	}
+	select {
+	case msg := <-started:
+		t.Fatalf("unexpected %s to an app without Suspend", proto.Kind(msg.Kind))
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestExceeded(t *testing.T) {
+	l := apps.Limits{Endpoints: 2, Sent: 100, BusyPercent: 50}
+	for _, tc := range []struct {
+		u    usage
+		over bool
+	}{
+		{usage{endpoints: 2, sent: 100, busy: 1000, samples: 2000}, false},
+		{usage{endpoints: 3}, true},
+		{usage{sent: 101}, true},
+		{usage{busy: 1200, samples: 2000}, true},
+		// Too few samples to judge.
+		{usage{busy: 10, samples: 10}, false},
+	} {
+		if got := exceeded(l, tc.u) != ""; got != tc.over {
+			t.Errorf("%+v: over=%v, want %v", tc.u, got, tc.over)
+		}
+	}
+	if why := exceeded(apps.Limits{}, usage{endpoints: 60, sent: 1 << 20}); why != "" {
+		t.Errorf("zero limits reported %q", why)
+	}
+}
+
+func TestCheckQuotasKillsApp(t *testing.T) {
+	k := kernel.New()
+	s := NewWith(nil, kernel.Capability{}, Options{})
+
+	held := make(chan struct{})
+	d := apps.Descriptor{ID: proto.AppSnake, Name: "snake", Limits: apps.Limits{Endpoints: 1}}
+	d.New = func(env apps.Env) kernel.Task {
+		return funcTask(func(ctx *kernel.Context) {
+			ctx.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+			ctx.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+			close(held)
+			ctx.Recv(env.EP)
+		})
+	}
+	s.apps[d.ID] = &app{desc: d}
+
+	done := make(chan struct{})
+	k.AddTask(funcTask(func(ctx *kernel.Context) {
+		defer close(done)
+		s.ensureRunning(ctx, d.ID)
+		<-held
+		s.checkQuotas(ctx)
+	}))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("checkQuotas did not return")
+	}
+
+	if s.isRunning(d.ID) {
+		t.Fatal("app over its endpoint limit is still running")
+	}
+	var task kernel.TaskID
+	for id := range s.tasks {
+		task = id
+	}
+	if task == kernel.NoTask {
+		t.Fatal("app task was not tracked")
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		alive := false
+		for _, ti := range k.Tasks() {
+			alive = alive || ti.ID == task
+		}
+		if !alive {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("app task was not killed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestKilledAppStartsAgainOnceUnwound(t *testing.T) {
+	k := kernel.New()
+	s := NewWith(nil, kernel.Capability{}, Options{})
+
+	started := make(chan struct{}, 2)
+	spin := make(chan struct{})
+	d := apps.Descriptor{ID: proto.AppBasic, Name: "basic", Limits: apps.Limits{Endpoints: 1}}
+	d.New = func(env apps.Env) kernel.Task {
+		return funcTask(func(ctx *kernel.Context) {
+			ctx.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+			ctx.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+			started <- struct{}{}
+			// Computes without kernel calls until the test lets it reach
+			// its check point.
+			<-spin
+			for {
+				ctx.Yield()
+			}
+		})
+	}
+	s.apps[d.ID] = &app{desc: d}
+
+	restarted := make(chan bool, 1)
+	done := make(chan struct{})
+	k.AddTask(funcTask(func(ctx *kernel.Context) {
+		defer close(done)
+		exitCap := ctx.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+		if ctx.SetSupervisor(exitCap.Restrict(kernel.RightSend), proto.TaskExitedNotice) {
+			go s.watchExits(ctx, exitCap.Restrict(kernel.RightRecv))
+		}
+		s.ensureRunning(ctx, d.ID)
+		<-started
+		s.checkQuotas(ctx)
+
+		s.ensureRunning(ctx, d.ID)
+		select {
+		case <-started:
+			restarted <- true
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(spin)
+		deadline := time.Now().Add(time.Second)
+		for {
+			s.mu.Lock()
+			killed := s.apps[d.ID].killed
+			s.mu.Unlock()
+			if killed == kernel.NoTask || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		s.ensureRunning(ctx, d.ID)
+		select {
+		case <-started:
+			restarted <- false
+			s.checkQuotas(ctx)
+		case <-time.After(time.Second):
+		}
+	}))
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("selects did not return")
+	}
+
+	select {
+	case early := <-restarted:
+		if early {
+			t.Fatal("app started again while its killed task was still running")
+		}
+	default:
+		t.Fatal("app did not start again after its killed task unwound")
+	}
+}
+
+func TestStoppedAppsFreeTheirEndpoints(t *testing.T) {
+	k := kernel.New()
+	s := NewWith(nil, kernel.Capability{}, Options{})
+
+	// More apps than the kernel has endpoints, each launched once.
+	const count = 120
+	for i := 1; i <= count; i++ {
+		d := apps.Descriptor{ID: proto.AppID(i), Name: "app"}
+		d.New = func(env apps.Env) kernel.Task {
+			return funcTask(func(ctx *kernel.Context) {
+				for {
+					msg, ok := ctx.Recv(env.EP)
+					if !ok || proto.Kind(msg.Kind) == proto.MsgAppShutdown {
+						return
+					}
+				}
+			})
+		}
+		s.apps[d.ID] = &app{desc: d}
+	}
+
+	echo := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	k.AddTask(funcTask(func(ctx *kernel.Context) {
+		for {
+			msg, ok := ctx.Recv(echo.Restrict(kernel.RightRecv))
+			if !ok {
+				return
+			}
+			ctx.SendToCapResult(msg.Cap, msg.Kind, nil, kernel.Capability{})
+		}
+	}))
+
+	callErr := make(chan error, 1)
+	k.AddTask(funcTask(func(ctx *kernel.Context) {
+		exitCap := ctx.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+		if ctx.SetSupervisor(exitCap.Restrict(kernel.RightSend), proto.TaskExitedNotice) {
+			go s.watchExits(ctx, exitCap.Restrict(kernel.RightRecv))
+		}
+		for i := 1; i <= count; i++ {
+			id := proto.AppID(i)
+			s.ensureRunning(ctx, id)
+			s.stop(ctx, id)
+			deadline := time.Now().Add(time.Second)
+			for {
+				s.mu.Lock()
+				held := s.apps[id].ep.Valid()
+				s.mu.Unlock()
+				if !held || time.Now().After(deadline) {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+		_, err := ctx.Call(echo.Restrict(kernel.RightSend), 1, nil, 1000)
+		callErr <- err
+	}))
+
+	select {
+	case err := <-callErr:
+		if err != nil {
+			t.Fatalf("Call after launching every app: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("launches did not finish")
+	}
+}
+
+func TestAppRunsWithSelectingIdentity(t *testing.T) {
+	k := kernel.New()
+	s := NewWith(nil, kernel.Capability{}, Options{})
+	public := k.NewEndpoint(kernel.RightSend)
+	alice := k.NewEndpoint(kernel.RightSend)
+	bob := k.NewEndpoint(kernel.RightSend)
+	s.caps["vfs"] = public
+
+	got := make(chan kernel.Capability, 4)
+	d := apps.Descriptor{ID: proto.AppVi, Name: "vi", Services: []string{"vfs"}}
+	d.New = func(env apps.Env) kernel.Task {
+		return funcTask(func(ctx *kernel.Context) {
+			got <- env.Cap("vfs")
+			for {
+				msg, ok := ctx.Recv(env.EP)
+				if !ok || proto.Kind(msg.Kind) == proto.MsgAppShutdown {
+					return
+				}
+			}
+		})
+	}
+	s.apps[d.ID] = &app{desc: d}
+
+	done := make(chan struct{})
+	// A restart waits ticks for the old task to exit.
+	go func() {
+		for seq := uint64(1); ; seq++ {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				k.TickTo(seq)
+			}
+		}
+	}()
+	k.AddTask(funcTask(func(ctx *kernel.Context) {
+		defer close(done)
+		exitCap := ctx.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+		if ctx.SetSupervisor(exitCap.Restrict(kernel.RightSend), proto.TaskExitedNotice) {
+			go s.watchExits(ctx, exitCap.Restrict(kernel.RightRecv))
+		}
+		s.ensureRunning(ctx, d.ID)
+		for _, c := range []kernel.Capability{alice, alice, bob} {
+			s.setVFS(ctx, d.ID, c)
+			s.ensureRunning(ctx, d.ID)
+		}
+	}))
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("selects did not return")
+	}
+
+	// Started as nobody, restarted for alice, kept for alice again and
+	// restarted for bob.
+	for i, want := range []kernel.Capability{public, alice, bob} {
+		select {
+		case c := <-got:
+			if c != want {
+				t.Errorf("start %d: vfs = %v, want %v", i, c, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("start %d: app not started", i)
+		}
+	}
+	select {
+	case c := <-got:
+		t.Fatalf("app restarted with %v for the identity it already had", c)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestShutdownOvertakesFullMailbox(t *testing.T) {
+	k := kernel.New()
+	s := NewWith(nil, kernel.Capability{}, Options{})
+
+	first := make(chan proto.Kind, 1)
+	release := make(chan struct{})
+	d := apps.Descriptor{ID: proto.AppSnake, Name: "snake"}
+	d.New = func(env apps.Env) kernel.Task {
+		return funcTask(func(ctx *kernel.Context) {
+			<-release
+			if msg, ok := ctx.Recv(env.EP); ok {
+				first <- proto.Kind(msg.Kind)
+			}
+		})
+	}
+	s.apps[d.ID] = &app{desc: d}
+
+	stopped := make(chan struct{})
+	finish := make(chan struct{})
+	defer close(finish)
+	k.AddTask(funcTask(func(ctx *kernel.Context) {
+		s.ensureRunning(ctx, d.ID)
+		to := s.appCapByID(d.ID)
+		for ctx.SendToCapResult(to, uint16(proto.MsgTermInput), []byte("x"), kernel.Capability{}) == kernel.SendOK {
+		}
+		s.stop(ctx, d.ID)
+		close(stopped)
+		// The app endpoint lives as long as appmgr.
+		<-finish
+	}))
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("stop blocked on the full mailbox")
+	}
+	close(release)
+
+	select {
+	case kind := <-first:
+		if kind != proto.MsgAppShutdown {
+			t.Fatalf("first message = %s, want app_shutdown", kind)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("app got nothing")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"spark/hal"
+	vfsclient "spark/sparkos/client/vfs"
 	"spark/sparkos/kernel"
 	"spark/sparkos/proto"
 	"spark/sparkos/tea"
@@ -17,13 +18,18 @@ import (
 
 const statusEveryTicks = 250
 
+// maxSubscribers bounds the status subscribers (a player and the status bar,
+// typically); a new one beyond that replaces the oldest.
+const maxSubscribers = 4
+
 type Service struct {
 	inCap  kernel.Capability
 	vfsCap kernel.Capability
+	vfs    *vfsclient.Client
 	pwm    hal.PWMAudio
 
 	subscriberMu sync.Mutex
-	subscriber   kernel.Capability
+	subscribers  []kernel.Capability
 
 	state       uint32
 	volume      uint32
@@ -44,7 +50,7 @@ type Service struct {
 }
 
 func New(inCap, vfsCap kernel.Capability, pwm hal.PWMAudio) *Service {
-	s := &Service{inCap: inCap, vfsCap: vfsCap, pwm: pwm}
+	s := &Service{inCap: inCap, vfsCap: vfsCap, vfs: vfsclient.New(vfsCap), pwm: pwm}
 	atomic.StoreUint32(&s.state, uint32(proto.AudioStopped))
 	atomic.StoreUint32(&s.volume, 255)
 	return s
@@ -99,7 +105,16 @@ func (s *Service) handleSubscribe(ctx *kernel.Context, msg kernel.Message) {
 		return
 	}
 	s.subscriberMu.Lock()
-	s.subscriber = msg.Cap
+	known := false
+	for _, sub := range s.subscribers {
+		known = known || sub == msg.Cap
+	}
+	if !known {
+		if len(s.subscribers) == maxSubscribers {
+			s.subscribers = append(s.subscribers[:0], s.subscribers[1:]...)
+		}
+		s.subscribers = append(s.subscribers, msg.Cap)
+	}
 	s.subscriberMu.Unlock()
 	s.sendStatus(ctx)
 }
@@ -210,7 +225,7 @@ func (s *Service) play(ctx *kernel.Context, path string) error {
 		return nil
 	}
 
-	f, err := newIPCFile(ctx, s.vfsCap, path)
+	f, err := newIPCFile(ctx, s.vfs, s.vfsCap, path)
 	if err != nil {
 		return err
 	}
@@ -351,9 +366,9 @@ func (s *Service) waitDrain(cancel <-chan struct{}) {
 
 func (s *Service) sendStatus(ctx *kernel.Context) {
 	s.subscriberMu.Lock()
-	sub := s.subscriber
+	subs := append([]kernel.Capability(nil), s.subscribers...)
 	s.subscriberMu.Unlock()
-	if !sub.Valid() {
+	if len(subs) == 0 {
 		return
 	}
 
@@ -374,19 +389,26 @@ func (s *Service) sendStatus(ctx *kernel.Context) {
 
 	payload := proto.AudioStatusPayload(state, vol, sr, pos, total)
 
-	res := ctx.SendToCapResult(sub, uint16(proto.MsgAudioStatus), payload, kernel.Capability{})
-	switch res {
-	case kernel.SendOK:
-		s.sendMeters(ctx, sub)
-		return
-	case kernel.SendErrQueueFull:
-		return
-	default:
-		s.subscriberMu.Lock()
-		if s.subscriber == sub {
-			s.subscriber = kernel.Capability{}
+	for _, sub := range subs {
+		res := ctx.SendToCapResult(sub, uint16(proto.MsgAudioStatus), payload, kernel.Capability{})
+		switch res {
+		case kernel.SendOK:
+			s.sendMeters(ctx, sub)
+		case kernel.SendErrQueueFull:
+		default:
+			s.dropSubscriber(sub)
+		}
+	}
+}
+
+func (s *Service) dropSubscriber(sub kernel.Capability) {
+	s.subscriberMu.Lock()
+	defer s.subscriberMu.Unlock()
+	for i, c := range s.subscribers {
+		if c == sub {
+			s.subscribers = append(s.subscribers[:i], s.subscribers[i+1:]...)
+			return
 		}
-		s.subscriberMu.Unlock()
 	}
 }
 
@@ -5,26 +5,21 @@ import (
 	"fmt"
 	"io"
 
+	vfsclient "spark/sparkos/client/vfs"
 	"spark/sparkos/kernel"
-	"spark/sparkos/proto"
 )
 
+// ipcFile streams a file from the VFS service. Reads larger than one message
+// go through the VFS client's shared region, so a PCM block is one round trip.
 type ipcFile struct {
-	ctx kernel.Context
-
-	vfsCap      kernel.Capability
-	replyCap    kernel.Capability
-	replyCapOut kernel.Capability
-	replyCh     <-chan kernel.Message
+	ctx    *kernel.Context
+	client *vfsclient.Client
 
 	path string
 	off  uint32
-
-	nextRequestID uint32
-	payloadBuf    [kernel.MaxMessageBytes]byte
 }
 
-func newIPCFile(ctx *kernel.Context, vfsCap kernel.Capability, path string) (*ipcFile, error) {
+func newIPCFile(ctx *kernel.Context, client *vfsclient.Client, vfsCap kernel.Capability, path string) (*ipcFile, error) {
 	if ctx == nil {
 		return nil, errors.New("audio: nil context")
 	}
@@ -34,87 +29,22 @@ func newIPCFile(ctx *kernel.Context, vfsCap kernel.Capability, path string) (*ip
 	if len(path) > kernel.MaxMessageBytes-12 {
 		return nil, errors.New("audio: path too long")
 	}
-
-	ep := ctx.NewEndpoint(kernel.RightSend | kernel.RightRecv)
-	if !ep.Valid() {
-		return nil, errors.New("audio: allocate vfs reply endpoint")
-	}
-	ch, ok := ctx.RecvChan(ep.Restrict(kernel.RightRecv))
-	if !ok {
-		return nil, errors.New("audio: recv vfs reply endpoint")
-	}
-
-	return &ipcFile{
-		ctx:           *ctx,
-		vfsCap:        vfsCap,
-		replyCap:      ep,
-		replyCapOut:   ep.Restrict(kernel.RightSend),
-		replyCh:       ch,
-		path:          path,
-		nextRequestID: 1,
-	}, nil
+	return &ipcFile{ctx: ctx, client: client, path: path}, nil
 }
 
 func (f *ipcFile) Read(p []byte) (int, error) {
 	if len(p) == 0 {
 		return 0, nil
 	}
-
-	maxRead := len(p)
-	maxPayload := kernel.MaxMessageBytes - 11
-	if maxRead > maxPayload {
-		maxRead = maxPayload
+	n, eof, err := f.client.ReadInto(f.ctx, f.path, f.off, p)
+	if err != nil {
+		return 0, fmt.Errorf("audio: %w", err)
 	}
-
-	reqID := f.nextRequestID
-	f.nextRequestID++
-	if f.nextRequestID == 0 {
-		f.nextRequestID = 1
-	}
-
-	payload, ok := proto.VFSReadPayloadInto(f.payloadBuf[:], reqID, f.path, f.off, uint16(maxRead))
-	if !ok {
-		return 0, errors.New("audio: vfs read payload too large")
-	}
-
-	res := f.ctx.SendToCapRetry(f.vfsCap, uint16(proto.MsgVFSRead), payload, f.replyCapOut, 500)
-	switch res {
-	case kernel.SendOK:
-	case kernel.SendErrQueueFull:
-		return 0, errors.New("audio: vfs read send: queue full")
-	default:
-		return 0, fmt.Errorf("audio: vfs read send: %s", res)
-	}
-
-	for {
-		msg, ok := <-f.replyCh
-		if !ok {
-			return 0, errors.New("audio: vfs reply channel closed")
-		}
-		switch proto.Kind(msg.Kind) {
-		case proto.MsgError:
-			code, ref, detail, ok := proto.DecodeErrorPayload(msg.Payload())
-			if !ok || ref != proto.MsgVFSRead {
-				return 0, fmt.Errorf("audio: vfs read: %s", code)
-			}
-			gotID, rest, ok := proto.DecodeErrorDetailWithRequestID(detail)
-			if !ok || gotID != reqID {
-				continue
-			}
-			return 0, fmt.Errorf("audio: vfs read: %s: %s", code, string(rest))
-		case proto.MsgVFSReadResp:
-			gotID, gotOff, eof, data, ok := proto.DecodeVFSReadRespPayload(msg.Payload())
-			if !ok || gotID != reqID || gotOff != f.off {
-				continue
-			}
-			n := copy(p, data)
-			f.off += uint32(n)
-			if eof && n == 0 {
-				return 0, io.EOF
-			}
-			return n, nil
-		}
+	f.off += uint32(n)
+	if eof && n == 0 {
+		return 0, io.EOF
 	}
+	return n, nil
 }
 
 func (f *ipcFile) Seek(offset int64, whence int) (int64, error) {
@@ -0,0 +1,29 @@
+package compositor
+
+type rect struct {
+	x, y, w, h int
+}
+
+func (r rect) empty() bool { return r.w <= 0 || r.h <= 0 }
+
+func (r rect) intersect(o rect) rect {
+	x0, y0 := max(r.x, o.x), max(r.y, o.y)
+	x1, y1 := min(r.x+r.w, o.x+o.w), min(r.y+r.h, o.y+o.h)
+	if x1 <= x0 || y1 <= y0 {
+		return rect{}
+	}
+	return rect{x0, y0, x1 - x0, y1 - y0}
+}
+
+// union returns the bounding box of r and o.
+func (r rect) union(o rect) rect {
+	switch {
+	case r.empty():
+		return o
+	case o.empty():
+		return r
+	}
+	x0, y0 := min(r.x, o.x), min(r.y, o.y)
+	x1, y1 := max(r.x+r.w, o.x+o.w), max(r.y+r.h, o.y+o.h)
+	return rect{x0, y0, x1 - x0, y1 - y0}
+}
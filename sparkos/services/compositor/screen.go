@@ -0,0 +1,69 @@
+package compositor
+
+import "spark/hal"
+
+// Screen returns the screen layer as a hal.Display. Present on its
+// framebuffer hands the frame to the compositor task and returns once it is
+// on screen with the overlays on top. Every caller gets the same pixels.
+func (s *Service) Screen() hal.Display {
+	return screen{s: s}
+}
+
+// Inset returns the screen layer below its top rows, which are left to an
+// overlay such as the status bar. Clients see a shorter framebuffer.
+func (s *Service) Inset(top int) hal.Display {
+	if top < 0 {
+		top = 0
+	}
+	return screen{s: s, top: top}
+}
+
+type screen struct {
+	s   *Service
+	top int
+}
+
+func (d screen) Framebuffer() hal.Framebuffer {
+	if d.s.fb == nil || d.top >= d.s.fb.Height() {
+		return nil
+	}
+	return screenFB(d)
+}
+
+type screenFB struct {
+	s   *Service
+	top int
+}
+
+func (f screenFB) Width() int              { return f.s.fb.Width() }
+func (f screenFB) Height() int             { return f.s.fb.Height() - f.top }
+func (f screenFB) Format() hal.PixelFormat { return f.s.fb.Format() }
+func (f screenFB) StrideBytes() int        { return f.s.fb.StrideBytes() }
+
+func (f screenFB) Buffer() []byte {
+	buf := f.s.back
+	if buf == nil {
+		buf = f.s.fb.Buffer()
+	}
+	return buf[f.top*f.s.fb.StrideBytes():]
+}
+
+func (f screenFB) ClearRGB(r, g, b uint8) {
+	if f.s.back == nil && f.top == 0 {
+		f.s.fb.ClearRGB(r, g, b)
+		return
+	}
+	buf := f.Buffer()
+	pixel := uint16(r&0xF8)<<8 | uint16(g&0xFC)<<3 | uint16(b)>>3
+	lo, hi := byte(pixel), byte(pixel>>8)
+	for i := 0; i+1 < len(buf); i += 2 {
+		buf[i], buf[i+1] = lo, hi
+	}
+}
+
+func (f screenFB) Present() error {
+	done := make(chan struct{})
+	f.s.present <- done
+	<-done
+	return nil
+}
@@ -0,0 +1,305 @@
+// Package compositor is the display server: it owns the hal.Framebuffer and
+// is the only code calling its Present.
+//
+// The screen layer (z 0) is what the term service and the apps draw on; they
+// get it as a hal.Display from Screen, so their code is unchanged. Overlay
+// surfaces (z 1..255: status bar, notifications, OSD) are shared-memory
+// regions of client tasks, composited on top in z order over the damaged
+// rectangles only.
+//
+// The screen layer is one buffer shared by term and every app; the
+// compositor does not keep them apart. Focus does: an app told with
+// MsgAppControl that it lost the focus stops drawing. A surface per app
+// would cost a framebuffer each, which the RP2350 does not have. Only
+// overlays are per-client.
+package compositor
+
+import (
+	"sort"
+	"sync"
+
+	"spark/hal"
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+)
+
+// maxSurfaces bounds the overlay surfaces of all clients together.
+const maxSurfaces = 8
+
+// Options configures the compositor.
+type Options struct {
+	// Backing gives the screen layer a buffer of its own, at the cost of one
+	// more framebuffer of memory. Without it the screen layer is drawn
+	// straight into the framebuffer: overlays are repainted after every
+	// screen frame, and an area a hidden or moved overlay leaves behind
+	// keeps its pixels until the screen client draws there again.
+	Backing bool
+}
+
+type surface struct {
+	id     uint8
+	client int
+	region kernel.Capability
+
+	r       rect
+	z       uint8
+	visible bool
+}
+
+// Service composites the screen layer and the overlay surfaces.
+//
+// Every overlay client gets its own endpoint (see Serve) and can only touch
+// the surfaces it created. A surface's pixels live in a region the client
+// owns, so the surface goes away with the client.
+type Service struct {
+	disp    hal.Display
+	opts    Options
+	clients []kernel.Capability
+
+	present chan chan struct{}
+
+	mu       sync.Mutex
+	fb       hal.Framebuffer
+	back     []byte
+	surfaces []*surface // by z, then creation order
+	nextID   uint8
+}
+
+// New returns a compositor for disp.
+func New(disp hal.Display, opts Options) *Service {
+	s := &Service{disp: disp, opts: opts, present: make(chan chan struct{})}
+	if disp != nil {
+		s.fb = disp.Framebuffer()
+	}
+	if s.fb != nil && opts.Backing {
+		s.back = make([]byte, len(s.fb.Buffer()))
+		copy(s.back, s.fb.Buffer())
+	}
+	return s
+}
+
+// Serve adds an overlay client whose requests arrive on in.
+// It must be called before the service runs.
+func (s *Service) Serve(in kernel.Capability) {
+	s.clients = append(s.clients, in)
+}
+
+func (s *Service) Run(ctx *kernel.Context) {
+	for i, in := range s.clients {
+		ch, ok := ctx.RecvChan(in)
+		if !ok {
+			continue
+		}
+		go s.serve(ctx, i, ch)
+	}
+	for done := range s.present {
+		s.mu.Lock()
+		s.composite(ctx, s.screenRect())
+		s.mu.Unlock()
+		close(done)
+	}
+}
+
+func (s *Service) serve(ctx *kernel.Context, client int, ch <-chan kernel.Message) {
+	for msg := range ch {
+		switch proto.Kind(msg.Kind) {
+		case proto.MsgSurfaceCreate:
+			s.handleCreate(ctx, client, msg)
+
+		case proto.MsgSurfaceDamage:
+			id, x, y, w, h, ok := proto.DecodeSurfaceDamagePayload(msg.Payload())
+			if !ok {
+				continue
+			}
+			s.mu.Lock()
+			if sf := s.surface(client, id); sf != nil && sf.visible {
+				damage := sf.r
+				if w != 0 && h != 0 {
+					damage = rect{sf.r.x + int(x), sf.r.y + int(y), int(w), int(h)}.intersect(sf.r)
+				}
+				s.composite(ctx, damage)
+			}
+			s.mu.Unlock()
+
+		case proto.MsgSurfaceConfig:
+			id, x, y, z, visible, ok := proto.DecodeSurfaceConfigPayload(msg.Payload())
+			if !ok || z == 0 {
+				continue
+			}
+			s.mu.Lock()
+			if sf := s.surface(client, id); sf != nil {
+				old := sf.r
+				sf.r.x, sf.r.y = int(x), int(y)
+				sf.z, sf.visible = z, visible
+				s.sortSurfaces()
+				s.composite(ctx, old.union(sf.r))
+			}
+			s.mu.Unlock()
+
+		case proto.MsgSurfaceDestroy:
+			id, ok := proto.DecodeSurfaceDestroyPayload(msg.Payload())
+			if !ok {
+				continue
+			}
+			s.mu.Lock()
+			if sf := s.surface(client, id); sf != nil {
+				s.remove(sf)
+				s.composite(ctx, sf.r)
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *Service) handleCreate(ctx *kernel.Context, client int, msg kernel.Message) {
+	if !msg.Cap.Valid() {
+		return
+	}
+	requestID, x, y, w, h, z, ok := proto.DecodeSurfaceCreatePayload(msg.Payload())
+	if !ok || w == 0 || h == 0 || z == 0 {
+		replyError(ctx, msg.Cap, proto.ErrBadMessage, requestID)
+		return
+	}
+	if s.fb == nil || int(w) > s.fb.Width() || int(h) > s.fb.Height() {
+		replyError(ctx, msg.Cap, proto.ErrTooLarge, requestID)
+		return
+	}
+	if px, ok := ctx.MapRegion(msg.Grant, kernel.RightRead); !ok || len(px) < int(w)*int(h)*2 {
+		replyError(ctx, msg.Cap, proto.ErrBadMessage, requestID)
+		return
+	}
+
+	s.mu.Lock()
+	if len(s.surfaces) >= maxSurfaces {
+		s.mu.Unlock()
+		replyError(ctx, msg.Cap, proto.ErrBusy, requestID)
+		return
+	}
+	sf := &surface{
+		id:      s.newID(),
+		client:  client,
+		region:  msg.Grant.Restrict(kernel.RightRead),
+		r:       rect{int(x), int(y), int(w), int(h)},
+		z:       z,
+		visible: true,
+	}
+	s.surfaces = append(s.surfaces, sf)
+	s.sortSurfaces()
+	s.composite(ctx, sf.r)
+	s.mu.Unlock()
+
+	_ = ctx.SendToCapResult(msg.Cap, uint16(proto.MsgSurfaceCreateResp), proto.SurfaceCreateRespPayload(requestID, sf.id), kernel.Capability{})
+}
+
+func replyError(ctx *kernel.Context, to kernel.Capability, code proto.ErrCode, requestID uint32) {
+	payload := proto.ErrorPayload(code, proto.MsgSurfaceCreate, proto.ErrorDetailWithRequestID(requestID, nil))
+	_ = ctx.SendToCapResult(to, uint16(proto.MsgError), payload, kernel.Capability{})
+}
+
+func (s *Service) surface(client int, id uint8) *surface {
+	for _, sf := range s.surfaces {
+		if sf.id == id && sf.client == client {
+			return sf
+		}
+	}
+	return nil
+}
+
+func (s *Service) newID() uint8 {
+	for {
+		s.nextID++
+		if s.nextID != 0 && s.surfaceByID(s.nextID) == nil {
+			return s.nextID
+		}
+	}
+}
+
+func (s *Service) surfaceByID(id uint8) *surface {
+	for _, sf := range s.surfaces {
+		if sf.id == id {
+			return sf
+		}
+	}
+	return nil
+}
+
+func (s *Service) remove(sf *surface) {
+	for i, o := range s.surfaces {
+		if o == sf {
+			s.surfaces = append(s.surfaces[:i], s.surfaces[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *Service) sortSurfaces() {
+	sort.SliceStable(s.surfaces, func(i, j int) bool { return s.surfaces[i].z < s.surfaces[j].z })
+}
+
+func (s *Service) screenRect() rect {
+	if s.fb == nil {
+		return rect{}
+	}
+	return rect{0, 0, s.fb.Width(), s.fb.Height()}
+}
+
+// composite redraws r from the screen layer and the visible overlays and
+// presents the framebuffer. s.mu must be held.
+func (s *Service) composite(ctx *kernel.Context, r rect) {
+	if s.fb == nil {
+		return
+	}
+	r = r.intersect(s.screenRect())
+	if r.empty() {
+		return
+	}
+	buf := s.fb.Buffer()
+	stride := s.fb.StrideBytes()
+
+	if s.back != nil {
+		for y := r.y; y < r.y+r.h; y++ {
+			off := y*stride + r.x*2
+			copy(buf[off:off+r.w*2], s.back[off:off+r.w*2])
+		}
+	}
+
+	var gone []*surface
+	for _, sf := range s.surfaces {
+		if !sf.visible {
+			continue
+		}
+		part := r.intersect(sf.r)
+		if part.empty() {
+			continue
+		}
+		px, ok := ctx.MapRegion(sf.region, kernel.RightRead)
+		if !ok || len(px) < sf.r.w*sf.r.h*2 {
+			// The client freed its region or exited.
+			gone = append(gone, sf)
+			continue
+		}
+		blit(buf, stride, px, sf.r, part)
+	}
+	for _, sf := range gone {
+		s.remove(sf)
+	}
+
+	_ = s.fb.Present()
+}
+
+// blit copies part (screen coordinates) of surface src at sr into dst,
+// skipping proto.SurfaceKeyRGB565 pixels.
+func blit(dst []byte, stride int, src []byte, sr, part rect) {
+	const keyLo, keyHi = byte(proto.SurfaceKeyRGB565 & 0xff), byte(proto.SurfaceKeyRGB565 >> 8)
+	for y := part.y; y < part.y+part.h; y++ {
+		d := y*stride + part.x*2
+		o := ((y-sr.y)*sr.w + (part.x - sr.x)) * 2
+		for i := 0; i < part.w*2; i += 2 {
+			lo, hi := src[o+i], src[o+i+1]
+			if lo == keyLo && hi == keyHi {
+				continue
+			}
+			dst[d+i], dst[d+i+1] = lo, hi
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package compositor
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"spark/hal"
+	compclient "spark/sparkos/client/compositor"
+	"spark/sparkos/kernel"
+)
+
+type testFB struct {
+	mu       sync.Mutex
+	w, h     int
+	buf      []byte
+	presents int
+}
+
+func newTestFB(w, h int) *testFB {
+	return &testFB{w: w, h: h, buf: make([]byte, w*h*2)}
+}
+
+func (f *testFB) Width() int              { return f.w }
+func (f *testFB) Height() int             { return f.h }
+func (f *testFB) Format() hal.PixelFormat { return hal.PixelFormatRGB565 }
+func (f *testFB) StrideBytes() int        { return f.w * 2 }
+func (f *testFB) Buffer() []byte          { return f.buf }
+func (f *testFB) ClearRGB(_, _, _ uint8)  {}
+func (f *testFB) Framebuffer() hal.Framebuffer {
+	return f
+}
+
+func (f *testFB) Present() error {
+	f.mu.Lock()
+	f.presents++
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *testFB) pixel(x, y int) uint16 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	o := (y*f.w + x) * 2
+	return uint16(f.buf[o]) | uint16(f.buf[o+1])<<8
+}
+
+func fill(b []byte, v uint16) {
+	for i := 0; i+1 < len(b); i += 2 {
+		b[i], b[i+1] = byte(v), byte(v>>8)
+	}
+}
+
+type funcTask func(ctx *kernel.Context)
+
+func (f funcTask) Run(ctx *kernel.Context) { f(ctx) }
+
+func TestOverlayOverScreen(t *testing.T) {
+	const (
+		red   = 0xF800
+		green = 0x07E0
+		blue  = 0x001F
+	)
+	k := kernel.New()
+	fb := newTestFB(8, 4)
+	svc := New(fb, Options{Backing: true})
+	clientEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	svc.Serve(clientEP.Restrict(kernel.RightRecv))
+	k.AddTask(svc)
+
+	screen := svc.Screen().Framebuffer()
+	fill(screen.Buffer(), red)
+	_ = screen.Present()
+	if got := fb.pixel(0, 0); got != red {
+		t.Fatalf("screen pixel = %#04x, want red", got)
+	}
+
+	step := make(chan func(ctx *kernel.Context))
+	done := make(chan error)
+	k.AddTask(funcTask(func(ctx *kernel.Context) {
+		for f := range step {
+			f(ctx)
+		}
+	}))
+	run := func(f func(ctx *kernel.Context) error) {
+		t.Helper()
+		step <- func(ctx *kernel.Context) { done <- f(ctx) }
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("client step timed out")
+		}
+	}
+	waitPixel := func(x, y int, want uint16) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for fb.pixel(x, y) != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("pixel (%d,%d) = %#04x, want %#04x", x, y, fb.pixel(x, y), want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// A 4x2 overlay at (2,1): blue with a transparent left column.
+	var sf *compclient.Surface
+	run(func(ctx *kernel.Context) error {
+		var err error
+		sf, err = compclient.Create(ctx, clientEP.Restrict(kernel.RightSend), 2, 1, 4, 2, 1)
+		if err != nil {
+			return err
+		}
+		fill(sf.Pixels, blue)
+		sf.Pixels[0], sf.Pixels[1] = 0x1F, 0xF8
+		return sf.Damage(ctx, 0, 0, 0, 0)
+	})
+	waitPixel(3, 1, blue)
+	if got := fb.pixel(2, 1); got != red {
+		t.Fatalf("transparent overlay pixel = %#04x, want red", got)
+	}
+	if got := fb.pixel(1, 1); got != red {
+		t.Fatalf("pixel left of overlay = %#04x, want red", got)
+	}
+
+	// A new screen frame stays below the overlay.
+	fill(screen.Buffer(), green)
+	_ = screen.Present()
+	if got, want := fb.pixel(3, 2), uint16(blue); got != want {
+		t.Fatalf("overlay pixel after screen frame = %#04x, want blue", got)
+	}
+	if got := fb.pixel(0, 0); got != green {
+		t.Fatalf("screen pixel = %#04x, want green", got)
+	}
+
+	// Hiding the overlay uncovers the screen layer.
+	run(func(ctx *kernel.Context) error { return sf.Hide(ctx) })
+	waitPixel(3, 2, green)
+}
+
+func TestInsetLeavesTopRows(t *testing.T) {
+	k := kernel.New()
+	fb := newTestFB(4, 4)
+	svc := New(fb, Options{Backing: true})
+	k.AddTask(svc)
+
+	inset := svc.Inset(1).Framebuffer()
+	if inset.Height() != 3 || len(inset.Buffer()) != 3*fb.StrideBytes() {
+		t.Fatalf("inset height %d, buffer %d bytes", inset.Height(), len(inset.Buffer()))
+	}
+	inset.ClearRGB(0xff, 0, 0)
+	_ = inset.Present()
+	if got := fb.pixel(0, 0); got != 0 {
+		t.Fatalf("reserved row pixel = %#04x, want untouched", got)
+	}
+	if got := fb.pixel(0, 1); got != 0xF800 {
+		t.Fatalf("first inset row pixel = %#04x, want red", got)
+	}
+}
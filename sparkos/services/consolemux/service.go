@@ -3,70 +3,54 @@ package consolemux
 import (
 	"fmt"
 
+	namesclient "spark/sparkos/client/names"
 	"spark/sparkos/kernel"
 	"spark/sparkos/proto"
 )
 
-const interruptByte = 0x07 // Ctrl+G (toggle focus between shell and app).
+const (
+	interruptByte   = 0x07 // Ctrl+G (toggle focus between shell and app).
+	nextConsoleByte = 0x0e // Ctrl+N (cycle through the shell and the open apps).
+)
+
+// maxConsoles bounds the number of app consoles; opening one more drops the
+// oldest console that is not focused.
+const maxConsoles = 8
 
 type Service struct {
-	inCap  kernel.Capability
-	ctlCap kernel.Capability
-
-	shellCap     kernel.Capability
-	rtdemoCap    kernel.Capability
-	rtvoxelCap   kernel.Capability
-	imgviewCap   kernel.Capability
-	viCap        kernel.Capability
-	mcCap        kernel.Capability
-	hexCap       kernel.Capability
-	vectorCap    kernel.Capability
-	snakeCap     kernel.Capability
-	tetrisCap    kernel.Capability
-	calendarCap  kernel.Capability
-	todoCap      kernel.Capability
-	archiveCap   kernel.Capability
-	teaCap       kernel.Capability
-	basicCap     kernel.Capability
-	rfCap        kernel.Capability
-	gpioscopeCap kernel.Capability
-	fbtestCap    kernel.Capability
-	serialCap    kernel.Capability
-	usersCap     kernel.Capability
-	donutCap     kernel.Capability
-	termCap      kernel.Capability
+	inCap    kernel.Capability
+	ctlCap   kernel.Capability
+	namesCap kernel.Capability
+
+	shellCap kernel.Capability
+	// appCaps caches app endpoints resolved through the name service.
+	appCaps map[proto.AppID]kernel.Capability
+
+	// consoles lists the apps opened with MsgAppSelect in console order
+	// (console 0 is the shell). Background apps stay here while appmgr keeps
+	// them loaded; switching to an unloaded one starts it again.
+	consoles []proto.AppID
 
 	activeApp proto.AppID
 	appActive bool
+
+	// home gets the focus back when another app gives it up (proto.AppNone
+	// hands it to the shell).
+	home proto.AppID
 }
 
-func New(inCap, ctlCap, shellCap, rtdemoCap, rtvoxelCap, imgviewCap, viCap, mcCap, hexCap, vectorCap, snakeCap, tetrisCap, calendarCap, todoCap, archiveCap, teaCap, basicCap, rfCap, gpioscopeCap, fbtestCap, serialCap, usersCap, donutCap, termCap kernel.Capability) *Service {
+// New returns a console multiplexer reading input on inCap. The shell and the
+// app endpoints (proto.AppEndpointName) are resolved through namesCap. An app
+// leaving the foreground returns the focus to home, or to the shell if home
+// is proto.AppNone.
+func New(inCap, ctlCap, namesCap kernel.Capability, home proto.AppID) *Service {
 	return &Service{
-		inCap:        inCap,
-		ctlCap:       ctlCap,
-		shellCap:     shellCap,
-		rtdemoCap:    rtdemoCap,
-		rtvoxelCap:   rtvoxelCap,
-		imgviewCap:   imgviewCap,
-		viCap:        viCap,
-		mcCap:        mcCap,
-		hexCap:       hexCap,
-		vectorCap:    vectorCap,
-		snakeCap:     snakeCap,
-		tetrisCap:    tetrisCap,
-		calendarCap:  calendarCap,
-		todoCap:      todoCap,
-		archiveCap:   archiveCap,
-		teaCap:       teaCap,
-		basicCap:     basicCap,
-		rfCap:        rfCap,
-		gpioscopeCap: gpioscopeCap,
-		fbtestCap:    fbtestCap,
-		serialCap:    serialCap,
-		usersCap:     usersCap,
-		donutCap:     donutCap,
-		termCap:      termCap,
-		activeApp:    proto.AppRTDemo,
+		inCap:     inCap,
+		ctlCap:    ctlCap,
+		namesCap:  namesCap,
+		appCaps:   make(map[proto.AppID]kernel.Capability),
+		activeApp: proto.AppRTDemo,
+		home:      home,
 	}
 }
 
@@ -75,23 +59,35 @@ func (s *Service) Run(ctx *kernel.Context) {
 	if !ok {
 		return
 	}
+	s.shellCap, _ = namesclient.Lookup(ctx, s.namesCap, "shell")
 
 	for msg := range ch {
 		switch proto.Kind(msg.Kind) {
 		case proto.MsgTermInput:
 			s.handleInput(ctx, msg.Payload())
+		case proto.MsgInputEvent:
+			s.handleEvent(ctx, msg.Payload())
 		case proto.MsgAppControl:
 			active, ok := proto.DecodeAppControlPayload(msg.Payload())
 			if !ok {
 				continue
 			}
+			if !active && s.goHome(ctx) {
+				continue
+			}
 			s.setActive(ctx, active)
+		case proto.MsgMuxSwitch:
+			id, ok := proto.DecodeMuxSwitchPayload(msg.Payload())
+			if !ok {
+				continue
+			}
+			s.focus(ctx, id, id != proto.AppNone)
 		case proto.MsgAppSelect:
 			appID, arg, ok := proto.DecodeAppSelectPayload(msg.Payload())
 			if !ok {
 				continue
 			}
-			s.handleAppSelect(ctx, appID, arg)
+			s.handleAppSelect(ctx, appID, arg, msg.Cap)
 		case proto.MsgMuxStatus:
 			s.handleStatus(ctx, msg)
 		}
@@ -106,6 +102,10 @@ func (s *Service) handleInput(ctx *kernel.Context, b []byte) {
 			s.flushInput(ctx, b[start:i])
 			start = i + 1
 			s.setActive(ctx, !s.appActive)
+		case nextConsoleByte:
+			s.flushInput(ctx, b[start:i])
+			start = i + 1
+			s.nextConsole(ctx)
 		}
 	}
 	s.flushInput(ctx, b[start:])
@@ -115,48 +115,133 @@ func (s *Service) flushInput(ctx *kernel.Context, b []byte) {
 	if len(b) == 0 {
 		return
 	}
-	dst := s.shellCap
 	if s.appActive {
-		dst = s.selectedAppCap()
-		if !dst.Valid() {
-			s.setActive(ctx, false)
-			dst = s.shellCap
-		} else {
-			if err := sendWithRetry(ctx, dst, proto.MsgTermInput, b, kernel.Capability{}); err == nil {
+		dst := s.selectedAppCap(ctx)
+		if dst.Valid() {
+			if err := sendInput(ctx, dst, proto.MsgTermInput, b); err == nil {
 				return
 			}
-			s.setActive(ctx, false)
-			dst = s.shellCap
+			s.forgetApp(s.activeApp)
 		}
+		s.setActive(ctx, false)
+	}
+	_ = sendInput(ctx, s.shell(ctx), proto.MsgTermInput, b)
+}
+
+// handleEvent passes a key event to the focused app. The shell reads
+// MsgTermInput only, and the focus keys stay with consolemux.
+func (s *Service) handleEvent(ctx *kernel.Context, b []byte) {
+	ev, ok := proto.DecodeInputEventPayload(b)
+	if !ok || !s.appActive || ev.Rune == interruptByte || ev.Rune == nextConsoleByte {
+		return
+	}
+	if err := sendInput(ctx, s.selectedAppCap(ctx), proto.MsgInputEvent, b); err != nil {
+		// Like flushInput: an app not taking keys loses the focus.
+		s.forgetApp(s.activeApp)
+		s.setActive(ctx, false)
 	}
-	_ = sendWithRetry(ctx, dst, proto.MsgTermInput, b, kernel.Capability{})
 }
 
 func (s *Service) setActive(ctx *kernel.Context, active bool) {
-	if active == s.appActive {
+	s.focus(ctx, s.activeApp, active)
+}
+
+// focus gives the keyboard to app id, or to the shell if app is false. The
+// app losing focus and the one gaining it are told with MsgAppControl; the
+// focused app also gets ctlCap to hand focus back.
+func (s *Service) focus(ctx *kernel.Context, id proto.AppID, app bool) {
+	if app == s.appActive && (!app || id == s.activeApp) {
 		return
 	}
-	if active && !s.selectedAppCap().Valid() {
+	if app && !s.appCap(ctx, id).Valid() {
 		return
 	}
-	s.appActive = active
 
-	appCap := s.selectedAppCap()
-	var xfer kernel.Capability
-	if s.appActive && s.ctlCap.Valid() {
-		xfer = s.ctlCap
+	hadApp := s.appActive
+	if hadApp {
+		_ = sendUrgent(ctx, s.selectedAppCap(ctx), proto.MsgAppControl, proto.AppControlPayload(false), kernel.Capability{})
+	}
+	s.appActive = app
+	if !app {
+		_ = sendUrgent(ctx, s.shell(ctx), proto.MsgAppControl, proto.AppControlPayload(true), kernel.Capability{})
+		return
+	}
+
+	s.activeApp = id
+	s.openConsole(id)
+	_ = sendUrgent(ctx, s.selectedAppCap(ctx), proto.MsgAppControl, proto.AppControlPayload(true), s.ctlCap)
+	if !hadApp {
+		_ = sendUrgent(ctx, s.shell(ctx), proto.MsgAppControl, proto.AppControlPayload(false), kernel.Capability{})
 	}
-	_ = sendWithRetry(ctx, appCap, proto.MsgAppControl, proto.AppControlPayload(active), xfer)
-	_ = sendWithRetry(ctx, s.shellCap, proto.MsgAppControl, proto.AppControlPayload(!active), kernel.Capability{})
 }
 
-func (s *Service) handleAppSelect(ctx *kernel.Context, id proto.AppID, arg string) {
-	appCap := s.appCapByID(id)
+// goHome focuses the home app when the focused app gives up the focus, and
+// reports whether it did.
+func (s *Service) goHome(ctx *kernel.Context) bool {
+	if s.home == proto.AppNone || !s.appActive || s.activeApp == s.home {
+		return false
+	}
+	if !s.appCap(ctx, s.home).Valid() {
+		return false
+	}
+	s.focus(ctx, s.home, true)
+	return true
+}
+
+// nextConsole focuses the console after the focused one, wrapping from the
+// last app back to the shell.
+func (s *Service) nextConsole(ctx *kernel.Context) {
+	cur := 0
+	if s.appActive {
+		cur = len(s.consoles)
+		for i, id := range s.consoles {
+			if id == s.activeApp {
+				cur = i + 1
+				break
+			}
+		}
+	}
+	next := (cur + 1) % (len(s.consoles) + 1)
+	if next == 0 {
+		s.focus(ctx, s.activeApp, false)
+		return
+	}
+	s.focus(ctx, s.consoles[next-1], true)
+}
+
+// handleAppSelect opens app id with arg. vfsCap, the VFS identity of whoever
+// opened it, goes along to appmgr.
+func (s *Service) handleAppSelect(ctx *kernel.Context, id proto.AppID, arg string, vfsCap kernel.Capability) {
+	appCap := s.appCap(ctx, id)
 	if !appCap.Valid() {
 		return
 	}
+	if s.appActive && id != s.activeApp {
+		// Selecting another app while one is focused sends the old one to
+		// the background; the shell's MsgAppControl focuses the new one.
+		_ = sendUrgent(ctx, s.selectedAppCap(ctx), proto.MsgAppControl, proto.AppControlPayload(false), kernel.Capability{})
+		s.appActive = false
+	}
 	s.activeApp = id
-	_ = sendWithRetry(ctx, appCap, proto.MsgAppSelect, proto.AppSelectPayload(id, arg), kernel.Capability{})
+	s.openConsole(id)
+	_ = sendWithRetry(ctx, appCap, proto.MsgAppSelect, proto.AppSelectPayload(id, arg), vfsCap)
+}
+
+func (s *Service) openConsole(id proto.AppID) {
+	for _, c := range s.consoles {
+		if c == id {
+			return
+		}
+	}
+	if len(s.consoles) >= maxConsoles {
+		for i, c := range s.consoles {
+			if c != s.activeApp {
+				s.consoles = append(s.consoles[:i], s.consoles[i+1:]...)
+				break
+			}
+		}
+	}
+	s.consoles = append(s.consoles, id)
 }
 
 func (s *Service) handleStatus(ctx *kernel.Context, msg kernel.Message) {
@@ -180,111 +265,95 @@ func (s *Service) handleStatus(ctx *kernel.Context, msg kernel.Message) {
 
 	activeApp := s.activeApp
 	focusApp := s.appActive
-	hasApp := s.selectedAppCap().Valid()
-	payload := proto.MuxStatusRespPayload(requestID, activeApp, focusApp, hasApp)
+	hasApp := s.selectedAppCap(ctx).Valid()
+	payload := proto.MuxStatusRespPayload(requestID, activeApp, focusApp, hasApp, s.consoles)
 	_ = sendWithRetry(ctx, msg.Cap, proto.MsgMuxStatusResp, payload, kernel.Capability{})
 }
 
-func (s *Service) selectedAppCap() kernel.Capability {
-	return s.appCapByID(s.activeApp)
+func (s *Service) selectedAppCap(ctx *kernel.Context) kernel.Capability {
+	return s.appCap(ctx, s.activeApp)
 }
 
-func (s *Service) appCapByID(id proto.AppID) kernel.Capability {
-	switch id {
-	case proto.AppRTDemo:
-		return s.rtdemoCap
-	case proto.AppRTVoxel:
-		return s.rtvoxelCap
-	case proto.AppImgView:
-		return s.imgviewCap
-	case proto.AppVi:
-		return s.viCap
-	case proto.AppMC:
-		return s.mcCap
-	case proto.AppHex:
-		return s.hexCap
-	case proto.AppVector:
-		return s.vectorCap
-	case proto.AppSnake:
-		return s.snakeCap
-	case proto.AppTetris:
-		return s.tetrisCap
-	case proto.AppCalendar:
-		return s.calendarCap
-	case proto.AppTodo:
-		return s.todoCap
-	case proto.AppArchive:
-		return s.archiveCap
-	case proto.AppTEA:
-		return s.teaCap
-	case proto.AppBasic:
-		return s.basicCap
-	case proto.AppRFAnalyzer:
-		return s.rfCap
-	case proto.AppGPIOScope:
-		return s.gpioscopeCap
-	case proto.AppFBTest:
-		return s.fbtestCap
-	case proto.AppSerialTerm:
-		return s.serialCap
-	case proto.AppUsers:
-		return s.usersCap
-	case proto.AppQuarkDonut:
-		return s.donutCap
-	default:
+// appCap returns the endpoint of app id, resolving it on first use. Apps are
+// published by appmgr when it starts, so a miss is retried next time.
+func (s *Service) appCap(ctx *kernel.Context, id proto.AppID) kernel.Capability {
+	if id == proto.AppNone {
+		return kernel.Capability{}
+	}
+	if c, ok := s.appCaps[id]; ok {
+		return c
+	}
+	c, err := namesclient.Lookup(ctx, s.namesCap, proto.AppEndpointName(id))
+	if err != nil {
 		return kernel.Capability{}
 	}
+	s.appCaps[id] = c
+	return c
+}
+
+// forgetApp drops a cached app endpoint after a failed send, so a republished
+// endpoint (appmgr restarted) is picked up.
+func (s *Service) forgetApp(id proto.AppID) {
+	delete(s.appCaps, id)
+}
+
+func (s *Service) shell(ctx *kernel.Context) kernel.Capability {
+	if !s.shellCap.Valid() {
+		s.shellCap, _ = namesclient.Lookup(ctx, s.namesCap, "shell")
+	}
+	return s.shellCap
 }
 
-const sendRetryLimit = 500
+const sendTimeoutTicks = 500
+
+// inputTimeoutTicks bounds how long a key waits for room in the focused
+// console's mailbox. Input is handled on one goroutine, so a hung app must
+// not hold up the keys that switch away from it.
+const inputTimeoutTicks = 50
 
 func sendWithRetry(ctx *kernel.Context, toCap kernel.Capability, kind proto.Kind, payload []byte, xfer kernel.Capability) error {
+	return sendChunks(ctx, toCap, kind, payload, xfer, false, sendTimeoutTicks)
+}
+
+// sendUrgent delivers a control message on the destination's urgent lane so
+// it is not queued behind terminal input.
+func sendUrgent(ctx *kernel.Context, toCap kernel.Capability, kind proto.Kind, payload []byte, xfer kernel.Capability) error {
+	return sendChunks(ctx, toCap, kind, payload, xfer, true, sendTimeoutTicks)
+}
+
+// sendInput delivers keyboard input, giving up after inputTimeoutTicks. The
+// rest of payload is dropped then.
+func sendInput(ctx *kernel.Context, toCap kernel.Capability, kind proto.Kind, payload []byte) error {
+	return sendChunks(ctx, toCap, kind, payload, kernel.Capability{}, false, inputTimeoutTicks)
+}
+
+func sendChunks(ctx *kernel.Context, toCap kernel.Capability, kind proto.Kind, payload []byte, xfer kernel.Capability, urgent bool, timeout uint64) error {
 	if !toCap.Valid() {
 		return nil
 	}
-	if len(payload) == 0 {
-		retries := 0
-		for {
-			res := ctx.SendToCapResult(toCap, uint16(kind), nil, xfer)
-			switch res {
-			case kernel.SendOK:
-				return nil
-			case kernel.SendErrQueueFull:
-				retries++
-				if retries >= sendRetryLimit {
-					return fmt.Errorf("consolemux send %s: queue full", kind)
-				}
-				ctx.BlockOnTick()
-			default:
-				return fmt.Errorf("consolemux send %s: %s", kind, res)
-			}
-		}
-	}
-
-	for len(payload) > 0 {
+	for {
 		chunk := payload
 		if len(chunk) > kernel.MaxMessageBytes {
 			chunk = chunk[:kernel.MaxMessageBytes]
 		}
 
-		retries := 0
-		for {
-			res := ctx.SendToCapResult(toCap, uint16(kind), chunk, xfer)
-			switch res {
-			case kernel.SendOK:
-				payload = payload[len(chunk):]
-				goto nextChunk
-			case kernel.SendErrQueueFull:
-				retries++
-				if retries >= sendRetryLimit {
-					return fmt.Errorf("consolemux send %s: queue full", kind)
-				}
-				ctx.BlockOnTick()
-			default:
-				return fmt.Errorf("consolemux send %s: %s", kind, res)
-			}
+		var res kernel.SendResult
+		if urgent {
+			res = ctx.SendUrgent(toCap, uint16(kind), chunk, xfer, timeout)
+		} else {
+			res = ctx.SendBlocking(toCap, uint16(kind), chunk, xfer, timeout)
+		}
+		switch res {
+		case kernel.SendOK:
+		case kernel.SendErrTimeout:
+			return fmt.Errorf("consolemux send %s: queue full", kind)
+		default:
+			return fmt.Errorf("consolemux send %s: %s", kind, res)
+		}
+
+		payload = payload[len(chunk):]
+		if len(payload) == 0 {
+			return nil
 		}
-	nextChunk:
 	}
-	return nil
 }
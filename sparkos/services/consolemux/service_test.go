@@ -1,11 +1,14 @@
 package consolemux
 
 import (
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"spark/hal"
 	"spark/sparkos/kernel"
 	"spark/sparkos/proto"
+	"spark/sparkos/services/names"
 )
 
 const testTimeout = 1 * time.Second
@@ -52,6 +55,18 @@ func (t *serviceTask) Run(ctx *kernel.Context) {
 	t.svc.Run(ctx)
 }
 
+// startNames runs a name service that publishes the shell and the RTDemo app
+// and returns the mux's client capability.
+func startNames(k *kernel.Kernel, shellCap, appCap kernel.Capability) kernel.Capability {
+	reg := names.New()
+	reg.Register("shell", shellCap)
+	reg.Register(proto.AppEndpointName(proto.AppRTDemo), appCap)
+	ep := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	reg.Serve(ep.Restrict(kernel.RightRecv), names.Access{Resolve: []string{"shell", "app.*"}})
+	k.AddTask(reg)
+	return ep.Restrict(kernel.RightSend)
+}
+
 func recvWithTimeout[T any](t *testing.T, ch <-chan T) T {
 	t.Helper()
 	select {
@@ -94,32 +109,7 @@ func TestCtrlGTogglesFocus(t *testing.T) {
 		t.Fatal("expected valid capabilities")
 	}
 
-	svc := New(
-		muxIn,
-		muxCtl,
-		shellSend,
-		appSend,
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-	)
+	svc := New(muxIn, muxCtl, startNames(k, shellSend, appSend), proto.AppNone)
 	k.AddTask(&serviceTask{svc: svc})
 
 	shellOut := make(chan kernel.Message, 16)
@@ -234,32 +224,7 @@ func TestMuxStatus(t *testing.T) {
 		t.Fatal("expected valid capabilities")
 	}
 
-	svc := New(
-		muxIn,
-		muxCtl,
-		shellSend,
-		appSend,
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-		kernel.Capability{},
-	)
+	svc := New(muxIn, muxCtl, startNames(k, shellSend, appSend), proto.AppNone)
 	k.AddTask(&serviceTask{svc: svc})
 
 	replyOut := make(chan kernel.Message, 16)
@@ -276,7 +241,7 @@ func TestMuxStatus(t *testing.T) {
 		t.Fatalf("expected MsgMuxStatusResp, got %s", proto.Kind(msg.Kind))
 	}
 
-	gotReqID, appID, focusApp, hasApp, ok := proto.DecodeMuxStatusRespPayload(msg.Payload())
+	gotReqID, appID, focusApp, hasApp, consoles, ok := proto.DecodeMuxStatusRespPayload(msg.Payload())
 	if !ok {
 		t.Fatal("expected valid mux status payload")
 	}
@@ -292,4 +257,215 @@ func TestMuxStatus(t *testing.T) {
 	if !hasApp {
 		t.Fatal("expected hasApp=true (app capability provided)")
 	}
+	if len(consoles) != 0 {
+		t.Fatalf("expected no app consoles before any select, got %v", consoles)
+	}
+}
+
+func expectControl(t *testing.T, ch <-chan kernel.Message, who string, want bool) {
+	t.Helper()
+	for {
+		msg := recvWithTimeout(t, ch)
+		if proto.Kind(msg.Kind) == proto.MsgAppSelect {
+			continue
+		}
+		if proto.Kind(msg.Kind) != proto.MsgAppControl {
+			t.Fatalf("%s: expected MsgAppControl, got %s", who, proto.Kind(msg.Kind))
+		}
+		active, ok := proto.DecodeAppControlPayload(msg.Payload())
+		if !ok || active != want {
+			t.Fatalf("%s: expected active=%v, got active=%v ok=%v", who, want, active, ok)
+		}
+		return
+	}
+}
+
+func TestVirtualConsoles(t *testing.T) {
+	k := kernel.New()
+
+	muxEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	shellEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	demoEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	snakeEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+
+	namesCap := startNames(k, shellEP.Restrict(kernel.RightSend), demoEP.Restrict(kernel.RightSend))
+	svc := New(muxEP.Restrict(kernel.RightRecv), muxEP.Restrict(kernel.RightSend), namesCap, proto.AppNone)
+	// The test name service only knows RTDemo; hand the mux Snake directly.
+	svc.appCaps[proto.AppSnake] = snakeEP.Restrict(kernel.RightSend)
+	k.AddTask(&serviceTask{svc: svc})
+
+	shellOut := make(chan kernel.Message, 16)
+	demoOut := make(chan kernel.Message, 16)
+	snakeOut := make(chan kernel.Message, 16)
+	k.AddTask(&recvTask{cap: shellEP.Restrict(kernel.RightRecv), out: shellOut})
+	k.AddTask(&recvTask{cap: demoEP.Restrict(kernel.RightRecv), out: demoOut})
+	k.AddTask(&recvTask{cap: snakeEP.Restrict(kernel.RightRecv), out: snakeOut})
+
+	sendReqCh := make(chan sendReq, 16)
+	k.AddTask(&senderTask{to: muxEP.Restrict(kernel.RightSend), reqs: sendReqCh})
+
+	sendTo(t, sendReqCh, proto.MsgAppSelect, proto.AppSelectPayload(proto.AppRTDemo, ""), kernel.Capability{})
+	sendTo(t, sendReqCh, proto.MsgAppSelect, proto.AppSelectPayload(proto.AppSnake, ""), kernel.Capability{})
+
+	// Ctrl+N: shell -> console 1 (RTDemo).
+	sendTo(t, sendReqCh, proto.MsgTermInput, []byte{nextConsoleByte}, kernel.Capability{})
+	expectControl(t, demoOut, "rtdemo", true)
+	expectControl(t, shellOut, "shell", false)
+
+	// Ctrl+N: RTDemo -> console 2 (Snake); the shell is not involved.
+	sendTo(t, sendReqCh, proto.MsgTermInput, []byte{nextConsoleByte}, kernel.Capability{})
+	expectControl(t, demoOut, "rtdemo", false)
+	expectControl(t, snakeOut, "snake", true)
+
+	sendTo(t, sendReqCh, proto.MsgTermInput, []byte("s"), kernel.Capability{})
+	if msg := recvWithTimeout(t, snakeOut); proto.Kind(msg.Kind) != proto.MsgTermInput || string(msg.Payload()) != "s" {
+		t.Fatalf("expected input %q at snake, got %s %q", "s", proto.Kind(msg.Kind), msg.Payload())
+	}
+
+	// Ctrl+N wraps back to the shell.
+	sendTo(t, sendReqCh, proto.MsgTermInput, []byte{nextConsoleByte}, kernel.Capability{})
+	expectControl(t, snakeOut, "snake", false)
+	expectControl(t, shellOut, "shell", true)
+
+	// MsgMuxSwitch jumps straight to a console.
+	sendTo(t, sendReqCh, proto.MsgMuxSwitch, proto.MuxSwitchPayload(proto.AppRTDemo), kernel.Capability{})
+	expectControl(t, demoOut, "rtdemo", true)
+	expectControl(t, shellOut, "shell", false)
+	sendTo(t, sendReqCh, proto.MsgMuxSwitch, proto.MuxSwitchPayload(proto.AppNone), kernel.Capability{})
+	expectControl(t, demoOut, "rtdemo", false)
+	expectControl(t, shellOut, "shell", true)
+}
+
+func TestAppExitReturnsHome(t *testing.T) {
+	k := kernel.New()
+
+	muxEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	shellEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	demoEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	homeEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+
+	namesCap := startNames(k, shellEP.Restrict(kernel.RightSend), demoEP.Restrict(kernel.RightSend))
+	svc := New(muxEP.Restrict(kernel.RightRecv), muxEP.Restrict(kernel.RightSend), namesCap, proto.AppLauncher)
+	svc.appCaps[proto.AppLauncher] = homeEP.Restrict(kernel.RightSend)
+	k.AddTask(&serviceTask{svc: svc})
+
+	shellOut := make(chan kernel.Message, 16)
+	demoOut := make(chan kernel.Message, 16)
+	homeOut := make(chan kernel.Message, 16)
+	k.AddTask(&recvTask{cap: shellEP.Restrict(kernel.RightRecv), out: shellOut})
+	k.AddTask(&recvTask{cap: demoEP.Restrict(kernel.RightRecv), out: demoOut})
+	k.AddTask(&recvTask{cap: homeEP.Restrict(kernel.RightRecv), out: homeOut})
+
+	sendReqCh := make(chan sendReq, 16)
+	k.AddTask(&senderTask{to: muxEP.Restrict(kernel.RightSend), reqs: sendReqCh})
+
+	// The launcher opens RTDemo.
+	sendTo(t, sendReqCh, proto.MsgMuxSwitch, proto.MuxSwitchPayload(proto.AppLauncher), kernel.Capability{})
+	expectControl(t, homeOut, "home", true)
+	expectControl(t, shellOut, "shell", false)
+	sendTo(t, sendReqCh, proto.MsgAppSelect, proto.AppSelectPayload(proto.AppRTDemo, ""), kernel.Capability{})
+	expectControl(t, homeOut, "home", false)
+	sendTo(t, sendReqCh, proto.MsgAppControl, proto.AppControlPayload(true), kernel.Capability{})
+	expectControl(t, demoOut, "rtdemo", true)
+	expectControl(t, shellOut, "shell", false)
+
+	// RTDemo quits: back to the launcher, not the shell.
+	sendTo(t, sendReqCh, proto.MsgAppControl, proto.AppControlPayload(false), kernel.Capability{})
+	expectControl(t, demoOut, "rtdemo", false)
+	expectControl(t, homeOut, "home", true)
+
+	// The launcher itself hands the focus to the shell.
+	sendTo(t, sendReqCh, proto.MsgAppControl, proto.AppControlPayload(false), kernel.Capability{})
+	expectControl(t, homeOut, "home", false)
+	expectControl(t, shellOut, "shell", true)
+}
+
+func TestInputEventsGoToFocusedApp(t *testing.T) {
+	k := kernel.New()
+
+	muxEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	shellEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	appEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+
+	svc := New(muxEP.Restrict(kernel.RightRecv), muxEP.Restrict(kernel.RightSend),
+		startNames(k, shellEP.Restrict(kernel.RightSend), appEP.Restrict(kernel.RightSend)), proto.AppNone)
+	k.AddTask(&serviceTask{svc: svc})
+
+	shellOut := make(chan kernel.Message, 16)
+	appOut := make(chan kernel.Message, 16)
+	k.AddTask(&recvTask{cap: shellEP.Restrict(kernel.RightRecv), out: shellOut})
+	k.AddTask(&recvTask{cap: appEP.Restrict(kernel.RightRecv), out: appOut})
+
+	sendReqCh := make(chan sendReq, 16)
+	k.AddTask(&senderTask{to: muxEP.Restrict(kernel.RightSend), reqs: sendReqCh})
+
+	down := proto.InputEventPayload(proto.InputEvent{Code: uint16(hal.KeyDown), Press: true})
+
+	// The shell reads bytes only: the event is dropped.
+	sendTo(t, sendReqCh, proto.MsgInputEvent, down, kernel.Capability{})
+	sendTo(t, sendReqCh, proto.MsgTermInput, []byte("a"), kernel.Capability{})
+	if msg := recvWithTimeout(t, shellOut); proto.Kind(msg.Kind) != proto.MsgTermInput {
+		t.Fatalf("expected MsgTermInput to shell, got %s", proto.Kind(msg.Kind))
+	}
+
+	sendTo(t, sendReqCh, proto.MsgTermInput, []byte{interruptByte}, kernel.Capability{})
+	recvWithTimeout(t, appOut)
+	recvWithTimeout(t, shellOut)
+
+	// The focus key stays with consolemux; other events reach the app.
+	sendTo(t, sendReqCh, proto.MsgInputEvent, proto.InputEventPayload(proto.InputEvent{Rune: interruptByte}), kernel.Capability{})
+	sendTo(t, sendReqCh, proto.MsgInputEvent, down, kernel.Capability{})
+	msg := recvWithTimeout(t, appOut)
+	if proto.Kind(msg.Kind) != proto.MsgInputEvent {
+		t.Fatalf("expected MsgInputEvent to app, got %s", proto.Kind(msg.Kind))
+	}
+	if ev, ok := proto.DecodeInputEventPayload(msg.Payload()); !ok || hal.KeyCode(ev.Code) != hal.KeyDown || !ev.Press {
+		t.Fatalf("unexpected event %+v (ok=%v)", ev, ok)
+	}
+}
+
+func TestHungAppLosesFocus(t *testing.T) {
+	k := kernel.New()
+	var now atomic.Uint64
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond):
+				k.TickTo(now.Add(1))
+			}
+		}
+	}()
+
+	muxEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	shellEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	// Nobody reads the app's endpoint: it is hung.
+	appEP := k.NewEndpointWith(kernel.RightSend|kernel.RightRecv, kernel.EndpointOptions{Depth: 1, Urgent: true})
+
+	svc := New(muxEP.Restrict(kernel.RightRecv), muxEP.Restrict(kernel.RightSend), startNames(k, shellEP.Restrict(kernel.RightSend), appEP.Restrict(kernel.RightSend)), proto.AppNone)
+	k.AddTask(&serviceTask{svc: svc})
+
+	shellOut := make(chan kernel.Message, 16)
+	k.AddTask(&recvTask{cap: shellEP.Restrict(kernel.RightRecv), out: shellOut})
+	sendReqCh := make(chan sendReq, 16)
+	k.AddTask(&senderTask{to: muxEP.Restrict(kernel.RightSend), reqs: sendReqCh})
+
+	sendTo(t, sendReqCh, proto.MsgTermInput, []byte{interruptByte}, kernel.Capability{})
+	expectControl(t, shellOut, "shell", false)
+
+	// The first key fills the app's mailbox, the second does not fit.
+	start := now.Load()
+	sendTo(t, sendReqCh, proto.MsgTermInput, []byte("a"), kernel.Capability{})
+	sendTo(t, sendReqCh, proto.MsgTermInput, []byte("b"), kernel.Capability{})
+	expectControl(t, shellOut, "shell", true)
+	msg := recvWithTimeout(t, shellOut)
+	if proto.Kind(msg.Kind) != proto.MsgTermInput || string(msg.Payload()) != "b" {
+		t.Fatalf("expected the key at the shell, got %s %q", proto.Kind(msg.Kind), msg.Payload())
+	}
+	if waited := now.Load() - start; waited >= sendTimeoutTicks {
+		t.Fatalf("input waited %d ticks for the hung app", waited)
+	}
 }
@@ -0,0 +1,132 @@
+package names
+
+import (
+	"strings"
+	"sync"
+
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+)
+
+// Access is what one client may do with the name service.
+//
+// A pattern is either an exact name or a prefix ending in "*" ("app.*").
+type Access struct {
+	// Resolve lists the names the client may look up.
+	Resolve []string
+	// Publish lists the names the client may register at runtime.
+	Publish []string
+}
+
+type client struct {
+	in     kernel.Capability
+	access Access
+}
+
+// Service maps names to capabilities.
+//
+// Every client gets its own endpoint (see Serve), so the service knows who
+// is asking without trusting the payload. Entries registered at boot with
+// Register and at runtime with MsgNameRegister live in the Service value, so
+// a restarted task keeps them if it reuses the same *Service.
+type Service struct {
+	mu      sync.Mutex
+	entries map[string]kernel.Capability
+	clients []client
+}
+
+func New() *Service {
+	return &Service{entries: make(map[string]kernel.Capability)}
+}
+
+// Register publishes c under name. Lookups hand out c restricted to the
+// rights the client asks for, so register only the rights clients may get.
+func (s *Service) Register(name string, c kernel.Capability) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c.Valid() {
+		s.entries[name] = c
+	} else {
+		delete(s.entries, name)
+	}
+}
+
+// Serve adds a client whose requests arrive on in.
+// It must be called before the service runs.
+func (s *Service) Serve(in kernel.Capability, access Access) {
+	s.clients = append(s.clients, client{in: in, access: access})
+}
+
+func (s *Service) Run(ctx *kernel.Context) {
+	for _, c := range s.clients {
+		ch, ok := ctx.RecvChan(c.in)
+		if !ok {
+			continue
+		}
+		go s.serve(ctx, ch, c.access)
+	}
+	select {}
+}
+
+func (s *Service) serve(ctx *kernel.Context, ch <-chan kernel.Message, access Access) {
+	for msg := range ch {
+		switch proto.Kind(msg.Kind) {
+		case proto.MsgNameLookup:
+			s.handleLookup(ctx, msg, access)
+		case proto.MsgNameRegister:
+			name, ok := proto.DecodeNameRegisterPayload(msg.Payload())
+			if !ok || !allowed(access.Publish, name) {
+				continue
+			}
+			s.Register(name, msg.Cap)
+		}
+	}
+}
+
+func (s *Service) handleLookup(ctx *kernel.Context, msg kernel.Message, access Access) {
+	if !msg.Cap.Valid() {
+		return
+	}
+	requestID, rights, name, ok := proto.DecodeNameLookupPayload(msg.Payload())
+	if !ok {
+		replyError(ctx, msg.Cap, proto.ErrBadMessage, requestID)
+		return
+	}
+	if !allowed(access.Resolve, name) {
+		replyError(ctx, msg.Cap, proto.ErrUnauthorized, requestID)
+		return
+	}
+
+	s.mu.Lock()
+	c, found := s.entries[name]
+	s.mu.Unlock()
+	if rights == 0 {
+		rights = uint8(kernel.RightSend)
+	}
+	c = c.Restrict(kernel.Rights(rights))
+	if !found || !c.Valid() {
+		replyError(ctx, msg.Cap, proto.ErrNotFound, requestID)
+		return
+	}
+	_ = ctx.SendToCapResult(msg.Cap, uint16(proto.MsgNameLookupResp), proto.NameLookupRespPayload(requestID), c)
+}
+
+func replyError(ctx *kernel.Context, to kernel.Capability, code proto.ErrCode, requestID uint32) {
+	payload := proto.ErrorPayload(code, proto.MsgNameLookup, proto.ErrorDetailWithRequestID(requestID, nil))
+	_ = ctx.SendToCapResult(to, uint16(proto.MsgError), payload, kernel.Capability{})
+}
+
+func allowed(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+			continue
+		}
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
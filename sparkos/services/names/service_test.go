@@ -0,0 +1,92 @@
+package names
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	namesclient "spark/sparkos/client/names"
+	"spark/sparkos/kernel"
+)
+
+type taskFunc func(ctx *kernel.Context)
+
+func (f taskFunc) Run(ctx *kernel.Context) { f(ctx) }
+
+// run executes f as a task and waits for it.
+func run(t *testing.T, k *kernel.Kernel, f func(ctx *kernel.Context)) {
+	t.Helper()
+	done := make(chan struct{})
+	k.AddTask(taskFunc(func(ctx *kernel.Context) {
+		defer close(done)
+		f(ctx)
+	}))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timed out")
+	}
+}
+
+func newClient(k *kernel.Kernel, s *Service, access Access) kernel.Capability {
+	ep := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	s.Serve(ep.Restrict(kernel.RightRecv), access)
+	return ep.Restrict(kernel.RightSend)
+}
+
+func TestLookupHonoursAllowList(t *testing.T) {
+	k := kernel.New()
+	vfsEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	logEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+
+	s := New()
+	s.Register("vfs", vfsEP)
+	s.Register("logger", logEP.Restrict(kernel.RightSend))
+	shell := newClient(k, s, Access{Resolve: []string{"vfs", "app.*"}})
+	appmgr := newClient(k, s, Access{Publish: []string{"app.*"}})
+	k.AddTask(s)
+
+	run(t, k, func(ctx *kernel.Context) {
+		c, err := namesclient.Lookup(ctx, shell, "vfs")
+		if err != nil || c != vfsEP.Restrict(kernel.RightSend) {
+			t.Errorf("lookup vfs: got %v, %v", c, err)
+		}
+		c, err = namesclient.LookupRights(ctx, shell, "vfs", kernel.RightSend|kernel.RightRecv)
+		if err != nil || c != vfsEP {
+			t.Errorf("lookup vfs with recv: got %v, %v", c, err)
+		}
+		if _, err := namesclient.Lookup(ctx, shell, "logger"); err == nil {
+			t.Error("expected logger to be outside the shell's allow-list")
+		}
+		if _, err := namesclient.Lookup(ctx, shell, "app.1"); !errors.Is(err, namesclient.ErrNotFound) {
+			t.Errorf("expected app.1 not found before it is published, got %v", err)
+		}
+
+		appEP := ctx.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+		if err := namesclient.Register(ctx, appmgr, "app.1", appEP.Restrict(kernel.RightSend)); err != nil {
+			t.Error(err)
+			return
+		}
+		if err := namesclient.Register(ctx, appmgr, "vfs", appEP.Restrict(kernel.RightSend)); err != nil {
+			t.Error(err)
+			return
+		}
+		// Registration is one-way and served on appmgr's own endpoint.
+		for i := 0; i < 100; i++ {
+			if c, err = namesclient.Lookup(ctx, shell, "app.1"); err == nil {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if err != nil || c != appEP.Restrict(kernel.RightSend) {
+			t.Errorf("lookup app.1: got %v, %v", c, err)
+		}
+		if _, err := namesclient.LookupRights(ctx, shell, "app.1", kernel.RightRecv); err == nil {
+			t.Error("expected no receive right on a send-only registration")
+		}
+		c, err = namesclient.Lookup(ctx, shell, "vfs")
+		if err != nil || c != vfsEP.Restrict(kernel.RightSend) {
+			t.Errorf("expected vfs to survive an unauthorized registration, got %v, %v", c, err)
+		}
+	})
+}
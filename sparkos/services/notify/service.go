@@ -0,0 +1,420 @@
+// Package notify is the notification service. It draws the status bar in the
+// rows the screen layer leaves free at the top (see compositor.Inset): the
+// focused app, the logged-in user, the audio state and the count of unread
+// notifications. Notifications posted with MsgNotify show as a toast below
+// the bar and are kept in a short history.
+//
+// While an app with apps.Descriptor.FullScreen has focus, the bar and toasts
+// are hidden; notifications keep arriving as unread.
+package notify
+
+import (
+	"image/color"
+	"strconv"
+
+	"spark/sparkos/apps"
+	audioclient "spark/sparkos/client/audio"
+	compclient "spark/sparkos/client/compositor"
+	muxclient "spark/sparkos/client/consolemux"
+	namesclient "spark/sparkos/client/names"
+	"spark/sparkos/fonts/font6x8cp1251"
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+
+	"tinygo.org/x/tinyfont"
+)
+
+// BarHeight is the height of the status bar in pixels.
+const BarHeight = 10
+
+const (
+	barZ   = 16
+	toastZ = 32
+
+	toastHeight = 12
+
+	// defaultToastTicks is how long a toast shows without a timeout of its own.
+	defaultToastTicks = 3000
+	// pollTicks is how often the focused app is read from consolemux.
+	pollTicks = 200
+	// maxHistory bounds the notifications kept for MsgNotifyList.
+	maxHistory = 16
+	// maxQueued bounds the toasts waiting for the one on screen.
+	maxQueued = 4
+)
+
+var (
+	barBG      = color.RGBA{0x20, 0x20, 0x28, 0xff}
+	barFG      = color.RGBA{0xd0, 0xd0, 0xd0, 0xff}
+	unreadFG   = color.RGBA{0xff, 0xd0, 0x40, 0xff}
+	toastFG    = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	severityBG = [...]color.RGBA{
+		proto.SeverityInfo:  {0x20, 0x50, 0x90, 0xff},
+		proto.SeverityWarn:  {0x90, 0x60, 0x10, 0xff},
+		proto.SeverityError: {0xa0, 0x20, 0x20, 0xff},
+	}
+)
+
+type entry struct {
+	sev     proto.Severity
+	tick    uint64
+	timeout uint64
+	text    string
+}
+
+// Service is the notification service.
+type Service struct {
+	in       kernel.Capability
+	compCap  kernel.Capability
+	namesCap kernel.Capability
+	width    int
+
+	muxCap kernel.Capability
+
+	bar   *compclient.Surface
+	toast *compclient.Surface
+
+	focus      proto.AppID
+	fullScreen bool
+	user       string
+
+	audio      proto.AudioState
+	audioSecs  uint32
+	barText    string
+	barUnread  int
+	barVisible bool
+
+	history []entry // oldest first
+	unread  int
+
+	queue      []entry
+	showing    bool
+	toastUntil uint64
+}
+
+// New returns the notification service receiving on in. It draws through the
+// compositor client endpoint compCap on a screen width pixels wide and
+// resolves consolemux and audio through namesCap.
+func New(in, compCap, namesCap kernel.Capability, width int) *Service {
+	return &Service{in: in, compCap: compCap, namesCap: namesCap, width: width}
+}
+
+func (s *Service) Run(ctx *kernel.Context) {
+	ch, ok := ctx.RecvChan(s.in)
+	if !ok {
+		return
+	}
+
+	if bar, err := compclient.Create(ctx, s.compCap, 0, 0, s.width, BarHeight, barZ); err == nil {
+		s.bar = bar
+		s.barVisible = true
+	}
+	if toast, err := compclient.Create(ctx, s.compCap, 0, BarHeight, s.width, toastHeight, toastZ); err == nil {
+		s.toast = toast
+		_ = toast.Hide(ctx)
+	}
+
+	var audioCh <-chan kernel.Message
+	if audioCap, err := namesclient.Lookup(ctx, s.namesCap, "audio"); err == nil {
+		statusEP := ctx.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+		if err := audioclient.New(audioCap).Subscribe(ctx, statusEP.Restrict(kernel.RightSend)); err == nil {
+			audioCh, _ = ctx.RecvChan(statusEP.Restrict(kernel.RightRecv))
+		}
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	tickCh := make(chan uint64, 16)
+	go func() {
+		last := ctx.NowTick()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			last = ctx.WaitTick(last)
+			select {
+			case tickCh <- last:
+			default:
+			}
+		}
+	}()
+
+	s.pollFocus(ctx)
+	s.drawBar(ctx)
+	lastPoll := ctx.NowTick()
+
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			s.handle(ctx, msg)
+
+		case msg, ok := <-audioCh:
+			if !ok {
+				audioCh = nil
+				continue
+			}
+			if proto.Kind(msg.Kind) != proto.MsgAudioStatus {
+				continue
+			}
+			state, _, sr, pos, _, ok := proto.DecodeAudioStatusPayload(msg.Payload())
+			if !ok {
+				continue
+			}
+			s.audio = state
+			s.audioSecs = 0
+			if sr != 0 {
+				s.audioSecs = pos / uint32(sr)
+			}
+			s.drawBar(ctx)
+
+		case now := <-tickCh:
+			if now-lastPoll >= pollTicks {
+				lastPoll = now
+				s.pollFocus(ctx)
+				s.drawBar(ctx)
+			}
+			if s.showing && now >= s.toastUntil {
+				s.showing = false
+				s.nextToast(ctx, now)
+			}
+		}
+	}
+}
+
+func (s *Service) handle(ctx *kernel.Context, msg kernel.Message) {
+	switch proto.Kind(msg.Kind) {
+	case proto.MsgNotify:
+		sev, timeout, text, ok := proto.DecodeNotifyPayload(msg.Payload())
+		if !ok {
+			return
+		}
+		e := entry{sev: sev, tick: ctx.NowTick(), timeout: uint64(timeout), text: text}
+		if e.timeout == 0 {
+			e.timeout = defaultToastTicks
+		}
+		if len(s.history) == maxHistory {
+			s.history = append(s.history[:0], s.history[1:]...)
+		}
+		s.history = append(s.history, e)
+		if s.unread < maxHistory {
+			s.unread++
+		}
+		if !s.fullScreen {
+			if len(s.queue) == maxQueued {
+				s.queue = append(s.queue[:0], s.queue[1:]...)
+			}
+			s.queue = append(s.queue, e)
+			if !s.showing {
+				s.nextToast(ctx, e.tick)
+			}
+		}
+		s.drawBar(ctx)
+
+	case proto.MsgNotifyUser:
+		if name, ok := proto.DecodeNotifyUserPayload(msg.Payload()); ok {
+			s.user = name
+			s.drawBar(ctx)
+		}
+
+	case proto.MsgNotifyList:
+		requestID, index, ok := proto.DecodeNotifyListPayload(msg.Payload())
+		if !ok || !msg.Cap.Valid() {
+			return
+		}
+		if index == 0 {
+			s.unread = 0
+			s.drawBar(ctx)
+		}
+		var payload []byte
+		if i := len(s.history) - 1 - int(index); i >= 0 {
+			e := s.history[i]
+			payload = proto.NotifyListRespPayload(requestID, uint8(len(s.history)), e.sev, uint32(e.tick), e.text)
+		} else {
+			payload = proto.NotifyListRespPayload(requestID, uint8(len(s.history)), 0, 0, "")
+		}
+		_ = ctx.SendToCapResult(msg.Cap, uint16(proto.MsgNotifyListResp), payload, kernel.Capability{})
+	}
+}
+
+// pollFocus reads the focused app from consolemux and hides the bar and
+// toasts for full-screen apps.
+func (s *Service) pollFocus(ctx *kernel.Context) {
+	if !s.muxCap.Valid() {
+		c, err := namesclient.Lookup(ctx, s.namesCap, "consolemux")
+		if err != nil {
+			return
+		}
+		s.muxCap = c
+	}
+	st, err := muxclient.GetStatus(ctx, s.muxCap)
+	if err != nil {
+		return
+	}
+	focus := proto.AppNone
+	if st.FocusApp {
+		focus = st.ActiveApp
+	}
+	s.focus = focus
+	d, _ := apps.ByID(focus)
+	fullScreen := focus != proto.AppNone && d.FullScreen
+	if fullScreen == s.fullScreen {
+		return
+	}
+	s.fullScreen = fullScreen
+	if fullScreen {
+		s.queue = s.queue[:0]
+		if s.showing {
+			s.showing = false
+			if s.toast != nil {
+				_ = s.toast.Hide(ctx)
+			}
+		}
+	}
+}
+
+// nextToast shows the next queued toast, or hides the toast surface.
+func (s *Service) nextToast(ctx *kernel.Context, now uint64) {
+	if s.toast == nil {
+		s.queue = s.queue[:0]
+		return
+	}
+	if len(s.queue) == 0 {
+		_ = s.toast.Hide(ctx)
+		return
+	}
+	e := s.queue[0]
+	s.queue = append(s.queue[:0], s.queue[1:]...)
+
+	c := canvas{px: s.toast.Pixels, w: s.toast.W, h: s.toast.H}
+	c.fill(severityBG[e.sev])
+	c.text(4, 9, fit(e.text, (s.toast.W-8)/charWidth), toastFG)
+	s.showing = true
+	s.toastUntil = now + e.timeout
+	if s.toast.Visible {
+		_ = s.toast.Damage(ctx, 0, 0, 0, 0)
+	} else {
+		_ = s.toast.Show(ctx)
+	}
+}
+
+// drawBar redraws the status bar if anything on it changed.
+func (s *Service) drawBar(ctx *kernel.Context) {
+	if s.bar == nil {
+		return
+	}
+	if s.fullScreen {
+		if s.barVisible {
+			s.barVisible = false
+			_ = s.bar.Hide(ctx)
+		}
+		return
+	}
+
+	name := "shell"
+	if d, ok := apps.ByID(s.focus); ok && s.focus != proto.AppNone {
+		name = d.Name
+	}
+	right := ""
+	switch s.audio {
+	case proto.AudioPlaying:
+		right = "> " + clock(s.audioSecs)
+	case proto.AudioPaused:
+		right = "|| " + clock(s.audioSecs)
+	}
+	if s.user != "" {
+		if right != "" {
+			right = s.user + "  " + right
+		} else {
+			right = s.user
+		}
+	}
+	text := " " + name
+	cols := s.width / charWidth
+	if pad := cols - len(text) - len(right) - 5; pad > 0 {
+		for i := 0; i < pad; i++ {
+			text += " "
+		}
+	}
+	text += right
+
+	if text == s.barText && s.unread == s.barUnread && s.barVisible {
+		return
+	}
+	s.barText, s.barUnread = text, s.unread
+
+	c := canvas{px: s.bar.Pixels, w: s.bar.W, h: s.bar.H}
+	c.fill(barBG)
+	c.text(0, 8, fit(text, cols-4), barFG)
+	if s.unread > 0 {
+		mark := "*" + strconv.Itoa(s.unread)
+		c.text(s.width-(len(mark)+1)*charWidth, 8, mark, unreadFG)
+	}
+	if s.barVisible {
+		_ = s.bar.Damage(ctx, 0, 0, 0, 0)
+		return
+	}
+	s.barVisible = true
+	_ = s.bar.Show(ctx)
+}
+
+func clock(secs uint32) string {
+	m, sec := secs/60, secs%60
+	out := strconv.Itoa(int(m)) + ":"
+	if sec < 10 {
+		out += "0"
+	}
+	return out + strconv.Itoa(int(sec))
+}
+
+// fit cuts s to n bytes.
+func fit(s string, n int) string {
+	if n < 0 {
+		return ""
+	}
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+const charWidth = 6
+
+// canvas draws into the RGB565 pixels of a surface.
+type canvas struct {
+	px   []byte
+	w, h int
+}
+
+func (c *canvas) Size() (x, y int16) { return int16(c.w), int16(c.h) }
+
+func (c *canvas) SetPixel(x, y int16, col color.RGBA) {
+	if x < 0 || int(x) >= c.w || y < 0 || int(y) >= c.h {
+		return
+	}
+	pixel := rgb565(col)
+	off := (int(y)*c.w + int(x)) * 2
+	c.px[off], c.px[off+1] = byte(pixel), byte(pixel>>8)
+}
+
+func (c *canvas) Display() error { return nil }
+
+func (c *canvas) fill(col color.RGBA) {
+	pixel := rgb565(col)
+	lo, hi := byte(pixel), byte(pixel>>8)
+	for i := 0; i+1 < len(c.px); i += 2 {
+		c.px[i], c.px[i+1] = lo, hi
+	}
+}
+
+func (c *canvas) text(x, baseline int, s string, col color.RGBA) {
+	tinyfont.WriteLine(c, font6x8cp1251.Font, int16(x), int16(baseline), s, col)
+}
+
+func rgb565(c color.RGBA) uint16 {
+	return uint16(c.R>>3)<<11 | uint16(c.G>>2)<<5 | uint16(c.B>>3)
+}
@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"spark/hal"
+	notifyclient "spark/sparkos/client/notify"
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+	"spark/sparkos/services/compositor"
+)
+
+type testFB struct {
+	mu   sync.Mutex
+	w, h int
+	buf  []byte
+}
+
+func (f *testFB) Width() int                   { return f.w }
+func (f *testFB) Height() int                  { return f.h }
+func (f *testFB) Format() hal.PixelFormat      { return hal.PixelFormatRGB565 }
+func (f *testFB) StrideBytes() int             { return f.w * 2 }
+func (f *testFB) Buffer() []byte               { return f.buf }
+func (f *testFB) ClearRGB(_, _, _ uint8)       {}
+func (f *testFB) Present() error               { return nil }
+func (f *testFB) Framebuffer() hal.Framebuffer { return f }
+
+func (f *testFB) pixel(x, y int) uint16 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	o := (y*f.w + x) * 2
+	return uint16(f.buf[o]) | uint16(f.buf[o+1])<<8
+}
+
+type funcTask func(ctx *kernel.Context)
+
+func (f funcTask) Run(ctx *kernel.Context) { f(ctx) }
+
+func TestToastAndHistory(t *testing.T) {
+	const w, h = 64, 32
+	k := kernel.New()
+	fb := &testFB{w: w, h: h, buf: make([]byte, w*h*2)}
+	comp := compositor.New(fb, compositor.Options{Backing: true})
+	compEP := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	comp.Serve(compEP.Restrict(kernel.RightRecv))
+	k.AddTask(comp)
+
+	in := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	k.AddTask(New(in.Restrict(kernel.RightRecv), compEP.Restrict(kernel.RightSend), kernel.Capability{}, w))
+
+	waitPixel := func(x, y int, want uint16) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for fb.pixel(x, y) != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("pixel (%d,%d) = %#04x, want %#04x", x, y, fb.pixel(x, y), want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitPixel(w-1, 0, rgb565(barBG))
+
+	got := make(chan []notifyclient.Entry, 1)
+	k.AddTask(funcTask(func(ctx *kernel.Context) {
+		notifyCap := in.Restrict(kernel.RightSend)
+		_ = notifyclient.Post(ctx, notifyCap, proto.SeverityInfo, 0, "first")
+		_ = notifyclient.Post(ctx, notifyCap, proto.SeverityError, 0, "second")
+		entries, err := notifyclient.List(ctx, notifyCap)
+		if err != nil {
+			t.Error(err)
+		}
+		got <- entries
+	}))
+
+	// The first toast shows below the bar while the second waits.
+	waitPixel(w-1, BarHeight, rgb565(severityBG[proto.SeverityInfo]))
+
+	select {
+	case entries := <-got:
+		if len(entries) != 2 || entries[0].Text != "second" || entries[0].Severity != proto.SeverityError || entries[1].Text != "first" {
+			t.Fatalf("history = %+v", entries)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("list timed out")
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"spark/sparkos/internal/userdb"
 	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
 )
 
 type authStage uint8
@@ -255,6 +256,8 @@ func (s *Service) authSuccess(ctx *kernel.Context, rec userdb.Record) {
 		s.cwd = "/"
 	}
 
+	s.beginSession(ctx, rec)
+
 	_ = s.writeString(ctx, "Welcome, "+rec.Name+".\n\n")
 	s.initTabsIfNeeded()
 	if s.tabIdx >= 0 && s.tabIdx < len(s.tabs) {
@@ -265,6 +268,12 @@ func (s *Service) authSuccess(ctx *kernel.Context, rec userdb.Record) {
 	}
 	_ = s.writeString(ctx, s.tabStatusLine())
 	_ = s.prompt(ctx)
+
+	if s.homeApp != proto.AppNone && s.muxCap.Valid() {
+		if err := s.selectApp(ctx, s.homeApp, ""); err == nil {
+			_ = s.sendToMux(ctx, proto.MsgAppControl, proto.AppControlPayload(true))
+		}
+	}
 }
 
 func (s *Service) redrawAuth(ctx *kernel.Context) error {
@@ -4,314 +4,63 @@ import (
 	"errors"
 	"strings"
 
+	"spark/sparkos/apps"
 	"spark/sparkos/internal/userdb"
 	"spark/sparkos/kernel"
 	"spark/sparkos/proto"
-	vitask "spark/sparkos/tasks/vi"
 )
 
+// registerAppCommands adds a command for every app in the apps registry.
 func registerAppCommands(r *registry) error {
-	for _, cmd := range []command{
-		{Name: "vi", Usage: "vi [file]", Desc: "Edit a file (SparkVi; build with -tags spark_vi).", Run: cmdVi},
-		{Name: "mc", Usage: "mc [dir]", Desc: "Midnight Commander-like file manager (q/ESC to exit).", Run: cmdMC},
-		{Name: "basic", Usage: "basic [file] | basic run <file>", Desc: "Tiny BASIC IDE (F1 code, F2 io, F3 vars).", Run: cmdBasic},
-		{Name: "hex", Usage: "hex <file>", Desc: "Hex viewer/editor (q/ESC to exit, w to save).", Run: cmdHex},
-		{Name: "vector", Usage: "vector [expr]", Desc: "Math calculator with graphing (g graph, H help).", Run: cmdVector},
-		{Name: "gpio", Aliases: []string{"scope", "sigview"}, Usage: "gpio", Desc: "GPIO / Signal Viewer (Tab modes, r run, q exit).", Run: cmdGPIOScope},
-		{Name: "snake", Usage: "snake", Desc: "Snake game (arrows move, p pause, r restart, q quit).", Run: cmdSnake},
-		{Name: "tetris", Usage: "tetris", Desc: "Tetris (arrows move, z/x rotate, c drop, p pause, r restart, q quit).", Run: cmdTetris},
-		{Name: "cal", Aliases: []string{"calendar"}, Usage: "cal [YYYY-MM[-DD]]", Desc: "Calendar (arrows move, Enter day view, a add, d delete, n/b month, q quit).", Run: cmdCalendar},
-		{Name: "todo", Usage: "todo [all|open|done|search]", Desc: "TODO list (a add, e edit, d delete, p prio, f filter, / search).", Run: cmdTodo},
-		{Name: "arc", Aliases: []string{"archive"}, Usage: "arc <file>", Desc: "Archive manager (tar/zip; x extract, c create).", Run: cmdArchive},
-		{Name: "tea", Usage: "tea [file|dir]", Desc: "TEA audio player (Enter play, Space pause, s stop, +/- volume).", Run: cmdTEA},
-		{Name: "rtdemo", Usage: "rtdemo [on|off]", Desc: "Start raytracing demo (exit with q/ESC).", Run: cmdRTDemo},
-		{Name: "rtvoxel", Usage: "rtvoxel [on|off]", Desc: "Start voxel world demo (exit with q/ESC).", Run: cmdRTVoxel},
-		{Name: "imgview", Usage: "imgview <file>", Desc: "View an image (BMP/PNG/JPEG; q/ESC to exit).", Run: cmdImgView},
-		{Name: "rf", Usage: "rf", Desc: "2.4 GHz RF Analyzer (nRF24 scan + waterfall + sniffer).", Run: cmdRFAnalyzer},
-		{Name: "fbtest", Usage: "fbtest", Desc: "Framebuffer benchmark (r rerun, q quit).", Run: cmdFBTest},
-		{Name: "serial", Usage: "serial", Desc: "Serial terminal (Ctrl+Q exit, Ctrl+R clear).", Run: cmdSerial},
-		{Name: "users", Usage: "users", Desc: "User manager (admin only; n new, p password, r role, h home).", Run: cmdUsers},
-		{Name: "donut", Usage: "donut", Desc: "QuarkGL 3D donut demo (q/ESC exit, w wireframe).", Run: cmdDonut},
-	} {
-		if err := r.register(cmd); err != nil {
+	for _, d := range apps.All() {
+		if err := r.register(command{
+			Name:    d.Name,
+			Aliases: d.Aliases,
+			Usage:   d.Usage,
+			Desc:    d.Desc,
+			Run:     appCommand(d),
+		}); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func cmdRFAnalyzer(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
-	if len(args) != 0 {
-		return errors.New("usage: rf")
+// appCommand selects the app with the argument built by its Args hook and
+// gives it the focus.
+func appCommand(d apps.Descriptor) cmdFunc {
+	parse := d.Args
+	if parse == nil {
+		parse = apps.NoArgs
 	}
-	if err := s.sendToMux(ctx, proto.MsgAppSelect, proto.AppSelectPayload(proto.AppRFAnalyzer, "")); err != nil {
-		return err
-	}
-	return s.sendToMux(ctx, proto.MsgAppControl, proto.AppControlPayload(true))
-}
-
-func cmdVi(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
-	if !vitask.Enabled {
-		return errors.New("not enabled in this build (build with -tags spark_vi)")
-	}
-
-	var target string
-	if len(args) == 1 {
-		target = s.absPath(args[0])
-	} else if len(args) > 1 {
-		return errors.New("usage: vi [file]")
-	}
-
-	if err := s.sendToMux(ctx, proto.MsgAppSelect, proto.AppSelectPayload(proto.AppVi, target)); err != nil {
-		return err
-	}
-	return s.sendToMux(ctx, proto.MsgAppControl, proto.AppControlPayload(true))
-}
-
-func cmdMC(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
-	var target string
-	if len(args) == 1 {
-		target = s.absPath(args[0])
-	} else if len(args) > 1 {
-		return errors.New("usage: mc [dir]")
-	} else {
-		target = s.cwd
-	}
-
-	if err := s.sendToMux(ctx, proto.MsgAppSelect, proto.AppSelectPayload(proto.AppMC, target)); err != nil {
-		return err
-	}
-	return s.sendToMux(ctx, proto.MsgAppControl, proto.AppControlPayload(true))
-}
-
-func cmdBasic(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
-	var arg string
-	switch len(args) {
-	case 0:
-		arg = ""
-	case 1:
-		arg = s.absPath(args[0])
-	case 2:
-		if args[0] != "run" {
-			return errors.New("usage: basic [file] | basic run <file>")
+	return func(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
+		arg, activate, err := parse(appShell{ctx: ctx, s: s}, args)
+		if errors.Is(err, apps.ErrUsage) {
+			return errors.New("usage: " + d.Usage)
 		}
-		arg = "run:" + s.absPath(args[1])
-	default:
-		return errors.New("usage: basic [file] | basic run <file>")
-	}
-	if err := s.sendToMux(ctx, proto.MsgAppSelect, proto.AppSelectPayload(proto.AppBasic, arg)); err != nil {
-		return err
-	}
-	return s.sendToMux(ctx, proto.MsgAppControl, proto.AppControlPayload(true))
-}
-
-func cmdHex(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
-	if len(args) != 1 {
-		return errors.New("usage: hex <file>")
-	}
-	target := s.absPath(args[0])
-
-	if err := s.sendToMux(ctx, proto.MsgAppSelect, proto.AppSelectPayload(proto.AppHex, target)); err != nil {
-		return err
-	}
-	return s.sendToMux(ctx, proto.MsgAppControl, proto.AppControlPayload(true))
-}
-
-func cmdVector(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
-	var expr string
-	if len(args) > 0 {
-		expr = strings.Join(args, " ")
-	}
-
-	if err := s.sendToMux(ctx, proto.MsgAppSelect, proto.AppSelectPayload(proto.AppVector, expr)); err != nil {
-		return err
-	}
-	return s.sendToMux(ctx, proto.MsgAppControl, proto.AppControlPayload(true))
-}
-
-func cmdGPIOScope(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
-	if len(args) != 0 {
-		return errors.New("usage: gpio")
-	}
-	if err := s.sendToMux(ctx, proto.MsgAppSelect, proto.AppSelectPayload(proto.AppGPIOScope, "")); err != nil {
-		return err
-	}
-	return s.sendToMux(ctx, proto.MsgAppControl, proto.AppControlPayload(true))
-}
-
-func cmdFBTest(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
-	if len(args) != 0 {
-		return errors.New("usage: fbtest")
-	}
-	if err := s.sendToMux(ctx, proto.MsgAppSelect, proto.AppSelectPayload(proto.AppFBTest, "")); err != nil {
-		return err
-	}
-	return s.sendToMux(ctx, proto.MsgAppControl, proto.AppControlPayload(true))
-}
-
-func cmdSerial(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
-	if len(args) != 0 {
-		return errors.New("usage: serial")
-	}
-	if err := s.sendToMux(ctx, proto.MsgAppSelect, proto.AppSelectPayload(proto.AppSerialTerm, "")); err != nil {
-		return err
-	}
-	return s.sendToMux(ctx, proto.MsgAppControl, proto.AppControlPayload(true))
-}
-
-func cmdUsers(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
-	if len(args) != 0 {
-		return errors.New("usage: users")
-	}
-	arg := ""
-	if s.userRole != userdb.RoleAdmin {
-		arg = "ro"
-		_ = s.printString(ctx, "users: read-only (use `su root` for admin)\n")
-	}
-	if err := s.sendToMux(ctx, proto.MsgAppSelect, proto.AppSelectPayload(proto.AppUsers, arg)); err != nil {
-		return err
-	}
-	return s.sendToMux(ctx, proto.MsgAppControl, proto.AppControlPayload(true))
-}
-
-func cmdDonut(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
-	if len(args) != 0 {
-		return errors.New("usage: donut")
-	}
-	if err := s.sendToMux(ctx, proto.MsgAppSelect, proto.AppSelectPayload(proto.AppQuarkDonut, "")); err != nil {
-		return err
-	}
-	return s.sendToMux(ctx, proto.MsgAppControl, proto.AppControlPayload(true))
-}
-
-func cmdSnake(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
-	if len(args) != 0 {
-		return errors.New("usage: snake")
-	}
-	if err := s.sendToMux(ctx, proto.MsgAppSelect, proto.AppSelectPayload(proto.AppSnake, "")); err != nil {
-		return err
-	}
-	return s.sendToMux(ctx, proto.MsgAppControl, proto.AppControlPayload(true))
-}
-
-func cmdTetris(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
-	if len(args) != 0 {
-		return errors.New("usage: tetris")
-	}
-	if err := s.sendToMux(ctx, proto.MsgAppSelect, proto.AppSelectPayload(proto.AppTetris, "")); err != nil {
-		return err
-	}
-	return s.sendToMux(ctx, proto.MsgAppControl, proto.AppControlPayload(true))
-}
-
-func cmdCalendar(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
-	var arg string
-	if len(args) == 1 {
-		arg = args[0]
-	} else if len(args) > 1 {
-		return errors.New("usage: cal [YYYY-MM[-DD]]")
-	}
-
-	if err := s.sendToMux(ctx, proto.MsgAppSelect, proto.AppSelectPayload(proto.AppCalendar, arg)); err != nil {
-		return err
-	}
-	return s.sendToMux(ctx, proto.MsgAppControl, proto.AppControlPayload(true))
-}
-
-func cmdTodo(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
-	var arg string
-	if len(args) == 1 {
-		arg = args[0]
-	} else if len(args) > 1 {
-		return errors.New("usage: todo [all|open|done|search]")
-	}
-
-	if err := s.sendToMux(ctx, proto.MsgAppSelect, proto.AppSelectPayload(proto.AppTodo, arg)); err != nil {
-		return err
-	}
-	return s.sendToMux(ctx, proto.MsgAppControl, proto.AppControlPayload(true))
-}
-
-func cmdArchive(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
-	if len(args) != 1 {
-		return errors.New("usage: arc <file>")
-	}
-	target := s.absPath(args[0])
-
-	if err := s.sendToMux(ctx, proto.MsgAppSelect, proto.AppSelectPayload(proto.AppArchive, target)); err != nil {
-		return err
-	}
-	return s.sendToMux(ctx, proto.MsgAppControl, proto.AppControlPayload(true))
-}
-
-func cmdTEA(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
-	var target string
-	if len(args) == 1 {
-		target = s.absPath(args[0])
-	} else if len(args) > 1 {
-		return errors.New("usage: tea [file|dir]")
-	}
-
-	if err := s.sendToMux(ctx, proto.MsgAppSelect, proto.AppSelectPayload(proto.AppTEA, target)); err != nil {
-		return err
-	}
-	return s.sendToMux(ctx, proto.MsgAppControl, proto.AppControlPayload(true))
-}
-
-func cmdRTDemo(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
-	active := true
-	if len(args) == 1 {
-		switch args[0] {
-		case "on":
-			active = true
-		case "off":
-			active = false
-		default:
-			return errors.New("usage: rtdemo [on|off]")
-		}
-	} else if len(args) > 1 {
-		return errors.New("usage: rtdemo [on|off]")
-	}
-
-	if active {
-		if err := s.sendToMux(ctx, proto.MsgAppSelect, proto.AppSelectPayload(proto.AppRTDemo, "")); err != nil {
+		if err != nil {
 			return err
 		}
-	}
-	return s.sendToMux(ctx, proto.MsgAppControl, proto.AppControlPayload(active))
-}
 
-func cmdRTVoxel(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
-	active := true
-	if len(args) == 1 {
-		switch args[0] {
-		case "on":
-			active = true
-		case "off":
-			active = false
-		default:
-			return errors.New("usage: rtvoxel [on|off]")
+		if activate {
+			if err := s.selectApp(ctx, d.ID, arg); err != nil {
+				return err
+			}
+			if d.Files && strings.HasPrefix(arg, "/") && s.vfsCap.Valid() {
+				_ = apps.AddRecent(ctx, s.vfsClient(), apps.Recent{App: d.Name, Path: arg})
+			}
 		}
-	} else if len(args) > 1 {
-		return errors.New("usage: rtvoxel [on|off]")
+		return s.sendToMux(ctx, proto.MsgAppControl, proto.AppControlPayload(activate))
 	}
-
-	if active {
-		if err := s.sendToMux(ctx, proto.MsgAppSelect, proto.AppSelectPayload(proto.AppRTVoxel, "")); err != nil {
-			return err
-		}
-	}
-	return s.sendToMux(ctx, proto.MsgAppControl, proto.AppControlPayload(active))
 }
 
-func cmdImgView(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
-	if len(args) != 1 {
-		return errors.New("usage: imgview <file>")
-	}
-	target := s.absPath(args[0])
-
-	if err := s.sendToMux(ctx, proto.MsgAppSelect, proto.AppSelectPayload(proto.AppImgView, target)); err != nil {
-		return err
-	}
-	return s.sendToMux(ctx, proto.MsgAppControl, proto.AppControlPayload(true))
+// appShell is the apps.Shell view of the shell running an app command.
+type appShell struct {
+	ctx *kernel.Context
+	s   *Service
 }
+
+func (a appShell) AbsPath(p string) string { return a.s.absPath(p) }
+func (a appShell) Cwd() string             { return a.s.cwd }
+func (a appShell) Admin() bool             { return a.s.userRole == userdb.RoleAdmin }
+func (a appShell) Notice(line string)      { _ = a.s.printString(a.ctx, line+"\n") }
@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"path"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"spark/sparkos/internal/userdb"
 	"spark/sparkos/kernel"
 	"spark/sparkos/proto"
 )
@@ -24,8 +27,13 @@ func registerFSCommands(r *registry) error {
 		{Name: "rm", Usage: "rm [-rf] <path...>", Desc: "Remove files or directories.", Run: cmdRm},
 		{Name: "find", Usage: "find [path]", Desc: "List paths recursively.", Run: cmdFind},
 		{Name: "stat", Usage: "stat <path>", Desc: "Show file metadata.", Run: cmdStat},
+		{Name: "chmod", Usage: "chmod <mode> <path...>", Desc: "Set permission bits (octal).", Run: cmdChmod},
+		{Name: "chown", Usage: "chown <user[:group]> <path...>", Desc: "Set owner and group.", Run: cmdChown},
 		{Name: "cat", Usage: "cat <path...>", Desc: "Print files.", Run: cmdCat},
 		{Name: "put", Usage: "put <path> <data...>", Desc: "Write bytes to a file.", Run: cmdPut},
+		{Name: "mount", Usage: "mount [<source> <path>]", Desc: "Mount a filesystem or list mounts.", Run: cmdMount},
+		{Name: "umount", Usage: "umount <path>", Desc: "Unmount a filesystem.", Run: cmdUmount},
+		{Name: "df", Usage: "df [-h]", Desc: "Show filesystem usage.", Run: cmdDf},
 	} {
 		if err := r.register(cmd); err != nil {
 			return err
@@ -64,6 +72,12 @@ func cmdRm(ctx *kernel.Context, s *Service, args []string, _ redirection) error
 func cmdStat(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
 	return s.stat(ctx, args)
 }
+func cmdChmod(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
+	return s.chmod(ctx, args)
+}
+func cmdChown(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
+	return s.chown(ctx, args)
+}
 func cmdCat(ctx *kernel.Context, s *Service, args []string, redir redirection) error {
 	return s.cat(ctx, args, redir)
 }
@@ -71,6 +85,16 @@ func cmdPut(ctx *kernel.Context, s *Service, args []string, _ redirection) error
 	return s.put(ctx, args)
 }
 
+func cmdMount(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
+	return s.mount(ctx, args)
+}
+func cmdUmount(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
+	return s.umount(ctx, args)
+}
+func cmdDf(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
+	return s.df(ctx, args)
+}
+
 func (s *Service) cd(ctx *kernel.Context, args []string) error {
 	target := "/"
 	if len(args) == 1 {
@@ -117,18 +141,14 @@ func (s *Service) ls(ctx *kernel.Context, args []string) error {
 		return err
 	}
 
+	var owners map[uint32]string
+	if long {
+		owners = s.userNames(ctx)
+	}
+
 	sort.Slice(ents, func(i, j int) bool { return ents[i].Name < ents[j].Name })
 	for _, e := range ents {
 		name := e.Name
-		mode := "----------"
-		if e.Type == proto.VFSEntryDir {
-			mode = "drwxr-xr-x"
-		} else if e.Type == proto.VFSEntryFile {
-			mode = "-rw-r--r--"
-		} else {
-			mode = "?---------"
-		}
-
 		if !long {
 			if err := s.printString(ctx, name+"\n"); err != nil {
 				return err
@@ -136,7 +156,13 @@ func (s *Service) ls(ctx *kernel.Context, args []string) error {
 			continue
 		}
 
-		if err := s.printString(ctx, fmt.Sprintf("%s %5d %s\n", mode, e.Size, name)); err != nil {
+		owner, ok := owners[e.UID]
+		if !ok {
+			owner = fmt.Sprint(e.UID)
+		}
+		line := fmt.Sprintf("%s %-8s %-6s %5d %16s %s\n",
+			fmtMode(e.Type, e.Mode), owner, userdb.GroupName(e.GID), e.Size, fmtTime(e.Mtime), name)
+		if err := s.printString(ctx, line); err != nil {
 			return err
 		}
 	}
@@ -352,18 +378,113 @@ func (s *Service) stat(ctx *kernel.Context, args []string) error {
 	if len(args) != 1 {
 		return errors.New("usage: stat <path>")
 	}
-	typ, size, err := s.vfsClient().Stat(ctx, s.absPath(args[0]))
+	e, err := s.vfsClient().StatEntry(ctx, s.absPath(args[0]))
 	if err != nil {
 		return err
 	}
 	t := "?"
-	switch typ {
+	switch e.Type {
 	case proto.VFSEntryFile:
 		t = "file"
 	case proto.VFSEntryDir:
 		t = "dir"
 	}
-	return s.printString(ctx, fmt.Sprintf("%s size=%d\n", t, size))
+	return s.printString(ctx, fmt.Sprintf("%s size=%d uid=%d gid=%d mode=%s\nmodified: %s\ncreated:  %s\n",
+		t, e.Size, e.UID, e.GID, fmtMode(e.Type, e.Mode), fmtTime(e.Mtime), fmtTime(e.Ctime)))
+}
+
+// fmtMode formats an entry type and permission bits as drwxr-xr-x.
+func fmtMode(typ proto.VFSEntryType, mode uint16) string {
+	b := []byte("?rwxrwxrwx")
+	switch typ {
+	case proto.VFSEntryFile:
+		b[0] = '-'
+	case proto.VFSEntryDir:
+		b[0] = 'd'
+	}
+	for i := 0; i < 9; i++ {
+		if mode&(1<<(8-i)) == 0 {
+			b[1+i] = '-'
+		}
+	}
+	if mode&proto.VFSModeSticky != 0 {
+		if b[9] == 'x' {
+			b[9] = 't'
+		} else {
+			b[9] = 'T'
+		}
+	}
+	return string(b)
+}
+
+// userNames maps the uids of the users database to names, for display. It
+// is empty if the database cannot be read.
+func (s *Service) userNames(ctx *kernel.Context) map[uint32]string {
+	names := make(map[uint32]string)
+	users, ok, err := s.loadUsers(ctx)
+	if err != nil || !ok {
+		return names
+	}
+	for _, u := range users {
+		names[u.UID] = u.Name
+	}
+	return names
+}
+
+func (s *Service) chmod(ctx *kernel.Context, args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: chmod <mode> <path...>")
+	}
+	mode, err := strconv.ParseUint(args[0], 8, 16)
+	if err != nil || mode > 0o777|proto.VFSModeSticky {
+		return errors.New("mode must be octal, 0 to 1777")
+	}
+	for _, p := range args[1:] {
+		if err := s.vfsClient().Chmod(ctx, s.absPath(p), uint16(mode)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) chown(ctx *kernel.Context, args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: chown <user[:group]> <path...>")
+	}
+	userName, groupName, hasGroup := strings.Cut(args[0], ":")
+	users, _, err := s.loadUsers(ctx)
+	if err != nil {
+		return err
+	}
+	var uid, gid uint32
+	if rec, ok := userdb.Find(users, userName); ok {
+		uid, gid = rec.UID, rec.GID()
+	} else if n, err := strconv.ParseUint(userName, 10, 32); err == nil {
+		uid, gid = uint32(n), userdb.GroupUsers
+	} else {
+		return errors.New("unknown user: " + userName)
+	}
+	if hasGroup {
+		g, ok := userdb.ParseGroup(groupName)
+		if !ok {
+			return errors.New("unknown group: " + groupName)
+		}
+		gid = g
+	}
+	for _, p := range args[1:] {
+		if err := s.vfsClient().Chown(ctx, s.absPath(p), uid, gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fmtTime formats a file timestamp, "-" if the filesystem does not keep it.
+func fmtTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04")
 }
 
 func (s *Service) cat(ctx *kernel.Context, args []string, redir redirection) error {
@@ -444,3 +565,70 @@ func (s *Service) put(ctx *kernel.Context, args []string) error {
 	_, err := s.vfsClient().Write(ctx, path, proto.VFSWriteTruncate, data)
 	return err
 }
+
+func (s *Service) mount(ctx *kernel.Context, args []string) error {
+	switch len(args) {
+	case 0:
+		mounts, err := s.vfsClient().Mounts(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range mounts {
+			_ = s.printString(ctx, fmt.Sprintf("%s on %s type %s\n", m.Source, m.Path, m.Type))
+		}
+		return nil
+	case 2:
+		return s.vfsClient().Mount(ctx, args[0], s.absPath(args[1]))
+	default:
+		return errors.New("usage: mount [<source> <path>]")
+	}
+}
+
+func (s *Service) umount(ctx *kernel.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: umount <path>")
+	}
+	return s.vfsClient().Unmount(ctx, s.absPath(args[0]))
+}
+
+func (s *Service) df(ctx *kernel.Context, args []string) error {
+	human := false
+	if len(args) == 1 && args[0] == "-h" {
+		human = true
+	} else if len(args) != 0 {
+		return errors.New("usage: df [-h]")
+	}
+
+	mounts, err := s.vfsClient().Mounts(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmtVal := func(v uint64) string {
+		if human {
+			return fmtBytes(v)
+		}
+		return fmt.Sprintf("%d", v/1024)
+	}
+
+	size := "1K-blocks"
+	if human {
+		size = "Size"
+	}
+	_ = s.printString(ctx, fmt.Sprintf("%-10s %10s %10s %10s %4s %s\n", "Filesystem", size, "Used", "Avail", "Use%", "Mounted on"))
+	for _, m := range mounts {
+		total, used, avail, pct := "-", "-", "-", "-"
+		if m.HasUsage {
+			free := uint64(0)
+			if m.Total >= m.Used {
+				free = m.Total - m.Used
+			}
+			total, used, avail = fmtVal(m.Total), fmtVal(m.Used), fmtVal(free)
+			if m.Total > 0 {
+				pct = fmt.Sprintf("%d%%", (m.Used*100+m.Total-1)/m.Total)
+			}
+		}
+		_ = s.printString(ctx, fmt.Sprintf("%-10s %10s %10s %10s %4s %s\n", m.Source, total, used, avail, pct, m.Path))
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ func (s *Service) initRegistry() error {
 		registerCoreCommands,
 		registerDebugCommands,
 		registerSysCommands,
+		registerSvcCommands,
 		registerFSCommands,
 		registerTextCommands,
 		registerAppCommands,
@@ -25,6 +26,7 @@ func (s *Service) initRegistryMinimal() error {
 	r := newRegistry()
 	for _, register := range []func(r *registry) error{
 		registerCoreCommands,
+		registerSvcCommands,
 		registerTextCommands,
 	} {
 		if err := register(r); err != nil {
@@ -4,13 +4,19 @@ import (
 	"errors"
 	"fmt"
 	"runtime"
+	"sort"
 	"strconv"
+	"strings"
 
 	"spark/internal/buildinfo"
+	"spark/sparkos/apps"
 	consolemuxclient "spark/sparkos/client/consolemux"
+	notifyclient "spark/sparkos/client/notify"
+	supervisorclient "spark/sparkos/client/supervisor"
 	timeclient "spark/sparkos/client/time"
 	"spark/sparkos/kernel"
 	"spark/sparkos/proto"
+	"spark/sparkos/trace"
 )
 
 func registerSysCommands(r *registry) error {
@@ -21,8 +27,14 @@ func registerSysCommands(r *registry) error {
 		{Name: "version", Usage: "version", Desc: "Show build version.", Run: cmdVersion},
 		{Name: "uname", Usage: "uname [-a]", Desc: "Show system information.", Run: cmdUname},
 		{Name: "free", Usage: "free [-h]", Desc: "Show memory usage.", Run: cmdFree},
+		{Name: "ps", Usage: "ps", Desc: "List tasks and what they wait on.", Run: cmdPs},
+		{Name: "ipcs", Usage: "ipcs", Desc: "List IPC endpoints and queue counters.", Run: cmdIpcs},
+		{Name: "top", Usage: "top [ticks]", Desc: "Show per-task message activity over an interval.", Run: cmdTop},
+		{Name: "trace", Usage: "trace start [n]|stop|show [n]|dump <path>", Desc: "Record IPC messages into a ring buffer.", Run: cmdTrace},
 		{Name: "mux", Usage: "mux", Desc: "Show consolemux status (active app + focus).", Run: cmdMux},
 		{Name: "focus", Usage: "focus [app|shell|toggle]", Desc: "Switch focus between shell and app.", Run: cmdFocus},
+		{Name: "vc", Usage: "vc [n|app|shell]", Desc: "List virtual consoles or switch to one (Ctrl+N cycles).", Run: cmdVc},
+		{Name: "notify", Usage: "notify [-w|-e] [text]", Desc: "Post a notification, or list recent ones.", Run: cmdNotify},
 	} {
 		if err := r.register(cmd); err != nil {
 			return err
@@ -65,8 +77,6 @@ func cmdUname(ctx *kernel.Context, s *Service, args []string, _ redirection) err
 }
 
 func cmdFree(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
-	_ = ctx
-
 	human := false
 	if len(args) == 1 {
 		if args[0] != "-h" {
@@ -102,9 +112,254 @@ func cmdFree(ctx *kernel.Context, s *Service, args []string, _ redirection) erro
 	_ = s.printString(ctx, "           total       used       free\n")
 	_ = s.printString(ctx, fmt.Sprintf("heap %11s %10s %10s\n", fmtVal(heapTotal), fmtVal(heapUsed), fmtVal(heapFree)))
 	_ = s.printString(ctx, fmt.Sprintf("sys  %11s %10s %10s\n", fmtVal(ms.Sys), fmtVal(ms.Alloc), fmtVal(sysFree)))
+
+	// tmpfs mounts hold their files in RAM too.
+	if !s.vfsCap.Valid() {
+		return nil
+	}
+	mounts, err := s.vfsClient().Mounts(ctx)
+	if err != nil {
+		return nil
+	}
+	for _, m := range mounts {
+		if m.Type != "tmpfs" || !m.HasUsage {
+			continue
+		}
+		tmpFree := uint64(0)
+		if m.Total >= m.Used {
+			tmpFree = m.Total - m.Used
+		}
+		_ = s.printString(ctx, fmt.Sprintf("tmp  %11s %10s %10s %s\n", fmtVal(m.Total), fmtVal(m.Used), fmtVal(tmpFree), m.Path))
+	}
+	return nil
+}
+
+func cmdPs(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
+	if len(args) != 0 {
+		return errors.New("usage: ps")
+	}
+	_ = s.printString(ctx, "  ID PPID STATE  WAIT  EP      SHM NAME\n")
+	for _, t := range ctx.Tasks() {
+		_ = s.printString(ctx, fmt.Sprintf("%4d %4s %-6s %4s %3d %8s %s\n",
+			t.ID, fmtTaskID(t.Parent), t.State, fmtWait(t), t.Endpoints, fmtBytes(uint64(t.RegionBytes)), t.Name))
+	}
+	return nil
+}
+
+// registerSvcCommands is shared with the minimal registry: service status is
+// most useful exactly when the rest of the system is misbehaving.
+func registerSvcCommands(r *registry) error {
+	return r.register(command{Name: "svc", Usage: "svc", Desc: "Show supervised services and their restarts.", Run: cmdSvc})
+}
+
+func cmdSvc(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
+	if len(args) != 0 {
+		return errors.New("usage: svc")
+	}
+	if !s.svcCap.Valid() {
+		return errors.New("svc: no supervisor capability")
+	}
+	svcs, err := supervisorclient.List(ctx, s.svcCap)
+	if err != nil {
+		return err
+	}
+	_ = s.printString(ctx, "NAME       STATE   POLICY    TASK RESTARTS LAST\n")
+	for _, st := range svcs {
+		last := "-"
+		if st.Restarts > 0 || st.State != proto.SvcRunning {
+			last = st.LastExit.String()
+		}
+		_ = s.printString(ctx, fmt.Sprintf("%-10s %-7s %-9s %4s %8d %s\n",
+			st.Name, st.State, st.Policy, fmtTaskID(kernel.TaskID(st.Task)), st.Restarts, last))
+	}
+	return nil
+}
+
+func cmdIpcs(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
+	if len(args) != 0 {
+		return errors.New("usage: ipcs")
+	}
+	_ = s.printString(ctx, "  EP  GEN OWNER RECV DEPTH   Q  HW   SENT  DROP FLAGS\n")
+	for _, ep := range ctx.Endpoints() {
+		flags := ""
+		if ep.Urgent {
+			flags += "u"
+		}
+		if ep.OneShot {
+			flags += "1"
+		}
+		if flags == "" {
+			flags = "-"
+		}
+		_ = s.printString(ctx, fmt.Sprintf("%4d %4d %5s %4s %5d %3d %3d %6d %5d %s\n",
+			ep.ID, ep.Gen, fmtTaskID(ep.Owner), fmtTaskID(ep.Receiver),
+			ep.Depth, ep.Queued, ep.HighWater, ep.Sent, ep.Dropped, flags))
+	}
 	return nil
 }
 
+// cmdTop samples the task counters twice and shows the busiest tasks of the interval.
+func cmdTop(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
+	interval := uint64(1000)
+	if len(args) == 1 {
+		v, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil || v == 0 {
+			return errors.New("top: invalid ticks")
+		}
+		interval = v
+	} else if len(args) > 1 {
+		return errors.New("usage: top [ticks]")
+	}
+	if !s.timeCap.Valid() {
+		return errors.New("top: no time capability")
+	}
+
+	before := make(map[kernel.TaskID]kernel.TaskInfo)
+	for _, t := range ctx.Tasks() {
+		before[t.ID] = t
+	}
+	if err := timeclient.Sleep(ctx, s.timeCap, uint32(interval)); err != nil {
+		return err
+	}
+
+	type row struct {
+		info                kernel.TaskInfo
+		sent, recv, dropped uint32
+		busy, samples       uint32
+	}
+	var rows []row
+	for _, t := range ctx.Tasks() {
+		r := row{info: t, sent: t.Sent, recv: t.Received, dropped: t.Dropped, busy: t.Busy, samples: t.Samples}
+		if prev, ok := before[t.ID]; ok && prev.Name == t.Name {
+			r.sent -= prev.Sent
+			r.recv -= prev.Received
+			r.dropped -= prev.Dropped
+			r.busy -= prev.Busy
+			r.samples -= prev.Samples
+		}
+		rows = append(rows, r)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].sent+rows[i].recv > rows[j].sent+rows[j].recv
+	})
+
+	_ = s.printString(ctx, fmt.Sprintf("%d tasks, %d ticks\n", len(rows), interval))
+	_ = s.printString(ctx, "  ID STATE    SENT   RECV  DROP BUSY NAME\n")
+	for _, r := range rows {
+		busy := 0
+		if r.samples > 0 {
+			busy = int(uint64(r.busy) * 100 / uint64(r.samples))
+		}
+		_ = s.printString(ctx, fmt.Sprintf("%4d %-6s %6d %6d %5d %3d%% %s\n", r.info.ID, r.info.State, r.sent, r.recv, r.dropped, busy, r.info.Name))
+	}
+	return nil
+}
+
+func cmdTrace(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
+	const usage = "usage: trace start [n]|stop|show [n]|dump <path>"
+	if len(args) == 0 {
+		state := "off"
+		if ctx.Tracing() {
+			state = "on"
+		}
+		_ = s.printString(ctx, fmt.Sprintf("tracing %s, %d events\n", state, len(ctx.TraceEvents())))
+		return nil
+	}
+
+	switch args[0] {
+	case "start":
+		n := 0
+		if len(args) > 2 {
+			return errors.New(usage)
+		}
+		if len(args) == 2 {
+			v, err := strconv.Atoi(args[1])
+			if err != nil || v <= 0 {
+				return errors.New("trace: invalid event count")
+			}
+			n = v
+		}
+		ctx.StartTrace(n)
+		return nil
+	case "stop":
+		if len(args) != 1 {
+			return errors.New(usage)
+		}
+		ctx.StopTrace()
+		return nil
+	case "show":
+		events := ctx.TraceEvents()
+		if len(args) == 2 {
+			v, err := strconv.Atoi(args[1])
+			if err != nil || v <= 0 {
+				return errors.New("trace: invalid event count")
+			}
+			if v < len(events) {
+				events = events[len(events)-v:]
+			}
+		} else if len(args) > 2 {
+			return errors.New(usage)
+		}
+		for _, ev := range events {
+			_ = s.printString(ctx, trace.Format(ev)+"\n")
+		}
+		return nil
+	case "dump":
+		if len(args) != 2 {
+			return errors.New(usage)
+		}
+		if !s.vfsCap.Valid() {
+			return errors.New("trace: dump needs VFS")
+		}
+		events := ctx.TraceEvents()
+		w, err := s.vfsClient().OpenWriter(ctx, s.absPath(args[1]), proto.VFSWriteTruncate)
+		if err != nil {
+			return err
+		}
+		if err := trace.Encode(w, s.traceHeader(), events); err != nil {
+			_, _ = w.Close()
+			return err
+		}
+		if _, err := w.Close(); err != nil {
+			return err
+		}
+		_ = s.printString(ctx, fmt.Sprintf("%d events\n", len(events)))
+		return nil
+	default:
+		return errors.New(usage)
+	}
+}
+
+// traceHeader describes the profile this shell was booted with, so that a
+// replay of a dump boots the same one.
+func (s *Service) traceHeader() trace.Header {
+	h := trace.Header{Console: s.inCap.Endpoint()}
+	if s.muxCap.Valid() {
+		h.Profile |= trace.ProfileFull
+		h.Console = s.muxCap.Endpoint()
+	}
+	if s.homeApp == proto.AppLauncher {
+		h.Profile |= trace.ProfileLauncher
+	}
+	return h
+}
+
+func fmtTaskID(id kernel.TaskID) string {
+	if id == kernel.NoTask {
+		return "-"
+	}
+	return strconv.Itoa(int(id))
+}
+
+func fmtWait(t kernel.TaskInfo) string {
+	switch t.State {
+	case kernel.TaskRecv, kernel.TaskSend, kernel.TaskCall:
+		return fmt.Sprintf("ep%d", t.BlockedOn)
+	default:
+		return "-"
+	}
+}
+
 func cmdMux(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
 	if len(args) != 0 {
 		return errors.New("usage: mux")
@@ -160,6 +415,75 @@ func cmdFocus(ctx *kernel.Context, s *Service, args []string, _ redirection) err
 	}
 }
 
+func cmdVc(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
+	if len(args) > 1 {
+		return errors.New("usage: vc [n|app|shell]")
+	}
+	st, err := consolemuxclient.GetStatus(ctx, s.muxCap)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		mark := func(focused bool) string {
+			if focused {
+				return "*"
+			}
+			return " "
+		}
+		_ = s.printString(ctx, fmt.Sprintf("%s0 shell\n", mark(!st.FocusApp)))
+		for i, id := range st.Consoles {
+			_ = s.printString(ctx, fmt.Sprintf("%s%d %s\n", mark(st.FocusApp && id == st.ActiveApp), i+1, appLabel(id)))
+		}
+		return nil
+	}
+
+	target := proto.AppNone
+	if n, err := strconv.Atoi(args[0]); err == nil {
+		if n < 0 || n > len(st.Consoles) {
+			return fmt.Errorf("vc: no console %d", n)
+		}
+		if n > 0 {
+			target = st.Consoles[n-1]
+		}
+	} else if args[0] != "shell" {
+		d, ok := apps.ByName(args[0])
+		if !ok {
+			return fmt.Errorf("vc: unknown app %q", args[0])
+		}
+		target = d.ID
+	}
+	return s.sendToMux(ctx, proto.MsgMuxSwitch, proto.MuxSwitchPayload(target))
+}
+
+func cmdNotify(ctx *kernel.Context, s *Service, args []string, _ redirection) error {
+	if !s.notifyCap.Valid() {
+		return errors.New("notify: no notification service")
+	}
+	if len(args) == 0 {
+		entries, err := notifyclient.List(ctx, s.notifyCap)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			_ = s.printString(ctx, fmt.Sprintf("%10d %-5s %s\n", e.Tick, e.Severity, e.Text))
+		}
+		return nil
+	}
+
+	sev := proto.SeverityInfo
+	switch args[0] {
+	case "-w":
+		sev, args = proto.SeverityWarn, args[1:]
+	case "-e":
+		sev, args = proto.SeverityError, args[1:]
+	}
+	if len(args) == 0 {
+		return errors.New("usage: notify [-w|-e] [text]")
+	}
+	return notifyclient.Post(ctx, s.notifyCap, sev, 0, strings.Join(args, " "))
+}
+
 func appLabel(id proto.AppID) string {
 	if name := appCommandName(id); name != "" {
 		return fmt.Sprintf("%s(%d)", name, id)
@@ -168,52 +492,13 @@ func appLabel(id proto.AppID) string {
 }
 
 func appCommandName(id proto.AppID) string {
-	switch id {
-	case proto.AppNone:
+	if id == proto.AppNone {
 		return "none"
-	case proto.AppRTDemo:
-		return "rtdemo"
-	case proto.AppVi:
-		return "vi"
-	case proto.AppRTVoxel:
-		return "rtvoxel"
-	case proto.AppImgView:
-		return "imgview"
-	case proto.AppMC:
-		return "mc"
-	case proto.AppHex:
-		return "hex"
-	case proto.AppVector:
-		return "vector"
-	case proto.AppSnake:
-		return "snake"
-	case proto.AppTetris:
-		return "tetris"
-	case proto.AppCalendar:
-		return "cal"
-	case proto.AppTodo:
-		return "todo"
-	case proto.AppArchive:
-		return "arc"
-	case proto.AppTEA:
-		return "tea"
-	case proto.AppBasic:
-		return "basic"
-	case proto.AppRFAnalyzer:
-		return "rf"
-	case proto.AppGPIOScope:
-		return "gpio"
-	case proto.AppFBTest:
-		return "fbtest"
-	case proto.AppSerialTerm:
-		return "serial"
-	case proto.AppUsers:
-		return "users"
-	case proto.AppQuarkDonut:
-		return "donut"
-	default:
-		return ""
 	}
+	if d, ok := apps.ByID(id); ok {
+		return d.Name
+	}
+	return ""
 }
 
 func fmtBytes(v uint64) string {
@@ -57,6 +57,7 @@ func cmdSu(ctx *kernel.Context, s *Service, args []string, _ redirection) error
 
 	if s.userRole == userdb.RoleAdmin {
 		s.applyUser(rec)
+		s.beginSession(ctx, rec)
 		_ = s.printString(ctx, s.tabStatusLine())
 		return nil
 	}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"spark/sparkos/apps"
 	"spark/sparkos/kernel"
 )
 
@@ -104,14 +105,9 @@ func argCandidates(cmdName string, argIndex int, argsBefore []string) []string {
 		if argIndex == 0 {
 			return []string{"-a"}
 		}
-	case "todo":
-		if argIndex == 0 {
-			return []string{"all", "open", "done", "search"}
-		}
-	case "rtdemo", "rtvoxel":
-		if argIndex == 0 {
-			return []string{"on", "off"}
-		}
+	}
+	if d, ok := apps.ByName(cmdName); ok && argIndex == 0 {
+		return d.Complete
 	}
 	return nil
 }
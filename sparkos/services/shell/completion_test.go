@@ -1,6 +1,11 @@
 package shell
 
-import "testing"
+import (
+	"testing"
+
+	"spark/sparkos/apps"
+	"spark/sparkos/kernel"
+)
 
 func TestUpdateCompletion_CommandName(t *testing.T) {
 	s := &Service{}
@@ -70,3 +75,32 @@ func TestUpdateCompletion_HelpCompletesCommands(t *testing.T) {
 		t.Fatalf("ghost=%q, want %q", s.ghost, "cus")
 	}
 }
+
+type nopTask struct{}
+
+func (nopTask) Run(*kernel.Context) {}
+
+func TestUpdateCompletion_RegisteredApp(t *testing.T) {
+	apps.Register(apps.Descriptor{
+		Name:     "shelltestgame",
+		Usage:    "shelltestgame [easy|hard]",
+		Args:     apps.OptionalArg,
+		Complete: []string{"easy", "hard"},
+		New:      func(apps.Env) kernel.Task { return nopTask{} },
+	})
+	s := &Service{}
+	if err := s.initRegistry(); err != nil {
+		t.Fatalf("initRegistry: %v", err)
+	}
+	if _, ok := s.reg.resolve("shelltestgame"); !ok {
+		t.Fatal("expected a command for the registered app")
+	}
+
+	s.line = []rune("shelltestgame h")
+	s.cursor = len(s.line)
+	s.updateCompletion()
+
+	if s.compMode != completionArg || s.best != "hard" {
+		t.Fatalf("compMode=%v best=%q, want arg completion %q", s.compMode, s.best, "hard")
+	}
+}
@@ -74,14 +74,29 @@ func (s *Service) sendToTerm(ctx *kernel.Context, kind proto.Kind, payload []byt
 }
 
 func (s *Service) sendToMux(ctx *kernel.Context, kind proto.Kind, payload []byte) error {
+	return s.sendToMuxCap(ctx, kind, payload, kernel.Capability{})
+}
+
+// selectApp opens app id with arg. The app gets the VFS identity of the
+// current user as its "vfs" service.
+func (s *Service) selectApp(ctx *kernel.Context, id proto.AppID, arg string) error {
+	return s.sendToMuxCap(ctx, proto.MsgAppSelect, proto.AppSelectPayload(id, arg), s.appVFSCap())
+}
+
+func (s *Service) sendToMuxCap(ctx *kernel.Context, kind proto.Kind, payload []byte, c kernel.Capability) error {
 	if !s.muxCap.Valid() {
 		return errors.New("no consolemux capability")
 	}
-	res := ctx.SendToCapRetry(s.muxCap, uint16(kind), payload, kernel.Capability{}, 500)
+	var res kernel.SendResult
+	if kind == proto.MsgAppControl || kind == proto.MsgMuxSwitch {
+		res = ctx.SendUrgent(s.muxCap, uint16(kind), payload, c, 500)
+	} else {
+		res = ctx.SendBlocking(s.muxCap, uint16(kind), payload, c, 500)
+	}
 	switch res {
 	case kernel.SendOK:
 		return nil
-	case kernel.SendErrQueueFull:
+	case kernel.SendErrTimeout:
 		if s.logCap.Valid() {
 			_ = logclient.Log(ctx, s.logCap, fmt.Sprintf("shell: consolemux send %s: queue full", kind))
 		}
@@ -6,6 +6,7 @@ import (
 	"unicode/utf8"
 
 	"spark/internal/buildinfo"
+	notifyclient "spark/sparkos/client/notify"
 	vfsclient "spark/sparkos/client/vfs"
 	"spark/sparkos/internal/userdb"
 	"spark/sparkos/kernel"
@@ -17,11 +18,21 @@ type Service struct {
 	termCap kernel.Capability
 	logCap  kernel.Capability
 	vfsCap  kernel.Capability
-	timeCap kernel.Capability
-	muxCap  kernel.Capability
-
-	vfs *vfsclient.Client
-	reg *registry
+	// vfsAuthCap issues the VFS credentials of logged-in users.
+	vfsAuthCap kernel.Capability
+	timeCap    kernel.Capability
+	muxCap     kernel.Capability
+	svcCap     kernel.Capability
+	notifyCap  kernel.Capability
+
+	// homeApp is the app focused after login, proto.AppNone for the shell.
+	homeApp proto.AppID
+
+	// vfs is the system client, used for logins; sessions holds the
+	// credentialed clients of the users logged in, by name.
+	vfs      *vfsclient.Client
+	sessions map[string]*session
+	reg      *registry
 
 	tabs   []tabState
 	tabIdx int
@@ -42,6 +53,8 @@ type Service struct {
 	user     string
 	userRole userdb.Role
 	userHome string
+	// shownUser is the user last sent to the status bar.
+	shownUser string
 
 	hint  string
 	ghost string
@@ -75,8 +88,42 @@ type Service struct {
 	suBlock  uint64
 }
 
+// Options are the services of a Service beyond its input and terminal. An
+// invalid capability is a missing service: without VFS the shell runs without
+// login, without Mux without apps and status bar.
+type Options struct {
+	Log  kernel.Capability
+	VFS  kernel.Capability
+	Time kernel.Capability
+	Mux  kernel.Capability
+	// Svc is the supervisor, for the svc command.
+	Svc    kernel.Capability
+	Notify kernel.Capability
+	// VFSAuth issues the VFS credentials of logged-in users. Without it
+	// every user acts with the VFS identity itself.
+	VFSAuth kernel.Capability
+	// Home is the app focused after login, proto.AppNone for the shell.
+	Home proto.AppID
+}
+
 func New(inCap kernel.Capability, termCap kernel.Capability, logCap kernel.Capability, vfsCap kernel.Capability, timeCap kernel.Capability, muxCap kernel.Capability) *Service {
-	return &Service{inCap: inCap, termCap: termCap, logCap: logCap, vfsCap: vfsCap, timeCap: timeCap, muxCap: muxCap}
+	return NewWith(inCap, termCap, Options{Log: logCap, VFS: vfsCap, Time: timeCap, Mux: muxCap})
+}
+
+// NewWith is New with opts.
+func NewWith(inCap, termCap kernel.Capability, opts Options) *Service {
+	return &Service{
+		inCap:      inCap,
+		termCap:    termCap,
+		logCap:     opts.Log,
+		vfsCap:     opts.VFS,
+		vfsAuthCap: opts.VFSAuth,
+		timeCap:    opts.Time,
+		muxCap:     opts.Mux,
+		svcCap:     opts.Svc,
+		notifyCap:  opts.Notify,
+		homeApp:    opts.Home,
+	}
 }
 
 const (
@@ -151,6 +198,21 @@ func (s *Service) Run(ctx *kernel.Context) {
 			}
 			s.handleFocus(ctx, active)
 		}
+		s.showUser(ctx)
+	}
+}
+
+// showUser tells the status bar about a login, su or tab switch.
+func (s *Service) showUser(ctx *kernel.Context) {
+	user := ""
+	if s.authed {
+		user = s.user
+	}
+	if user == s.shownUser || !s.notifyCap.Valid() {
+		return
+	}
+	if notifyclient.SetUser(ctx, s.notifyCap, user) == nil {
+		s.shownUser = user
 	}
 }
 
@@ -545,6 +607,7 @@ func (s *Service) submit(ctx *kernel.Context) {
 		_ = s.prompt(ctx)
 		return
 	}
+	s.ensureSession(ctx)
 	if err := cmd.Run(ctx, s, args, redirect); err != nil {
 		_ = s.printString(ctx, cmd.Name+": "+err.Error()+"\n")
 	}
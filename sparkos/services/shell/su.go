@@ -140,6 +140,7 @@ func (s *Service) suSubmit(ctx *kernel.Context) {
 	s.suBuf = s.suBuf[:0]
 	if ok {
 		s.applyUser(rec)
+		s.beginSession(ctx, rec)
 		s.suActive = false
 		s.suTarget = ""
 		s.suFails = 0
@@ -1,10 +1,114 @@
 package shell
 
-import vfsclient "spark/sparkos/client/vfs"
+import (
+	pathpkg "path"
+	"strings"
 
+	vfsclient "spark/sparkos/client/vfs"
+	"spark/sparkos/internal/userdb"
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+)
+
+// session is the VFS identity of a logged-in user.
+type session struct {
+	rec    userdb.Record
+	cred   kernel.Capability
+	client *vfsclient.Client
+}
+
+// vfsClient returns the client for the commands of the current user. When VFS
+// issues credentials it carries the user's, so VFS checks what the user may
+// do; otherwise it is the system client.
 func (s *Service) vfsClient() *vfsclient.Client {
+	if !s.vfsAuthCap.Valid() || s.user == "" {
+		return s.sysVFS()
+	}
+	if sess := s.sessions[s.user]; sess != nil && sess.client != nil {
+		return sess.client
+	}
+	// Without a credential fail closed rather than act as the system.
+	return vfsclient.New(kernel.Capability{})
+}
+
+// appVFSCap is the VFS endpoint of the apps the current user starts: the
+// user's credential, or the shell's own endpoint when VFS has no logins.
+func (s *Service) appVFSCap() kernel.Capability {
+	if !s.vfsAuthCap.Valid() || s.user == "" {
+		return s.vfsCap
+	}
+	if sess := s.sessions[s.user]; sess != nil && sess.client != nil {
+		return sess.cred
+	}
+	return kernel.Capability{}
+}
+
+func (s *Service) sysVFS() *vfsclient.Client {
 	if s.vfs == nil {
 		s.vfs = vfsclient.New(s.vfsCap)
 	}
 	return s.vfs
 }
+
+// beginSession records rec as logged in and issues its credential.
+func (s *Service) beginSession(ctx *kernel.Context, rec userdb.Record) {
+	if !s.vfsAuthCap.Valid() {
+		return
+	}
+	if s.sessions == nil {
+		s.sessions = make(map[string]*session)
+	}
+	if sess := s.sessions[rec.Name]; sess == nil || sess.rec != rec {
+		s.sessions[rec.Name] = &session{rec: rec}
+	}
+	s.ensureSession(ctx)
+}
+
+// ensureSession issues the credential of the current user if it has none or
+// lost it, as when VFS restarts. The first time it also makes sure the
+// user's home exists and belongs to the user.
+func (s *Service) ensureSession(ctx *kernel.Context) {
+	sess := s.sessions[s.user]
+	if sess == nil || (sess.client != nil && ctx.Alive(sess.cred)) {
+		return
+	}
+	first := !sess.cred.Valid()
+	cred, err := vfsclient.IssueCred(ctx, s.vfsAuthCap, proto.VFSCred{
+		UID:   sess.rec.UID,
+		GID:   sess.rec.GID(),
+		Admin: sess.rec.Role == userdb.RoleAdmin,
+	})
+	if err != nil {
+		_ = s.printString(ctx, "vfs: "+err.Error()+"\n")
+		return
+	}
+	sess.cred = cred
+	sess.client = vfsclient.New(cred)
+	if first {
+		s.prepareHome(ctx, sess.rec)
+	}
+}
+
+// prepareHome creates the home of rec and gives it to the user, best effort.
+// Homes of admins and the root directory are left alone.
+func (s *Service) prepareHome(ctx *kernel.Context, rec userdb.Record) {
+	home := rec.Home
+	if home == "" || home == "/" || rec.Role == userdb.RoleAdmin {
+		return
+	}
+	c := s.sysVFS()
+	dir := ""
+	for _, part := range strings.Split(strings.Trim(home, "/"), "/") {
+		dir = pathpkg.Join("/", dir, part)
+		if _, _, err := c.Stat(ctx, dir); err != nil {
+			if err := c.Mkdir(ctx, dir); err != nil {
+				return
+			}
+		}
+	}
+	e, err := c.StatEntry(ctx, home)
+	if err != nil || e.UID != 0 {
+		return
+	}
+	_ = c.Chown(ctx, home, rec.UID, rec.GID())
+}
@@ -0,0 +1,284 @@
+package supervisor
+
+import (
+	"fmt"
+
+	logclient "spark/sparkos/client/logger"
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+)
+
+const (
+	backoffMinTicks = 50
+	backoffMaxTicks = 5_000
+
+	// stableAfterTicks resets the backoff once a service has run that long.
+	stableAfterTicks = 10_000
+
+	// A service that has to be restarted more than maxRestarts times within
+	// restartWindowTicks is marked failed and left alone.
+	maxRestarts        = 5
+	restartWindowTicks = 30_000
+)
+
+// Spec describes a supervised service.
+type Spec struct {
+	Name   string
+	Policy proto.SvcPolicy
+	// After lists services that must be started first.
+	After []string
+	// New returns a fresh task for every start and restart.
+	New func() kernel.Task
+}
+
+type service struct {
+	spec Spec
+
+	state    proto.SvcState
+	task     kernel.TaskID
+	restarts uint16
+	lastExit proto.ExitReason
+
+	startedAt   uint64
+	backoff     uint64
+	windowStart uint64
+	windowCount int
+}
+
+// Service starts services in dependency order and restarts them per policy.
+//
+// Status requests (MsgSvcStatus) are served on ep.
+type Service struct {
+	ep     kernel.Capability
+	logCap kernel.Capability
+
+	svcs   []service
+	byTask map[kernel.TaskID]int
+	due    chan int
+}
+
+func New(specs []Spec, ep kernel.Capability, logCap kernel.Capability) *Service {
+	s := &Service{
+		ep:     ep,
+		logCap: logCap,
+		svcs:   make([]service, len(specs)),
+		byTask: make(map[kernel.TaskID]int),
+		due:    make(chan int, len(specs)),
+	}
+	for i, spec := range specs {
+		s.svcs[i] = service{spec: spec, state: proto.SvcStopped}
+	}
+	return s
+}
+
+func (s *Service) Run(ctx *kernel.Context) {
+	exitCap := ctx.NewEndpointWith(kernel.RightSend|kernel.RightRecv, kernel.EndpointOptions{Depth: 16})
+	exits, ok := ctx.RecvChan(exitCap.Restrict(kernel.RightRecv))
+	if !ok || !ctx.SetSupervisor(exitCap.Restrict(kernel.RightSend), proto.TaskExitedNotice) {
+		s.log(ctx, "supervisor: no exit endpoint, services will not be restarted")
+	}
+	var requests <-chan kernel.Message
+	if s.ep.Valid() {
+		requests, _ = ctx.RecvChan(s.ep)
+	}
+
+	for _, i := range startOrder(s.svcs) {
+		s.start(ctx, i)
+	}
+
+	for {
+		select {
+		case msg, ok := <-exits:
+			if !ok {
+				exits = nil
+				continue
+			}
+			if proto.Kind(msg.Kind) == proto.MsgTaskExited {
+				s.handleExit(ctx, msg)
+			}
+		case msg, ok := <-requests:
+			if !ok {
+				requests = nil
+				continue
+			}
+			if proto.Kind(msg.Kind) == proto.MsgSvcStatus {
+				s.handleStatus(ctx, msg)
+			}
+		case i := <-s.due:
+			if s.svcs[i].state == proto.SvcBackoff {
+				s.start(ctx, i)
+			}
+		}
+	}
+}
+
+// named gives a service task its table name in kernel introspection.
+type named struct {
+	kernel.Task
+	name string
+}
+
+func (n named) Name() string { return n.name }
+
+func (s *Service) start(ctx *kernel.Context, i int) {
+	sv := &s.svcs[i]
+	id := ctx.AddTask(named{Task: sv.spec.New(), name: sv.spec.Name})
+	if id == kernel.NoTask {
+		s.log(ctx, fmt.Sprintf("supervisor: %s: no free task slot", sv.spec.Name))
+		s.scheduleRestart(ctx, i)
+		return
+	}
+	sv.state = proto.SvcRunning
+	sv.task = id
+	sv.startedAt = ctx.NowTick()
+	s.byTask[id] = i
+}
+
+func (s *Service) handleExit(ctx *kernel.Context, msg kernel.Message) {
+	if msg.Grant.Valid() {
+		ctx.FreeRegion(msg.Grant)
+	}
+	exit, ok := proto.DecodeTaskExitedPayload(msg.Payload())
+	if !ok {
+		return
+	}
+	i, ok := s.byTask[kernel.TaskID(exit.Task)]
+	if !ok {
+		return
+	}
+	delete(s.byTask, kernel.TaskID(exit.Task))
+
+	sv := &s.svcs[i]
+	sv.task = kernel.NoTask
+	sv.lastExit = exit.Reason
+	if exit.Reason == proto.ExitPanic {
+		s.log(ctx, fmt.Sprintf("supervisor: %s panicked: %s", sv.spec.Name, exit.Value))
+	}
+
+	restart := false
+	switch sv.spec.Policy {
+	case proto.SvcPermanent:
+		restart = true
+	case proto.SvcTransient:
+		restart = exit.Reason != proto.ExitNormal
+	}
+	if !restart {
+		sv.state = proto.SvcStopped
+		return
+	}
+
+	now := ctx.NowTick()
+	if sv.windowCount == 0 || now-sv.windowStart > restartWindowTicks {
+		sv.windowStart = now
+		sv.windowCount = 0
+	}
+	sv.windowCount++
+	if sv.windowCount > maxRestarts {
+		sv.state = proto.SvcFailed
+		s.log(ctx, fmt.Sprintf("supervisor: %s: restarted too often, giving up", sv.spec.Name))
+		return
+	}
+	s.scheduleRestart(ctx, i)
+}
+
+// scheduleRestart puts a service into backoff. The delay doubles on every
+// restart and starts over once the service has run for stableAfterTicks.
+func (s *Service) scheduleRestart(ctx *kernel.Context, i int) {
+	sv := &s.svcs[i]
+	now := ctx.NowTick()
+	switch {
+	case sv.backoff == 0 || now-sv.startedAt >= stableAfterTicks:
+		sv.backoff = backoffMinTicks
+	case sv.backoff < backoffMaxTicks:
+		sv.backoff *= 2
+		if sv.backoff > backoffMaxTicks {
+			sv.backoff = backoffMaxTicks
+		}
+	}
+	sv.state = proto.SvcBackoff
+	sv.restarts++
+
+	at := now + sv.backoff
+	go func() {
+		for now := ctx.NowTick(); now < at; {
+			now = ctx.WaitTick(now)
+		}
+		s.due <- i
+	}()
+}
+
+func (s *Service) handleStatus(ctx *kernel.Context, msg kernel.Message) {
+	if !msg.Cap.Valid() {
+		return
+	}
+	requestID, index, ok := proto.DecodeSvcStatusPayload(msg.Payload())
+	if !ok {
+		_ = ctx.SendToCapResult(msg.Cap, uint16(proto.MsgError), proto.ErrorPayload(proto.ErrBadMessage, proto.MsgSvcStatus, nil), kernel.Capability{})
+		return
+	}
+	if int(index) >= len(s.svcs) {
+		_ = ctx.SendToCapResult(msg.Cap, uint16(proto.MsgError), proto.ErrorPayload(proto.ErrNotFound, proto.MsgSvcStatus, nil), kernel.Capability{})
+		return
+	}
+
+	sv := &s.svcs[index]
+	st := proto.SvcStatus{
+		Index:    index,
+		Total:    uint8(len(s.svcs)),
+		State:    sv.state,
+		Policy:   sv.spec.Policy,
+		Task:     uint8(sv.task),
+		Restarts: sv.restarts,
+		LastExit: sv.lastExit,
+		Name:     sv.spec.Name,
+	}
+	_ = ctx.SendToCapResult(msg.Cap, uint16(proto.MsgSvcStatusResp), proto.SvcStatusRespPayload(requestID, st), kernel.Capability{})
+}
+
+func (s *Service) log(ctx *kernel.Context, line string) {
+	if s.logCap.Valid() {
+		_ = logclient.Log(ctx, s.logCap, line)
+	}
+}
+
+// startOrder returns service indices so that every service comes after the
+// services it lists in After. Unknown names are ignored; services caught in a
+// dependency cycle are started last, in table order.
+func startOrder(svcs []service) []int {
+	index := make(map[string]int, len(svcs))
+	for i := range svcs {
+		index[svcs[i].spec.Name] = i
+	}
+
+	order := make([]int, 0, len(svcs))
+	started := make([]bool, len(svcs))
+	for len(order) < len(svcs) {
+		progress := false
+		for i := range svcs {
+			if started[i] {
+				continue
+			}
+			ready := true
+			for _, dep := range svcs[i].spec.After {
+				if j, ok := index[dep]; ok && !started[j] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				started[i] = true
+				order = append(order, i)
+				progress = true
+			}
+		}
+		if !progress {
+			for i := range svcs {
+				if !started[i] {
+					started[i] = true
+					order = append(order, i)
+				}
+			}
+		}
+	}
+	return order
+}
@@ -0,0 +1,130 @@
+package supervisor
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	supclient "spark/sparkos/client/supervisor"
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+)
+
+type taskFunc func(ctx *kernel.Context)
+
+func (f taskFunc) Run(ctx *kernel.Context) { f(ctx) }
+
+func startTicker(t *testing.T, k *kernel.Kernel) {
+	t.Helper()
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	go func() {
+		for seq := uint64(1); ; seq++ {
+			select {
+			case <-done:
+				return
+			case <-time.After(100 * time.Microsecond):
+				k.TickTo(seq)
+			}
+		}
+	}()
+}
+
+func block(ctx *kernel.Context) { ctx.WaitTick(ctx.NowTick() + 1<<40) }
+
+func TestStartOrderFollowsDependencies(t *testing.T) {
+	svcs := []service{
+		{spec: Spec{Name: "shell", After: []string{"term", "vfs"}}},
+		{spec: Spec{Name: "term", After: []string{"logger"}}},
+		{spec: Spec{Name: "logger"}},
+		{spec: Spec{Name: "vfs", After: []string{"logger", "missing"}}},
+		{spec: Spec{Name: "x", After: []string{"y"}}},
+		{spec: Spec{Name: "y", After: []string{"x"}}},
+	}
+	got := startOrder(svcs)
+	want := []int{2, 3, 1, 0, 4, 5}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestRestartPolicies(t *testing.T) {
+	k := kernel.New()
+	startTicker(t, k)
+
+	var crashyRuns, transientRuns, temporaryRuns int32
+	specs := []Spec{
+		{Name: "crashy", Policy: proto.SvcPermanent, New: func() kernel.Task {
+			return taskFunc(func(ctx *kernel.Context) {
+				if atomic.AddInt32(&crashyRuns, 1) == 1 {
+					panic("first run")
+				}
+				block(ctx)
+			})
+		}},
+		{Name: "done", Policy: proto.SvcTransient, New: func() kernel.Task {
+			return taskFunc(func(ctx *kernel.Context) { atomic.AddInt32(&transientRuns, 1) })
+		}},
+		{Name: "oneshot", Policy: proto.SvcTemporary, New: func() kernel.Task {
+			return taskFunc(func(ctx *kernel.Context) {
+				atomic.AddInt32(&temporaryRuns, 1)
+				panic("temporary")
+			})
+		}},
+		{Name: "looper", Policy: proto.SvcPermanent, New: func() kernel.Task {
+			return taskFunc(func(ctx *kernel.Context) { panic("always") })
+		}},
+	}
+	ep := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	k.AddTaskWith(New(specs, ep.Restrict(kernel.RightRecv), kernel.Capability{}), kernel.TaskOptions{Core: true})
+
+	want := map[string]proto.SvcState{
+		"crashy":  proto.SvcRunning,
+		"done":    proto.SvcStopped,
+		"oneshot": proto.SvcStopped,
+		"looper":  proto.SvcFailed,
+	}
+	var last []proto.SvcStatus
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		statusCh := make(chan []proto.SvcStatus, 1)
+		k.AddTask(taskFunc(func(ctx *kernel.Context) {
+			st, _ := supclient.List(ctx, ep.Restrict(kernel.RightSend))
+			statusCh <- st
+		}))
+		last = <-statusCh
+
+		matched := len(last) == len(specs)
+		for _, st := range last {
+			if want[st.Name] != st.State {
+				matched = false
+			}
+		}
+		if matched {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("services did not settle: %+v", last)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	crashy := last[0]
+	if crashy.Restarts != 1 || crashy.LastExit != proto.ExitPanic || crashy.Task == 0 {
+		t.Fatalf("unexpected crashy status %+v", crashy)
+	}
+	if last[3].Restarts != maxRestarts {
+		t.Fatalf("expected looper to be restarted %d times, got %+v", maxRestarts, last[3])
+	}
+	if n := atomic.LoadInt32(&transientRuns); n != 1 {
+		t.Fatalf("transient service ran %d times after a normal exit", n)
+	}
+	if n := atomic.LoadInt32(&temporaryRuns); n != 1 {
+		t.Fatalf("temporary service ran %d times", n)
+	}
+}
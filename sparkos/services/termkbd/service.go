@@ -13,9 +13,14 @@ type Service struct {
 
 	events  <-chan hal.KeyEvent
 	pending []byte
+	// sendEvents is Options.Events; inputEvents are the MsgInputEvent
+	// messages not sent yet.
+	sendEvents  bool
+	inputEvents []proto.InputEvent
 
-	heldCode hal.KeyCode
-	heldData []byte
+	heldCode  hal.KeyCode
+	heldData  []byte
+	heldEvent hal.KeyEvent
 
 	nextRepeatTick uint64
 }
@@ -25,9 +30,21 @@ func New(in hal.Input, termCap kernel.Capability) *Service {
 	return &Service{in: in, outCap: termCap, outKind: proto.MsgTermWrite}
 }
 
+// Options configure a Service in input mode.
+type Options struct {
+	// Events also sends every key event, release and repeat included, as a
+	// MsgInputEvent. Only consolemux reads them; the shell does not.
+	Events bool
+}
+
 // NewInput writes VT100 bytes as input messages to an intermediate consumer (e.g. shell).
 func NewInput(in hal.Input, inputCap kernel.Capability) *Service {
-	return &Service{in: in, outCap: inputCap, outKind: proto.MsgTermInput}
+	return NewInputWith(in, inputCap, Options{})
+}
+
+// NewInputWith is NewInput with opts.
+func NewInputWith(in hal.Input, inputCap kernel.Capability, opts Options) *Service {
+	return &Service{in: in, outCap: inputCap, outKind: proto.MsgTermInput, sendEvents: opts.Events}
 }
 
 func (s *Service) Run(ctx *kernel.Context) {
@@ -81,25 +98,26 @@ func (s *Service) Run(ctx *kernel.Context) {
 }
 
 func (s *Service) handleKeyEvent(ctx *kernel.Context, ev hal.KeyEvent) {
+	s.queueEvent(ev, false)
 	if !ev.Press {
 		if s.heldData != nil && ev.Code == s.heldCode {
 			s.heldData = nil
 			s.nextRepeatTick = 0
 		}
+		s.flush(ctx)
 		return
 	}
 
 	data := vt100FromKey(ev)
-	if len(data) > 0 {
-		s.pending = append(s.pending, data...)
-		s.flush(ctx)
-	}
+	s.pending = append(s.pending, data...)
+	s.flush(ctx)
 
 	if !repeatableKey(ev, data) {
 		return
 	}
 	s.heldCode = ev.Code
 	s.heldData = append(s.heldData[:0], data...)
+	s.heldEvent = ev
 
 	now := ctx.NowTick()
 	s.nextRepeatTick = now + repeatDelayTicks
@@ -113,15 +131,40 @@ func (s *Service) handleRepeat(tick uint64) {
 		return
 	}
 	s.pending = append(s.pending, s.heldData...)
+	s.queueEvent(s.heldEvent, true)
 	s.nextRepeatTick = tick + repeatRateTicks
 }
 
-func (s *Service) flush(ctx *kernel.Context) {
-	if len(s.pending) == 0 {
+// queueEvent queues ev as a MsgInputEvent with Options.Events. Events beyond
+// maxQueuedEvents are dropped while the consumer is not reading.
+func (s *Service) queueEvent(ev hal.KeyEvent, repeat bool) {
+	if !s.sendEvents || len(s.inputEvents) >= maxQueuedEvents {
 		return
 	}
+	s.inputEvents = append(s.inputEvents, proto.InputEvent{
+		Code:     uint16(ev.Code),
+		Rune:     ev.Rune,
+		Scancode: ev.Scancode,
+		Mods:     uint8(ev.Mods),
+		Press:    ev.Press,
+		Repeat:   repeat,
+	})
+}
+
+func (s *Service) flush(ctx *kernel.Context) {
 	if !s.outCap.Valid() {
 		s.pending = nil
+		s.inputEvents = nil
+		return
+	}
+	for len(s.inputEvents) > 0 {
+		res := ctx.SendToCapResult(s.outCap, uint16(proto.MsgInputEvent), proto.InputEventPayload(s.inputEvents[0]), kernel.Capability{})
+		if res == kernel.SendErrQueueFull {
+			break
+		}
+		s.inputEvents = s.inputEvents[1:]
+	}
+	if len(s.pending) == 0 {
 		return
 	}
 
@@ -145,6 +188,8 @@ const (
 	// These values aim to match typical desktop key-repeat feel without spamming.
 	repeatDelayTicks = 350
 	repeatRateTicks  = 60
+
+	maxQueuedEvents = 32
 )
 
 func repeatableKey(ev hal.KeyEvent, data []byte) bool {
@@ -153,7 +198,8 @@ func repeatableKey(ev hal.KeyEvent, data []byte) bool {
 	}
 	switch ev.Code {
 	case hal.KeyUp, hal.KeyDown, hal.KeyLeft, hal.KeyRight,
-		hal.KeyBackspace, hal.KeyDelete, hal.KeyHome, hal.KeyEnd:
+		hal.KeyBackspace, hal.KeyDelete, hal.KeyHome, hal.KeyEnd,
+		hal.KeyPageUp, hal.KeyPageDown:
 		return true
 	default:
 		return false
@@ -194,6 +240,30 @@ func vt100FromKey(ev hal.KeyEvent) []byte {
 		return []byte("\x1b[12~")
 	case hal.KeyF3:
 		return []byte("\x1b[13~")
+	case hal.KeyF4:
+		return []byte("\x1b[14~")
+	case hal.KeyF5:
+		return []byte("\x1b[15~")
+	case hal.KeyF6:
+		return []byte("\x1b[17~")
+	case hal.KeyF7:
+		return []byte("\x1b[18~")
+	case hal.KeyF8:
+		return []byte("\x1b[19~")
+	case hal.KeyF9:
+		return []byte("\x1b[20~")
+	case hal.KeyF10:
+		return []byte("\x1b[21~")
+	case hal.KeyF11:
+		return []byte("\x1b[23~")
+	case hal.KeyF12:
+		return []byte("\x1b[24~")
+	case hal.KeyInsert:
+		return []byte("\x1b[2~")
+	case hal.KeyPageUp:
+		return []byte("\x1b[5~")
+	case hal.KeyPageDown:
+		return []byte("\x1b[6~")
 	default:
 		return nil
 	}
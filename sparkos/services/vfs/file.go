@@ -0,0 +1,273 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+)
+
+// maxOpenFiles bounds the handles open at once, across all clients.
+const maxOpenFiles = 16
+
+// fileHandle is a file a backend keeps open between requests.
+type fileHandle interface {
+	io.ReadWriteSeeker
+	io.Closer
+	Truncate(size int64) error
+	Sync() error
+}
+
+// openFile is a handle returned by MsgVFSOpen. owner is the reply endpoint
+// of the open request; the file is closed once it is gone. Only requests
+// from sender with cred may use the handle: numbers are easy to guess, and
+// file requests come with a new reply endpoint each, so the reply endpoint
+// cannot tell clients apart.
+type openFile struct {
+	f      fileHandle
+	fs     fsHandle
+	owner  kernel.Capability
+	sender kernel.Sender
+	cred   proto.VFSCred
+}
+
+// openFlags converts proto flags to os.O_* flags for fsHandle.OpenFile.
+func openFlags(flags proto.VFSOpenFlag) int {
+	var flag int
+	switch {
+	case flags&proto.VFSOpenRead != 0 && flags&proto.VFSOpenWrite != 0:
+		flag = os.O_RDWR
+	case flags&proto.VFSOpenWrite != 0:
+		flag = os.O_WRONLY
+	default:
+		flag = os.O_RDONLY
+	}
+	if flags&proto.VFSOpenCreate != 0 {
+		flag |= os.O_CREATE
+	}
+	if flags&proto.VFSOpenExcl != 0 {
+		flag |= os.O_EXCL
+	}
+	if flags&proto.VFSOpenTruncate != 0 {
+		flag |= os.O_TRUNC
+	}
+	if flags&proto.VFSOpenAppend != 0 {
+		flag |= os.O_APPEND
+	}
+	return flag
+}
+
+// closeOrphans closes the files of clients whose reply endpoint is gone,
+// typically because the client task exited without closing them.
+func (s *Service) closeOrphans(ctx *kernel.Context) {
+	for h, of := range s.files {
+		if !ctx.Alive(of.owner) {
+			_ = of.f.Close()
+			delete(s.files, h)
+		}
+	}
+}
+
+// file returns the open file for handle or reports that there is none. The
+// handles of other clients are reported as missing too.
+func (s *Service) file(ctx *kernel.Context, msg kernel.Message, ref proto.Kind, requestID, handle uint32) (*openFile, bool) {
+	reply := msg.Cap
+	of := s.files[handle]
+	if of == nil || of.sender != msg.Sender || of.cred != s.caller || !ctx.Alive(of.owner) {
+		_ = s.sendErr(ctx, reply, proto.ErrNotFound, ref, requestID, "bad file handle")
+		return nil, false
+	}
+	return of, true
+}
+
+func (s *Service) handleOpen(ctx *kernel.Context, msg kernel.Message) {
+	reply := msg.Cap
+	requestID, flags, path, ok := proto.DecodeVFSOpenPayload(msg.Payload())
+	if !ok {
+		_ = s.sendErr(ctx, reply, proto.ErrBadMessage, proto.MsgVFSOpen, 0, "decode open")
+		return
+	}
+	if !reply.Valid() {
+		return
+	}
+	if len(s.files) >= maxOpenFiles {
+		_ = s.sendErr(ctx, reply, proto.ErrBusy, proto.MsgVFSOpen, requestID, "too many open files")
+		return
+	}
+
+	if flags&proto.VFSOpenRead != 0 || flags&proto.VFSOpenWrite == 0 {
+		if s.denied(ctx, reply, proto.MsgVFSOpen, requestID, path, accRead) {
+			return
+		}
+	}
+	if flags&(proto.VFSOpenWrite|proto.VFSOpenCreate|proto.VFSOpenTruncate) != 0 {
+		if s.denied(ctx, reply, proto.MsgVFSOpen, requestID, path, accWrite) {
+			return
+		}
+	}
+	created := !s.exists(path)
+	backend, rel, ok := s.resolve(path)
+	if !ok {
+		s.sendResolveErr(ctx, reply, proto.MsgVFSOpen, requestID, path)
+		return
+	}
+	f, err := backend.OpenFile(rel, openFlags(flags))
+	if err != nil {
+		_ = s.sendErr(ctx, reply, mapVFSError(err), proto.MsgVFSOpen, requestID, err.Error())
+		return
+	}
+	if created {
+		s.own(backend, rel)
+	}
+
+	if s.files == nil {
+		s.files = make(map[uint32]*openFile)
+	}
+	for {
+		s.nextHandle++
+		if s.nextHandle != 0 && s.files[s.nextHandle] == nil {
+			break
+		}
+	}
+	s.files[s.nextHandle] = &openFile{f: f, fs: backend, owner: reply, sender: msg.Sender, cred: s.caller}
+	_ = s.send(ctx, reply, proto.MsgVFSOpenResp, proto.VFSOpenRespPayload(requestID, s.nextHandle))
+}
+
+func (s *Service) handleFileRead(ctx *kernel.Context, msg kernel.Message) {
+	reply := msg.Cap
+	requestID, handle, maxBytes, ok := proto.DecodeVFSFileReadPayload(msg.Payload())
+	if !ok {
+		_ = s.sendErr(ctx, reply, proto.ErrBadMessage, proto.MsgVFSFileRead, 0, "decode file read")
+		return
+	}
+	of, ok := s.file(ctx, msg, proto.MsgVFSFileRead, requestID, handle)
+	if !ok {
+		return
+	}
+
+	shared := msg.Grant.Valid()
+	var buf []byte
+	if shared {
+		buf, ok = ctx.MapRegion(msg.Grant, kernel.RightWrite)
+		if !ok {
+			_ = s.sendErr(ctx, reply, proto.ErrUnauthorized, proto.MsgVFSFileRead, requestID, "no writable grant")
+			return
+		}
+	} else {
+		buf = make([]byte, kernel.MaxMessageBytes-9)
+	}
+	if maxBytes < uint32(len(buf)) {
+		buf = buf[:maxBytes]
+	}
+
+	n, err := io.ReadFull(of.f, buf)
+	eof := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	if err != nil && !eof {
+		_ = s.sendErr(ctx, reply, mapVFSError(err), proto.MsgVFSFileRead, requestID, err.Error())
+		return
+	}
+	data := buf[:n]
+	if shared {
+		data = nil
+	}
+	_ = s.send(ctx, reply, proto.MsgVFSFileReadResp, proto.VFSFileReadRespPayload(requestID, eof, uint32(n), data))
+}
+
+func (s *Service) handleFileWrite(ctx *kernel.Context, msg kernel.Message) {
+	reply := msg.Cap
+	requestID, handle, n, data, ok := proto.DecodeVFSFileWritePayload(msg.Payload())
+	if !ok {
+		_ = s.sendErr(ctx, reply, proto.ErrBadMessage, proto.MsgVFSFileWrite, 0, "decode file write")
+		return
+	}
+	of, ok := s.file(ctx, msg, proto.MsgVFSFileWrite, requestID, handle)
+	if !ok {
+		return
+	}
+	if len(data) == 0 && n > 0 {
+		buf, ok := ctx.MapRegion(msg.Grant, kernel.RightRead)
+		if !ok || int(n) > len(buf) {
+			_ = s.sendErr(ctx, reply, proto.ErrUnauthorized, proto.MsgVFSFileWrite, requestID, "no readable grant")
+			return
+		}
+		data = buf[:n]
+	}
+
+	written, err := of.f.Write(data)
+	if err == nil && written != len(data) {
+		err = errors.New("short write")
+	}
+	if err != nil {
+		_ = s.sendErr(ctx, reply, mapVFSError(err), proto.MsgVFSFileWrite, requestID, err.Error())
+		return
+	}
+	_ = s.send(ctx, reply, proto.MsgVFSFileResp, proto.VFSFileRespPayload(requestID, uint64(written)))
+}
+
+func (s *Service) handleFileSeek(ctx *kernel.Context, msg kernel.Message) {
+	reply := msg.Cap
+	requestID, handle, off, whence, ok := proto.DecodeVFSFileSeekPayload(msg.Payload())
+	if !ok || whence > io.SeekEnd {
+		_ = s.sendErr(ctx, reply, proto.ErrBadMessage, proto.MsgVFSFileSeek, requestID, "decode file seek")
+		return
+	}
+	of, ok := s.file(ctx, msg, proto.MsgVFSFileSeek, requestID, handle)
+	if !ok {
+		return
+	}
+	pos, err := of.f.Seek(off, int(whence))
+	if err != nil {
+		_ = s.sendErr(ctx, reply, mapVFSError(err), proto.MsgVFSFileSeek, requestID, err.Error())
+		return
+	}
+	_ = s.send(ctx, reply, proto.MsgVFSFileResp, proto.VFSFileRespPayload(requestID, uint64(pos)))
+}
+
+func (s *Service) handleFileTruncate(ctx *kernel.Context, msg kernel.Message) {
+	reply := msg.Cap
+	requestID, handle, size, ok := proto.DecodeVFSFileTruncatePayload(msg.Payload())
+	if !ok {
+		_ = s.sendErr(ctx, reply, proto.ErrBadMessage, proto.MsgVFSFileTruncate, 0, "decode file truncate")
+		return
+	}
+	of, ok := s.file(ctx, msg, proto.MsgVFSFileTruncate, requestID, handle)
+	if !ok {
+		return
+	}
+	if err := of.f.Truncate(int64(size)); err != nil {
+		_ = s.sendErr(ctx, reply, mapVFSError(err), proto.MsgVFSFileTruncate, requestID, err.Error())
+		return
+	}
+	_ = s.send(ctx, reply, proto.MsgVFSFileResp, proto.VFSFileRespPayload(requestID, 0))
+}
+
+// handleFileSyncClose serves MsgVFSFileSync and MsgVFSFileClose, which share
+// a payload. A handle is released even if closing the file fails.
+func (s *Service) handleFileSyncClose(ctx *kernel.Context, msg kernel.Message) {
+	reply := msg.Cap
+	ref := proto.Kind(msg.Kind)
+	requestID, handle, ok := proto.DecodeVFSFileHandlePayload(msg.Payload())
+	if !ok {
+		_ = s.sendErr(ctx, reply, proto.ErrBadMessage, ref, 0, "decode file handle")
+		return
+	}
+	of, ok := s.file(ctx, msg, ref, requestID, handle)
+	if !ok {
+		return
+	}
+
+	var err error
+	if ref == proto.MsgVFSFileClose {
+		delete(s.files, handle)
+		err = of.f.Close()
+	} else {
+		err = of.f.Sync()
+	}
+	if err != nil {
+		_ = s.sendErr(ctx, reply, mapVFSError(err), ref, requestID, err.Error())
+		return
+	}
+	_ = s.send(ctx, reply, proto.MsgVFSFileResp, proto.VFSFileRespPayload(requestID, 0))
+}
@@ -0,0 +1,174 @@
+package vfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	vfsclient "spark/sparkos/client/vfs"
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+)
+
+// memFile is a file of a memFS; it keeps the data of the filesystem.
+type memFile struct {
+	fs     *memFS
+	pos    int64
+	closed bool
+}
+
+func (m *memFS) OpenFile(string, int) (fileHandle, error) {
+	m.f = &memFile{fs: m}
+	return m.f, nil
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	if f.pos >= int64(len(f.fs.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.fs.data[f.pos:])
+	f.pos += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if end := f.pos + int64(len(p)); end > int64(len(f.fs.data)) {
+		f.fs.data = append(f.fs.data, make([]byte, end-int64(len(f.fs.data)))...)
+	}
+	n := copy(f.fs.data[f.pos:], p)
+	f.pos += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Seek(off int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		off += f.pos
+	case io.SeekEnd:
+		off += int64(len(f.fs.data))
+	}
+	if off < 0 {
+		return 0, errors.New("negative position")
+	}
+	f.pos = off
+	return off, nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.fs.data = append(f.fs.data[:0:0], f.fs.data[:size]...)
+	return nil
+}
+
+func (f *memFile) Sync() error  { return nil }
+func (f *memFile) Close() error { f.closed = true; return nil }
+
+func TestFileReadWriteSeek(t *testing.T) {
+	k := kernel.New()
+	ep := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	fs := &memFS{data: testData(3000)}
+	s := &Service{sd: fs}
+	startService(k, s, ep)
+
+	runClient(t, k, func(ctx *kernel.Context) {
+		c := vfsclient.New(ep.Restrict(kernel.RightSend))
+		f, err := c.Open(ctx, "/sd/data", proto.VFSOpenRead|proto.VFSOpenWrite)
+		if err != nil {
+			t.Errorf("Open: %v", err)
+			return
+		}
+
+		got, err := io.ReadAll(f)
+		if err != nil || !bytes.Equal(got, testData(3000)) {
+			t.Errorf("ReadAll: %d bytes, err=%v", len(got), err)
+		}
+
+		if pos, err := f.Seek(-10, io.SeekEnd); err != nil || pos != 2990 {
+			t.Errorf("Seek: pos=%d err=%v", pos, err)
+		}
+		tail := bytes.Repeat([]byte{0xAA}, 2000)
+		if n, err := f.Write(tail); err != nil || n != len(tail) {
+			t.Errorf("Write: n=%d err=%v", n, err)
+		}
+		if err := f.Truncate(4000); err != nil {
+			t.Errorf("Truncate: %v", err)
+		}
+		if err := f.Close(); err != nil {
+			t.Errorf("Close: %v", err)
+		}
+		if _, err := f.Read(make([]byte, 1)); err == nil {
+			t.Error("Read after Close succeeded")
+		}
+	})
+
+	want := append(testData(2990), bytes.Repeat([]byte{0xAA}, 1010)...)
+	if !bytes.Equal(fs.data, want) {
+		t.Fatalf("file has %d bytes, not the written data", len(fs.data))
+	}
+	if !fs.f.closed || len(s.files) != 0 {
+		t.Fatalf("file not closed: closed=%v handles=%d", fs.f.closed, len(s.files))
+	}
+}
+
+func TestFileClosedWhenOwnerExits(t *testing.T) {
+	k := kernel.New()
+	ep := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	fs := &memFS{data: testData(10)}
+	s := &Service{sd: fs}
+	startService(k, s, ep)
+
+	runClient(t, k, func(ctx *kernel.Context) {
+		c := vfsclient.New(ep.Restrict(kernel.RightSend))
+		if _, err := c.Open(ctx, "/sd/data", proto.VFSOpenRead); err != nil {
+			t.Errorf("Open: %v", err)
+		}
+	})
+
+	runClient(t, k, func(ctx *kernel.Context) {
+		c := vfsclient.New(ep.Restrict(kernel.RightSend))
+		if _, err := c.Mounts(ctx); err != nil {
+			t.Errorf("Mounts: %v", err)
+		}
+	})
+	if fs.f == nil || !fs.f.closed {
+		t.Fatal("file of an exited task was not closed")
+	}
+}
+
+func TestFileHandleBelongsToOpener(t *testing.T) {
+	k := kernel.New()
+	ep := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	fs := &memFS{data: testData(10)}
+	s := &Service{sd: fs}
+	startService(k, s, ep)
+
+	opened := make(chan *vfsclient.File)
+	release := make(chan struct{})
+	k.AddTask(taskFunc(func(ctx *kernel.Context) {
+		f, err := vfsclient.New(ep.Restrict(kernel.RightSend)).Open(ctx, "/sd/data", proto.VFSOpenRead|proto.VFSOpenWrite)
+		if err != nil {
+			t.Errorf("Open: %v", err)
+		}
+		opened <- f
+		<-release
+	}))
+	if <-opened == nil {
+		close(release)
+		return
+	}
+	defer close(release)
+
+	// Handles are numbered from 1: another task guesses the first one.
+	runClient(t, k, func(ctx *kernel.Context) {
+		svc := ep.Restrict(kernel.RightSend)
+		if msg, err := ctx.Call(svc, uint16(proto.MsgVFSFileWrite), proto.VFSFileWritePayload(1, 1, 3, []byte("bad")), 0); err != nil || proto.Kind(msg.Kind) != proto.MsgError {
+			t.Errorf("write through another task's handle = %s, %v; want MsgError", proto.Kind(msg.Kind), err)
+		}
+		if msg, err := ctx.Call(svc, uint16(proto.MsgVFSFileClose), proto.VFSFileHandlePayload(2, 1), 0); err != nil || proto.Kind(msg.Kind) != proto.MsgError {
+			t.Errorf("close of another task's handle = %s, %v; want MsgError", proto.Kind(msg.Kind), err)
+		}
+	})
+	if !bytes.Equal(fs.data, testData(10)) || fs.f.closed {
+		t.Fatal("another task changed or closed the file")
+	}
+}
@@ -0,0 +1,274 @@
+package vfs
+
+import (
+	"errors"
+	pathpkg "path"
+	"sort"
+	"strings"
+
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+)
+
+// mount is an entry of the mount table: fs serves every path below path.
+type mount struct {
+	path   string
+	source string
+	fs     fsHandle
+}
+
+// usageFS is implemented by backends that can report their size for df.
+type usageFS interface {
+	Usage() (total, used uint64, err error)
+}
+
+// fsSource is a filesystem that can be mounted by name.
+type fsSource struct {
+	typ string
+	// open returns the backend; it is called on every mount of the source.
+	open func(s *Service, ctx *kernel.Context) (fsHandle, error)
+	// multi sources open a new filesystem on each mount, so they may be
+	// mounted at several paths at once.
+	multi bool
+}
+
+// sources are the filesystems known to MsgVFSMount. flash and sd are each
+// backed by a single device and are mounted at one path at a time.
+var sources = map[string]fsSource{
+	"flash": {typ: "littlefs", open: (*Service).openFlash},
+	"sd":    {typ: "fat", open: (*Service).openSD},
+	"tmp":   {typ: "tmpfs", open: (*Service).openTmp, multi: true},
+}
+
+func (s *Service) openFlash(_ *kernel.Context) (fsHandle, error) {
+	if s.fs == nil {
+		return nil, errors.New("flash not available")
+	}
+	return flashFS{fs: s.fs}, nil
+}
+
+// openSD probes the card again if none was found before, so a card inserted
+// after boot can be mounted.
+func (s *Service) openSD(ctx *kernel.Context) (fsHandle, error) {
+	if s.sd == nil {
+		s.sd = s.initSD(ctx)
+	}
+	if s.sd == nil {
+		return nil, errors.New("sd not available")
+	}
+	return s.sd, nil
+}
+
+// mountDefaults mounts flash at /, the SD card at /sd and an empty tmpfs at
+// /tmp, whichever are available.
+func (s *Service) mountDefaults(ctx *kernel.Context) {
+	_ = s.mount(ctx, "flash", "/")
+	_ = s.mount(ctx, "sd", "/sd")
+	_ = s.mount(ctx, "tmp", "/tmp")
+}
+
+// mount attaches source at path.
+func (s *Service) mount(ctx *kernel.Context, source, path string) error {
+	src, ok := sources[source]
+	if !ok {
+		return errUnknownSource
+	}
+	if !validMountPath(path) {
+		return errBadMountPath
+	}
+	for _, m := range s.mounts {
+		if m.path == path || (m.source == source && !src.multi) {
+			return errMounted
+		}
+	}
+	fs, err := src.open(s, ctx)
+	if err != nil {
+		return err
+	}
+	s.attach(path, source, fs)
+	return nil
+}
+
+// attach adds fs to the mount table without checks.
+func (s *Service) attach(path, source string, fs fsHandle) {
+	s.mounts = append(s.mounts, mount{path: path, source: source, fs: fs})
+	sort.Slice(s.mounts, func(i, j int) bool { return s.mounts[i].path < s.mounts[j].path })
+}
+
+// unmount detaches the filesystem mounted at path. It fails while files on
+// it are open for writing.
+func (s *Service) unmount(path string) error {
+	for i, m := range s.mounts {
+		if m.path != path {
+			continue
+		}
+		for _, w := range s.writers {
+			if w.fs == m.fs {
+				return errMountBusy
+			}
+		}
+		for _, f := range s.files {
+			if f.fs == m.fs {
+				return errMountBusy
+			}
+		}
+		s.mounts = append(s.mounts[:i], s.mounts[i+1:]...)
+		return nil
+	}
+	return errNotMounted
+}
+
+var (
+	errUnknownSource = errors.New("unknown filesystem")
+	errBadMountPath  = errors.New("mount point must be a clean absolute path")
+	errMounted       = errors.New("already mounted")
+	errMountBusy     = errors.New("files are open")
+	errNotMounted    = errors.New("not mounted")
+)
+
+func validMountPath(path string) bool {
+	return strings.HasPrefix(path, "/") && pathpkg.Clean(path) == path
+}
+
+// lookup returns the mount with the longest path that contains path. The
+// root mount also serves relative paths.
+func (s *Service) lookup(path string) *mount {
+	if path == "" {
+		return nil
+	}
+	var best *mount
+	for i := range s.mounts {
+		m := &s.mounts[i]
+		if m.path != "/" && path != m.path && !strings.HasPrefix(path, m.path+"/") {
+			continue
+		}
+		if best == nil || len(m.path) > len(best.path) {
+			best = m
+		}
+	}
+	return best
+}
+
+// resolve returns the backend serving path and the path within it.
+func (s *Service) resolve(path string) (fsHandle, string, bool) {
+	m := s.lookup(path)
+	if m == nil {
+		return nil, "", false
+	}
+	if m.path == "/" {
+		return m.fs, path, true
+	}
+	rel := path[len(m.path):]
+	if rel == "" {
+		rel = "/"
+	}
+	return m.fs, rel, true
+}
+
+// sendResolveErr reports a path resolve could not serve.
+func (s *Service) sendResolveErr(ctx *kernel.Context, reply kernel.Capability, ref proto.Kind, requestID uint32, path string) {
+	if path == "" {
+		_ = s.sendErr(ctx, reply, proto.ErrBadMessage, ref, requestID, "invalid path")
+		return
+	}
+	_ = s.sendErr(ctx, reply, proto.ErrNotFound, ref, requestID, "nothing mounted at "+path)
+}
+
+// mountChildren returns the names of the mount points directly below dir.
+// They are listed as directories even if the parent filesystem has none.
+func (s *Service) mountChildren(dir string) []string {
+	if len(dir) > 1 {
+		dir = strings.TrimSuffix(dir, "/")
+	}
+	var names []string
+	for _, m := range s.mounts {
+		if m.path != "/" && pathpkg.Dir(m.path) == dir {
+			names = append(names, pathpkg.Base(m.path))
+		}
+	}
+	return names
+}
+
+// isMountDir reports whether path is a mount point or has one below it, and
+// so is a directory whatever the filesystems say.
+func (s *Service) isMountDir(path string) bool {
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	prefix := path + "/"
+	if path == "/" {
+		prefix = "/"
+	}
+	for _, m := range s.mounts {
+		if m.path == path || strings.HasPrefix(m.path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) handleMount(ctx *kernel.Context, msg kernel.Message) {
+	reply := msg.Cap
+	requestID, source, path, ok := proto.DecodeVFSMountPayload(msg.Payload())
+	if !ok {
+		_ = s.sendErr(ctx, reply, proto.ErrBadMessage, proto.MsgVFSMount, 0, "decode mount")
+		return
+	}
+	if s.denied(ctx, reply, proto.MsgVFSMount, requestID, path, accAdmin) {
+		return
+	}
+	if err := s.mount(ctx, source, path); err != nil {
+		_ = s.sendErr(ctx, reply, mapMountError(err), proto.MsgVFSMount, requestID, err.Error())
+		return
+	}
+	_ = s.send(ctx, reply, proto.MsgVFSMountResp, proto.VFSMountRespPayload(requestID))
+}
+
+func (s *Service) handleUnmount(ctx *kernel.Context, msg kernel.Message) {
+	reply := msg.Cap
+	requestID, path, ok := proto.DecodeVFSUnmountPayload(msg.Payload())
+	if !ok {
+		_ = s.sendErr(ctx, reply, proto.ErrBadMessage, proto.MsgVFSUnmount, 0, "decode unmount")
+		return
+	}
+	if s.denied(ctx, reply, proto.MsgVFSUnmount, requestID, path, accAdmin) {
+		return
+	}
+	if err := s.unmount(path); err != nil {
+		_ = s.sendErr(ctx, reply, mapMountError(err), proto.MsgVFSUnmount, requestID, err.Error())
+		return
+	}
+	_ = s.send(ctx, reply, proto.MsgVFSUnmountResp, proto.VFSUnmountRespPayload(requestID))
+}
+
+func (s *Service) handleMounts(ctx *kernel.Context, msg kernel.Message) {
+	reply := msg.Cap
+	requestID, ok := proto.DecodeVFSMountsPayload(msg.Payload())
+	if !ok {
+		_ = s.sendErr(ctx, reply, proto.ErrBadMessage, proto.MsgVFSMounts, 0, "decode mounts")
+		return
+	}
+	for _, m := range s.mounts {
+		info := proto.VFSMountInfo{Path: m.path, Source: m.source, Type: sources[m.source].typ}
+		if u, ok := m.fs.(usageFS); ok {
+			if total, used, err := u.Usage(); err == nil {
+				info.Total, info.Used, info.HasUsage = total, used, true
+			}
+		}
+		_ = s.send(ctx, reply, proto.MsgVFSMountsResp, proto.VFSMountsRespPayload(requestID, false, info))
+	}
+	_ = s.send(ctx, reply, proto.MsgVFSMountsResp, proto.VFSMountsRespPayload(requestID, true, proto.VFSMountInfo{}))
+}
+
+func mapMountError(err error) proto.ErrCode {
+	switch {
+	case errors.Is(err, errUnknownSource), errors.Is(err, errNotMounted):
+		return proto.ErrNotFound
+	case errors.Is(err, errBadMountPath):
+		return proto.ErrBadMessage
+	case errors.Is(err, errMounted), errors.Is(err, errMountBusy):
+		return proto.ErrBusy
+	default:
+		return proto.ErrNotFound
+	}
+}
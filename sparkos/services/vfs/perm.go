@@ -0,0 +1,321 @@
+package vfs
+
+import (
+	"errors"
+	pathpkg "path"
+	"strings"
+
+	"spark/sparkos/fs/littlefs"
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+)
+
+// systemCred is the identity of requests on Options.SystemCap, which only
+// the system services named at boot hold. They are trusted with everything.
+var systemCred = proto.VFSCred{Admin: true}
+
+// nobody is the uid and gid of publicCred.
+const nobody = 1<<32 - 1
+
+// publicCred is the identity of requests on the public endpoint, which any
+// task can look up in the name service: it owns nothing and gets only what
+// others are allowed.
+var publicCred = proto.VFSCred{UID: nobody, GID: nobody}
+
+// maxCreds bounds the credentials issued at once. Each is an endpoint, and
+// endpoints are only released when VFS exits.
+const maxCreds = 8
+
+// credEndpoint is an endpoint VFS serves with the identity of cred.
+type credEndpoint struct {
+	cred proto.VFSCred
+	ep   kernel.Capability
+}
+
+// credRequest is a message received on a credential endpoint.
+type credRequest struct {
+	msg  kernel.Message
+	cred proto.VFSCred
+}
+
+// permFS is implemented by backends that store owners and permission bits.
+type permFS interface {
+	Chmod(path string, mode uint16) error
+	Chown(path string, uid, gid uint32) error
+}
+
+// Chmod and Chown pass through to littlefs.
+func (f flashFS) Chmod(path string, mode uint16) error     { return f.fs.Chmod(path, mode) }
+func (f flashFS) Chown(path string, uid, gid uint32) error { return f.fs.Chown(path, uid, gid) }
+
+// access is what a request does to a path.
+type access uint8
+
+const (
+	// accStat looks at the entry; only /etc is closed to it.
+	accStat access = iota
+	// accRead reads a file or lists a directory.
+	accRead
+	// accWrite changes a file, creating it in its parent if needed.
+	accWrite
+	// accParent creates, removes or renames the entry in its parent.
+	accParent
+	// accAdmin changes the mount table.
+	accAdmin
+)
+
+// Permission bits checked against the owner, group or other class.
+const (
+	permRead  = 0o4
+	permWrite = 0o2
+)
+
+var errPermission = errors.New("permission denied")
+
+// issueCred returns the endpoint serving cred, creating it on first use.
+func (s *Service) issueCred(ctx *kernel.Context, cred proto.VFSCred, done <-chan struct{}) (kernel.Capability, error) {
+	for _, c := range s.creds {
+		if c.cred == cred {
+			return c.ep, nil
+		}
+	}
+	if len(s.creds) >= maxCreds {
+		return kernel.Capability{}, errors.New("too many credentials")
+	}
+	ep := ctx.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	ch, ok := ctx.RecvChan(ep.Restrict(kernel.RightRecv))
+	if !ok {
+		return kernel.Capability{}, errors.New("no endpoint for credential")
+	}
+	go func() {
+		for {
+			select {
+			case msg := <-ch:
+				select {
+				case s.credIn <- credRequest{msg: msg, cred: cred}:
+				case <-done:
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	s.creds = append(s.creds, credEndpoint{cred: cred, ep: ep})
+	return ep, nil
+}
+
+func (s *Service) handleAuth(ctx *kernel.Context, msg kernel.Message, done <-chan struct{}) {
+	reply := msg.Cap
+	if proto.Kind(msg.Kind) != proto.MsgVFSCredIssue {
+		_ = s.sendErr(ctx, reply, proto.ErrBadMessage, proto.Kind(msg.Kind), 0, "auth endpoint only issues credentials")
+		return
+	}
+	requestID, cred, ok := proto.DecodeVFSCredIssuePayload(msg.Payload())
+	if !ok {
+		_ = s.sendErr(ctx, reply, proto.ErrBadMessage, proto.MsgVFSCredIssue, 0, "decode cred issue")
+		return
+	}
+	ep, err := s.issueCred(ctx, cred, done)
+	if err != nil {
+		_ = s.sendErr(ctx, reply, proto.ErrBusy, proto.MsgVFSCredIssue, requestID, err.Error())
+		return
+	}
+	_ = ctx.SendToCapRetry(reply, uint16(proto.MsgVFSCredIssueResp), proto.VFSCredIssueRespPayload(requestID), ep.Restrict(kernel.RightSend), 500)
+}
+
+// underEtc reports whether path is /etc or below it.
+func underEtc(path string) bool {
+	return path == "/etc" || strings.HasPrefix(path, "/etc/")
+}
+
+// cleanPath reports whether path is absolute and free of . and .. elements,
+// so the checks see the entry the backend will use.
+func cleanPath(path string) bool {
+	if path == "/" {
+		return true
+	}
+	p := strings.TrimSuffix(path, "/")
+	return strings.HasPrefix(p, "/") && pathpkg.Clean(p) == p
+}
+
+// statPath returns the entry at path, including mount points.
+func (s *Service) statPath(path string) (littlefs.Info, bool) {
+	backend, rel, ok := s.resolve(path)
+	if ok {
+		if info, err := backend.Stat(rel); err == nil {
+			return info, true
+		}
+	}
+	if s.isMountDir(path) {
+		info := littlefs.Info{Type: littlefs.TypeDir, Mode: littlefs.DefaultDirMode}
+		// The root of a filesystem without permissions is open to all.
+		if _, perms := backend.(permFS); ok && rel == "/" && !perms {
+			info.Mode = 0o777
+		}
+		return info, true
+	}
+	return littlefs.Info{}, false
+}
+
+// permitted reports whether cred has perm on info by its owner, group or
+// other bits.
+func permitted(cred proto.VFSCred, info littlefs.Info, perm uint16) bool {
+	mode := info.Mode
+	switch {
+	case cred.UID == info.UID:
+		mode >>= 6
+	case cred.GID == info.GID:
+		mode >>= 3
+	}
+	return mode&perm != 0
+}
+
+// searchable reports whether the caller may read every directory above the
+// clean path: a directory closed to the caller hides everything below it, as
+// search permission does.
+func (s *Service) searchable(path string) bool {
+	p := strings.TrimSuffix(path, "/")
+	for p != "/" && p != "" {
+		p = pathpkg.Dir(p)
+		if info, ok := s.statPath(p); ok && !permitted(s.caller, info, permRead) {
+			return false
+		}
+	}
+	return true
+}
+
+// allow checks the caller's access to path. Entries that do not exist pass,
+// so the backend reports them as missing.
+func (s *Service) allow(path string, a access) error {
+	c := s.caller
+	if c.Admin {
+		return nil
+	}
+	if a == accAdmin || !cleanPath(path) || underEtc(path) {
+		return errPermission
+	}
+	if !s.searchable(path) {
+		return errPermission
+	}
+
+	switch a {
+	case accRead:
+		if info, ok := s.statPath(path); ok && !permitted(c, info, permRead) {
+			return errPermission
+		}
+	case accWrite:
+		if info, ok := s.statPath(path); ok {
+			if !permitted(c, info, permWrite) {
+				return errPermission
+			}
+			return nil
+		}
+		return s.allow(path, accParent)
+	case accParent:
+		if path == "/" {
+			return errPermission
+		}
+		dir, ok := s.statPath(pathpkg.Dir(strings.TrimSuffix(path, "/")))
+		if !ok {
+			return nil
+		}
+		if !permitted(c, dir, permWrite) {
+			return errPermission
+		}
+		// In a sticky directory only owners may remove or replace entries.
+		if dir.Mode&littlefs.ModeSticky != 0 && dir.UID != c.UID {
+			if info, ok := s.statPath(path); ok && info.UID != c.UID {
+				return errPermission
+			}
+		}
+	}
+	return nil
+}
+
+// denied reports a refused request to reply.
+func (s *Service) denied(ctx *kernel.Context, reply kernel.Capability, ref proto.Kind, requestID uint32, path string, a access) bool {
+	if err := s.allow(path, a); err != nil {
+		_ = s.sendErr(ctx, reply, proto.ErrUnauthorized, ref, requestID, err.Error()+": "+path)
+		return true
+	}
+	return false
+}
+
+// exists reports whether path names an entry, for own.
+func (s *Service) exists(path string) bool {
+	_, ok := s.statPath(path)
+	return ok
+}
+
+// own gives an entry the caller created to the caller. Owners are best
+// effort, like timestamps: failing to store them does not fail the request.
+func (s *Service) own(backend fsHandle, rel string) {
+	if s.caller.UID == 0 && s.caller.GID == 0 {
+		return
+	}
+	if p, ok := backend.(permFS); ok {
+		_ = p.Chown(rel, s.caller.UID, s.caller.GID)
+	}
+}
+
+func (s *Service) handleChmod(ctx *kernel.Context, msg kernel.Message) {
+	reply := msg.Cap
+	requestID, mode, path, ok := proto.DecodeVFSChmodPayload(msg.Payload())
+	if !ok {
+		_ = s.sendErr(ctx, reply, proto.ErrBadMessage, proto.MsgVFSChmod, 0, "decode chmod")
+		return
+	}
+	if s.denied(ctx, reply, proto.MsgVFSChmod, requestID, path, accStat) {
+		return
+	}
+	info, ok := s.statPath(path)
+	if ok && !s.caller.Admin && info.UID != s.caller.UID {
+		_ = s.sendErr(ctx, reply, proto.ErrUnauthorized, proto.MsgVFSChmod, requestID, "not the owner: "+path)
+		return
+	}
+	s.setAttrs(ctx, reply, proto.MsgVFSChmod, proto.MsgVFSChmodResp, requestID, path, func(p permFS, rel string) error {
+		return p.Chmod(rel, mode)
+	})
+}
+
+func (s *Service) handleChown(ctx *kernel.Context, msg kernel.Message) {
+	reply := msg.Cap
+	requestID, uid, gid, path, ok := proto.DecodeVFSChownPayload(msg.Payload())
+	if !ok {
+		_ = s.sendErr(ctx, reply, proto.ErrBadMessage, proto.MsgVFSChown, 0, "decode chown")
+		return
+	}
+	if s.denied(ctx, reply, proto.MsgVFSChown, requestID, path, accAdmin) {
+		return
+	}
+	s.setAttrs(ctx, reply, proto.MsgVFSChown, proto.MsgVFSChownResp, requestID, path, func(p permFS, rel string) error {
+		return p.Chown(rel, uid, gid)
+	})
+}
+
+// setAttrs applies fn to the backend serving path.
+func (s *Service) setAttrs(
+	ctx *kernel.Context,
+	reply kernel.Capability,
+	ref, resp proto.Kind,
+	requestID uint32,
+	path string,
+	fn func(p permFS, rel string) error,
+) {
+	backend, rel, ok := s.resolve(path)
+	if !ok {
+		s.sendResolveErr(ctx, reply, ref, requestID, path)
+		return
+	}
+	p, ok := backend.(permFS)
+	if !ok {
+		_ = s.sendErr(ctx, reply, proto.ErrBadMessage, ref, requestID, "filesystem has no permissions")
+		return
+	}
+	if err := fn(p, rel); err != nil {
+		_ = s.sendErr(ctx, reply, mapVFSError(err), ref, requestID, err.Error())
+		return
+	}
+	_ = s.send(ctx, reply, resp, proto.VFSAttrRespPayload(requestID))
+}
@@ -0,0 +1,214 @@
+package vfs
+
+import (
+	"testing"
+
+	vfsclient "spark/sparkos/client/vfs"
+	"spark/sparkos/fs/littlefs"
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+)
+
+// treeFS keeps the metadata of a few entries and supports permissions.
+type treeFS struct {
+	dummyFS
+	entries map[string]littlefs.Info
+}
+
+func (t *treeFS) Stat(path string) (littlefs.Info, error) {
+	info, ok := t.entries[path]
+	if !ok {
+		return littlefs.Info{}, littlefs.ErrNotFound
+	}
+	return info, nil
+}
+
+func (t *treeFS) Mkdir(path string) error {
+	t.entries[path] = littlefs.Info{Type: littlefs.TypeDir, Mode: littlefs.DefaultDirMode}
+	return nil
+}
+
+func (t *treeFS) OpenWriter(path string, _ littlefs.WriteMode) (writeHandle, error) {
+	if _, ok := t.entries[path]; !ok {
+		t.entries[path] = littlefs.Info{Type: littlefs.TypeFile, Mode: littlefs.DefaultFileMode}
+	}
+	return &memWriter{}, nil
+}
+
+func (t *treeFS) Chmod(path string, mode uint16) error {
+	info, ok := t.entries[path]
+	if !ok {
+		return littlefs.ErrNotFound
+	}
+	info.Mode = mode
+	t.entries[path] = info
+	return nil
+}
+
+func (t *treeFS) Chown(path string, uid, gid uint32) error {
+	info, ok := t.entries[path]
+	if !ok {
+		return littlefs.ErrNotFound
+	}
+	info.UID, info.GID = uid, gid
+	t.entries[path] = info
+	return nil
+}
+
+func TestCredentialsArePermissionChecked(t *testing.T) {
+	dir := func(mode uint16, uid, gid uint32) littlefs.Info {
+		return littlefs.Info{Type: littlefs.TypeDir, Mode: mode, UID: uid, GID: gid}
+	}
+	file := func(mode uint16, uid, gid uint32) littlefs.Info {
+		return littlefs.Info{Type: littlefs.TypeFile, Size: 4, Mode: mode, UID: uid, GID: gid}
+	}
+	tree := &treeFS{entries: map[string]littlefs.Info{
+		"/":               dir(0o755, 0, 0),
+		"/etc":            dir(0o755, 0, 0),
+		"/etc/users":      file(0o644, 0, 0),
+		"/home":           dir(0o755, 0, 0),
+		"/home/alice":     dir(0o755, 1000, 100),
+		"/home/bob":       dir(0o755, 1001, 100),
+		"/home/bob/notes": file(0o600, 1001, 100),
+		"/home/bob/share": file(0o664, 1001, 100),
+		// A private home hides its world-readable files.
+		"/home/carol":       dir(0o700, 1003, 103),
+		"/home/carol/notes": file(0o644, 1003, 103),
+	}}
+
+	k := kernel.New()
+	ep := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	auth := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	sys := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	s := NewWith(nil, ep.Restrict(kernel.RightRecv), Options{
+		SystemCap: sys.Restrict(kernel.RightRecv),
+		AuthCap:   auth.Restrict(kernel.RightRecv),
+	})
+	s.attach("/", "flash", tree)
+	k.AddTask(s)
+
+	runClient(t, k, func(ctx *kernel.Context) {
+		authCap := auth.Restrict(kernel.RightSend)
+		aliceCred, err := vfsclient.IssueCred(ctx, authCap, proto.VFSCred{UID: 1000, GID: 100})
+		if err != nil {
+			t.Errorf("IssueCred: %v", err)
+			return
+		}
+		if again, err := vfsclient.IssueCred(ctx, authCap, proto.VFSCred{UID: 1000, GID: 100}); err != nil || again != aliceCred {
+			t.Errorf("second IssueCred = %v, %v; want the same credential", again, err)
+		}
+		alice := vfsclient.New(aliceCred)
+
+		for _, p := range []string{"/etc/users", "/home/bob/notes", "/home/alice/../../etc/users"} {
+			if _, _, err := alice.ReadAt(ctx, p, 0, 4); err == nil {
+				t.Errorf("alice read %s", p)
+			}
+		}
+		if _, _, err := alice.ReadAt(ctx, "/home/bob/share", 0, 4); err != nil {
+			t.Errorf("alice could not read a group-readable file: %v", err)
+		}
+		if _, _, err := alice.ReadAt(ctx, "/home/carol/notes", 0, 4); err == nil {
+			t.Error("alice read a file in a private home")
+		}
+		if _, _, err := alice.Stat(ctx, "/home/carol/notes"); err == nil {
+			t.Error("alice looked into a private home")
+		}
+		if _, err := alice.Write(ctx, "/etc/users", proto.VFSWriteTruncate, []byte("x")); err == nil {
+			t.Error("alice overwrote /etc/users")
+		}
+		if _, err := alice.Write(ctx, "/home/bob/share", proto.VFSWriteTruncate, []byte("x")); err != nil {
+			t.Errorf("alice could not write a group-writable file: %v", err)
+		}
+		if err := alice.Mkdir(ctx, "/x"); err == nil {
+			t.Error("alice created a directory in /")
+		}
+		if err := alice.Mount(ctx, "sd", "/card"); err == nil {
+			t.Error("alice mounted a filesystem")
+		}
+
+		if _, err := alice.Write(ctx, "/home/alice/a", proto.VFSWriteTruncate, []byte("x")); err != nil {
+			t.Errorf("alice could not write in her home: %v", err)
+		}
+		if err := alice.Chmod(ctx, "/home/alice/a", 0o600); err != nil {
+			t.Errorf("alice could not chmod her file: %v", err)
+		}
+		if err := alice.Chmod(ctx, "/home/bob/share", 0o666); err == nil {
+			t.Error("alice changed the mode of bob's file")
+		}
+		if err := alice.Chown(ctx, "/home/alice/a", 1001, 100); err == nil {
+			t.Error("alice gave a file away")
+		}
+
+		// /tmp is a tmpfs whose root is sticky.
+		bobCred, err := vfsclient.IssueCred(ctx, authCap, proto.VFSCred{UID: 1001, GID: 100})
+		if err != nil {
+			t.Errorf("IssueCred(bob): %v", err)
+			return
+		}
+		bob := vfsclient.New(bobCred)
+		if _, err := bob.Write(ctx, "/tmp/bob", proto.VFSWriteTruncate, []byte("x")); err != nil {
+			t.Errorf("bob could not create a file in /tmp: %v", err)
+		}
+		if err := bob.Chmod(ctx, "/tmp/bob", 0o666); err != nil {
+			t.Errorf("bob could not chmod his file in /tmp: %v", err)
+		}
+		if _, err := alice.Write(ctx, "/tmp/bob", proto.VFSWriteTruncate, []byte("x")); err != nil {
+			t.Errorf("alice could not write a world-writable file in /tmp: %v", err)
+		}
+		if err := alice.Remove(ctx, "/tmp/bob"); err == nil {
+			t.Error("alice removed bob's file from a sticky directory")
+		}
+		if err := alice.Rename(ctx, "/home/alice/a", "/tmp/bob"); err == nil {
+			t.Error("alice replaced bob's file in a sticky directory")
+		}
+		if _, err := alice.Write(ctx, "/tmp/mine", proto.VFSWriteTruncate, []byte("x")); err != nil {
+			t.Errorf("alice could not create a file in /tmp: %v", err)
+		}
+		if err := alice.Remove(ctx, "/tmp/mine"); err != nil {
+			t.Errorf("alice could not remove her file from /tmp: %v", err)
+		}
+
+		admin, err := vfsclient.IssueCred(ctx, authCap, proto.VFSCred{UID: 1002, GID: 0, Admin: true})
+		if err != nil {
+			t.Errorf("IssueCred(admin): %v", err)
+			return
+		}
+		if _, _, err := vfsclient.New(admin).ReadAt(ctx, "/etc/users", 0, 4); err != nil {
+			t.Errorf("admin could not read /etc/users: %v", err)
+		}
+
+		if _, err := vfsclient.IssueCred(ctx, ep.Restrict(kernel.RightSend), proto.VFSCred{Admin: true}); err == nil {
+			t.Error("the public endpoint issued a credential")
+		}
+
+		public := vfsclient.New(ep.Restrict(kernel.RightSend))
+		if _, _, err := public.ReadAt(ctx, "/etc/users", 0, 4); err == nil {
+			t.Error("the public endpoint read /etc/users")
+		}
+		if _, err := public.Write(ctx, "/home/bob/share", proto.VFSWriteTruncate, []byte("x")); err == nil {
+			t.Error("the public endpoint wrote a file of bob's")
+		}
+		if _, _, err := public.ReadAt(ctx, "/home/bob/share", 0, 4); err != nil {
+			t.Errorf("the public endpoint could not read a world-readable file: %v", err)
+		}
+		if _, _, err := public.ReadAt(ctx, "/home/carol/notes", 0, 4); err == nil {
+			t.Error("the public endpoint read a file in a private home")
+		}
+		carolCred, err := vfsclient.IssueCred(ctx, authCap, proto.VFSCred{UID: 1003, GID: 103})
+		if err != nil {
+			t.Errorf("IssueCred(carol): %v", err)
+			return
+		}
+		if _, _, err := vfsclient.New(carolCred).ReadAt(ctx, "/home/carol/notes", 0, 4); err != nil {
+			t.Errorf("carol could not read her own file: %v", err)
+		}
+		system := vfsclient.New(sys.Restrict(kernel.RightSend))
+		if _, err := system.Write(ctx, "/etc/users", proto.VFSWriteTruncate, []byte("root")); err != nil {
+			t.Errorf("the system endpoint could not write /etc/users: %v", err)
+		}
+	})
+
+	if got := tree.entries["/home/alice/a"]; got.UID != 1000 || got.GID != 100 || got.Mode != 0o600 {
+		t.Errorf("/home/alice/a = uid %d gid %d mode %o; want alice's, 0600", got.UID, got.GID, got.Mode)
+	}
+}
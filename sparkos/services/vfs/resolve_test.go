@@ -3,7 +3,11 @@ package vfs
 import (
 	"testing"
 
+	vfsclient "spark/sparkos/client/vfs"
 	"spark/sparkos/fs/littlefs"
+	"spark/sparkos/fs/tmpfs"
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
 )
 
 type dummyFS struct{}
@@ -15,9 +19,11 @@ func (dummyFS) Rename(string, string) error
 func (dummyFS) Stat(string) (littlefs.Info, error)                               { return littlefs.Info{}, nil }
 func (dummyFS) ReadAt(string, []byte, uint32) (int, bool, error)                 { return 0, true, nil }
 func (dummyFS) OpenWriter(string, littlefs.WriteMode) (writeHandle, error)       { return nil, nil }
+func (dummyFS) OpenFile(string, int) (fileHandle, error)                         { return nil, littlefs.ErrNotFound }
 
 func TestResolve_SDWithoutFlash(t *testing.T) {
 	s := &Service{sd: dummyFS{}}
+	s.mountDefaults(nil)
 
 	fs, rel, ok := s.resolve("/sd")
 	if !ok || fs == nil || rel != "/" {
@@ -36,3 +42,159 @@ func TestResolve_SDWithoutFlash(t *testing.T) {
 		t.Fatalf("resolve(/etc) ok=true; want ok=false when flash fs is nil")
 	}
 }
+
+func TestResolveLongestMount(t *testing.T) {
+	root, sd := &memFS{}, &memFS{}
+	s := &Service{}
+	s.attach("/", "flash", root)
+	s.attach("/sd", "sd", sd)
+
+	for _, tc := range []struct {
+		path string
+		fs   fsHandle
+		rel  string
+	}{
+		{"/etc/rc", root, "/etc/rc"},
+		{"/sd", sd, "/"},
+		{"/sd/a/b", sd, "/a/b"},
+		{"/sdcard", root, "/sdcard"},
+	} {
+		fs, rel, ok := s.resolve(tc.path)
+		if !ok || fs != tc.fs || rel != tc.rel {
+			t.Errorf("resolve(%s) = ok=%v rel=%q; want ok=true rel=%q on its mount", tc.path, ok, rel, tc.rel)
+		}
+	}
+}
+
+func TestMountUnmount(t *testing.T) {
+	k := kernel.New()
+	ep := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	startService(k, &Service{sd: &memFS{data: testData(10)}}, ep)
+
+	runClient(t, k, func(ctx *kernel.Context) {
+		c := vfsclient.New(ep.Restrict(kernel.RightSend))
+
+		mounts, err := c.Mounts(ctx)
+		if err != nil || len(mounts) != 1 || mounts[0].Path != "/sd" || mounts[0].Type != "fat" {
+			t.Errorf("Mounts = %+v, %v; want sd on /sd", mounts, err)
+			return
+		}
+		ents, err := c.List(ctx, "/")
+		if err != nil || len(ents) != 1 || ents[0].Name != "sd" || ents[0].Type != proto.VFSEntryDir {
+			t.Errorf("List(/) = %+v, %v; want the sd mount point", ents, err)
+		}
+		if err := c.Mount(ctx, "sd", "/card"); err == nil {
+			t.Error("mounted sd twice")
+		}
+		if err := c.Mount(ctx, "nope", "/x"); err == nil {
+			t.Error("mounted an unknown source")
+		}
+
+		w, err := c.OpenWriter(ctx, "/sd/f", proto.VFSWriteTruncate)
+		if err != nil {
+			t.Errorf("OpenWriter: %v", err)
+			return
+		}
+		if err := c.Unmount(ctx, "/sd"); err == nil {
+			t.Error("unmounted /sd with a file open for writing")
+		}
+		if _, err := w.Close(); err != nil {
+			t.Errorf("Close: %v", err)
+		}
+		if err := c.Unmount(ctx, "/sd"); err != nil {
+			t.Errorf("Unmount: %v", err)
+		}
+		if _, _, err := c.ReadAt(ctx, "/sd/f", 0, 4); err == nil {
+			t.Error("read from an unmounted path")
+		}
+
+		if err := c.Mount(ctx, "sd", "/card"); err != nil {
+			t.Errorf("Mount(sd, /card): %v", err)
+		}
+		if got, _, err := c.ReadAt(ctx, "/card/f", 0, 4); err != nil || len(got) != 4 {
+			t.Errorf("ReadAt(/card/f) = %d bytes, %v", len(got), err)
+		}
+	})
+}
+
+// metaFS holds one file with timestamps and an owner.
+type metaFS struct {
+	dummyFS
+	info littlefs.Info
+}
+
+func (m metaFS) Stat(string) (littlefs.Info, error) { return m.info, nil }
+
+func (m metaFS) ListDir(_ string, fn func(string, littlefs.Info) bool) error {
+	fn("f", m.info)
+	return nil
+}
+
+func TestStatAndListCarryMeta(t *testing.T) {
+	k := kernel.New()
+	ep := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	info := littlefs.Info{Type: littlefs.TypeFile, Size: 5, Mtime: 1700000000, Ctime: 1600000000, UID: 7}
+	startService(k, &Service{sd: metaFS{info: info}}, ep)
+
+	runClient(t, k, func(ctx *kernel.Context) {
+		c := vfsclient.New(ep.Restrict(kernel.RightSend))
+		e, err := c.StatEntry(ctx, "/sd/f")
+		if err != nil || e.Name != "f" || e.Size != 5 || e.UID != 7 ||
+			e.Mtime.Unix() != info.Mtime || e.Ctime.Unix() != info.Ctime {
+			t.Errorf("StatEntry = %+v, %v", e, err)
+		}
+
+		ents, err := c.List(ctx, "/sd")
+		if err != nil || len(ents) != 1 || ents[0].Mtime.Unix() != info.Mtime || ents[0].UID != 7 {
+			t.Errorf("List = %+v, %v", ents, err)
+		}
+
+		// Mount points have no metadata of their own.
+		e, err = c.StatEntry(ctx, "/sd")
+		if err != nil || e.Type != proto.VFSEntryDir || !e.Mtime.IsZero() {
+			t.Errorf("StatEntry(/sd) = %+v, %v", e, err)
+		}
+	})
+}
+
+func TestTmpMount(t *testing.T) {
+	k := kernel.New()
+	ep := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	startService(k, &Service{tmpBytes: tmpfs.NodeBytes + 8}, ep)
+
+	runClient(t, k, func(ctx *kernel.Context) {
+		c := vfsclient.New(ep.Restrict(kernel.RightSend))
+
+		if _, err := c.Write(ctx, "/tmp/a", proto.VFSWriteTruncate, []byte("12345")); err != nil {
+			t.Errorf("Write(/tmp/a): %v", err)
+		}
+		if _, err := c.Write(ctx, "/tmp/b", proto.VFSWriteTruncate, []byte("6789")); err == nil {
+			t.Error("wrote past the tmpfs budget")
+		}
+		if err := c.Mount(ctx, "tmp", "/scratch"); err != nil {
+			t.Errorf("Mount(tmp, /scratch): %v", err)
+		}
+		if _, _, err := c.ReadAt(ctx, "/scratch/a", 0, 4); err == nil {
+			t.Error("a second tmp mount shares files with /tmp")
+		}
+
+		mounts, err := c.Mounts(ctx)
+		if err != nil || len(mounts) != 2 {
+			t.Errorf("Mounts = %+v, %v; want two tmpfs mounts", mounts, err)
+			return
+		}
+		if m := mounts[1]; m.Path != "/tmp" || m.Type != "tmpfs" || !m.HasUsage || m.Total != tmpfs.NodeBytes+8 || m.Used != tmpfs.NodeBytes+5 {
+			t.Errorf("Mounts[1] = %+v; want /tmp with one 5-byte file", m)
+		}
+
+		if err := c.Unmount(ctx, "/tmp"); err != nil {
+			t.Errorf("Unmount: %v", err)
+		}
+		if err := c.Mount(ctx, "tmp", "/tmp"); err != nil {
+			t.Errorf("Mount(tmp, /tmp): %v", err)
+		}
+		if _, _, err := c.ReadAt(ctx, "/tmp/a", 0, 4); err == nil {
+			t.Error("/tmp kept its files across a remount")
+		}
+	})
+}
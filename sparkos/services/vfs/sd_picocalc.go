@@ -60,11 +60,7 @@ func (fs *sdFatFS) ListDir(path string, fn func(name string, info littlefs.Info)
 		if name == "." || name == ".." {
 			continue
 		}
-		typ := littlefs.TypeFile
-		if e.IsDir() {
-			typ = littlefs.TypeDir
-		}
-		if !fn(name, littlefs.Info{Type: typ, Size: uint32(e.Size())}) {
+		if !fn(name, fatInfo(e)) {
 			return nil
 		}
 	}
@@ -100,11 +96,22 @@ func (fs *sdFatFS) Stat(path string) (littlefs.Info, error) {
 	if err != nil {
 		return littlefs.Info{}, mapFatErr("stat", err)
 	}
-	typ := littlefs.TypeFile
+	return fatInfo(fi), nil
+}
+
+// fatInfo converts a FAT directory entry. FAT keeps no owner or permissions,
+// so everything belongs to uid 0 and is open to all, and tinyfs reports only
+// the modification time, so Ctime stays unknown.
+func fatInfo(fi os.FileInfo) littlefs.Info {
+	info := littlefs.Info{Type: littlefs.TypeFile, Size: uint32(fi.Size()), Mode: 0o666}
 	if fi.IsDir() {
-		typ = littlefs.TypeDir
+		info.Type = littlefs.TypeDir
+		info.Mode = 0o777
+	}
+	if mt := fi.ModTime(); !mt.IsZero() {
+		info.Mtime = mt.Unix()
 	}
-	return littlefs.Info{Type: typ, Size: uint32(fi.Size())}, nil
+	return info
 }
 
 func (fs *sdFatFS) ReadAt(path string, p []byte, off uint32) (n int, eof bool, err error) {
@@ -156,6 +163,63 @@ func (fs *sdFatFS) OpenWriter(path string, mode littlefs.WriteMode) (writeHandle
 	return &sdWriter{f: f}, nil
 }
 
+func (fs *sdFatFS) OpenFile(path string, flag int) (fileHandle, error) {
+	if fs == nil || fs.fat == nil {
+		return nil, errors.New("sd: not ready")
+	}
+	f, err := fs.fat.OpenFile(path, flag)
+	if err != nil {
+		return nil, mapFatErr("open", err)
+	}
+	return &sdFile{f: f}, nil
+}
+
+// sdFile is a FAT file kept open between requests. Truncate and Sync are
+// used when the FAT driver provides them.
+type sdFile struct {
+	f tinyfs.File
+}
+
+func (f *sdFile) Read(p []byte) (int, error) {
+	n, err := f.f.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return n, mapFatErr("read", err)
+	}
+	if n == 0 && len(p) > 0 && err == nil {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *sdFile) Write(p []byte) (int, error) {
+	n, err := f.f.Write(p)
+	return n, mapFatErr("write", err)
+}
+
+func (f *sdFile) Seek(off int64, whence int) (int64, error) {
+	pos, err := f.f.Seek(off, whence)
+	return pos, mapFatErr("seek", err)
+}
+
+func (f *sdFile) Truncate(size int64) error {
+	t, ok := f.f.(interface{ Truncate(int64) error })
+	if !ok {
+		return fmt.Errorf("sd truncate: %w", littlefs.ErrInvalid)
+	}
+	return mapFatErr("truncate", t.Truncate(size))
+}
+
+func (f *sdFile) Sync() error {
+	if s, ok := f.f.(interface{ Sync() error }); ok {
+		return mapFatErr("sync", s.Sync())
+	}
+	return nil
+}
+
+func (f *sdFile) Close() error {
+	return mapFatErr("close", f.f.Close())
+}
+
 type sdWriter struct {
 	f       tinyfs.File
 	written uint32
@@ -3,7 +3,6 @@ package vfs
 import (
 	"errors"
 	"fmt"
-	"strings"
 
 	"spark/hal"
 	"spark/sparkos/fs/littlefs"
@@ -13,21 +12,83 @@ import (
 
 type Service struct {
 	inCap kernel.Capability
-	flash hal.Flash
+	// sysCap is served with the system identity.
+	sysCap kernel.Capability
+	// authCap receives MsgVFSCredIssue; only the login authority holds it.
+	authCap kernel.Capability
+	flash   hal.Flash
+	// tmpBytes is the budget of each tmp mount. NewWith always sets it; a
+	// Service without it, as in tests, cannot mount tmp.
+	tmpBytes uint64
 
 	fs *littlefs.FS
 	sd fsHandle
 
-	writers map[uint32]*writeSession
+	// mounts is the mount table, sorted by path.
+	mounts []mount
+
+	writers map[writeKey]*writeSession
+
+	// files are the handles returned by MsgVFSOpen.
+	files      map[uint32]*openFile
+	nextHandle uint32
+
+	// creds are the credential endpoints issued so far; their requests
+	// arrive on credIn. caller is the identity of the request being handled.
+	creds  []credEndpoint
+	credIn chan credRequest
+	caller proto.VFSCred
+}
+
+// writeKey names a write session. Request IDs are chosen by clients, so the
+// session also belongs to the task that opened it.
+type writeKey struct {
+	sender    kernel.Sender
+	requestID uint32
 }
 
 type writeSession struct {
 	reply  kernel.Capability
 	writer writeHandle
+	fs     fsHandle
+	// cred is the identity that opened the session; only it may use it.
+	cred proto.VFSCred
+}
+
+// writer returns the write session of requestID opened by the sender of msg
+// with the caller's identity.
+func (s *Service) writer(msg kernel.Message, requestID uint32) (writeKey, *writeSession) {
+	key := writeKey{sender: msg.Sender, requestID: requestID}
+	sess := s.writers[key]
+	if sess == nil || sess.writer == nil || sess.cred != s.caller {
+		return key, nil
+	}
+	return key, sess
+}
+
+// Options configure a Service beyond its flash and public endpoint.
+type Options struct {
+	// SystemCap receives requests served with the system identity, for the
+	// services trusted with everything. Requests on the public endpoint run
+	// as nobody.
+	SystemCap kernel.Capability
+	// AuthCap receives MsgVFSCredIssue, which issues credentials.
+	AuthCap kernel.Capability
+	// TmpBytes is the byte budget of the tmpfs mounted at /tmp; 0 means
+	// DefaultTmpBytes.
+	TmpBytes uint64
 }
 
 func New(flash hal.Flash, inCap kernel.Capability) *Service {
-	return &Service{flash: flash, inCap: inCap}
+	return NewWith(flash, inCap, Options{})
+}
+
+// NewWith is New with opts.
+func NewWith(flash hal.Flash, inCap kernel.Capability, opts Options) *Service {
+	if opts.TmpBytes == 0 {
+		opts.TmpBytes = DefaultTmpBytes
+	}
+	return &Service{flash: flash, inCap: inCap, sysCap: opts.SystemCap, authCap: opts.AuthCap, tmpBytes: opts.TmpBytes}
 }
 
 type writeHandle interface {
@@ -44,6 +105,8 @@ type fsHandle interface {
 	Stat(path string) (littlefs.Info, error)
 	ReadAt(path string, p []byte, off uint32) (n int, eof bool, err error)
 	OpenWriter(path string, mode littlefs.WriteMode) (writeHandle, error)
+	// OpenFile opens path with os.O_* flags.
+	OpenFile(path string, flag int) (fileHandle, error)
 }
 
 type flashFS struct {
@@ -63,6 +126,14 @@ func (f flashFS) ReadAt(path string, p []byte, off uint32) (int, bool, error) {
 func (f flashFS) OpenWriter(path string, mode littlefs.WriteMode) (writeHandle, error) {
 	return f.fs.OpenWriter(path, mode)
 }
+func (f flashFS) OpenFile(path string, flag int) (fileHandle, error) {
+	file, err := f.fs.OpenFile(path, flag)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+func (f flashFS) Usage() (total, used uint64, err error) { return f.fs.Usage() }
 
 func (s *Service) Run(ctx *kernel.Context) {
 	ch, ok := ctx.RecvChan(s.inCap)
@@ -70,7 +141,6 @@ func (s *Service) Run(ctx *kernel.Context) {
 		return
 	}
 
-	s.sd = s.initSD(ctx)
 	if s.flash != nil {
 		fs, err := littlefs.New(s.flash, littlefs.Options{})
 		if err == nil {
@@ -80,37 +150,104 @@ func (s *Service) Run(ctx *kernel.Context) {
 			s.fs = fs
 		}
 	}
+	s.mountDefaults(ctx)
 
 	if s.writers == nil {
-		s.writers = make(map[uint32]*writeSession)
-	}
-
-	for msg := range ch {
-		switch proto.Kind(msg.Kind) {
-		case proto.MsgVFSList:
-			s.handleList(ctx, msg)
-		case proto.MsgVFSMkdir:
-			s.handleMkdir(ctx, msg)
-		case proto.MsgVFSRemove:
-			s.handleRemove(ctx, msg)
-		case proto.MsgVFSRename:
-			s.handleRename(ctx, msg)
-		case proto.MsgVFSCopy:
-			s.handleCopy(ctx, msg)
-		case proto.MsgVFSStat:
-			s.handleStat(ctx, msg)
-		case proto.MsgVFSRead:
-			s.handleRead(ctx, msg)
-		case proto.MsgVFSWriteOpen:
-			s.handleWriteOpen(ctx, msg)
-		case proto.MsgVFSWriteChunk:
-			s.handleWriteChunk(ctx, msg)
-		case proto.MsgVFSWriteClose:
-			s.handleWriteClose(ctx, msg)
+		s.writers = make(map[writeKey]*writeSession)
+	}
+
+	var sysCh, authCh <-chan kernel.Message
+	if s.sysCap.Valid() {
+		sysCh, _ = ctx.RecvChan(s.sysCap)
+	}
+	if s.authCap.Valid() {
+		authCh, _ = ctx.RecvChan(s.authCap)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	s.credIn = make(chan credRequest)
+
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			s.handleAs(ctx, msg, publicCred)
+		case msg := <-sysCh:
+			s.handle(ctx, msg)
+		case msg := <-authCh:
+			s.handleAuth(ctx, msg, done)
+		case r := <-s.credIn:
+			s.handleAs(ctx, r.msg, r.cred)
 		}
 	}
 }
 
+// handle serves a request with the system identity.
+func (s *Service) handle(ctx *kernel.Context, msg kernel.Message) {
+	s.handleAs(ctx, msg, systemCred)
+}
+
+// handleAs serves a request with the identity cred.
+func (s *Service) handleAs(ctx *kernel.Context, msg kernel.Message, cred proto.VFSCred) {
+	if len(s.files) > 0 {
+		s.closeOrphans(ctx)
+	}
+	s.caller = cred
+
+	switch proto.Kind(msg.Kind) {
+	case proto.MsgVFSList:
+		s.handleList(ctx, msg)
+	case proto.MsgVFSMkdir:
+		s.handleMkdir(ctx, msg)
+	case proto.MsgVFSRemove:
+		s.handleRemove(ctx, msg)
+	case proto.MsgVFSRename:
+		s.handleRename(ctx, msg)
+	case proto.MsgVFSCopy:
+		s.handleCopy(ctx, msg)
+	case proto.MsgVFSStat:
+		s.handleStat(ctx, msg)
+	case proto.MsgVFSRead:
+		s.handleRead(ctx, msg)
+	case proto.MsgVFSReadShared:
+		s.handleReadShared(ctx, msg)
+	case proto.MsgVFSWriteOpen:
+		s.handleWriteOpen(ctx, msg)
+	case proto.MsgVFSWriteChunk:
+		s.handleWriteChunk(ctx, msg)
+	case proto.MsgVFSWriteShared:
+		s.handleWriteShared(ctx, msg)
+	case proto.MsgVFSWriteClose:
+		s.handleWriteClose(ctx, msg)
+	case proto.MsgVFSMount:
+		s.handleMount(ctx, msg)
+	case proto.MsgVFSUnmount:
+		s.handleUnmount(ctx, msg)
+	case proto.MsgVFSMounts:
+		s.handleMounts(ctx, msg)
+	case proto.MsgVFSOpen:
+		s.handleOpen(ctx, msg)
+	case proto.MsgVFSFileRead:
+		s.handleFileRead(ctx, msg)
+	case proto.MsgVFSFileWrite:
+		s.handleFileWrite(ctx, msg)
+	case proto.MsgVFSFileSeek:
+		s.handleFileSeek(ctx, msg)
+	case proto.MsgVFSFileTruncate:
+		s.handleFileTruncate(ctx, msg)
+	case proto.MsgVFSFileSync, proto.MsgVFSFileClose:
+		s.handleFileSyncClose(ctx, msg)
+	case proto.MsgVFSChmod:
+		s.handleChmod(ctx, msg)
+	case proto.MsgVFSChown:
+		s.handleChown(ctx, msg)
+	case proto.MsgVFSCredIssue:
+		_ = s.sendErr(ctx, msg.Cap, proto.ErrUnauthorized, proto.MsgVFSCredIssue, 0, "credentials are issued on the auth endpoint")
+	}
+}
+
 func (s *Service) handleList(ctx *kernel.Context, msg kernel.Message) {
 	reply := msg.Cap
 	requestID, path, ok := proto.DecodeVFSListPayload(msg.Payload())
@@ -119,33 +256,31 @@ func (s *Service) handleList(ctx *kernel.Context, msg kernel.Message) {
 		return
 	}
 
-	if path == "/" && s.fs == nil {
-		if s.sd != nil {
-			_ = s.send(ctx, reply, proto.MsgVFSListResp, proto.VFSListRespPayload(requestID, false, proto.VFSEntryDir, 0, "sd"))
-			_ = s.send(ctx, reply, proto.MsgVFSListResp, proto.VFSListRespPayload(requestID, true, proto.VFSEntryUnknown, 0, ""))
-			return
-		}
-		_ = s.sendErr(ctx, reply, proto.ErrInternal, proto.MsgVFSList, requestID, "vfs not ready")
+	if s.denied(ctx, reply, proto.MsgVFSList, requestID, path, accRead) {
 		return
 	}
-
+	children := s.mountChildren(path)
 	backend, rel, ok := s.resolve(path)
-	if !ok {
-		if isSDPath(path) {
-			_ = s.sendErr(ctx, reply, proto.ErrNotFound, proto.MsgVFSList, requestID, "sd not available")
-		} else if s.fs == nil {
-			_ = s.sendErr(ctx, reply, proto.ErrInternal, proto.MsgVFSList, requestID, "vfs not ready")
-		} else {
-			_ = s.sendErr(ctx, reply, proto.ErrBadMessage, proto.MsgVFSList, requestID, "invalid path")
-		}
+	if !ok && len(children) == 0 {
+		s.sendResolveErr(ctx, reply, proto.MsgVFSList, requestID, path)
 		return
 	}
 
-	if path == "/" && s.sd != nil {
-		_ = s.send(ctx, reply, proto.MsgVFSListResp, proto.VFSListRespPayload(requestID, false, proto.VFSEntryDir, 0, "sd"))
+	mounted := make(map[string]bool, len(children))
+	for _, name := range children {
+		mounted[name] = true
+		_ = s.send(ctx, reply, proto.MsgVFSListResp, proto.VFSListRespPayload(requestID, false, proto.VFSEntryDir, 0, mountMeta, name))
+	}
+	if !ok {
+		_ = s.send(ctx, reply, proto.MsgVFSListResp, proto.VFSListRespPayload(requestID, true, proto.VFSEntryUnknown, 0, proto.VFSMeta{}, ""))
+		return
 	}
 
+	// A directory that only holds mount points need not exist below them.
 	if err := backend.ListDir(rel, func(name string, info littlefs.Info) bool {
+		if mounted[name] {
+			return true
+		}
 		typ := proto.VFSEntryUnknown
 		switch info.Type {
 		case littlefs.TypeFile:
@@ -153,14 +288,14 @@ func (s *Service) handleList(ctx *kernel.Context, msg kernel.Message) {
 		case littlefs.TypeDir:
 			typ = proto.VFSEntryDir
 		}
-		_ = s.send(ctx, reply, proto.MsgVFSListResp, proto.VFSListRespPayload(requestID, false, typ, info.Size, name))
+		_ = s.send(ctx, reply, proto.MsgVFSListResp, proto.VFSListRespPayload(requestID, false, typ, info.Size, metaOf(info), name))
 		return true
-	}); err != nil {
+	}); err != nil && (len(children) == 0 || !errors.Is(err, littlefs.ErrNotFound)) {
 		_ = s.sendErr(ctx, reply, mapVFSError(err), proto.MsgVFSList, requestID, err.Error())
 		return
 	}
 
-	_ = s.send(ctx, reply, proto.MsgVFSListResp, proto.VFSListRespPayload(requestID, true, proto.VFSEntryUnknown, 0, ""))
+	_ = s.send(ctx, reply, proto.MsgVFSListResp, proto.VFSListRespPayload(requestID, true, proto.VFSEntryUnknown, 0, proto.VFSMeta{}, ""))
 }
 
 func (s *Service) handleMkdir(ctx *kernel.Context, msg kernel.Message) {
@@ -171,21 +306,19 @@ func (s *Service) handleMkdir(ctx *kernel.Context, msg kernel.Message) {
 		return
 	}
 
+	if s.denied(ctx, reply, proto.MsgVFSMkdir, requestID, path, accParent) {
+		return
+	}
 	backend, rel, ok := s.resolve(path)
 	if !ok {
-		if isSDPath(path) {
-			_ = s.sendErr(ctx, reply, proto.ErrNotFound, proto.MsgVFSMkdir, requestID, "sd not available")
-		} else if s.fs == nil {
-			_ = s.sendErr(ctx, reply, proto.ErrInternal, proto.MsgVFSMkdir, requestID, "vfs not ready")
-		} else {
-			_ = s.sendErr(ctx, reply, proto.ErrBadMessage, proto.MsgVFSMkdir, requestID, "invalid path")
-		}
+		s.sendResolveErr(ctx, reply, proto.MsgVFSMkdir, requestID, path)
 		return
 	}
 	if err := backend.Mkdir(rel); err != nil {
 		_ = s.sendErr(ctx, reply, mapVFSError(err), proto.MsgVFSMkdir, requestID, err.Error())
 		return
 	}
+	s.own(backend, rel)
 	_ = s.send(ctx, reply, proto.MsgVFSMkdirResp, proto.VFSMkdirRespPayload(requestID))
 }
 
@@ -197,15 +330,12 @@ func (s *Service) handleRemove(ctx *kernel.Context, msg kernel.Message) {
 		return
 	}
 
+	if s.denied(ctx, reply, proto.MsgVFSRemove, requestID, path, accParent) {
+		return
+	}
 	backend, rel, ok := s.resolve(path)
 	if !ok {
-		if isSDPath(path) {
-			_ = s.sendErr(ctx, reply, proto.ErrNotFound, proto.MsgVFSRemove, requestID, "sd not available")
-		} else if s.fs == nil {
-			_ = s.sendErr(ctx, reply, proto.ErrInternal, proto.MsgVFSRemove, requestID, "vfs not ready")
-		} else {
-			_ = s.sendErr(ctx, reply, proto.ErrBadMessage, proto.MsgVFSRemove, requestID, "invalid path")
-		}
+		s.sendResolveErr(ctx, reply, proto.MsgVFSRemove, requestID, path)
 		return
 	}
 	if err := backend.Remove(rel); err != nil {
@@ -223,26 +353,18 @@ func (s *Service) handleRename(ctx *kernel.Context, msg kernel.Message) {
 		return
 	}
 
+	if s.denied(ctx, reply, proto.MsgVFSRename, requestID, oldPath, accParent) ||
+		s.denied(ctx, reply, proto.MsgVFSRename, requestID, newPath, accParent) {
+		return
+	}
 	oldFS, oldRel, ok := s.resolve(oldPath)
 	if !ok {
-		if isSDPath(oldPath) {
-			_ = s.sendErr(ctx, reply, proto.ErrNotFound, proto.MsgVFSRename, requestID, "sd not available")
-		} else if s.fs == nil {
-			_ = s.sendErr(ctx, reply, proto.ErrInternal, proto.MsgVFSRename, requestID, "vfs not ready")
-		} else {
-			_ = s.sendErr(ctx, reply, proto.ErrBadMessage, proto.MsgVFSRename, requestID, "invalid old path")
-		}
+		s.sendResolveErr(ctx, reply, proto.MsgVFSRename, requestID, oldPath)
 		return
 	}
 	newFS, newRel, ok := s.resolve(newPath)
 	if !ok {
-		if isSDPath(newPath) {
-			_ = s.sendErr(ctx, reply, proto.ErrNotFound, proto.MsgVFSRename, requestID, "sd not available")
-		} else if s.fs == nil {
-			_ = s.sendErr(ctx, reply, proto.ErrInternal, proto.MsgVFSRename, requestID, "vfs not ready")
-		} else {
-			_ = s.sendErr(ctx, reply, proto.ErrBadMessage, proto.MsgVFSRename, requestID, "invalid new path")
-		}
+		s.sendResolveErr(ctx, reply, proto.MsgVFSRename, requestID, newPath)
 		return
 	}
 	if oldFS != newFS {
@@ -268,26 +390,19 @@ func (s *Service) handleCopy(ctx *kernel.Context, msg kernel.Message) {
 		return
 	}
 
+	if s.denied(ctx, reply, proto.MsgVFSCopy, requestID, srcPath, accRead) ||
+		s.denied(ctx, reply, proto.MsgVFSCopy, requestID, dstPath, accWrite) {
+		return
+	}
+	created := !s.exists(dstPath)
 	srcFS, srcRel, ok := s.resolve(srcPath)
 	if !ok {
-		if isSDPath(srcPath) {
-			_ = s.sendErr(ctx, reply, proto.ErrNotFound, proto.MsgVFSCopy, requestID, "sd not available")
-		} else if s.fs == nil {
-			_ = s.sendErr(ctx, reply, proto.ErrInternal, proto.MsgVFSCopy, requestID, "vfs not ready")
-		} else {
-			_ = s.sendErr(ctx, reply, proto.ErrBadMessage, proto.MsgVFSCopy, requestID, "invalid src path")
-		}
+		s.sendResolveErr(ctx, reply, proto.MsgVFSCopy, requestID, srcPath)
 		return
 	}
 	dstFS, dstRel, ok := s.resolve(dstPath)
 	if !ok {
-		if isSDPath(dstPath) {
-			_ = s.sendErr(ctx, reply, proto.ErrNotFound, proto.MsgVFSCopy, requestID, "sd not available")
-		} else if s.fs == nil {
-			_ = s.sendErr(ctx, reply, proto.ErrInternal, proto.MsgVFSCopy, requestID, "vfs not ready")
-		} else {
-			_ = s.sendErr(ctx, reply, proto.ErrBadMessage, proto.MsgVFSCopy, requestID, "invalid dst path")
-		}
+		s.sendResolveErr(ctx, reply, proto.MsgVFSCopy, requestID, dstPath)
 		return
 	}
 
@@ -306,6 +421,9 @@ func (s *Service) handleCopy(ctx *kernel.Context, msg kernel.Message) {
 		_ = s.sendErr(ctx, reply, mapVFSError(err), proto.MsgVFSCopy, requestID, err.Error())
 		return
 	}
+	if created {
+		s.own(dstFS, dstRel)
+	}
 	defer func() { _ = w.Close() }()
 
 	const bufSize = 4096
@@ -376,19 +494,16 @@ func (s *Service) handleStat(ctx *kernel.Context, msg kernel.Message) {
 		return
 	}
 
-	backend, rel, ok := s.resolve(path)
-	if !ok {
-		if isSDPath(path) {
-			_ = s.sendErr(ctx, reply, proto.ErrNotFound, proto.MsgVFSStat, requestID, "sd not available")
-		} else if s.fs == nil {
-			_ = s.sendErr(ctx, reply, proto.ErrInternal, proto.MsgVFSStat, requestID, "vfs not ready")
-		} else {
-			_ = s.sendErr(ctx, reply, proto.ErrBadMessage, proto.MsgVFSStat, requestID, "invalid path")
-		}
+	if s.denied(ctx, reply, proto.MsgVFSStat, requestID, path, accStat) {
 		return
 	}
-	if path == "/sd" && s.sd != nil {
-		_ = s.send(ctx, reply, proto.MsgVFSStatResp, proto.VFSStatRespPayload(requestID, proto.VFSEntryDir, 0))
+	if s.isMountDir(path) {
+		_ = s.send(ctx, reply, proto.MsgVFSStatResp, proto.VFSStatRespPayload(requestID, proto.VFSEntryDir, 0, mountMeta))
+		return
+	}
+	backend, rel, ok := s.resolve(path)
+	if !ok {
+		s.sendResolveErr(ctx, reply, proto.MsgVFSStat, requestID, path)
 		return
 	}
 
@@ -406,7 +521,14 @@ func (s *Service) handleStat(ctx *kernel.Context, msg kernel.Message) {
 		typ = proto.VFSEntryDir
 	}
 
-	_ = s.send(ctx, reply, proto.MsgVFSStatResp, proto.VFSStatRespPayload(requestID, typ, info.Size))
+	_ = s.send(ctx, reply, proto.MsgVFSStatResp, proto.VFSStatRespPayload(requestID, typ, info.Size, metaOf(info)))
+}
+
+// mountMeta is the metadata of mount points, which have none of their own.
+var mountMeta = proto.VFSMeta{Mode: littlefs.DefaultDirMode}
+
+func metaOf(info littlefs.Info) proto.VFSMeta {
+	return proto.VFSMeta{Mtime: info.Mtime, Ctime: info.Ctime, UID: info.UID, GID: info.GID, Mode: info.Mode}
 }
 
 func (s *Service) handleRead(ctx *kernel.Context, msg kernel.Message) {
@@ -427,25 +549,63 @@ func (s *Service) handleRead(ctx *kernel.Context, msg kernel.Message) {
 	}
 	buf := make([]byte, max)
 
-	backend, rel, ok := s.resolve(path)
+	n, eof, ok := s.readAt(ctx, reply, proto.MsgVFSRead, requestID, path, buf, off)
 	if !ok {
-		if isSDPath(path) {
-			_ = s.sendErr(ctx, reply, proto.ErrNotFound, proto.MsgVFSRead, requestID, "sd not available")
-		} else if s.fs == nil {
-			_ = s.sendErr(ctx, reply, proto.ErrInternal, proto.MsgVFSRead, requestID, "vfs not ready")
-		} else {
-			_ = s.sendErr(ctx, reply, proto.ErrBadMessage, proto.MsgVFSRead, requestID, "invalid path")
-		}
 		return
 	}
+	_ = s.send(ctx, reply, proto.MsgVFSReadResp, proto.VFSReadRespPayload(requestID, off, eof, buf[:n]))
+}
 
-	n, eof, err := backend.ReadAt(rel, buf, off)
-	if err != nil {
-		_ = s.sendErr(ctx, reply, mapVFSError(err), proto.MsgVFSRead, requestID, err.Error())
+// handleReadShared reads straight into the region granted with the request,
+// so one round trip moves up to the region size instead of one message payload.
+func (s *Service) handleReadShared(ctx *kernel.Context, msg kernel.Message) {
+	reply := msg.Cap
+	requestID, path, off, maxBytes, ok := proto.DecodeVFSReadPayload(msg.Payload())
+	if !ok {
+		_ = s.sendErr(ctx, reply, proto.ErrBadMessage, proto.MsgVFSReadShared, 0, "decode read")
+		return
+	}
+	buf, ok := ctx.MapRegion(msg.Grant, kernel.RightWrite)
+	if !ok {
+		_ = s.sendErr(ctx, reply, proto.ErrUnauthorized, proto.MsgVFSReadShared, requestID, "no writable grant")
 		return
 	}
+	if int(maxBytes) < len(buf) {
+		buf = buf[:maxBytes]
+	}
 
-	_ = s.send(ctx, reply, proto.MsgVFSReadResp, proto.VFSReadRespPayload(requestID, off, eof, buf[:n]))
+	n, eof, ok := s.readAt(ctx, reply, proto.MsgVFSReadShared, requestID, path, buf, off)
+	if !ok {
+		return
+	}
+	_ = s.send(ctx, reply, proto.MsgVFSReadSharedResp, proto.VFSReadSharedRespPayload(requestID, off, eof, uint32(n)))
+}
+
+// readAt reads path into buf and reports failures to reply.
+func (s *Service) readAt(
+	ctx *kernel.Context,
+	reply kernel.Capability,
+	ref proto.Kind,
+	requestID uint32,
+	path string,
+	buf []byte,
+	off uint32,
+) (n int, eof bool, ok bool) {
+	if s.denied(ctx, reply, ref, requestID, path, accRead) {
+		return 0, false, false
+	}
+	backend, rel, ok := s.resolve(path)
+	if !ok {
+		s.sendResolveErr(ctx, reply, ref, requestID, path)
+		return 0, false, false
+	}
+
+	n, eof, err := backend.ReadAt(rel, buf, off)
+	if err != nil {
+		_ = s.sendErr(ctx, reply, mapVFSError(err), ref, requestID, err.Error())
+		return 0, false, false
+	}
+	return n, eof, true
 }
 
 func (s *Service) handleWriteOpen(ctx *kernel.Context, msg kernel.Message) {
@@ -459,9 +619,9 @@ func (s *Service) handleWriteOpen(ctx *kernel.Context, msg kernel.Message) {
 		return
 	}
 
-	if prev := s.writers[requestID]; prev != nil {
+	if key, prev := s.writer(msg, requestID); prev != nil {
 		_ = prev.writer.Close()
-		delete(s.writers, requestID)
+		delete(s.writers, key)
 	}
 
 	wmode := littlefs.WriteTruncate
@@ -469,15 +629,13 @@ func (s *Service) handleWriteOpen(ctx *kernel.Context, msg kernel.Message) {
 		wmode = littlefs.WriteAppend
 	}
 
+	if s.denied(ctx, reply, proto.MsgVFSWriteOpen, requestID, path, accWrite) {
+		return
+	}
+	created := !s.exists(path)
 	backend, rel, ok := s.resolve(path)
 	if !ok {
-		if isSDPath(path) {
-			_ = s.sendErr(ctx, reply, proto.ErrNotFound, proto.MsgVFSWriteOpen, requestID, "sd not available")
-		} else if s.fs == nil {
-			_ = s.sendErr(ctx, reply, proto.ErrInternal, proto.MsgVFSWriteOpen, requestID, "vfs not ready")
-		} else {
-			_ = s.sendErr(ctx, reply, proto.ErrBadMessage, proto.MsgVFSWriteOpen, requestID, "invalid path")
-		}
+		s.sendResolveErr(ctx, reply, proto.MsgVFSWriteOpen, requestID, path)
 		return
 	}
 
@@ -486,8 +644,12 @@ func (s *Service) handleWriteOpen(ctx *kernel.Context, msg kernel.Message) {
 		_ = s.sendErr(ctx, reply, mapVFSError(err), proto.MsgVFSWriteOpen, requestID, err.Error())
 		return
 	}
+	if created {
+		s.own(backend, rel)
+	}
 
-	s.writers[requestID] = &writeSession{reply: reply, writer: w}
+	key := writeKey{sender: msg.Sender, requestID: requestID}
+	s.writers[key] = &writeSession{reply: reply, writer: w, fs: backend, cred: s.caller}
 	_ = s.send(ctx, reply, proto.MsgVFSWriteResp, proto.VFSWriteRespPayload(requestID, false, 0))
 }
 
@@ -497,8 +659,8 @@ func (s *Service) handleWriteChunk(ctx *kernel.Context, msg kernel.Message) {
 		return
 	}
 
-	sess := s.writers[requestID]
-	if sess == nil || sess.writer == nil {
+	key, sess := s.writer(msg, requestID)
+	if sess == nil {
 		return
 	}
 
@@ -506,28 +668,62 @@ func (s *Service) handleWriteChunk(ctx *kernel.Context, msg kernel.Message) {
 	if err != nil {
 		_ = s.sendErr(ctx, sess.reply, mapVFSError(err), proto.MsgVFSWriteChunk, requestID, err.Error())
 		_ = sess.writer.Close()
-		delete(s.writers, requestID)
+		delete(s.writers, key)
 		return
 	}
 	if n != len(data) {
 		_ = s.sendErr(ctx, sess.reply, proto.ErrInternal, proto.MsgVFSWriteChunk, requestID, "short write")
 		_ = sess.writer.Close()
-		delete(s.writers, requestID)
+		delete(s.writers, key)
 		return
 	}
 }
 
+// handleWriteShared appends the granted region's first n bytes to a write
+// session and acknowledges on the request's reply capability.
+func (s *Service) handleWriteShared(ctx *kernel.Context, msg kernel.Message) {
+	reply := msg.Cap
+	requestID, n, ok := proto.DecodeVFSWriteSharedPayload(msg.Payload())
+	if !ok {
+		_ = s.sendErr(ctx, reply, proto.ErrBadMessage, proto.MsgVFSWriteShared, 0, "decode write shared")
+		return
+	}
+
+	key, sess := s.writer(msg, requestID)
+	if sess == nil {
+		_ = s.sendErr(ctx, reply, proto.ErrNotFound, proto.MsgVFSWriteShared, requestID, "no write session")
+		return
+	}
+	buf, ok := ctx.MapRegion(msg.Grant, kernel.RightRead)
+	if !ok || int(n) > len(buf) {
+		_ = s.sendErr(ctx, reply, proto.ErrUnauthorized, proto.MsgVFSWriteShared, requestID, "no readable grant")
+		return
+	}
+
+	written, err := sess.writer.Write(buf[:n])
+	if err == nil && written != int(n) {
+		err = errors.New("short write")
+	}
+	if err != nil {
+		_ = s.sendErr(ctx, reply, mapVFSError(err), proto.MsgVFSWriteShared, requestID, err.Error())
+		_ = sess.writer.Close()
+		delete(s.writers, key)
+		return
+	}
+	_ = s.send(ctx, reply, proto.MsgVFSWriteResp, proto.VFSWriteRespPayload(requestID, false, n))
+}
+
 func (s *Service) handleWriteClose(ctx *kernel.Context, msg kernel.Message) {
 	requestID, ok := proto.DecodeVFSWriteClosePayload(msg.Payload())
 	if !ok {
 		return
 	}
 
-	sess := s.writers[requestID]
-	if sess == nil || sess.writer == nil {
+	key, sess := s.writer(msg, requestID)
+	if sess == nil {
 		return
 	}
-	delete(s.writers, requestID)
+	delete(s.writers, key)
 
 	if err := sess.writer.Close(); err != nil {
 		_ = s.sendErr(ctx, sess.reply, mapVFSError(err), proto.MsgVFSWriteClose, requestID, err.Error())
@@ -575,30 +771,3 @@ func mapVFSError(err error) proto.ErrCode {
 		return proto.ErrInternal
 	}
 }
-
-func (s *Service) resolve(path string) (fsHandle, string, bool) {
-	if path == "" {
-		return nil, "", false
-	}
-	if path == "/sd" || path == "/sd/" {
-		if s.sd == nil {
-			return nil, "", false
-		}
-		return s.sd, "/", true
-	}
-	if strings.HasPrefix(path, "/sd/") {
-		if s.sd == nil {
-			return nil, "", false
-		}
-		return s.sd, path[3:], true
-	}
-	if s.fs == nil {
-		return nil, "", false
-	}
-	root := flashFS{fs: s.fs}
-	return root, path, true
-}
-
-func isSDPath(path string) bool {
-	return path == "/sd" || path == "/sd/" || strings.HasPrefix(path, "/sd/")
-}
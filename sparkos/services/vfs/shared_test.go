@@ -0,0 +1,152 @@
+package vfs
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	vfsclient "spark/sparkos/client/vfs"
+	"spark/sparkos/fs/littlefs"
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+)
+
+type memFS struct {
+	dummyFS
+	data []byte
+	w    *memWriter
+	f    *memFile
+}
+
+func (m *memFS) ReadAt(_ string, p []byte, off uint32) (int, bool, error) {
+	if int(off) >= len(m.data) {
+		return 0, true, nil
+	}
+	n := copy(p, m.data[off:])
+	return n, int(off)+n >= len(m.data), nil
+}
+
+func (m *memFS) OpenWriter(string, littlefs.WriteMode) (writeHandle, error) {
+	m.w = &memWriter{}
+	return m.w, nil
+}
+
+type memWriter struct {
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (w *memWriter) Write(p []byte) (int, error) { return w.buf.Write(p) }
+func (w *memWriter) Close() error                { w.closed = true; return nil }
+func (w *memWriter) BytesWritten() uint32        { return uint32(w.buf.Len()) }
+
+type taskFunc func(ctx *kernel.Context)
+
+func (f taskFunc) Run(ctx *kernel.Context) { f(ctx) }
+
+// startService runs the request loop of s on ep without touching real storage.
+func startService(k *kernel.Kernel, s *Service, ep kernel.Capability) {
+	s.writers = make(map[writeKey]*writeSession)
+	s.mountDefaults(nil)
+	k.AddTask(taskFunc(func(ctx *kernel.Context) {
+		ch, ok := ctx.RecvChan(ep.Restrict(kernel.RightRecv))
+		if !ok {
+			return
+		}
+		for msg := range ch {
+			s.handle(ctx, msg)
+		}
+	}))
+}
+
+func runClient(t *testing.T, k *kernel.Kernel, fn func(ctx *kernel.Context)) {
+	t.Helper()
+	done := make(chan struct{})
+	k.AddTask(taskFunc(func(ctx *kernel.Context) {
+		defer close(done)
+		fn(ctx)
+	}))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("client task timed out")
+	}
+}
+
+func testData(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i * 7)
+	}
+	return b
+}
+
+func TestSharedReadMovesLargeChunks(t *testing.T) {
+	k := kernel.New()
+	ep := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	fs := &memFS{data: testData(3000)}
+	startService(k, &Service{sd: fs}, ep)
+
+	runClient(t, k, func(ctx *kernel.Context) {
+		c := vfsclient.New(ep.Restrict(kernel.RightSend))
+		got, eof, err := c.ReadAt(ctx, "/sd/pcm", 0, 2048)
+		if err != nil {
+			t.Errorf("ReadAt: %v", err)
+			return
+		}
+		if len(got) != 2048 || eof {
+			t.Errorf("expected a single 2048-byte chunk, got %d bytes eof=%v", len(got), eof)
+		}
+		if !bytes.Equal(got, fs.data[:len(got)]) {
+			t.Error("shared read returned wrong data")
+		}
+
+		buf := make([]byte, 2048)
+		n, eof, err := c.ReadInto(ctx, "/sd/pcm", 2048, buf)
+		if err != nil || n != 3000-2048 || !eof {
+			t.Errorf("ReadInto tail: n=%d eof=%v err=%v", n, eof, err)
+		}
+	})
+}
+
+func TestSharedWriteAppendsToSession(t *testing.T) {
+	k := kernel.New()
+	ep := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	fs := &memFS{}
+	startService(k, &Service{sd: fs}, ep)
+
+	data := testData(5000)
+	runClient(t, k, func(ctx *kernel.Context) {
+		c := vfsclient.New(ep.Restrict(kernel.RightSend))
+		n, err := c.Write(ctx, "/sd/out", proto.VFSWriteTruncate, data)
+		if err != nil {
+			t.Errorf("Write: %v", err)
+			return
+		}
+		if n != uint32(len(data)) {
+			t.Errorf("expected %d bytes written, got %d", len(data), n)
+		}
+	})
+	if fs.w == nil || !fs.w.closed || !bytes.Equal(fs.w.buf.Bytes(), data) {
+		t.Fatal("file contents do not match the written data")
+	}
+}
+
+func TestSharedReadRequiresWritableGrant(t *testing.T) {
+	k := kernel.New()
+	ep := k.NewEndpoint(kernel.RightSend | kernel.RightRecv)
+	startService(k, &Service{sd: &memFS{data: testData(10)}}, ep)
+
+	runClient(t, k, func(ctx *kernel.Context) {
+		region := ctx.NewRegion(64)
+		payload := proto.VFSReadPayload(1, "/sd/x", 0, 64)
+		msg, err := ctx.CallGrant(ep.Restrict(kernel.RightSend), uint16(proto.MsgVFSReadShared), payload, region.Restrict(kernel.RightRead), 0)
+		if err != nil {
+			t.Errorf("CallGrant: %v", err)
+			return
+		}
+		if proto.Kind(msg.Kind) != proto.MsgError {
+			t.Errorf("expected MsgError for a read-only grant, got %s", proto.Kind(msg.Kind))
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package vfs
+
+import (
+	"errors"
+
+	"spark/sparkos/fs/littlefs"
+	"spark/sparkos/fs/tmpfs"
+	"spark/sparkos/kernel"
+)
+
+// DefaultTmpBytes is the budget of a tmp mount when Options leave it unset.
+const DefaultTmpBytes = 64 * 1024
+
+// tmpFS serves a tmpfs, which keeps its files in RAM.
+type tmpFS struct {
+	fs *tmpfs.FS
+}
+
+func (t tmpFS) ListDir(path string, fn func(name string, info littlefs.Info) bool) error {
+	return t.fs.ListDir(path, fn)
+}
+func (t tmpFS) Mkdir(path string) error                 { return t.fs.Mkdir(path) }
+func (t tmpFS) Remove(path string) error                { return t.fs.Remove(path) }
+func (t tmpFS) Rename(oldPath, newPath string) error    { return t.fs.Rename(oldPath, newPath) }
+func (t tmpFS) Stat(path string) (littlefs.Info, error) { return t.fs.Stat(path) }
+func (t tmpFS) ReadAt(path string, p []byte, off uint32) (int, bool, error) {
+	return t.fs.ReadAt(path, p, off)
+}
+func (t tmpFS) OpenWriter(path string, mode littlefs.WriteMode) (writeHandle, error) {
+	w, err := t.fs.OpenWriter(path, mode)
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+func (t tmpFS) OpenFile(path string, flag int) (fileHandle, error) {
+	file, err := t.fs.OpenFile(path, flag)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+func (t tmpFS) Usage() (total, used uint64, err error)   { return t.fs.Usage() }
+func (t tmpFS) Chmod(path string, mode uint16) error     { return t.fs.Chmod(path, mode) }
+func (t tmpFS) Chown(path string, uid, gid uint32) error { return t.fs.Chown(path, uid, gid) }
+
+// openTmp returns an empty tmpfs. Every mount gets its own, and its files
+// go away with the mount or when VFS restarts.
+func (s *Service) openTmp(_ *kernel.Context) (fsHandle, error) {
+	if s.tmpBytes == 0 {
+		return nil, errors.New("tmpfs not configured")
+	}
+	return tmpFS{fs: tmpfs.New(s.tmpBytes)}, nil
+}
@@ -0,0 +1,364 @@
+package spx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Assemble translates assembly source into a program.
+//
+// One statement per line; ';' starts a comment. A line may start with a
+// label ("loop:"). Code labels are code offsets, data labels memory
+// addresses. Directives:
+//
+//	.service name       add name to the manifest
+//	.mem n              memory size (default DefaultMemSize)
+//	.equ name value     define a constant
+//	.code / .data       switch section (code first)
+//	.byte v, ...        data bytes
+//	.word v, ...        data i32 words
+//	.ascii "text"       data string (Go quoting)
+//	.asciz "text"       the same, NUL-terminated
+//	.space n            n zero bytes
+//
+// Instructions are the Op names; push takes a value, jumps and call a code
+// label, sys a Sys name. The entry point is the label "main", or offset 0.
+func Assemble(src string) (*Program, error) {
+	a := &assembler{
+		symbols: make(map[string]int32),
+		mem:     DefaultMemSize,
+	}
+	for i, line := range strings.Split(src, "\n") {
+		if err := a.line(line); err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+	}
+	return a.finish()
+}
+
+type section uint8
+
+const (
+	sectCode section = iota
+	sectData
+)
+
+// insn is a code statement, sized in the first pass and encoded once all
+// labels are known.
+type insn struct {
+	line int
+	op   Op
+	arg  string
+}
+
+type assembler struct {
+	lineNo  int
+	sect    section
+	symbols map[string]int32
+	insns   []insn
+	codeLen int
+	data    []byte
+	// fixups are .word operands naming a label defined later.
+	fixups   []fixup
+	services []string
+	mem      int
+}
+
+type fixup struct {
+	line int
+	at   int
+	name string
+}
+
+func (a *assembler) line(raw string) error {
+	a.lineNo++
+	s := strings.TrimSpace(stripComment(raw))
+	if s == "" {
+		return nil
+	}
+	if i := strings.IndexByte(s, ':'); i > 0 && isIdent(s[:i]) {
+		if err := a.label(s[:i]); err != nil {
+			return err
+		}
+		s = strings.TrimSpace(s[i+1:])
+		if s == "" {
+			return nil
+		}
+	}
+
+	word, rest := s, ""
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		word, rest = s[:i], s[i+1:]
+	}
+	word = strings.ToLower(word)
+	rest = strings.TrimSpace(rest)
+	if strings.HasPrefix(word, ".") {
+		return a.directive(word, rest)
+	}
+	if a.sect != sectCode {
+		return fmt.Errorf("instruction %q in .data", word)
+	}
+	return a.insn(word, rest)
+}
+
+func (a *assembler) label(name string) error {
+	if _, dup := a.symbols[name]; dup {
+		return fmt.Errorf("%s redefined", name)
+	}
+	if a.sect == sectCode {
+		a.symbols[name] = int32(a.codeLen)
+	} else {
+		a.symbols[name] = int32(len(a.data))
+	}
+	return nil
+}
+
+func (a *assembler) directive(word, rest string) error {
+	switch word {
+	case ".code":
+		a.sect = sectCode
+	case ".data":
+		a.sect = sectData
+	case ".service":
+		if !isIdent(rest) {
+			return fmt.Errorf("bad service name %q", rest)
+		}
+		a.services = append(a.services, rest)
+	case ".mem":
+		n, err := a.value(rest)
+		if err != nil {
+			return err
+		}
+		a.mem = int(n)
+	case ".equ":
+		f := strings.Fields(rest)
+		if len(f) != 2 || !isIdent(f[0]) {
+			return fmt.Errorf("usage: .equ name value")
+		}
+		n, err := a.value(f[1])
+		if err != nil {
+			return err
+		}
+		return a.define(f[0], n)
+	case ".byte", ".word":
+		if a.sect != sectData {
+			return fmt.Errorf("%s outside .data", word)
+		}
+		for _, f := range strings.Split(rest, ",") {
+			f = strings.TrimSpace(f)
+			if word == ".byte" {
+				n, err := a.value(f)
+				if err != nil {
+					return err
+				}
+				if n < -128 || n > 255 {
+					return fmt.Errorf("byte %d out of range", n)
+				}
+				a.data = append(a.data, byte(n))
+				continue
+			}
+			n, err := a.value(f)
+			if err != nil && isIdent(f) {
+				a.fixups = append(a.fixups, fixup{line: a.lineNo, at: len(a.data), name: f})
+			} else if err != nil {
+				return err
+			}
+			a.data = binary.LittleEndian.AppendUint32(a.data, uint32(n))
+		}
+	case ".ascii", ".asciz":
+		if a.sect != sectData {
+			return fmt.Errorf("%s outside .data", word)
+		}
+		str, err := strconv.Unquote(rest)
+		if err != nil {
+			return fmt.Errorf("bad string %s", rest)
+		}
+		a.data = append(a.data, str...)
+		if word == ".asciz" {
+			a.data = append(a.data, 0)
+		}
+	case ".space":
+		if a.sect != sectData {
+			return fmt.Errorf(".space outside .data")
+		}
+		n, err := a.value(rest)
+		if err != nil {
+			return err
+		}
+		if n < 0 || n > MaxMemBytes {
+			return fmt.Errorf(".space %d out of range", n)
+		}
+		a.data = append(a.data, make([]byte, n)...)
+	default:
+		return fmt.Errorf("unknown directive %s", word)
+	}
+	return nil
+}
+
+func (a *assembler) define(name string, v int32) error {
+	if _, dup := a.symbols[name]; dup {
+		return fmt.Errorf("%s redefined", name)
+	}
+	a.symbols[name] = v
+	return nil
+}
+
+func (a *assembler) insn(word, arg string) error {
+	op, ok := opByName(word)
+	if !ok || op == OpPush8 {
+		return fmt.Errorf("unknown instruction %q", word)
+	}
+	switch operandSize(op) {
+	case 0:
+		if arg != "" {
+			return fmt.Errorf("%s takes no operand", word)
+		}
+	default:
+		if arg == "" {
+			return fmt.Errorf("%s needs an operand", word)
+		}
+	}
+	if op == OpSys {
+		if _, ok := SysByName(arg); !ok {
+			return fmt.Errorf("unknown syscall %q", arg)
+		}
+	}
+	// A push of a value known now fits in a byte when it can; labels and
+	// later constants always take four.
+	if op == OpPush {
+		if n, err := a.value(arg); err == nil && n >= -128 && n <= 127 {
+			op = OpPush8
+		}
+	}
+	a.insns = append(a.insns, insn{line: a.lineNo, op: op, arg: arg})
+	a.codeLen += 1 + operandSize(op)
+	if a.codeLen > MaxCodeBytes {
+		return fmt.Errorf("code larger than %d bytes", MaxCodeBytes)
+	}
+	return nil
+}
+
+func (a *assembler) finish() (*Program, error) {
+	code := make([]byte, 0, a.codeLen)
+	for _, in := range a.insns {
+		code = append(code, byte(in.op))
+		switch in.op {
+		case OpPush, OpPush8:
+			n, err := a.value(in.arg)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", in.line, err)
+			}
+			if in.op == OpPush8 {
+				code = append(code, byte(int8(n)))
+			} else {
+				code = binary.LittleEndian.AppendUint32(code, uint32(n))
+			}
+		case OpJmp, OpJz, OpJnz, OpCall:
+			n, err := a.value(in.arg)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", in.line, err)
+			}
+			if n < 0 || int(n) >= a.codeLen {
+				return nil, fmt.Errorf("line %d: %s target %d outside code", in.line, in.op, n)
+			}
+			code = binary.LittleEndian.AppendUint16(code, uint16(n))
+		case OpSys:
+			s, _ := SysByName(in.arg)
+			code = append(code, byte(s))
+		}
+	}
+	for _, f := range a.fixups {
+		n, ok := a.symbols[f.name]
+		if !ok {
+			return nil, fmt.Errorf("line %d: undefined %s", f.line, f.name)
+		}
+		binary.LittleEndian.PutUint32(a.data[f.at:], uint32(n))
+	}
+
+	p := &Program{
+		Services: a.services,
+		MemSize:  a.mem,
+		Code:     code,
+		Data:     a.data,
+	}
+	if main, ok := a.symbols["main"]; ok {
+		p.Entry = int(main)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// value parses a number, a character literal or a defined name.
+func (a *assembler) value(s string) (int32, error) {
+	if s == "" {
+		return 0, fmt.Errorf("missing value")
+	}
+	if v, ok := a.symbols[s]; ok {
+		return v, nil
+	}
+	if strings.HasPrefix(s, "'") {
+		r, err := strconv.Unquote(s)
+		if err != nil || len([]rune(r)) != 1 {
+			return 0, fmt.Errorf("bad character %s", s)
+		}
+		return int32([]rune(r)[0]), nil
+	}
+	n, err := strconv.ParseInt(s, 0, 64)
+	if err != nil {
+		if isIdent(s) {
+			return 0, fmt.Errorf("undefined %s", s)
+		}
+		return 0, fmt.Errorf("bad value %q", s)
+	}
+	if n < -1<<31 || n > 1<<32-1 {
+		return 0, fmt.Errorf("value %s out of range", s)
+	}
+	return int32(n), nil
+}
+
+func opByName(name string) (Op, bool) {
+	for op, n := range opNames {
+		if n == name {
+			return op, true
+		}
+	}
+	return 0, false
+}
+
+// stripComment drops a ';' comment outside quotes.
+func stripComment(s string) string {
+	quote := byte(0)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == ';':
+			return s[:i]
+		}
+	}
+	return s
+}
+
+func isIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		case i > 0 && c >= '0' && c <= '9':
+		default:
+			return false
+		}
+	}
+	return true
+}
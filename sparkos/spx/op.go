@@ -0,0 +1,155 @@
+package spx
+
+// Op is an instruction opcode. Operands follow the opcode byte: OpPush an
+// i32, OpPush8 an i8, jumps and OpCall a u16 code offset, OpSys a Sys.
+//
+// Stack effects are written bottom to top: "a b -- a+b".
+type Op uint8
+
+const (
+	OpHalt  Op = 0x00 // --
+	OpNop   Op = 0x01
+	OpPush  Op = 0x02 // -- v
+	OpPush8 Op = 0x03 // -- v
+	OpDup   Op = 0x04 // a -- a a
+	OpDrop  Op = 0x05 // a --
+	OpSwap  Op = 0x06 // a b -- b a
+	OpOver  Op = 0x07 // a b -- a b a
+
+	OpAdd Op = 0x10 // a b -- a+b
+	OpSub Op = 0x11
+	OpMul Op = 0x12
+	OpDiv Op = 0x13 // traps on b == 0
+	OpMod Op = 0x14
+	OpAnd Op = 0x15
+	OpOr  Op = 0x16
+	OpXor Op = 0x17
+	OpShl Op = 0x18
+	OpShr Op = 0x19 // arithmetic
+	OpNeg Op = 0x1a // a -- -a
+	OpNot Op = 0x1b // a -- ^a
+
+	OpEq Op = 0x20 // a b -- a==b (1 or 0)
+	OpNe Op = 0x21
+	OpLt Op = 0x22
+	OpLe Op = 0x23
+	OpGt Op = 0x24
+	OpGe Op = 0x25
+
+	OpJmp  Op = 0x30
+	OpJz   Op = 0x31 // c --, jumps if c == 0
+	OpJnz  Op = 0x32 // c --, jumps if c != 0
+	OpCall Op = 0x33
+	OpRet  Op = 0x34
+
+	OpLoad   Op = 0x40 // addr -- i32
+	OpStore  Op = 0x41 // v addr --
+	OpLoadB  Op = 0x42 // addr -- u8
+	OpStoreB Op = 0x43 // v addr --
+
+	OpSys Op = 0x50 // args -- results, see Sys
+)
+
+var opNames = map[Op]string{
+	OpHalt: "halt", OpNop: "nop", OpPush: "push", OpPush8: "push8",
+	OpDup: "dup", OpDrop: "drop", OpSwap: "swap", OpOver: "over",
+	OpAdd: "add", OpSub: "sub", OpMul: "mul", OpDiv: "div", OpMod: "mod",
+	OpAnd: "and", OpOr: "or", OpXor: "xor", OpShl: "shl", OpShr: "shr",
+	OpNeg: "neg", OpNot: "not",
+	OpEq: "eq", OpNe: "ne", OpLt: "lt", OpLe: "le", OpGt: "gt", OpGe: "ge",
+	OpJmp: "jmp", OpJz: "jz", OpJnz: "jnz", OpCall: "call", OpRet: "ret",
+	OpLoad: "load", OpStore: "store", OpLoadB: "loadb", OpStoreB: "storeb",
+	OpSys: "sys",
+}
+
+func (o Op) String() string {
+	if s, ok := opNames[o]; ok {
+		return s
+	}
+	return "op?"
+}
+
+// operandSize returns the bytes following o, or -1 for an unknown opcode.
+func operandSize(o Op) int {
+	switch o {
+	case OpPush:
+		return 4
+	case OpPush8, OpSys:
+		return 1
+	case OpJmp, OpJz, OpJnz, OpCall:
+		return 2
+	}
+	if _, ok := opNames[o]; ok {
+		return 0
+	}
+	return -1
+}
+
+// Sys is a syscall number, the operand of OpSys.
+type Sys uint8
+
+const (
+	SysExit    Sys = iota // code --
+	SysPutc               // ch --
+	SysPuts               // addr len --
+	SysGetKey             // -- key; waits for a key
+	SysPollKey            // -- key; -1 if none
+	SysTicks              // -- ms since boot (low 31 bits)
+	SysSleep              // ms --
+	SysWidth              // -- screen width
+	SysHeight             // -- screen height
+	SysClear              // rgb565 --
+	SysRect               // x y w h rgb565 --
+	SysText               // x y addr len rgb565 --
+	SysPresent            // --
+	SysRead               // path plen buf max off -- n; -1 on error (vfs)
+	SysWrite              // path plen buf len append -- n; -1 on error (vfs)
+	SysNotify             // addr len -- 0; -1 on error (notify)
+)
+
+var sysInfo = []struct {
+	name    string
+	service string
+}{
+	SysExit:    {"exit", ""},
+	SysPutc:    {"putc", ""},
+	SysPuts:    {"puts", ""},
+	SysGetKey:  {"getkey", ""},
+	SysPollKey: {"pollkey", ""},
+	SysTicks:   {"ticks", ""},
+	SysSleep:   {"sleep", ""},
+	SysWidth:   {"width", ""},
+	SysHeight:  {"height", ""},
+	SysClear:   {"clear", ""},
+	SysRect:    {"rect", ""},
+	SysText:    {"text", ""},
+	SysPresent: {"present", ""},
+	SysRead:    {"read", "vfs"},
+	SysWrite:   {"write", "vfs"},
+	SysNotify:  {"notify", "notify"},
+}
+
+func (s Sys) String() string {
+	if int(s) < len(sysInfo) {
+		return sysInfo[s].name
+	}
+	return "sys?"
+}
+
+// Service returns the manifest entry s needs, or "" if it needs none.
+func (s Sys) Service() string {
+	if int(s) < len(sysInfo) {
+		return sysInfo[s].service
+	}
+	return ""
+}
+
+// SysByName returns the syscall called name.
+func SysByName(name string) (Sys, bool) {
+	for i, info := range sysInfo {
+		if info.name == name {
+			return Sys(i), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,141 @@
+// Package spx is the SparkOS user-program format: a compact executable for a
+// sandboxed stack machine, loaded from the filesystem at run time instead of
+// being linked into the firmware.
+//
+// File layout (little-endian):
+//
+//	0  u32 Magic ("SPX" + version)
+//	4  u8  service count
+//	5  u8  reserved
+//	6  u16 memory size in bytes (data is loaded at address 0)
+//	8  u16 code length
+//	10 u16 data length
+//	12 u16 entry point (code offset)
+//	14 u16 reserved
+//	16 services: u8 length + name each, the manifest
+//	   code
+//	   data
+//
+// A program reaches the system only through syscalls (see Sys); the ones
+// bound to a service trap unless the service is in the manifest.
+package spx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Magic identifies version 1 executables.
+const Magic uint32 = 'S' | 'P'<<8 | 'X'<<16 | 1<<24
+
+const headerSize = 16
+
+// Limits of a program; they keep a running one within a few tens of KiB.
+const (
+	MaxCodeBytes   = 32 * 1024
+	MaxMemBytes    = 32 * 1024
+	MaxServices    = 4
+	DefaultMemSize = 4 * 1024
+)
+
+var errHeaderInvalid = errors.New("spx: invalid header")
+
+// Program is a parsed executable.
+type Program struct {
+	// Services is the manifest: the services the program may use.
+	Services []string
+	// MemSize is the size of the program's memory, Data included.
+	MemSize int
+	Entry   int
+	Code    []byte
+	Data    []byte
+}
+
+// Validate checks the program against the format limits.
+func (p *Program) Validate() error {
+	switch {
+	case len(p.Code) == 0 || len(p.Code) > MaxCodeBytes:
+		return fmt.Errorf("spx: code size %d out of range", len(p.Code))
+	case p.MemSize <= 0 || p.MemSize > MaxMemBytes:
+		return fmt.Errorf("spx: memory size %d out of range", p.MemSize)
+	case len(p.Data) > p.MemSize:
+		return fmt.Errorf("spx: data (%d bytes) larger than memory (%d)", len(p.Data), p.MemSize)
+	case p.Entry < 0 || p.Entry >= len(p.Code):
+		return fmt.Errorf("spx: entry %d outside code", p.Entry)
+	case len(p.Services) > MaxServices:
+		return fmt.Errorf("spx: %d services, at most %d", len(p.Services), MaxServices)
+	}
+	for _, s := range p.Services {
+		if s == "" || len(s) > 255 {
+			return fmt.Errorf("spx: bad service name %q", s)
+		}
+	}
+	return nil
+}
+
+// Uses reports whether service is in the manifest.
+func (p *Program) Uses(service string) bool {
+	for _, s := range p.Services {
+		if s == service {
+			return true
+		}
+	}
+	return false
+}
+
+// Encode returns the executable image of p.
+func Encode(p *Program) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	out := make([]byte, headerSize, headerSize+len(p.Code)+len(p.Data)+16)
+	binary.LittleEndian.PutUint32(out[0:4], Magic)
+	out[4] = uint8(len(p.Services))
+	binary.LittleEndian.PutUint16(out[6:8], uint16(p.MemSize))
+	binary.LittleEndian.PutUint16(out[8:10], uint16(len(p.Code)))
+	binary.LittleEndian.PutUint16(out[10:12], uint16(len(p.Data)))
+	binary.LittleEndian.PutUint16(out[12:14], uint16(p.Entry))
+	for _, s := range p.Services {
+		out = append(out, uint8(len(s)))
+		out = append(out, s...)
+	}
+	out = append(out, p.Code...)
+	out = append(out, p.Data...)
+	return out, nil
+}
+
+// Parse decodes an executable image. Code and Data alias b.
+func Parse(b []byte) (*Program, error) {
+	if len(b) < headerSize || binary.LittleEndian.Uint32(b[0:4]) != Magic {
+		return nil, errHeaderInvalid
+	}
+	n := int(b[4])
+	p := &Program{
+		MemSize: int(binary.LittleEndian.Uint16(b[6:8])),
+		Entry:   int(binary.LittleEndian.Uint16(b[12:14])),
+	}
+	codeLen := int(binary.LittleEndian.Uint16(b[8:10]))
+	dataLen := int(binary.LittleEndian.Uint16(b[10:12]))
+	if n > MaxServices {
+		return nil, fmt.Errorf("spx: %d services, at most %d", n, MaxServices)
+	}
+
+	rest := b[headerSize:]
+	for i := 0; i < n; i++ {
+		if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+			return nil, errHeaderInvalid
+		}
+		p.Services = append(p.Services, string(rest[1:1+int(rest[0])]))
+		rest = rest[1+int(rest[0]):]
+	}
+	if len(rest) != codeLen+dataLen {
+		return nil, fmt.Errorf("spx: image is %d bytes, header says %d", len(rest), codeLen+dataLen)
+	}
+	p.Code = rest[:codeLen]
+	p.Data = rest[codeLen:]
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,214 @@
+package spx
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+// testSys records output and hands out queued keys.
+type testSys struct {
+	out  bytes.Buffer
+	keys []int32
+}
+
+func (s *testSys) Syscall(m *Machine, n Sys) error {
+	switch n {
+	case SysExit:
+		code, err := m.Pop()
+		if err != nil {
+			return err
+		}
+		m.Exit(code)
+	case SysPutc:
+		c, err := m.Pop()
+		if err != nil {
+			return err
+		}
+		s.out.WriteByte(byte(c))
+	case SysPuts:
+		n, err := m.Pop()
+		if err != nil {
+			return err
+		}
+		addr, err := m.Pop()
+		if err != nil {
+			return err
+		}
+		b, err := m.Bytes(addr, n)
+		if err != nil {
+			return err
+		}
+		s.out.Write(b)
+	case SysGetKey:
+		if len(s.keys) == 0 {
+			return ErrWait
+		}
+		k := s.keys[0]
+		s.keys = s.keys[1:]
+		return m.Push(k)
+	case SysRead:
+		return m.Push(-1)
+	default:
+		return errors.New("unexpected syscall " + n.String())
+	}
+	return nil
+}
+
+const sumSrc = `
+; prints the sum of 1..n for a key n, then exits with it
+.equ n_addr 0
+.data
+	.word 0          ; n
+msg:	.ascii "sum="
+.code
+main:
+	sys getkey
+	push n_addr
+	store
+	push 0           ; acc
+loop:
+	push n_addr
+	load
+	jz done
+	push n_addr
+	load
+	add
+	push n_addr
+	load
+	push 1
+	sub
+	push n_addr
+	store
+	jmp loop
+done:
+	push msg
+	push 4
+	sys puts
+	dup
+	call digit
+	sys exit
+digit:                  ; v -- (prints the last digit)
+	push 10
+	mod
+	push '0'
+	add
+	sys putc
+	ret
+`
+
+func TestAssembleRun(t *testing.T) {
+	p, err := Assemble(sumSrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := Encode(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err = Parse(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sys := &testSys{}
+	m, err := NewMachine(p, sys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st, err := m.Run(1000); st != StateWaiting || err != nil {
+		t.Fatalf("expected to wait for a key, got %d, %v", st, err)
+	}
+	sys.keys = []int32{10}
+	if st, err := m.Run(1000); st != StateHalted || err != nil {
+		t.Fatalf("expected to halt, got %d, %v", st, err)
+	}
+	if got := sys.out.String(); got != "sum=5" {
+		t.Fatalf("output %q, want %q", got, "sum=5")
+	}
+	if m.ExitCode() != 55 {
+		t.Fatalf("exit code %d, want 55", m.ExitCode())
+	}
+}
+
+func TestManifestEnforced(t *testing.T) {
+	src := `
+	push 0
+	push 0
+	push 0
+	push 0
+	push 0
+	sys read
+	halt
+`
+	p, err := Assemble(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ := NewMachine(p, &testSys{})
+	var trap *Trap
+	if _, err := m.Run(100); !errors.As(err, &trap) || !strings.Contains(err.Error(), "not in manifest") {
+		t.Fatalf("expected a manifest trap, got %v", err)
+	}
+
+	p, err = Assemble(".service vfs\n" + src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ = NewMachine(p, &testSys{})
+	if st, err := m.Run(100); st != StateHalted || err != nil {
+		t.Fatalf("expected the read to run, got %d, %v", st, err)
+	}
+}
+
+func TestTraps(t *testing.T) {
+	for _, src := range []string{
+		"push 1\npush 0\ndiv",
+		"drop",
+		"push 40000\nload",
+		"l: call l",
+	} {
+		p, err := Assemble(src)
+		if err != nil {
+			t.Fatalf("%q: %v", src, err)
+		}
+		m, _ := NewMachine(p, &testSys{})
+		if _, err := m.Run(1000); err == nil {
+			t.Errorf("%q: expected a trap", src)
+		}
+	}
+}
+
+func TestBytesBounds(t *testing.T) {
+	p, err := Assemble("halt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ := NewMachine(p, &testSys{})
+	for _, c := range [][2]int32{{math.MaxInt32 - 2, 8}, {8, math.MaxInt32}, {-1, 1}, {0, -1}} {
+		if _, err := m.Bytes(c[0], c[1]); err == nil {
+			t.Errorf("Bytes(%d, %d) succeeded", c[0], c[1])
+		}
+	}
+	if b, err := m.Bytes(0, 4); err != nil || len(b) != 4 {
+		t.Errorf("Bytes(0, 4) = %d bytes, %v", len(b), err)
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	for _, src := range []string{
+		"frob",
+		"push",
+		"jmp nowhere",
+		"sys fly",
+		".data\npush 1",
+		"a:\na:\nhalt",
+		".mem 100000\nhalt",
+	} {
+		if _, err := Assemble(src); err == nil {
+			t.Errorf("%q: expected an error", src)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package spx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Machine limits.
+const (
+	StackDepth = 256
+	CallDepth  = 64
+)
+
+// ErrWait is returned by a Syscaller that cannot complete yet (no key, still
+// sleeping). Run stops on the OpSys with its arguments still on the stack
+// and retries it on the next call.
+var ErrWait = errors.New("spx: waiting")
+
+var (
+	errStackUnderflow = errors.New("stack underflow")
+	errStackOverflow  = errors.New("stack overflow")
+	errCallOverflow   = errors.New("call stack overflow")
+	errDivZero        = errors.New("division by zero")
+	errBadOpcode      = errors.New("bad opcode")
+	errBadJump        = errors.New("jump outside code")
+	errBadAddress     = errors.New("memory access out of range")
+)
+
+// Syscaller implements the syscalls of a Machine. It takes its arguments with
+// Pop (or Peek, before returning ErrWait) and pushes its results.
+type Syscaller interface {
+	Syscall(m *Machine, s Sys) error
+}
+
+// State is where Run stopped.
+type State uint8
+
+const (
+	// StateRunning: the step budget ran out.
+	StateRunning State = iota
+	// StateWaiting: a syscall returned ErrWait.
+	StateWaiting
+	// StateHalted: the program halted or exited (see ExitCode).
+	StateHalted
+)
+
+// Trap is a fatal program error.
+type Trap struct {
+	PC  int
+	Err error
+}
+
+func (t *Trap) Error() string { return fmt.Sprintf("spx: trap at %04x: %v", t.PC, t.Err) }
+
+func (t *Trap) Unwrap() error { return t.Err }
+
+// Machine runs a Program. It is not safe for concurrent use.
+type Machine struct {
+	prog *Program
+	sys  Syscaller
+
+	mem   []byte
+	stack []int32
+	calls []uint16
+	pc    int
+
+	halted   bool
+	exitCode int32
+}
+
+// NewMachine returns a machine at the entry point of p with Data loaded at
+// address 0.
+func NewMachine(p *Program, sys Syscaller) (*Machine, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	m := &Machine{
+		prog:  p,
+		sys:   sys,
+		mem:   make([]byte, p.MemSize),
+		stack: make([]int32, 0, StackDepth),
+		calls: make([]uint16, 0, CallDepth),
+		pc:    p.Entry,
+	}
+	copy(m.mem, p.Data)
+	return m, nil
+}
+
+// Program returns the program m runs.
+func (m *Machine) Program() *Program { return m.prog }
+
+// ExitCode returns the SysExit code, or 0 after OpHalt.
+func (m *Machine) ExitCode() int32 { return m.exitCode }
+
+// Exit halts the machine with code; it is how SysExit is implemented.
+func (m *Machine) Exit(code int32) {
+	m.halted = true
+	m.exitCode = code
+}
+
+// Push pushes v.
+func (m *Machine) Push(v int32) error {
+	if len(m.stack) == StackDepth {
+		return errStackOverflow
+	}
+	m.stack = append(m.stack, v)
+	return nil
+}
+
+// Pop pops the top of the stack.
+func (m *Machine) Pop() (int32, error) {
+	if len(m.stack) == 0 {
+		return 0, errStackUnderflow
+	}
+	v := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	return v, nil
+}
+
+// Peek returns the value n slots below the top (0 is the top).
+func (m *Machine) Peek(n int) (int32, error) {
+	if n < 0 || n >= len(m.stack) {
+		return 0, errStackUnderflow
+	}
+	return m.stack[len(m.stack)-1-n], nil
+}
+
+// Bytes returns n bytes of memory at addr; the slice aliases the memory.
+func (m *Machine) Bytes(addr, n int32) ([]byte, error) {
+	// Compare against the remaining length: addr+n can overflow where int
+	// is 32 bits.
+	if addr < 0 || n < 0 || int(n) > len(m.mem) || int(addr) > len(m.mem)-int(n) {
+		return nil, errBadAddress
+	}
+	return m.mem[addr : int(addr)+int(n)], nil
+}
+
+// Run executes at most budget instructions.
+func (m *Machine) Run(budget int) (State, error) {
+	for ; budget > 0; budget-- {
+		if m.halted {
+			return StateHalted, nil
+		}
+		pc := m.pc
+		if err := m.step(); err != nil {
+			if errors.Is(err, ErrWait) {
+				m.pc = pc
+				return StateWaiting, nil
+			}
+			m.halted = true
+			return StateHalted, &Trap{PC: pc, Err: err}
+		}
+	}
+	if m.halted {
+		return StateHalted, nil
+	}
+	return StateRunning, nil
+}
+
+func (m *Machine) step() error {
+	code := m.prog.Code
+	if m.pc < 0 || m.pc >= len(code) {
+		return errBadJump
+	}
+	op := Op(code[m.pc])
+	n := operandSize(op)
+	if n < 0 {
+		return errBadOpcode
+	}
+	if m.pc+1+n > len(code) {
+		return errBadJump
+	}
+	arg := code[m.pc+1 : m.pc+1+n]
+	m.pc += 1 + n
+
+	switch op {
+	case OpHalt:
+		m.halted = true
+		return nil
+	case OpNop:
+		return nil
+	case OpPush:
+		return m.Push(int32(binary.LittleEndian.Uint32(arg)))
+	case OpPush8:
+		return m.Push(int32(int8(arg[0])))
+	case OpDup:
+		v, err := m.Peek(0)
+		if err != nil {
+			return err
+		}
+		return m.Push(v)
+	case OpDrop:
+		_, err := m.Pop()
+		return err
+	case OpSwap:
+		if len(m.stack) < 2 {
+			return errStackUnderflow
+		}
+		top := len(m.stack) - 1
+		m.stack[top], m.stack[top-1] = m.stack[top-1], m.stack[top]
+		return nil
+	case OpOver:
+		v, err := m.Peek(1)
+		if err != nil {
+			return err
+		}
+		return m.Push(v)
+
+	case OpNeg, OpNot:
+		v, err := m.Pop()
+		if err != nil {
+			return err
+		}
+		if op == OpNeg {
+			return m.Push(-v)
+		}
+		return m.Push(^v)
+
+	case OpAdd, OpSub, OpMul, OpDiv, OpMod, OpAnd, OpOr, OpXor, OpShl, OpShr,
+		OpEq, OpNe, OpLt, OpLe, OpGt, OpGe:
+		b, err := m.Pop()
+		if err != nil {
+			return err
+		}
+		a, err := m.Pop()
+		if err != nil {
+			return err
+		}
+		v, err := binop(op, a, b)
+		if err != nil {
+			return err
+		}
+		return m.Push(v)
+
+	case OpJmp:
+		return m.jump(arg)
+	case OpJz, OpJnz:
+		c, err := m.Pop()
+		if err != nil {
+			return err
+		}
+		if (c == 0) == (op == OpJz) {
+			return m.jump(arg)
+		}
+		return nil
+	case OpCall:
+		if len(m.calls) == CallDepth {
+			return errCallOverflow
+		}
+		m.calls = append(m.calls, uint16(m.pc))
+		return m.jump(arg)
+	case OpRet:
+		if len(m.calls) == 0 {
+			return errStackUnderflow
+		}
+		m.pc = int(m.calls[len(m.calls)-1])
+		m.calls = m.calls[:len(m.calls)-1]
+		return nil
+
+	case OpLoad, OpLoadB:
+		addr, err := m.Pop()
+		if err != nil {
+			return err
+		}
+		if op == OpLoadB {
+			b, err := m.Bytes(addr, 1)
+			if err != nil {
+				return err
+			}
+			return m.Push(int32(b[0]))
+		}
+		b, err := m.Bytes(addr, 4)
+		if err != nil {
+			return err
+		}
+		return m.Push(int32(binary.LittleEndian.Uint32(b)))
+	case OpStore, OpStoreB:
+		addr, err := m.Pop()
+		if err != nil {
+			return err
+		}
+		v, err := m.Pop()
+		if err != nil {
+			return err
+		}
+		if op == OpStoreB {
+			b, err := m.Bytes(addr, 1)
+			if err != nil {
+				return err
+			}
+			b[0] = byte(v)
+			return nil
+		}
+		b, err := m.Bytes(addr, 4)
+		if err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint32(b, uint32(v))
+		return nil
+
+	case OpSys:
+		s := Sys(arg[0])
+		if svc := s.Service(); svc != "" && !m.prog.Uses(svc) {
+			return fmt.Errorf("%s: service %q not in manifest", s, svc)
+		}
+		if m.sys == nil {
+			return fmt.Errorf("%s: no syscalls", s)
+		}
+		return m.sys.Syscall(m, s)
+	}
+	return errBadOpcode
+}
+
+func (m *Machine) jump(arg []byte) error {
+	to := int(binary.LittleEndian.Uint16(arg))
+	if to >= len(m.prog.Code) {
+		return errBadJump
+	}
+	m.pc = to
+	return nil
+}
+
+func binop(op Op, a, b int32) (int32, error) {
+	switch op {
+	case OpAdd:
+		return a + b, nil
+	case OpSub:
+		return a - b, nil
+	case OpMul:
+		return a * b, nil
+	case OpDiv, OpMod:
+		if b == 0 {
+			return 0, errDivZero
+		}
+		if op == OpDiv {
+			return a / b, nil
+		}
+		return a % b, nil
+	case OpAnd:
+		return a & b, nil
+	case OpOr:
+		return a | b, nil
+	case OpXor:
+		return a ^ b, nil
+	case OpShl:
+		return a << uint32(b&31), nil
+	case OpShr:
+		return a >> uint32(b&31), nil
+	}
+
+	var c bool
+	switch op {
+	case OpEq:
+		c = a == b
+	case OpNe:
+		c = a != b
+	case OpLt:
+		c = a < b
+	case OpLe:
+		c = a <= b
+	case OpGt:
+		c = a > b
+	case OpGe:
+		c = a >= b
+	}
+	if c {
+		return 1, nil
+	}
+	return 0, nil
+}
@@ -2,9 +2,17 @@ package archive
 
 import (
 	"fmt"
+	"time"
+
+	vfsclient "spark/sparkos/client/vfs"
+	"spark/sparkos/proto"
 )
 
-func tarHeader(rel string, size uint32, isDir bool) [tarBlockSize]byte {
+// tarHeader builds the ustar header of an entry, with its owner, mode and
+// modification time if the filesystem keeps them.
+func tarHeader(rel string, ent vfsclient.Entry) [tarBlockSize]byte {
+	isDir := ent.Type == proto.VFSEntryDir
+	size := ent.Size
 	rel = sanitizeRelPath(rel)
 	if isDir && rel != "" && !stringsHasSuffix(rel, "/") {
 		rel += "/"
@@ -31,11 +39,15 @@ func tarHeader(rel string, size uint32, isDir bool) [tarBlockSize]byte {
 		size = 0
 	}
 
+	if ent.Mode != 0 {
+		mode = uint32(ent.Mode)
+	}
+
 	writeOctal(h[100:108], mode)
-	writeOctal(h[108:116], 0) // uid
-	writeOctal(h[116:124], 0) // gid
+	writeOctal(h[108:116], ent.UID)
+	writeOctal(h[116:124], ent.GID)
 	writeOctal(h[124:136], size)
-	writeOctal(h[136:148], 0) // mtime
+	writeOctal(h[136:148], tarTime(ent.Mtime))
 
 	for i := 148; i < 156; i++ {
 		h[i] = ' '
@@ -51,6 +63,14 @@ func tarHeader(rel string, size uint32, isDir bool) [tarBlockSize]byte {
 	return h
 }
 
+// tarTime returns t in Unix seconds, 0 for unknown and out-of-range times.
+func tarTime(t time.Time) uint32 {
+	if t.IsZero() || t.Unix() < 0 || t.Unix() > int64(^uint32(0)) {
+		return 0
+	}
+	return uint32(t.Unix())
+}
+
 func tarChecksum(b []byte) uint32 {
 	var sum uint32
 	for i := 0; i < len(b); i++ {
@@ -868,8 +868,9 @@ func (t *Task) createTar(ctx *kernel.Context, outPath, srcDir string) error {
 	}
 	defer func() { _, _ = w.Close() }()
 
-	addFile := func(rel string, filePath string, size uint32) error {
-		hdr := tarHeader(rel, size, false)
+	addFile := func(rel string, filePath string, ent vfsclient.Entry) error {
+		size := ent.Size
+		hdr := tarHeader(rel, ent)
 		if _, err := w.Write(hdr[:]); err != nil {
 			return err
 		}
@@ -903,20 +904,20 @@ func (t *Task) createTar(ctx *kernel.Context, outPath, srcDir string) error {
 		return nil
 	}
 
-	addDir := func(rel string) error {
-		hdr := tarHeader(rel, 0, true)
+	addDir := func(rel string, ent vfsclient.Entry) error {
+		hdr := tarHeader(rel, ent)
 		_, err := w.Write(hdr[:])
 		return err
 	}
 
-	if err := t.walkDir(ctx, srcDir, "", func(rel, full string, typ proto.VFSEntryType, size uint32) error {
-		switch typ {
+	if err := t.walkDir(ctx, srcDir, "", func(rel, full string, ent vfsclient.Entry) error {
+		switch ent.Type {
 		case proto.VFSEntryDir:
 			if rel != "" {
-				return addDir(rel)
+				return addDir(rel, ent)
 			}
 		case proto.VFSEntryFile:
-			return addFile(rel, full, size)
+			return addFile(rel, full, ent)
 		}
 		return nil
 	}); err != nil {
@@ -949,15 +950,15 @@ func (t *Task) createZipStore(ctx *kernel.Context, outPath, srcDir string) error
 	defer func() { _, _ = w.Close() }()
 
 	zw := newZipStoreWriter(w)
-	if err := t.walkDir(ctx, srcDir, "", func(rel, full string, typ proto.VFSEntryType, size uint32) error {
-		switch typ {
+	if err := t.walkDir(ctx, srcDir, "", func(rel, full string, ent vfsclient.Entry) error {
+		switch ent.Type {
 		case proto.VFSEntryDir:
 			if rel == "" {
 				return nil
 			}
-			return zw.AddDir(rel)
+			return zw.AddDir(rel, ent.Mtime)
 		case proto.VFSEntryFile:
-			return zw.AddFile(ctx, t.vfs, rel, full, size)
+			return zw.AddFile(ctx, t.vfs, rel, full, ent.Size, ent.Mtime)
 		default:
 			return nil
 		}
@@ -975,7 +976,7 @@ func (t *Task) walkDir(
 	ctx *kernel.Context,
 	dir string,
 	relBase string,
-	visit func(rel, full string, typ proto.VFSEntryType, size uint32) error,
+	visit func(rel, full string, ent vfsclient.Entry) error,
 ) error {
 	entries, err := t.vfs.List(ctx, dir)
 	if err != nil {
@@ -999,7 +1000,7 @@ func (t *Task) walkDir(
 		}
 		rel = sanitizeRelPath(rel)
 
-		if err := visit(rel, full, ent.Type, ent.Size); err != nil {
+		if err := visit(rel, full, ent); err != nil {
 			return err
 		}
 		if ent.Type == proto.VFSEntryDir {
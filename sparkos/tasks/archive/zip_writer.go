@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"strings"
+	"time"
 
 	vfsclient "spark/sparkos/client/vfs"
 	"spark/sparkos/kernel"
@@ -15,6 +16,8 @@ type zipCentralEntry struct {
 	crc32 uint32
 	size  uint32
 
+	modTime, modDate uint16
+
 	localOff          uint32
 	isDir             bool
 	useDataDescriptor bool
@@ -41,7 +44,18 @@ func (z *zipStoreWriter) write(p []byte) error {
 	return err
 }
 
-func (z *zipStoreWriter) AddDir(name string) error {
+// dosTime encodes t as the DOS time and date of zip headers. Unknown times
+// and times before 1980 become 1980-01-01 00:00.
+func dosTime(t time.Time) (tm, date uint16) {
+	if t.Year() < 1980 {
+		return 0, 1<<5 | 1
+	}
+	tm = uint16(t.Hour()<<11 | t.Minute()<<5 | t.Second()/2)
+	date = uint16((t.Year()-1980)<<9 | int(t.Month())<<5 | t.Day())
+	return tm, date
+}
+
+func (z *zipStoreWriter) AddDir(name string, mtime time.Time) error {
 	name = sanitizeRelPath(name)
 	if name == "" {
 		return nil
@@ -50,12 +64,15 @@ func (z *zipStoreWriter) AddDir(name string) error {
 		name += "/"
 	}
 	localOff := z.off
+	modTime, modDate := dosTime(mtime)
 
 	var hdr [30]byte
 	binary.LittleEndian.PutUint32(hdr[0:4], zipLocalSig)
 	binary.LittleEndian.PutUint16(hdr[4:6], 20)
 	binary.LittleEndian.PutUint16(hdr[6:8], 0)
 	binary.LittleEndian.PutUint16(hdr[8:10], 0) // store
+	binary.LittleEndian.PutUint16(hdr[10:12], modTime)
+	binary.LittleEndian.PutUint16(hdr[12:14], modDate)
 	binary.LittleEndian.PutUint32(hdr[14:18], 0)
 	binary.LittleEndian.PutUint32(hdr[18:22], 0)
 	binary.LittleEndian.PutUint32(hdr[22:26], 0)
@@ -68,19 +85,20 @@ func (z *zipStoreWriter) AddDir(name string) error {
 	if err := z.write([]byte(name)); err != nil {
 		return err
 	}
-	z.entries = append(z.entries, zipCentralEntry{name: name, localOff: localOff, isDir: true})
+	z.entries = append(z.entries, zipCentralEntry{name: name, modTime: modTime, modDate: modDate, localOff: localOff, isDir: true})
 	return nil
 }
 
-func (z *zipStoreWriter) AddFile(ctx *kernel.Context, vfs *vfsclient.Client, name, path string, size uint32) error {
+func (z *zipStoreWriter) AddFile(ctx *kernel.Context, vfs *vfsclient.Client, name, path string, size uint32, mtime time.Time) error {
 	name = sanitizeRelPath(name)
 	if name == "" {
 		return fmt.Errorf("zip: empty name")
 	}
 	if strings.HasSuffix(name, "/") {
-		return z.AddDir(name)
+		return z.AddDir(name, mtime)
 	}
 	localOff := z.off
+	modTime, modDate := dosTime(mtime)
 
 	// Use data descriptor (flag bit 3) so we can stream without precomputing CRC.
 	const flagDataDescriptor = 0x08
@@ -90,6 +108,8 @@ func (z *zipStoreWriter) AddFile(ctx *kernel.Context, vfs *vfsclient.Client, nam
 	binary.LittleEndian.PutUint16(hdr[4:6], 20)
 	binary.LittleEndian.PutUint16(hdr[6:8], flagDataDescriptor)
 	binary.LittleEndian.PutUint16(hdr[8:10], 0) // store
+	binary.LittleEndian.PutUint16(hdr[10:12], modTime)
+	binary.LittleEndian.PutUint16(hdr[12:14], modDate)
 	binary.LittleEndian.PutUint32(hdr[14:18], 0)
 	binary.LittleEndian.PutUint32(hdr[18:22], 0)
 	binary.LittleEndian.PutUint32(hdr[22:26], 0)
@@ -141,6 +161,8 @@ func (z *zipStoreWriter) AddFile(ctx *kernel.Context, vfs *vfsclient.Client, nam
 		name:              name,
 		crc32:             crc,
 		size:              size,
+		modTime:           modTime,
+		modDate:           modDate,
 		localOff:          localOff,
 		isDir:             false,
 		useDataDescriptor: true,
@@ -162,6 +184,8 @@ func (z *zipStoreWriter) Close() error {
 		}
 		binary.LittleEndian.PutUint16(h[8:10], flags)
 		binary.LittleEndian.PutUint16(h[10:12], 0) // store
+		binary.LittleEndian.PutUint16(h[12:14], e.modTime)
+		binary.LittleEndian.PutUint16(h[14:16], e.modDate)
 		binary.LittleEndian.PutUint32(h[16:20], e.crc32)
 		binary.LittleEndian.PutUint32(h[20:24], e.size)
 		binary.LittleEndian.PutUint32(h[24:28], e.size)
@@ -694,7 +694,7 @@ func (t *Task) spawnProgram(ctx *kernel.Context, path string) error {
 		p.upsertLine(no, rest)
 	}
 
-	go func() {
+	ctx.Go(func() {
 		vm := newVM(defaultMaxFiles)
 		vm.prog = &p
 		vm.vfs = vfs
@@ -708,6 +708,9 @@ func (t *Task) spawnProgram(ctx *kernel.Context, path string) error {
 			return
 		}
 		for vm.running {
+			// The loop makes no other kernel call; without this a kill
+			// would never stop it.
+			ctx.Yield()
 			step, err := vm.step()
 			if err != nil {
 				select {
@@ -737,7 +740,7 @@ func (t *Task) spawnProgram(ctx *kernel.Context, path string) error {
 		case t.jobOut <- "[spawn] done: " + path:
 		default:
 		}
-	}()
+	})
 
 	select {
 	case t.jobOut <- "[spawn] started: " + path:
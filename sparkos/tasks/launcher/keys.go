@@ -1,4 +1,4 @@
-package snake
+package launcher
 
 import "unicode/utf8"
 
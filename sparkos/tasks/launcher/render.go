@@ -0,0 +1,265 @@
+package launcher
+
+import (
+	"image/color"
+
+	"spark/hal"
+
+	"tinygo.org/x/tinyfont"
+)
+
+const (
+	tileW = 64
+	tileH = 52
+
+	iconBoxW = 40
+	iconBoxH = 28
+	// iconScale magnifies the icon glyphs.
+	iconScale = 2
+
+	// maxRecentRows bounds the recent files panel.
+	maxRecentRows = 4
+)
+
+var (
+	colorBG      = color.RGBA{R: 0x10, G: 0x14, B: 0x1C, A: 0xFF}
+	colorText    = color.RGBA{R: 0xEE, G: 0xEE, B: 0xEE, A: 0xFF}
+	colorDim     = color.RGBA{R: 0x88, G: 0x90, B: 0x9C, A: 0xFF}
+	colorSel     = color.RGBA{R: 0x2A, G: 0x4A, B: 0x7A, A: 0xFF}
+	colorStatus  = color.RGBA{R: 0xFF, G: 0xD1, B: 0x4A, A: 0xFF}
+	colorDivider = color.RGBA{R: 0x30, G: 0x38, B: 0x44, A: 0xFF}
+
+	// iconColors are picked by app ID so an icon keeps its color.
+	iconColors = []color.RGBA{
+		{R: 0x3A, G: 0x86, B: 0xC8, A: 0xFF},
+		{R: 0x4C, G: 0xA8, B: 0x5A, A: 0xFF},
+		{R: 0xC8, G: 0x7A, B: 0x2E, A: 0xFF},
+		{R: 0x9A, G: 0x5C, B: 0xC8, A: 0xFF},
+		{R: 0xC8, G: 0x4A, B: 0x5A, A: 0xFF},
+		{R: 0x2E, G: 0xA8, B: 0xA0, A: 0xFF},
+		{R: 0xA8, G: 0x9A, B: 0x2E, A: 0xFF},
+		{R: 0x5A, G: 0x6A, B: 0x80, A: 0xFF},
+	}
+)
+
+func (t *Task) lineH() int { return int(t.fontHeight) + 2 }
+
+func (t *Task) cols() int {
+	if t.fb == nil {
+		return 1
+	}
+	if c := t.fb.Width() / tileW; c > 0 {
+		return c
+	}
+	return 1
+}
+
+// recentRows is the number of recent files shown.
+func (t *Task) recentRows() int {
+	if len(t.recent) < maxRecentRows {
+		return len(t.recent)
+	}
+	return maxRecentRows
+}
+
+// layout returns where the grid starts and how many tile rows fit.
+func (t *Task) layout() (gridY, rows int) {
+	h := t.fb.Height()
+	gridY = t.lineH()
+	bottom := t.lineH()
+	if n := t.recentRows(); n > 0 {
+		bottom += (n + 1) * t.lineH()
+	}
+	rows = (h - gridY - bottom) / tileH
+	if rows < 1 {
+		rows = 1
+	}
+	return gridY, rows
+}
+
+func (t *Task) render() {
+	if !t.active || t.fb == nil || t.fb.Format() != hal.PixelFormatRGB565 {
+		return
+	}
+	w := t.fb.Width()
+	h := t.fb.Height()
+	if w <= 0 || h <= 0 || len(t.entries) == 0 {
+		return
+	}
+	d := &fbDisplayer{fb: t.fb}
+	_ = d.FillRectangle(0, 0, int16(w), int16(h), colorBG)
+
+	t.drawText(d, 2, 1, "Home", colorText)
+	hint := "Enter open  Tab recent  q shell"
+	t.drawText(d, w-len(hint)*int(t.fontWidth)-2, 1, hint, colorDim)
+
+	cols := t.cols()
+	gridY, rows := t.layout()
+	row := t.sel / cols
+	if row < t.top {
+		t.top = row
+	}
+	if row >= t.top+rows {
+		t.top = row - rows + 1
+	}
+	x0 := (w - cols*tileW) / 2
+	for i := t.top * cols; i < len(t.entries) && i < (t.top+rows)*cols; i++ {
+		r := i/cols - t.top
+		c := i % cols
+		t.drawTile(d, x0+c*tileW, gridY+r*tileH, t.entries[i], i == t.sel && t.zone == zoneApps)
+	}
+
+	y := h - t.lineH()
+	if n := t.recentRows(); n > 0 {
+		y -= (n + 1) * t.lineH()
+		_ = d.FillRectangle(0, int16(y), int16(w), 1, colorDivider)
+		t.drawText(d, 2, y+2, "Recent", colorDim)
+		first := 0
+		if t.recentSel >= n {
+			first = t.recentSel - n + 1
+		}
+		for i := 0; i < n; i++ {
+			ry := y + (i+1)*t.lineH()
+			r := t.recent[first+i]
+			if first+i == t.recentSel && t.zone == zoneRecent {
+				_ = d.FillRectangle(0, int16(ry), int16(w), int16(t.lineH()), colorSel)
+			}
+			t.drawText(d, 2, ry+1, t.fit(r.App, 8), colorDim)
+			t.drawText(d, 2+8*int(t.fontWidth), ry+1, t.fit(r.Path, w/int(t.fontWidth)-9), colorText)
+		}
+		y = h - t.lineH()
+	}
+
+	line, c := t.status, colorStatus
+	if line == "" {
+		line, c = t.entries[t.sel].desc, colorDim
+		if t.zone == zoneRecent && t.recentSel < len(t.recent) {
+			line = "Open " + t.recent[t.recentSel].Path + " in " + t.recent[t.recentSel].App
+		}
+	}
+	t.drawText(d, 2, y+1, t.fit(line, w/int(t.fontWidth)), c)
+
+	_ = t.fb.Present()
+}
+
+func (t *Task) drawTile(d *fbDisplayer, x, y int, e entry, selected bool) {
+	if selected {
+		_ = d.FillRectangle(int16(x+1), int16(y+1), tileW-2, tileH-2, colorSel)
+	}
+	bx := x + (tileW-iconBoxW)/2
+	by := y + 4
+	_ = d.FillRectangle(int16(bx), int16(by), iconBoxW, iconBoxH, iconColors[int(e.id)%len(iconColors)])
+
+	icon := e.icon
+	if icon == "" && e.name != "" {
+		icon = e.name[:1]
+	}
+	_, iw := tinyfont.LineWidth(t.font, icon)
+	s := &scaledDisplayer{
+		d:     d,
+		x0:    bx + (iconBoxW-int(iw)*iconScale)/2,
+		y0:    by + (iconBoxH-int(t.fontHeight)*iconScale)/2,
+		scale: iconScale,
+	}
+	tinyfont.WriteLine(s, t.font, 0, t.fontHeight, icon, colorText)
+
+	name := t.fit(e.name, tileW/int(t.fontWidth))
+	nx := x + (tileW-len(name)*int(t.fontWidth))/2
+	t.drawText(d, nx, by+iconBoxH+4, name, colorText)
+}
+
+// fit shortens s to n characters.
+func (t *Task) fit(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	if n == 1 {
+		return string(r[:1])
+	}
+	return string(r[:n-1]) + "~"
+}
+
+func (t *Task) drawText(d *fbDisplayer, x, y int, s string, c color.RGBA) {
+	tinyfont.WriteLine(d, t.font, int16(x), int16(y)+t.fontHeight, s, c)
+}
+
+// scaledDisplayer draws every pixel as a scale x scale block at (x0, y0).
+type scaledDisplayer struct {
+	d      *fbDisplayer
+	x0, y0 int
+	scale  int
+}
+
+func (s *scaledDisplayer) Size() (x, y int16) { return s.d.Size() }
+
+func (s *scaledDisplayer) SetPixel(x, y int16, c color.RGBA) {
+	_ = s.d.FillRectangle(int16(s.x0+int(x)*s.scale), int16(s.y0+int(y)*s.scale), int16(s.scale), int16(s.scale), c)
+}
+
+func (s *scaledDisplayer) Display() error { return nil }
+
+type fbDisplayer struct {
+	fb hal.Framebuffer
+}
+
+func (d *fbDisplayer) Size() (x, y int16) {
+	return int16(d.fb.Width()), int16(d.fb.Height())
+}
+
+func (d *fbDisplayer) SetPixel(x, y int16, c color.RGBA) {
+	_ = d.FillRectangle(x, y, 1, 1, c)
+}
+
+func (d *fbDisplayer) Display() error { return nil }
+
+func (d *fbDisplayer) FillRectangle(x, y, width, height int16, c color.RGBA) error {
+	buf := d.fb.Buffer()
+	if buf == nil {
+		return nil
+	}
+
+	w := d.fb.Width()
+	h := d.fb.Height()
+	x0 := clampInt(int(x), 0, w)
+	y0 := clampInt(int(y), 0, h)
+	x1 := clampInt(int(x)+int(width), 0, w)
+	y1 := clampInt(int(y)+int(height), 0, h)
+	if x0 >= x1 || y0 >= y1 {
+		return nil
+	}
+
+	pixel := rgb565From888(c.R, c.G, c.B)
+	lo := byte(pixel)
+	hi := byte(pixel >> 8)
+	stride := d.fb.StrideBytes()
+	for py := y0; py < y1; py++ {
+		row := py * stride
+		for px := x0; px < x1; px++ {
+			off := row + px*2
+			if off < 0 || off+1 >= len(buf) {
+				continue
+			}
+			buf[off] = lo
+			buf[off+1] = hi
+		}
+	}
+	return nil
+}
+
+func rgb565From888(r, g, b uint8) uint16 {
+	return uint16((uint16(r>>3)&0x1F)<<11 | (uint16(g>>2)&0x3F)<<5 | (uint16(b>>3) & 0x1F))
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -0,0 +1,370 @@
+// Package launcher is the home screen: a grid of the registered apps and the
+// recently opened files, started through consolemux like the shell does.
+package launcher
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"unicode"
+
+	"spark/hal"
+	"spark/sparkos/apps"
+	vfsclient "spark/sparkos/client/vfs"
+	"spark/sparkos/fonts/font6x8cp1251"
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+
+	"tinygo.org/x/tinyfont"
+)
+
+type zone uint8
+
+const (
+	zoneApps zone = iota
+	zoneRecent
+)
+
+// entry is a grid tile: an app, or the shell.
+type entry struct {
+	id   proto.AppID
+	name string
+	icon string
+	desc string
+}
+
+// shellEntry hands the focus back to the shell.
+var shellEntry = entry{name: "shell", icon: ">_", desc: "Command shell."}
+
+type Task struct {
+	disp   hal.Display
+	ep     kernel.Capability
+	vfsCap kernel.Capability
+
+	fb hal.Framebuffer
+
+	font       tinyfont.Fonter
+	fontWidth  int16
+	fontHeight int16
+
+	active bool
+	muxCap kernel.Capability
+
+	entries []entry
+	recent  []apps.Recent
+
+	zone      zone
+	sel       int
+	recentSel int
+	// top is the first grid row on screen.
+	top int
+
+	// status is shown instead of the selected app's description until the
+	// next key.
+	status string
+
+	inbuf []byte
+}
+
+func New(disp hal.Display, ep kernel.Capability, vfsCap kernel.Capability) *Task {
+	return &Task{disp: disp, ep: ep, vfsCap: vfsCap}
+}
+
+func (t *Task) Run(ctx *kernel.Context) {
+	ch, ok := ctx.RecvChan(t.ep)
+	if !ok {
+		return
+	}
+	if t.disp == nil {
+		return
+	}
+
+	t.fb = t.disp.Framebuffer()
+	if t.fb == nil {
+		return
+	}
+
+	t.font = font6x8cp1251.Font
+	t.fontHeight = 8
+	_, outboxWidth := tinyfont.LineWidth(t.font, "0")
+	t.fontWidth = int16(outboxWidth)
+	if t.fontWidth <= 0 {
+		return
+	}
+
+	for msg := range ch {
+		switch proto.Kind(msg.Kind) {
+		case proto.MsgAppShutdown:
+			return
+
+		case proto.MsgAppControl:
+			if msg.Cap.Valid() {
+				t.muxCap = msg.Cap
+			}
+			active, ok := proto.DecodeAppControlPayload(msg.Payload())
+			if !ok {
+				continue
+			}
+			t.setActive(ctx, active)
+
+		case proto.MsgAppSelect:
+			appID, _, ok := proto.DecodeAppSelectPayload(msg.Payload())
+			if !ok || appID != proto.AppLauncher {
+				continue
+			}
+			if t.active {
+				t.render()
+			}
+
+		case proto.MsgTermInput:
+			if !t.active {
+				continue
+			}
+			t.handleInput(ctx, msg.Payload())
+			if t.active {
+				t.render()
+			}
+		}
+	}
+}
+
+func (t *Task) setActive(ctx *kernel.Context, active bool) {
+	if active == t.active {
+		return
+	}
+	t.active = active
+	if !t.active {
+		t.inbuf = t.inbuf[:0]
+		return
+	}
+
+	// Apps and recent files may have changed while another app was in front.
+	t.loadEntries()
+	t.loadRecent(ctx)
+	t.render()
+}
+
+func (t *Task) loadEntries() {
+	t.entries = append(t.entries[:0], shellEntry)
+	for _, d := range apps.All() {
+		if d.ID == proto.AppLauncher {
+			continue
+		}
+		t.entries = append(t.entries, entry{id: d.ID, name: d.Name, icon: d.Icon, desc: d.Desc})
+	}
+	if t.sel >= len(t.entries) {
+		t.sel = len(t.entries) - 1
+	}
+}
+
+func (t *Task) loadRecent(ctx *kernel.Context) {
+	t.recent = nil
+	if t.vfsCap.Valid() {
+		t.recent, _ = apps.LoadRecent(ctx, vfsclient.New(t.vfsCap))
+	}
+	if t.recentSel >= len(t.recent) {
+		t.recentSel = len(t.recent) - 1
+	}
+	if t.recentSel < 0 {
+		t.recentSel = 0
+	}
+	if len(t.recent) == 0 {
+		t.zone = zoneApps
+	}
+}
+
+func (t *Task) handleInput(ctx *kernel.Context, b []byte) {
+	t.inbuf = append(t.inbuf, b...)
+	buf := t.inbuf
+
+	for len(buf) > 0 {
+		n, k, ok := nextKey(buf)
+		if !ok {
+			break
+		}
+		buf = buf[n:]
+		t.handleKey(ctx, k)
+		if !t.active {
+			t.inbuf = t.inbuf[:0]
+			return
+		}
+	}
+	t.inbuf = append(t.inbuf[:0], buf...)
+}
+
+func (t *Task) handleKey(ctx *kernel.Context, k key) {
+	t.status = ""
+
+	switch k.kind {
+	case keyEsc:
+		t.requestExit(ctx)
+		return
+	case keyTab:
+		if t.zone == zoneApps && len(t.recent) > 0 {
+			t.zone = zoneRecent
+		} else {
+			t.zone = zoneApps
+		}
+		return
+	case keyRune:
+		if k.r == 'q' {
+			t.requestExit(ctx)
+			return
+		}
+	}
+
+	if t.zone == zoneRecent {
+		t.handleRecentKey(ctx, k)
+		return
+	}
+
+	cols := t.cols()
+	switch k.kind {
+	case keyLeft:
+		t.move(-1)
+	case keyRight:
+		t.move(1)
+	case keyUp:
+		t.move(-cols)
+	case keyDown:
+		t.move(cols)
+	case keyHome:
+		t.sel = 0
+	case keyEnd:
+		t.sel = len(t.entries) - 1
+	case keyEnter:
+		t.open(ctx, t.entries[t.sel])
+	case keyRune:
+		if k.r == ' ' {
+			t.open(ctx, t.entries[t.sel])
+			return
+		}
+		t.jump(k.r)
+	}
+}
+
+func (t *Task) handleRecentKey(ctx *kernel.Context, k key) {
+	switch k.kind {
+	case keyUp:
+		if t.recentSel > 0 {
+			t.recentSel--
+		}
+	case keyDown:
+		if t.recentSel+1 < len(t.recent) {
+			t.recentSel++
+		}
+	case keyEnter:
+		if t.recentSel < len(t.recent) {
+			t.openRecent(ctx, t.recent[t.recentSel])
+		}
+	}
+}
+
+// move shifts the selection by delta tiles, stopping at the ends.
+func (t *Task) move(delta int) {
+	sel := t.sel + delta
+	if sel < 0 || sel >= len(t.entries) {
+		return
+	}
+	t.sel = sel
+}
+
+// jump selects the next entry after the selection whose name starts with r.
+func (t *Task) jump(r rune) {
+	r = unicode.ToLower(r)
+	for i := 1; i <= len(t.entries); i++ {
+		j := (t.sel + i) % len(t.entries)
+		if name := t.entries[j].name; name != "" && rune(name[0]) == r {
+			t.sel = j
+			return
+		}
+	}
+}
+
+// open starts the app of e without arguments, as its shell command would
+// with none.
+func (t *Task) open(ctx *kernel.Context, e entry) {
+	if e.id == proto.AppNone {
+		t.requestExit(ctx)
+		return
+	}
+	d, ok := apps.ByID(e.id)
+	if !ok {
+		t.status = e.name + ": not installed"
+		return
+	}
+	t.start(ctx, d, nil)
+}
+
+func (t *Task) openRecent(ctx *kernel.Context, r apps.Recent) {
+	d, ok := apps.ByName(r.App)
+	if !ok {
+		t.status = r.App + ": not installed"
+		return
+	}
+	if t.start(ctx, d, []string{r.Path}) && t.vfsCap.Valid() {
+		_ = apps.AddRecent(ctx, vfsclient.New(t.vfsCap), r)
+	}
+}
+
+// start runs the Args hook of d on args and selects the app with the result.
+func (t *Task) start(ctx *kernel.Context, d apps.Descriptor, args []string) bool {
+	parse := d.Args
+	if parse == nil {
+		parse = apps.NoArgs
+	}
+	arg, activate, err := parse(argShell{t: t}, args)
+	if errors.Is(err, apps.ErrUsage) {
+		t.status = "usage: " + d.Usage + " (open it from the shell)"
+		return false
+	}
+	if err != nil {
+		t.status = d.Name + ": " + err.Error()
+		return false
+	}
+	if !activate {
+		return false
+	}
+	if !t.muxCap.Valid() {
+		t.status = "no consolemux"
+		return false
+	}
+
+	// Both go on the normal lane so consolemux sees the selection first. The
+	// app runs with the launcher's VFS identity, the user's.
+	if res := ctx.SendToCapRetry(t.muxCap, uint16(proto.MsgAppSelect), proto.AppSelectPayload(d.ID, arg), t.vfsCap, 500); res != kernel.SendOK {
+		t.status = d.Name + ": " + res.String()
+		return false
+	}
+	_ = ctx.SendToCapRetry(t.muxCap, uint16(proto.MsgAppControl), proto.AppControlPayload(true), kernel.Capability{}, 500)
+	// The app owns the screen now; don't draw over it before consolemux
+	// tells us we lost the focus.
+	t.active = false
+	return true
+}
+
+// requestExit gives the focus to the shell.
+func (t *Task) requestExit(ctx *kernel.Context) {
+	t.active = false
+	if !t.muxCap.Valid() {
+		return
+	}
+	_ = ctx.SendToCapRetry(t.muxCap, uint16(proto.MsgAppControl), proto.AppControlPayload(false), kernel.Capability{}, 500)
+}
+
+// argShell is the apps.Shell view of the launcher: it sits at the root and
+// has no admin rights.
+type argShell struct {
+	t *Task
+}
+
+func (a argShell) AbsPath(p string) string {
+	if strings.HasPrefix(p, "/") {
+		return path.Clean(p)
+	}
+	return path.Join("/", p)
+}
+
+func (a argShell) Cwd() string        { return "/" }
+func (a argShell) Admin() bool        { return false }
+func (a argShell) Notice(line string) { a.t.status = line }
@@ -4,6 +4,7 @@ import (
 	"path"
 	"sort"
 	"strings"
+	"time"
 
 	vfsclient "spark/sparkos/client/vfs"
 	"spark/sparkos/kernel"
@@ -14,6 +15,7 @@ type entry struct {
 	Name     string
 	Type     proto.VFSEntryType
 	Size     uint32
+	Mtime    time.Time
 	FullPath string
 }
 
@@ -25,6 +27,8 @@ type panel struct {
 	entries []entry
 	sel     int
 	scroll  int
+	// byTime sorts the newest entries first instead of by name.
+	byTime bool
 }
 
 func (p *panel) selected() (entry, bool) {
@@ -118,10 +122,25 @@ func (t *Task) loadDir(ctx *kernel.Context, p *panel) error {
 			Name:     e.Name,
 			Type:     e.Type,
 			Size:     e.Size,
+			Mtime:    e.Mtime,
 			FullPath: full,
 		})
 	}
 
+	sortEntries(entries, p.byTime)
+	p.entries = entries
+	if p.sel >= len(p.entries) {
+		p.sel = len(p.entries) - 1
+	}
+	if p.sel < 0 {
+		p.sel = 0
+	}
+	return nil
+}
+
+// sortEntries puts ".." first, then directories, then files, each by name or
+// newest first.
+func sortEntries(entries []entry, byTime bool) {
 	sort.Slice(entries, func(i, j int) bool {
 		a := entries[i]
 		b := entries[j]
@@ -136,17 +155,28 @@ func (t *Task) loadDir(ctx *kernel.Context, p *panel) error {
 		if da != db {
 			return da
 		}
+		if byTime && !a.Mtime.Equal(b.Mtime) {
+			return a.Mtime.After(b.Mtime)
+		}
 		return a.Name < b.Name
 	})
+}
 
-	p.entries = entries
-	if p.sel >= len(p.entries) {
-		p.sel = len(p.entries) - 1
+// toggleSort switches between sorting by name and by time, keeping the
+// selected entry selected.
+func (p *panel) toggleSort() {
+	cur, ok := p.selected()
+	p.byTime = !p.byTime
+	sortEntries(p.entries, p.byTime)
+	if !ok {
+		return
 	}
-	if p.sel < 0 {
-		p.sel = 0
+	for i, e := range p.entries {
+		if e.Name == cur.Name {
+			p.sel = i
+			break
+		}
 	}
-	return nil
 }
 
 func cleanPath(p string) string {
@@ -386,6 +386,7 @@ func (t *Task) renderHelp() {
 		"BACKSPACE: parent dir",
 		"c: copy file to other panel",
 		"n: mkdir (auto name)",
+		"s: sort by name / newest first",
 		"r or Ctrl+R: refresh",
 		"q or ESC: quit",
 		"",
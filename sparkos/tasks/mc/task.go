@@ -373,6 +373,14 @@ func (t *Task) handleKey(ctx *kernel.Context, k key) {
 			if err := t.openHexSelected(ctx); err != nil {
 				t.setMessage("hex: " + err.Error())
 			}
+		case 's':
+			p := t.activePanelPtr()
+			p.toggleSort()
+			if p.byTime {
+				t.setMessage("sort: newest first")
+			} else {
+				t.setMessage("sort: name")
+			}
 		}
 	}
 
@@ -1143,7 +1151,11 @@ func (t *Task) headerText() string {
 
 func (t *Task) statusText() string {
 	if t.message == "" {
-		return ""
+		e, ok := t.activePanelPtr().selected()
+		if !ok || e.Name == ".." || e.Mtime.IsZero() {
+			return ""
+		}
+		return clipRunes(e.Mtime.Format("2006-01-02 15:04")+"  "+e.Name, t.cols)
 	}
 	return clipRunes(t.message, t.cols)
 }
@@ -5,6 +5,7 @@ import (
 	"image/color"
 
 	"spark/hal"
+	"spark/sparkos/client/input"
 	"spark/sparkos/fonts/font6x8cp1251"
 	"spark/sparkos/kernel"
 	"spark/sparkos/proto"
@@ -215,12 +216,12 @@ func (t *Task) handleInput(ctx *kernel.Context, b []byte) {
 	buf := t.inbuf
 
 	for len(buf) > 0 {
-		n, k, ok := nextKey(buf)
+		n, ev, ok := input.Parse(buf)
 		if !ok {
 			break
 		}
 		buf = buf[n:]
-		t.handleKey(ctx, k)
+		t.handleKey(ctx, ev)
 		if !t.active {
 			t.inbuf = t.inbuf[:0]
 			return
@@ -229,20 +230,23 @@ func (t *Task) handleInput(ctx *kernel.Context, b []byte) {
 	t.inbuf = append(t.inbuf[:0], buf...)
 }
 
-func (t *Task) handleKey(ctx *kernel.Context, k key) {
-	switch k.kind {
-	case keyEsc:
+func (t *Task) handleKey(ctx *kernel.Context, ev input.Event) {
+	switch ev.Code {
+	case hal.KeyEscape:
 		t.requestExit(ctx)
-	case keyUp:
+	case hal.KeyUp:
 		t.setDir(ctx, dirUp)
-	case keyDown:
+	case hal.KeyDown:
 		t.setDir(ctx, dirDown)
-	case keyLeft:
+	case hal.KeyLeft:
 		t.setDir(ctx, dirLeft)
-	case keyRight:
+	case hal.KeyRight:
 		t.setDir(ctx, dirRight)
-	case keyRune:
-		switch k.r {
+	case hal.KeyUnknown:
+		if ev.Mods&hal.ModCtrl != 0 {
+			return
+		}
+		switch ev.Rune {
 		case 'q':
 			t.requestExit(ctx)
 		case 'p', ' ':
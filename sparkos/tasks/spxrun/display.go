@@ -0,0 +1,48 @@
+package spxrun
+
+import (
+	"image/color"
+
+	"spark/hal"
+)
+
+type fbDisplayer struct {
+	fb hal.Framebuffer
+}
+
+func (d *fbDisplayer) Size() (x, y int16) {
+	return int16(d.fb.Width()), int16(d.fb.Height())
+}
+
+func (d *fbDisplayer) SetPixel(x, y int16, c color.RGBA) {
+	buf := d.fb.Buffer()
+	ix := int(x)
+	iy := int(y)
+	if buf == nil || ix < 0 || ix >= d.fb.Width() || iy < 0 || iy >= d.fb.Height() {
+		return
+	}
+	pixel := rgb565From888(c.R, c.G, c.B)
+	off := iy*d.fb.StrideBytes() + ix*2
+	buf[off] = byte(pixel)
+	buf[off+1] = byte(pixel >> 8)
+}
+
+func (d *fbDisplayer) Display() error { return nil }
+
+func rgb565From888(r, g, b uint8) uint16 {
+	return uint16((uint16(r>>3)&0x1F)<<11 | (uint16(g>>2)&0x3F)<<5 | (uint16(b>>3) & 0x1F))
+}
+
+func rgb565To888(p uint16) color.RGBA {
+	return color.RGBA{R: uint8(p>>11) << 3, G: uint8(p>>5&0x3F) << 2, B: uint8(p&0x1F) << 3, A: 0xFF}
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
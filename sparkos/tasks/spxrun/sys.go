@@ -0,0 +1,316 @@
+package spxrun
+
+import (
+	"fmt"
+	"image/color"
+
+	notifyclient "spark/sparkos/client/notify"
+	vfsclient "spark/sparkos/client/vfs"
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+	"spark/sparkos/spx"
+
+	"tinygo.org/x/tinyfont"
+)
+
+// maxIOBytes bounds one read or write syscall.
+const maxIOBytes = 4096
+
+// sysTable implements the syscalls of a running program. Text from putc and
+// puts goes to a console drawn straight onto the framebuffer.
+type sysTable struct {
+	task *Task
+	// ctx is set while the program runs.
+	ctx *kernel.Context
+
+	vfs       *vfsclient.Client
+	notifyCap kernel.Capability
+
+	sleeping bool
+	wake     uint64
+
+	col, row int
+	dirty    bool
+}
+
+var consoleFG = color.RGBA{R: 0xEE, G: 0xEE, B: 0xEE, A: 0xFF}
+
+// reset drops the grants and the console state of the previous program.
+func (s *sysTable) reset() {
+	s.vfs = nil
+	s.notifyCap = kernel.Capability{}
+	s.sleeping = false
+	s.col, s.row = 0, 0
+}
+
+func (s *sysTable) Syscall(m *spx.Machine, n spx.Sys) error {
+	switch n {
+	case spx.SysExit:
+		code, err := m.Pop()
+		if err != nil {
+			return err
+		}
+		m.Exit(code)
+		return nil
+
+	case spx.SysPutc:
+		c, err := m.Pop()
+		if err != nil {
+			return err
+		}
+		s.putc(rune(c))
+		return nil
+
+	case spx.SysPuts:
+		args, err := pop(m, 2)
+		if err != nil {
+			return err
+		}
+		b, err := m.Bytes(args[0], args[1])
+		if err != nil {
+			return err
+		}
+		s.print(string(b))
+		return nil
+
+	case spx.SysGetKey, spx.SysPollKey:
+		t := s.task
+		if len(t.inbuf) == 0 {
+			if n == spx.SysGetKey {
+				return spx.ErrWait
+			}
+			return m.Push(-1)
+		}
+		k := t.inbuf[0]
+		t.inbuf = t.inbuf[1:]
+		return m.Push(int32(k))
+
+	case spx.SysTicks:
+		return m.Push(int32(s.ctx.NowTick() & 0x7fffffff))
+
+	case spx.SysSleep:
+		ms, err := m.Peek(0)
+		if err != nil {
+			return err
+		}
+		now := s.ctx.NowTick()
+		if !s.sleeping {
+			s.sleeping = true
+			s.wake = now + uint64(max(ms, 0))
+		}
+		if now < s.wake {
+			return spx.ErrWait
+		}
+		s.sleeping = false
+		_, err = m.Pop()
+		return err
+
+	case spx.SysWidth:
+		return m.Push(int32(s.task.fb.Width()))
+	case spx.SysHeight:
+		return m.Push(int32(s.task.fb.Height()))
+
+	case spx.SysClear:
+		c, err := m.Pop()
+		if err != nil {
+			return err
+		}
+		s.clear(uint16(c))
+		return nil
+
+	case spx.SysRect:
+		args, err := pop(m, 5)
+		if err != nil {
+			return err
+		}
+		s.fill(int(args[0]), int(args[1]), int(args[2]), int(args[3]), uint16(args[4]))
+		return nil
+
+	case spx.SysText:
+		args, err := pop(m, 5)
+		if err != nil {
+			return err
+		}
+		b, err := m.Bytes(args[2], args[3])
+		if err != nil {
+			return err
+		}
+		t := s.task
+		d := &fbDisplayer{fb: t.fb}
+		tinyfont.WriteLine(d, t.font, int16(args[0]), int16(args[1])+t.fontHeight, string(b), rgb565To888(uint16(args[4])))
+		s.dirty = true
+		return nil
+
+	case spx.SysPresent:
+		s.dirty = true
+		return nil
+
+	case spx.SysRead:
+		args, err := pop(m, 5)
+		if err != nil {
+			return err
+		}
+		path, err := m.Bytes(args[0], args[1])
+		if err != nil {
+			return err
+		}
+		buf, err := m.Bytes(args[2], min(args[3], maxIOBytes))
+		if err != nil {
+			return err
+		}
+		if s.vfs == nil || args[4] < 0 {
+			return m.Push(-1)
+		}
+		var got int
+		for got < len(buf) {
+			k, eof, err := s.vfs.ReadInto(s.ctx, string(path), uint32(args[4])+uint32(got), buf[got:])
+			if err != nil {
+				return m.Push(-1)
+			}
+			got += k
+			if eof || k == 0 {
+				break
+			}
+		}
+		return m.Push(int32(got))
+
+	case spx.SysWrite:
+		args, err := pop(m, 5)
+		if err != nil {
+			return err
+		}
+		path, err := m.Bytes(args[0], args[1])
+		if err != nil {
+			return err
+		}
+		data, err := m.Bytes(args[2], min(args[3], maxIOBytes))
+		if err != nil {
+			return err
+		}
+		if s.vfs == nil {
+			return m.Push(-1)
+		}
+		mode := proto.VFSWriteTruncate
+		if args[4] != 0 {
+			mode = proto.VFSWriteAppend
+		}
+		if _, err := s.vfs.Write(s.ctx, string(path), mode, data); err != nil {
+			return m.Push(-1)
+		}
+		return m.Push(int32(len(data)))
+
+	case spx.SysNotify:
+		args, err := pop(m, 2)
+		if err != nil {
+			return err
+		}
+		b, err := m.Bytes(args[0], min(args[1], proto.MaxNotifyBytes))
+		if err != nil {
+			return err
+		}
+		if !s.notifyCap.Valid() {
+			return m.Push(-1)
+		}
+		if err := notifyclient.Post(s.ctx, s.notifyCap, proto.SeverityInfo, 0, string(b)); err != nil {
+			return m.Push(-1)
+		}
+		return m.Push(0)
+	}
+	return fmt.Errorf("unknown syscall %d", n)
+}
+
+// pop takes n arguments, returned bottom first.
+func pop(m *spx.Machine, n int) ([]int32, error) {
+	args := make([]int32, n)
+	for i := n - 1; i >= 0; i-- {
+		v, err := m.Pop()
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	return args, nil
+}
+
+func (s *sysTable) print(str string) {
+	for _, r := range str {
+		s.putc(r)
+	}
+}
+
+func (s *sysTable) putc(r rune) {
+	t := s.task
+	cols := t.fb.Width() / int(t.fontWidth)
+	switch r {
+	case '\n':
+		s.newline()
+		return
+	case '\r':
+		s.col = 0
+		return
+	}
+	if s.col >= cols {
+		s.newline()
+	}
+	x := s.col * int(t.fontWidth)
+	y := s.row * int(t.fontHeight)
+	s.fill(x, y, int(t.fontWidth), int(t.fontHeight), 0)
+	d := &fbDisplayer{fb: t.fb}
+	tinyfont.WriteLine(d, t.font, int16(x), int16(y)+t.fontHeight, string(r), consoleFG)
+	s.col++
+}
+
+// newline moves to the next line, scrolling at the bottom.
+func (s *sysTable) newline() {
+	t := s.task
+	s.col = 0
+	s.row++
+	rows := t.fb.Height() / int(t.fontHeight)
+	if s.row < rows {
+		return
+	}
+	s.row = rows - 1
+	buf := t.fb.Buffer()
+	stride := t.fb.StrideBytes()
+	line := int(t.fontHeight) * stride
+	if buf != nil && line < len(buf) {
+		copy(buf, buf[line:rows*line])
+	}
+	s.fill(0, s.row*int(t.fontHeight), t.fb.Width(), int(t.fontHeight), 0)
+}
+
+func (s *sysTable) clear(pixel uint16) {
+	s.fill(0, 0, s.task.fb.Width(), s.task.fb.Height(), pixel)
+	s.col, s.row = 0, 0
+}
+
+func (s *sysTable) fill(x, y, w, h int, pixel uint16) {
+	fb := s.task.fb
+	buf := fb.Buffer()
+	if buf == nil {
+		return
+	}
+	x0 := clampInt(x, 0, fb.Width())
+	y0 := clampInt(y, 0, fb.Height())
+	x1 := clampInt(x+w, 0, fb.Width())
+	y1 := clampInt(y+h, 0, fb.Height())
+	stride := fb.StrideBytes()
+	for py := y0; py < y1; py++ {
+		row := py * stride
+		for px := x0; px < x1; px++ {
+			off := row + px*2
+			buf[off] = byte(pixel)
+			buf[off+1] = byte(pixel >> 8)
+		}
+	}
+	s.dirty = true
+}
+
+// flush presents what the program drew since the last flush.
+func (s *sysTable) flush() {
+	if !s.dirty {
+		return
+	}
+	s.dirty = false
+	_ = s.task.fb.Present()
+}
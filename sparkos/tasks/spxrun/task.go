@@ -0,0 +1,278 @@
+// Package spxrun is the loader of user programs: it reads an spx executable
+// from the filesystem and runs it in the sandboxed spx machine, handing it
+// only the services its manifest declares.
+package spxrun
+
+import (
+	"errors"
+	"fmt"
+
+	"spark/hal"
+	vfsclient "spark/sparkos/client/vfs"
+	"spark/sparkos/fonts/font6x8cp1251"
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+	"spark/sparkos/spx"
+
+	"tinygo.org/x/tinyfont"
+)
+
+const (
+	exitCtrlQ = 0x11
+
+	// sliceSteps is how many instructions run per tick.
+	sliceSteps = 2000
+	// maxImageBytes bounds an executable on disk.
+	maxImageBytes = 16 + spx.MaxServices*256 + spx.MaxCodeBytes + spx.MaxMemBytes
+	maxKeys       = 64
+)
+
+type Task struct {
+	disp      hal.Display
+	ep        kernel.Capability
+	vfsCap    kernel.Capability
+	notifyCap kernel.Capability
+
+	fb hal.Framebuffer
+
+	font       tinyfont.Fonter
+	fontWidth  int16
+	fontHeight int16
+
+	active bool
+	muxCap kernel.Capability
+
+	path string
+	// pending is a program selected while in the background; it is loaded
+	// on activation, when the screen is ours.
+	pending string
+	m       *spx.Machine
+	// done is set once the program has stopped; the next key leaves.
+	done bool
+
+	// sys holds what the program may reach; service fields are set only
+	// for services in its manifest.
+	sys sysTable
+
+	inbuf []byte
+}
+
+func New(disp hal.Display, ep kernel.Capability, vfsCap kernel.Capability, notifyCap kernel.Capability) *Task {
+	return &Task{disp: disp, ep: ep, vfsCap: vfsCap, notifyCap: notifyCap}
+}
+
+func (t *Task) Run(ctx *kernel.Context) {
+	ch, ok := ctx.RecvChan(t.ep)
+	if !ok {
+		return
+	}
+	if t.disp == nil {
+		return
+	}
+
+	t.fb = t.disp.Framebuffer()
+	if t.fb == nil || t.fb.Format() != hal.PixelFormatRGB565 {
+		return
+	}
+
+	t.font = font6x8cp1251.Font
+	t.fontHeight = 8
+	_, outboxWidth := tinyfont.LineWidth(t.font, "0")
+	t.fontWidth = int16(outboxWidth)
+	if t.fontWidth <= 0 {
+		return
+	}
+	t.sys.task = t
+
+	done := make(chan struct{})
+	defer close(done)
+
+	tickCh := make(chan uint64, 8)
+	go func() {
+		last := ctx.NowTick()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			last = ctx.WaitTick(last)
+			select {
+			case tickCh <- last:
+			default:
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-tickCh:
+			t.step(ctx)
+
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			switch proto.Kind(msg.Kind) {
+			case proto.MsgAppShutdown:
+				t.stop()
+				return
+
+			case proto.MsgAppControl:
+				if msg.Cap.Valid() {
+					t.muxCap = msg.Cap
+				}
+				active, ok := proto.DecodeAppControlPayload(msg.Payload())
+				if !ok {
+					continue
+				}
+				t.active = active
+				if t.active && t.pending != "" {
+					t.load(ctx, t.pending)
+					t.pending = ""
+				}
+
+			case proto.MsgAppSelect:
+				appID, arg, ok := proto.DecodeAppSelectPayload(msg.Payload())
+				if !ok || appID != proto.AppRun {
+					continue
+				}
+				if arg == "" {
+					continue
+				}
+				if t.active {
+					t.load(ctx, arg)
+				} else {
+					t.pending = arg
+				}
+
+			case proto.MsgTermInput:
+				if !t.active {
+					continue
+				}
+				t.handleInput(ctx, msg.Payload())
+				t.step(ctx)
+			}
+		}
+	}
+}
+
+// load replaces the running program with the one at path.
+func (t *Task) load(ctx *kernel.Context, path string) {
+	t.stop()
+	t.path = path
+	t.sys.clear(0)
+
+	p, err := t.readProgram(ctx, path)
+	if err == nil {
+		err = t.grant(p)
+	}
+	if err == nil {
+		t.m, err = spx.NewMachine(p, &t.sys)
+	}
+	if err != nil {
+		t.finish(fmt.Sprintf("run %s: %v", path, err))
+	}
+}
+
+func (t *Task) readProgram(ctx *kernel.Context, path string) (*spx.Program, error) {
+	if !t.vfsCap.Valid() {
+		return nil, errors.New("vfs unavailable")
+	}
+	vfs := vfsclient.New(t.vfsCap)
+	typ, size, err := vfs.Stat(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if typ != proto.VFSEntryFile || size > maxImageBytes {
+		return nil, errors.New("not an executable")
+	}
+	img := make([]byte, size)
+	var n int
+	for n < len(img) {
+		m, eof, err := vfs.ReadInto(ctx, path, uint32(n), img[n:])
+		if err != nil {
+			return nil, err
+		}
+		n += m
+		if eof || m == 0 {
+			break
+		}
+	}
+	return spx.Parse(img[:n])
+}
+
+// grant hands the program the services of its manifest and refuses one
+// that programs may not have.
+func (t *Task) grant(p *spx.Program) error {
+	for _, s := range p.Services {
+		switch s {
+		case "vfs":
+			if !t.vfsCap.Valid() {
+				return errors.New("vfs unavailable")
+			}
+			t.sys.vfs = vfsclient.New(t.vfsCap)
+		case "notify":
+			if !t.notifyCap.Valid() {
+				return errors.New("notify unavailable")
+			}
+			t.sys.notifyCap = t.notifyCap
+		default:
+			return fmt.Errorf("service %q is not available to programs", s)
+		}
+	}
+	return nil
+}
+
+// step runs a slice of the program while it has the focus.
+func (t *Task) step(ctx *kernel.Context) {
+	if !t.active || t.m == nil || t.done {
+		return
+	}
+	t.sys.ctx = ctx
+	st, err := t.m.Run(sliceSteps)
+	t.sys.ctx = nil
+	switch {
+	case err != nil:
+		t.finish(err.Error())
+	case st == spx.StateHalted:
+		t.finish(fmt.Sprintf("[%s exited with %d]", t.path, t.m.ExitCode()))
+	}
+	t.sys.flush()
+}
+
+// finish prints why the program stopped and waits for a key.
+func (t *Task) finish(line string) {
+	t.done = true
+	t.sys.newline()
+	t.sys.print(line + "\npress any key")
+	t.sys.flush()
+}
+
+func (t *Task) stop() {
+	t.m = nil
+	t.done = false
+	t.inbuf = t.inbuf[:0]
+	t.sys.reset()
+}
+
+func (t *Task) handleInput(ctx *kernel.Context, b []byte) {
+	for _, c := range b {
+		switch {
+		case c == exitCtrlQ || t.done:
+			t.stop()
+			t.requestExit(ctx)
+			return
+		case len(t.inbuf) < maxKeys:
+			t.inbuf = append(t.inbuf, c)
+		}
+	}
+}
+
+func (t *Task) requestExit(ctx *kernel.Context) {
+	t.active = false
+	if !t.muxCap.Valid() {
+		return
+	}
+	_ = ctx.SendToCapRetry(t.muxCap, uint16(proto.MsgAppControl), proto.AppControlPayload(false), kernel.Capability{}, 500)
+}
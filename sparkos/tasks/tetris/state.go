@@ -0,0 +1,64 @@
+package tetris
+
+import "encoding/binary"
+
+// stateVersion tags the suspended game format.
+const stateVersion = 1
+
+// stateHeader is version, piece, rotation, x, y, next piece, flags, rng,
+// score and lines; the board follows.
+const stateHeader = 7 + 3*4
+
+// stateGameOver is the flag for a finished game.
+const stateGameOver = 1
+
+// encodeState serializes the game for MsgAppSuspend. A line clear in
+// progress is finished first.
+func (t *Task) encodeState() []byte {
+	if t.clearActive {
+		t.finishClear()
+	}
+	b := make([]byte, stateHeader, stateHeader+len(t.board))
+	b[0] = stateVersion
+	b[1] = byte(t.curID)
+	b[2] = byte(t.curRot)
+	b[3] = byte(int8(t.curPos.x))
+	b[4] = byte(int8(t.curPos.y))
+	b[5] = byte(t.nextID)
+	if t.gameOver {
+		b[6] |= stateGameOver
+	}
+	binary.LittleEndian.PutUint32(b[7:], t.rng)
+	binary.LittleEndian.PutUint32(b[11:], uint32(t.score))
+	binary.LittleEndian.PutUint32(b[15:], uint32(t.lines))
+	return append(b, t.board...)
+}
+
+// decodeState restores a game saved by encodeState. The game comes back
+// paused. It reports false, leaving the task alone, for a malformed state.
+func (t *Task) decodeState(b []byte) bool {
+	if len(b) != stateHeader+boardWidth*boardHeight || b[0] != stateVersion {
+		return false
+	}
+	if b[1] > byte(pieceL) || b[5] > byte(pieceL) || b[2] > 3 {
+		return false
+	}
+	t.w = t.fb.Width()
+	t.h = t.fb.Height()
+	t.boardW = boardWidth
+	t.boardH = boardHeight
+	t.board = append(t.board[:0], b[stateHeader:]...)
+	t.curID = pieceID(b[1])
+	t.curRot = int(b[2])
+	t.curPos = point{x: int(int8(b[3])), y: int(int8(b[4]))}
+	t.nextID = pieceID(b[5])
+	t.gameOver = b[6]&stateGameOver != 0
+	t.rng = binary.LittleEndian.Uint32(b[7:])
+	t.score = int(binary.LittleEndian.Uint32(b[11:]))
+	t.lines = int(binary.LittleEndian.Uint32(b[15:]))
+	t.level = 1 + t.lines/10
+	t.paused = !t.gameOver
+	t.clearActive = false
+	t.clearCount = 0
+	return true
+}
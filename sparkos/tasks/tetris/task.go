@@ -5,6 +5,9 @@ import (
 	"image/color"
 
 	"spark/hal"
+	"spark/sparkos/apps"
+	"spark/sparkos/client/input"
+	vfsclient "spark/sparkos/client/vfs"
 	"spark/sparkos/fonts/font6x8cp1251"
 	"spark/sparkos/kernel"
 	"spark/sparkos/proto"
@@ -33,6 +36,8 @@ type Task struct {
 	disp hal.Display
 	ep   kernel.Capability
 
+	vfsCap kernel.Capability
+
 	fb hal.Framebuffer
 
 	font       tinyfont.Fonter
@@ -77,6 +82,9 @@ type Task struct {
 	lastFall uint64
 
 	inbuf []byte
+	// keys holds the keys down, from MsgInputEvent: holding Down drops the
+	// piece fast.
+	keys input.State
 }
 
 const (
@@ -85,12 +93,13 @@ const (
 
 	fallBaseTicks = 70
 	fallMinTicks  = 10
+	softDropTicks = 10
 
 	clearFlashTicks = 18
 )
 
-func New(disp hal.Display, ep kernel.Capability) *Task {
-	return &Task{disp: disp, ep: ep, cell: 12}
+func New(disp hal.Display, ep kernel.Capability, vfsCap kernel.Capability) *Task {
+	return &Task{disp: disp, ep: ep, vfsCap: vfsCap, cell: 12}
 }
 
 func (t *Task) Run(ctx *kernel.Context) {
@@ -141,6 +150,22 @@ func (t *Task) Run(ctx *kernel.Context) {
 				t.unload()
 				return
 
+			case proto.MsgAppSuspend:
+				if p, ok := proto.DecodeAppStatePayload(msg.Payload()); ok && len(t.board) != 0 {
+					_ = apps.SaveState(ctx, vfsclient.New(t.vfsCap), p, t.encodeState())
+				}
+				t.unload()
+				return
+
+			case proto.MsgAppResume:
+				p, ok := proto.DecodeAppStatePayload(msg.Payload())
+				if !ok {
+					continue
+				}
+				if data, err := apps.LoadState(ctx, vfsclient.New(t.vfsCap), p); err == nil && data != nil {
+					t.decodeState(data)
+				}
+
 			case proto.MsgAppControl:
 				if msg.Cap.Valid() {
 					t.muxCap = msg.Cap
@@ -168,6 +193,11 @@ func (t *Task) Run(ctx *kernel.Context) {
 				if t.active {
 					t.render()
 				}
+
+			case proto.MsgInputEvent:
+				if ev, ok := input.Decode(msg.Payload()); ok && t.active {
+					t.keys.Apply(ev)
+				}
 			}
 
 		case now := <-tickCh:
@@ -183,6 +213,10 @@ func (t *Task) Run(ctx *kernel.Context) {
 				continue
 			}
 			interval := uint64(t.fallIntervalTicks())
+			soft := t.keys.Held(hal.KeyDown) && interval > softDropTicks
+			if soft {
+				interval = softDropTicks
+			}
 			if interval == 0 {
 				interval = 1
 			}
@@ -192,6 +226,8 @@ func (t *Task) Run(ctx *kernel.Context) {
 			t.lastFall = now
 			if !t.tryMove(0, 1) {
 				t.lockOrClear(now)
+			} else if soft {
+				t.score++
 			}
 			t.render()
 		}
@@ -212,6 +248,7 @@ func (t *Task) setActive(ctx *kernel.Context, active bool) {
 	}
 	t.active = active
 	if !t.active {
+		t.keys.Reset()
 		return
 	}
 	if len(t.board) == 0 {
@@ -243,12 +280,12 @@ func (t *Task) handleInput(ctx *kernel.Context, b []byte) {
 	t.inbuf = append(t.inbuf, b...)
 	buf := t.inbuf
 	for len(buf) > 0 {
-		n, k, ok := nextKey(buf)
+		n, ev, ok := input.Parse(buf)
 		if !ok {
 			break
 		}
 		buf = buf[n:]
-		t.handleKey(ctx, k)
+		t.handleKey(ctx, ev)
 		if !t.active {
 			t.inbuf = t.inbuf[:0]
 			return
@@ -257,30 +294,33 @@ func (t *Task) handleInput(ctx *kernel.Context, b []byte) {
 	t.inbuf = append(t.inbuf[:0], buf...)
 }
 
-func (t *Task) handleKey(ctx *kernel.Context, k key) {
-	switch k.kind {
-	case keyEsc:
+func (t *Task) handleKey(ctx *kernel.Context, ev input.Event) {
+	switch ev.Code {
+	case hal.KeyEscape:
 		t.requestExit(ctx)
-	case keyLeft:
+	case hal.KeyLeft:
 		if !t.paused && !t.gameOver && !t.clearActive {
 			_ = t.tryMove(-1, 0)
 		}
-	case keyRight:
+	case hal.KeyRight:
 		if !t.paused && !t.gameOver && !t.clearActive {
 			_ = t.tryMove(1, 0)
 		}
-	case keyDown:
+	case hal.KeyDown:
 		if !t.paused && !t.gameOver && !t.clearActive {
 			if t.tryMove(0, 1) {
 				t.score += 1
 			}
 		}
-	case keyUp:
+	case hal.KeyUp:
 		if !t.paused && !t.gameOver && !t.clearActive {
 			t.rotate(1)
 		}
-	case keyRune:
-		switch k.r {
+	case hal.KeyUnknown:
+		if ev.Mods&hal.ModCtrl != 0 {
+			return
+		}
+		switch ev.Rune {
 		case 'q':
 			t.requestExit(ctx)
 		case 'p', ' ':
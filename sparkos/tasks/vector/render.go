@@ -10,6 +10,7 @@ import (
 
 	"spark/hal"
 	"spark/sparkos/fonts/font6x8cp1251"
+	"spark/sparkos/kernel"
 
 	"tinygo.org/x/drivers"
 	"tinygo.org/x/tinyfont"
@@ -210,7 +211,7 @@ func (t *Task) initFont() bool {
 	return t.fontWidth > 0 && t.fontHeight > 0
 }
 
-func (t *Task) render() {
+func (t *Task) render(ctx *kernel.Context) {
 	if !t.active || t.fb == nil || t.d == nil {
 		return
 	}
@@ -232,7 +233,7 @@ func (t *Task) render() {
 
 	switch t.tab {
 	case tabPlot:
-		t.renderGraph(panelY, w, int(viewH))
+		t.renderGraph(ctx, panelY, w, int(viewH))
 	case tabStack:
 		t.renderStack(panelY)
 	default:
@@ -594,9 +595,9 @@ func (t *Task) renderStack(panelY int16) {
 	}
 }
 
-func (t *Task) renderGraph(panelY int16, w int16, viewHPx int) {
+func (t *Task) renderGraph(ctx *kernel.Context, panelY int16, w int16, viewHPx int) {
 	if t.plotDim == 3 {
-		t.renderGraph3D(panelY, w, viewHPx)
+		t.renderGraph3D(ctx, panelY, w, viewHPx)
 		return
 	}
 
@@ -641,7 +642,7 @@ func (t *Task) renderGraph(panelY int16, w int16, viewHPx int) {
 	t.drawLegend(plotX, plotY, plotW, plotH, plots)
 }
 
-func (t *Task) renderGraph3D(panelY int16, w int16, viewHPx int) {
+func (t *Task) renderGraph3D(ctx *kernel.Context, panelY int16, w int16, viewHPx int) {
 	expr := t.graph
 	src := t.graphExpr
 	if expr == nil {
@@ -731,11 +732,12 @@ func (t *Task) renderGraph3D(panelY int16, w int16, viewHPx int) {
 	var wg sync.WaitGroup
 	wg.Add(2)
 	split := gridY / 2
-	go func() {
+	ctx.Go(func() {
 		defer wg.Done()
 		localMin := math.Inf(1)
 		localMax := math.Inf(-1)
 		for iy := 0; iy < split; iy++ {
+			ctx.Yield()
 			y := t.yMin + (float64(iy)/float64(gridY-1))*(t.yMax-t.yMin)
 			for ix := 0; ix < gridX; ix++ {
 				x := t.xMin + (float64(ix)/float64(gridX-1))*(t.xMax-t.xMin)
@@ -753,12 +755,13 @@ func (t *Task) renderGraph3D(panelY int16, w int16, viewHPx int) {
 			}
 		}
 		results[0] = minmax{min: localMin, max: localMax}
-	}()
-	go func() {
+	})
+	ctx.Go(func() {
 		defer wg.Done()
 		localMin := math.Inf(1)
 		localMax := math.Inf(-1)
 		for iy := split; iy < gridY; iy++ {
+			ctx.Yield()
 			y := t.yMin + (float64(iy)/float64(gridY-1))*(t.yMax-t.yMin)
 			for ix := 0; ix < gridX; ix++ {
 				x := t.xMin + (float64(ix)/float64(gridX-1))*(t.xMax-t.xMin)
@@ -776,7 +779,7 @@ func (t *Task) renderGraph3D(panelY int16, w int16, viewHPx int) {
 			}
 		}
 		results[1] = minmax{min: localMin, max: localMax}
-	}()
+	})
 	wg.Wait()
 
 	zMin := math.Min(results[0].min, results[1].min)
@@ -853,14 +856,14 @@ func (t *Task) renderGraph3D(panelY int16, w int16, viewHPx int) {
 
 	wg = sync.WaitGroup{}
 	wg.Add(2)
-	go func() {
+	ctx.Go(func() {
 		defer wg.Done()
 		drawSegments(0, dispatchY, zsub0, ch0)
-	}()
-	go func() {
+	})
+	ctx.Go(func() {
 		defer wg.Done()
 		drawSegments(dispatchY, int(plotH), zsub1, ch1)
-	}()
+	})
 
 	sendSeg := func(x0, y0, d0, x1, y1, d1 float64, col color.RGBA) {
 		cx0, cy0, cx1, cy1, u0, u1, ok := clipLineToRectWithT(x0, y0, x1, y1, xmin, ymin, xmax, ymax)
@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"spark/hal"
+	"spark/sparkos/apps"
 	vfsclient "spark/sparkos/client/vfs"
 	"spark/sparkos/kernel"
 	"spark/sparkos/proto"
@@ -38,6 +39,10 @@ const (
 	notebooksDir = "/vector/notebooks"
 	notebookExt  = ".vnb"
 	maxNotebook  = 64 * 1024
+
+	// suspendInputPrefix marks the edited line in a suspended session; it is
+	// a comment to the notebook reader.
+	suspendInputPrefix = "# input: "
 )
 
 // Task implements a framebuffer-based math calculator with graphing.
@@ -215,6 +220,18 @@ func (t *Task) Run(ctx *kernel.Context) {
 			t.unloadSession()
 			return
 
+		case proto.MsgAppSuspend:
+			if p, ok := proto.DecodeAppStatePayload(msg.Payload()); ok {
+				_ = t.suspend(ctx, p)
+			}
+			t.unloadSession()
+			return
+
+		case proto.MsgAppResume:
+			if p, ok := proto.DecodeAppStatePayload(msg.Payload()); ok {
+				_ = t.resume(ctx, p)
+			}
+
 		case proto.MsgAppControl:
 			if msg.Cap.Valid() {
 				t.muxCap = msg.Cap
@@ -234,7 +251,7 @@ func (t *Task) Run(ctx *kernel.Context) {
 				t.setInput(arg)
 			}
 			if t.active {
-				t.render()
+				t.render(ctx)
 			}
 
 		case proto.MsgTermInput:
@@ -243,7 +260,7 @@ func (t *Task) Run(ctx *kernel.Context) {
 			}
 			t.handleInput(ctx, msg.Payload())
 			if t.active {
-				t.render()
+				t.render(ctx)
 			}
 		}
 	}
@@ -263,7 +280,7 @@ func (t *Task) setActive(ctx *kernel.Context, active bool) {
 	t.initSession()
 	t.setMessage("F1 term | F2 plot | F3 stack | H help | q quit")
 	t.updateHint()
-	t.render()
+	t.render(ctx)
 }
 
 func (t *Task) setMessage(msg string) {
@@ -814,15 +831,7 @@ func (t *Task) saveNotebook(ctx *kernel.Context, arg string) error {
 	}
 	path := t.notebookPath(arg)
 
-	var b strings.Builder
-	b.WriteString("# vector notebook v1\n")
-	b.WriteString("# saved: ")
-	b.WriteString(fmt.Sprintf("mode=%v prec=%d\n", t.e.mode, t.e.prec))
-	for _, line := range t.history {
-		b.WriteString(line)
-		b.WriteByte('\n')
-	}
-	data := []byte(b.String())
+	data := t.notebookText()
 	if len(data) > maxNotebook {
 		return fmt.Errorf("too large (%d bytes)", len(data))
 	}
@@ -846,12 +855,32 @@ func (t *Task) loadNotebook(ctx *kernel.Context, arg string) error {
 	}
 
 	t.appendLine(":load " + arg)
+	t.replayNotebook(ctx, data, "loaded: "+path)
+	return nil
+}
+
+// notebookText returns the history in notebook form.
+func (t *Task) notebookText() []byte {
+	var b strings.Builder
+	b.WriteString("# vector notebook v1\n")
+	b.WriteString("# saved: ")
+	b.WriteString(fmt.Sprintf("mode=%v prec=%d\n", t.e.mode, t.e.prec))
+	for _, line := range t.history {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return []byte(b.String())
+}
+
+// replayNotebook starts a new session showing msg and evaluates the
+// notebook in it.
+func (t *Task) replayNotebook(ctx *kernel.Context, data []byte, msg string) {
 	t.unloadSession()
 	if t.vfs == nil && t.vfsCap.Valid() {
 		t.vfs = vfsclient.New(t.vfsCap)
 	}
 	t.initSession()
-	t.setMessage("loaded: " + path)
+	t.setMessage(msg)
 
 	lines := strings.Split(string(data), "\n")
 	for _, line := range lines {
@@ -861,6 +890,35 @@ func (t *Task) loadNotebook(ctx *kernel.Context, arg string) error {
 		}
 		t.evalLine(ctx, line, true)
 	}
+}
+
+// suspend saves the session for MsgAppSuspend: the history as a notebook
+// followed by the line being edited.
+func (t *Task) suspend(ctx *kernel.Context, path string) error {
+	if len(t.history) == 0 && len(t.input) == 0 {
+		return nil
+	}
+	data := t.notebookText()
+	if len(t.input) != 0 {
+		data = append(data, suspendInputPrefix...)
+		data = append(data, string(t.input)...)
+		data = append(data, '\n')
+	}
+	return apps.SaveState(ctx, vfsclient.New(t.vfsCap), path, data)
+}
+
+// resume restores a session saved by suspend.
+func (t *Task) resume(ctx *kernel.Context, path string) error {
+	data, err := apps.LoadState(ctx, vfsclient.New(t.vfsCap), path)
+	if err != nil || data == nil {
+		return err
+	}
+	t.replayNotebook(ctx, data, "resumed")
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, suspendInputPrefix) {
+			t.setInput(strings.TrimPrefix(line, suspendInputPrefix))
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,73 @@
+//go:build spark_vi
+
+package vi
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"spark/sparkos/apps"
+	"spark/sparkos/kernel"
+)
+
+// stateMagic starts a suspended session: "vi1 <modified> <line> <col> <path>",
+// followed by the buffer if it was modified. An unmodified buffer is read
+// back from its file.
+const stateMagic = "vi1"
+
+// suspend saves the session for MsgAppSuspend.
+func (t *Task) suspend(ctx *kernel.Context, p string) error {
+	e := &t.editor
+	if !e.modified && e.filePath == "" {
+		return nil
+	}
+	modified := 0
+	if e.modified {
+		modified = 1
+	}
+	data := []byte(fmt.Sprintf("%s %d %d %d %s\n", stateMagic, modified, e.cursorLine, e.cursorCol, e.filePath))
+	if e.modified {
+		data = append(data, encodeLines(e.lines)...)
+	}
+	return apps.SaveState(ctx, t.vfsClient(), p, data)
+}
+
+// resume restores a session saved by suspend.
+func (t *Task) resume(ctx *kernel.Context, p string) error {
+	data, err := apps.LoadState(ctx, t.vfsClient(), p)
+	if err != nil || data == nil {
+		return err
+	}
+	header, body, _ := strings.Cut(string(data), "\n")
+	f := strings.SplitN(header, " ", 5)
+	if len(f) != 5 || f[0] != stateMagic {
+		return errors.New("vi: bad state")
+	}
+	line, err1 := strconv.Atoi(f[2])
+	col, err2 := strconv.Atoi(f[3])
+	if err1 != nil || err2 != nil {
+		return errors.New("vi: bad state")
+	}
+	filePath := f[4]
+
+	if f[1] == "1" {
+		t.editor.reset()
+		t.editor.filePath = filePath
+		t.editor.lines = decodeLines([]byte(body))
+		t.editor.modified = true
+	} else if err := t.openPath(ctx, filePath); err != nil {
+		return err
+	}
+	t.editor.cursorLine = line
+	t.editor.cursorCol = col
+	t.editor.clampCursor()
+	t.editor.ensureCursorVisible(t.viewRows, t.cols)
+	if filePath == "" {
+		t.editor.setMessage("[No Name] [Modified] (resumed)")
+	} else {
+		t.editor.setMessage(fmt.Sprintf("\"%s\" (resumed)", filePath))
+	}
+	return nil
+}
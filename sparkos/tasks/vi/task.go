@@ -98,6 +98,20 @@ func (t *Task) Run(ctx *kernel.Context) {
 			t.unloadSession()
 			return
 
+		case proto.MsgAppSuspend:
+			if p, ok := proto.DecodeAppStatePayload(msg.Payload()); ok {
+				_ = t.suspend(ctx, p)
+			}
+			t.unloadSession()
+			return
+
+		case proto.MsgAppResume:
+			if p, ok := proto.DecodeAppStatePayload(msg.Payload()); ok {
+				if err := t.resume(ctx, p); err != nil {
+					t.editor.setMessage(err.Error())
+				}
+			}
+
 		case proto.MsgAppControl:
 			if msg.Cap.Valid() {
 				t.muxCap = msg.Cap
@@ -0,0 +1,36 @@
+package trace
+
+import "spark/sparkos/kernel"
+
+// Replay is a task that re-sends recorded messages to an endpoint, keeping
+// their relative timing in ticks.
+//
+// Only the recorded payload prefix is sent; capabilities are not replayed.
+type Replay struct {
+	events []kernel.TraceEvent
+	to     kernel.Capability
+	done   func(ctx *kernel.Context)
+}
+
+// NewReplay creates a replay of events (see Inputs) to the to endpoint.
+// done, if not nil, runs in the task after the last message was sent.
+func NewReplay(events []kernel.TraceEvent, to kernel.Capability, done func(ctx *kernel.Context)) *Replay {
+	return &Replay{events: events, to: to, done: done}
+}
+
+func (r *Replay) Run(ctx *kernel.Context) {
+	if len(r.events) > 0 {
+		start := ctx.NowTick()
+		first := r.events[0].Tick
+		for _, ev := range r.events {
+			at := start + (ev.Tick - first)
+			for now := ctx.NowTick(); now < at; {
+				now = ctx.WaitTick(now)
+			}
+			_ = ctx.SendBlocking(r.to, ev.Kind, ev.Payload(), kernel.Capability{}, 0)
+		}
+	}
+	if r.done != nil {
+		r.done(ctx)
+	}
+}
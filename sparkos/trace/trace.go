@@ -0,0 +1,175 @@
+// Package trace stores and prints kernel IPC traces.
+//
+// A trace file is a 12-byte header ("SPKT", u16 version, u16 prefix size,
+// u8 profile, u8 console endpoint, u16 reserved) followed by fixed-size
+// little-endian records, one per kernel.TraceEvent.
+package trace
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+)
+
+// Magic is "SPKT" in little-endian.
+const Magic = 0x544b5053
+
+const (
+	version    = 2
+	headerSize = 12
+	recordSize = 18 + kernel.TracePrefixBytes
+)
+
+// Profile flags of Header, mirroring the app.Config of the traced system.
+const (
+	ProfileFull     = 1 << 0
+	ProfileLauncher = 1 << 1
+)
+
+// Header describes the system a trace was recorded on, so that a replay
+// boots the same one.
+type Header struct {
+	// Profile is a set of Profile* flags.
+	Profile uint8
+	// Console is the endpoint the keyboard task sends to: the shell's, or
+	// with ProfileFull, consolemux's.
+	Console kernel.Endpoint
+}
+
+const (
+	flagCap   = 1 << 0
+	flagGrant = 1 << 1
+)
+
+var errHeaderInvalid = errors.New("trace: invalid header")
+
+// Encode writes h and events to w in the trace file format.
+func Encode(w io.Writer, h Header, events []kernel.TraceEvent) error {
+	var hdr [headerSize]byte
+	binary.LittleEndian.PutUint32(hdr[0:4], Magic)
+	binary.LittleEndian.PutUint16(hdr[4:6], version)
+	binary.LittleEndian.PutUint16(hdr[6:8], kernel.TracePrefixBytes)
+	hdr[8] = h.Profile
+	hdr[9] = byte(h.Console)
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+
+	var rec [recordSize]byte
+	for _, ev := range events {
+		binary.LittleEndian.PutUint64(rec[0:8], ev.Tick)
+		rec[8] = byte(ev.Op)
+		rec[9] = byte(ev.Task)
+		rec[10] = byte(ev.From)
+		rec[11] = byte(ev.To)
+		binary.LittleEndian.PutUint16(rec[12:14], ev.Kind)
+		binary.LittleEndian.PutUint16(rec[14:16], ev.Len)
+		var flags byte
+		if ev.Cap {
+			flags |= flagCap
+		}
+		if ev.Grant {
+			flags |= flagGrant
+		}
+		rec[16] = flags
+		rec[17] = byte(ev.Result)
+		copy(rec[18:], ev.Prefix[:])
+		if _, err := w.Write(rec[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decode reads a trace written by Encode.
+func Decode(r io.Reader) (Header, []kernel.TraceEvent, error) {
+	var hdr [headerSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return Header{}, nil, fmt.Errorf("trace: header: %w", err)
+	}
+	if binary.LittleEndian.Uint32(hdr[0:4]) != Magic ||
+		binary.LittleEndian.Uint16(hdr[4:6]) != version ||
+		binary.LittleEndian.Uint16(hdr[6:8]) != kernel.TracePrefixBytes {
+		return Header{}, nil, errHeaderInvalid
+	}
+	h := Header{Profile: hdr[8], Console: kernel.Endpoint(hdr[9])}
+
+	var events []kernel.TraceEvent
+	var rec [recordSize]byte
+	for {
+		_, err := io.ReadFull(r, rec[:])
+		if err == io.EOF {
+			return h, events, nil
+		}
+		if err != nil {
+			return h, events, fmt.Errorf("trace: record %d: %w", len(events), err)
+		}
+		ev := kernel.TraceEvent{
+			Tick:   binary.LittleEndian.Uint64(rec[0:8]),
+			Op:     kernel.TraceOp(rec[8]),
+			Task:   kernel.TaskID(rec[9]),
+			From:   kernel.Endpoint(rec[10]),
+			To:     kernel.Endpoint(rec[11]),
+			Kind:   binary.LittleEndian.Uint16(rec[12:14]),
+			Len:    binary.LittleEndian.Uint16(rec[14:16]),
+			Cap:    rec[16]&flagCap != 0,
+			Grant:  rec[16]&flagGrant != 0,
+			Result: kernel.SendResult(rec[17]),
+		}
+		copy(ev.Prefix[:], rec[18:])
+		events = append(events, ev)
+	}
+}
+
+// Format renders one event as a single line, for example:
+//
+//	1234 send task3 ep0->ep5 term_input len=2 cap "ls"
+func Format(ev kernel.TraceEvent) string {
+	kind := proto.Kind(ev.Kind).String()
+	if kind == "unknown" {
+		kind = "kind" + strconv.Itoa(int(ev.Kind))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d %s task%d ep%d->ep%d %s len=%d", ev.Tick, ev.Op, ev.Task, ev.From, ev.To, kind, ev.Len)
+	if ev.Cap {
+		b.WriteString(" cap")
+	}
+	if ev.Grant {
+		b.WriteString(" grant")
+	}
+	if ev.Op == kernel.TraceSend && ev.Result != kernel.SendOK {
+		b.WriteString(" err=")
+		b.WriteString(ev.Result.String())
+	}
+	if ev.Len > 0 {
+		b.WriteByte(' ')
+		b.WriteString(strconv.Quote(string(ev.Payload())))
+		if ev.Truncated() {
+			b.WriteString("...")
+		}
+	}
+	return b.String()
+}
+
+// Inputs returns the delivered MsgTermInput and MsgInputEvent sends to
+// console, in order. They are the input stream Replay re-injects: only the
+// first hop of each key, not consolemux and appmgr passing it on.
+func Inputs(events []kernel.TraceEvent, console kernel.Endpoint) []kernel.TraceEvent {
+	var out []kernel.TraceEvent
+	for _, ev := range events {
+		if ev.Op != kernel.TraceSend || ev.Result != kernel.SendOK || ev.To != console {
+			continue
+		}
+		if k := proto.Kind(ev.Kind); k == proto.MsgTermInput || k == proto.MsgInputEvent {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
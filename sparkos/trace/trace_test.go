@@ -0,0 +1,85 @@
+package trace
+
+import (
+	"bytes"
+	"testing"
+
+	"spark/sparkos/kernel"
+	"spark/sparkos/proto"
+)
+
+func event(tick uint64, kind proto.Kind, payload string) kernel.TraceEvent {
+	ev := kernel.TraceEvent{Tick: tick, Op: kernel.TraceSend, Task: 3, To: 5, Kind: uint16(kind), Len: uint16(len(payload))}
+	copy(ev.Prefix[:], payload)
+	return ev
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	in := []kernel.TraceEvent{
+		event(10, proto.MsgTermInput, "ls\r"),
+		event(11, proto.MsgTermWrite, "hello"),
+	}
+	in[1].Cap = true
+	in[1].Result = kernel.SendErrQueueFull
+
+	hdr := Header{Profile: ProfileFull | ProfileLauncher, Console: 9}
+	var buf bytes.Buffer
+	if err := Encode(&buf, hdr, in); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if got, want := buf.Len(), headerSize+len(in)*recordSize; got != want {
+		t.Fatalf("expected %d bytes, got %d", want, got)
+	}
+	gotHdr, out, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if gotHdr != hdr {
+		t.Fatalf("header %+v, want %+v", gotHdr, hdr)
+	}
+	if len(out) != len(in) {
+		t.Fatalf("expected %d events, got %d", len(in), len(out))
+	}
+	for i := range in {
+		if out[i] != in[i] {
+			t.Fatalf("event %d: got %+v, want %+v", i, out[i], in[i])
+		}
+	}
+}
+
+func TestDecodeRejectsBadHeader(t *testing.T) {
+	if _, _, err := Decode(bytes.NewReader([]byte("NOTATRACE"))); err == nil {
+		t.Fatal("expected an error for a bad header")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	ev := event(1234, proto.MsgTermInput, "ls")
+	ev.Cap = true
+	if got, want := Format(ev), `1234 send task3 ep0->ep5 term_input len=2 cap "ls"`; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestInputsKeepsDeliveredKeysToConsole(t *testing.T) {
+	dropped := event(2, proto.MsgTermInput, "b")
+	dropped.Result = kernel.SendErrQueueFull
+	recv := event(3, proto.MsgTermInput, "c")
+	recv.Op = kernel.TraceRecv
+	// consolemux passing a key on to the shell or an app.
+	forwarded := event(5, proto.MsgTermInput, "e")
+	forwarded.To = 7
+	key := event(6, proto.MsgInputEvent, "f")
+
+	got := Inputs([]kernel.TraceEvent{
+		event(1, proto.MsgTermInput, "a"),
+		dropped,
+		recv,
+		event(4, proto.MsgAppControl, "d"),
+		forwarded,
+		key,
+	}, 5)
+	if len(got) != 2 || string(got[0].Payload()) != "a" || got[1].Kind != uint16(proto.MsgInputEvent) {
+		t.Fatalf("unexpected inputs %+v", got)
+	}
+}